@@ -0,0 +1,131 @@
+package benchoutbox
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/events"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/outbox"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/postgres"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Задержка от коммита InsertPayment до Publish: опрос раз в 200ms против LISTEN/NOTIFY.
+// Нужен Postgres со схемой checkout:
+//
+//	TEST_PG_DSN=postgres://... go test -bench=. -benchtime=50x ./benchmarks/benchoutbox
+func BenchmarkPublishLatency(b *testing.B) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		b.Skip("TEST_PG_DSN not set")
+	}
+	repo, err := postgres.NewPaymentsRepo(dsn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(repo.Close)
+	if err := repo.RunMigrations(); err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("poll", func(b *testing.B) {
+		benchLatency(b, repo, nil, 200*time.Millisecond)
+	})
+	b.Run("notify", func(b *testing.B) {
+		benchLatency(b, repo, repo.OutboxListener(), 2*time.Second)
+	})
+}
+
+func benchLatency(b *testing.B, repo *postgres.PaymentsRepo, notifier outbox.Notifier, poll time.Duration) {
+	pub := newPublisher()
+	worker := outbox.New(config.Outbox{
+		PollInterval:        poll,
+		PollTimeout:         2 * time.Second,
+		BatchSize:           100,
+		ResetEventsInterval: time.Hour,
+		ResetEventsTimeout:  time.Second,
+		MaxParallel:         10,
+		BackoffBase:         time.Second,
+		BackoffMax:          time.Second,
+		HeartbeatInterval:   5 * time.Second,
+		OwnerTTL:            30 * time.Second,
+		ReclaimAfter:        5 * time.Minute,
+	}, pub, repo, notifier, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go worker.Run(ctx)
+	time.Sleep(100 * time.Millisecond) // LISTEN успевает подняться
+
+	run := uuid.NewString()
+	var total time.Duration
+
+	b.ResetTimer()
+	for i := range b.N {
+		pay := payment.Payment{
+			ID:            "pay_" + uuid.NewString(),
+			MerchantID:    "m_bench",
+			OrderID:       fmt.Sprintf("o_%s_%d", run, i),
+			Amount:        decimal.NewFromInt(100),
+			Currency:      "USD",
+			MethodToken:   "tok_bench",
+			Status:        payment.StatusPending,
+			CaptureMethod: payment.CaptureAutomatic,
+		}
+		env, err := events.NewPaymentCreatedEvent(pay)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		done := pub.expect(pay.ID)
+		start := time.Now()
+		if err := repo.InsertPayment(ctx, pay, env); err != nil {
+			b.Fatal(err)
+		}
+		select {
+		case <-done:
+			total += time.Since(start)
+		case <-time.After(5 * time.Second):
+			b.Fatal("event was not published")
+		}
+	}
+	b.StopTimer()
+
+	b.ReportMetric(float64(total.Microseconds())/float64(b.N)/1000, "ms/publish")
+}
+
+// publisher ничего не отправляет, только сообщает, что событие дошло до Publish
+type publisher struct {
+	mu      sync.Mutex
+	waiters map[string]chan struct{}
+}
+
+func newPublisher() *publisher {
+	return &publisher{waiters: make(map[string]chan struct{})}
+}
+
+func (p *publisher) expect(key string) <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	ch := make(chan struct{})
+	p.waiters[key] = ch
+	return ch
+}
+
+func (p *publisher) Publish(ctx context.Context, env event.Envelope) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if ch, ok := p.waiters[env.Key]; ok {
+		close(ch)
+		delete(p.waiters, env.Key)
+	}
+	return nil
+}
@@ -4,13 +4,23 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/idempotency"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/authexpiry"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/idemsweep"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/inbox"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/kafka"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/memidem"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/outbox"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/outboxarchive"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/postgres"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/ratelimit"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/redisidem"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/replay"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/webhook"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/transport/web"
 )
 
@@ -19,7 +29,13 @@ type App struct {
 	postgres *postgres.PaymentsRepo
 	redis    *redisidem.Store
 	kafka    *kafka.Producer
+	consumer *kafka.Consumer
 	worker   *outbox.Worker
+	archiver *outboxarchive.Worker
+	inbox    *inbox.Worker
+	expiry   *authexpiry.Worker
+	webhooks *webhook.Worker
+	sweeper  *idemsweep.Worker // nil, если ключи живут в Redis со своим TTL
 	server   *web.Server
 }
 
@@ -35,23 +51,74 @@ func Build() (*App, error) {
 		return nil, fmt.Errorf("failed init postgres: %w", err)
 	}
 
-	redis, err := redisidem.New(cfg.Redis)
-	if err != nil {
-		return nil, fmt.Errorf("failed init redis: %w", err)
+	// без Redis не обойтись, только если в нём ключи идемпотентности:
+	// лимиты и подписи при его недоступности живут в памяти инстанса
+	redis := redisidem.New(cfg.Redis)
+	if err := redis.Ping(); err != nil {
+		if cfg.Idempotency.Backend == "" || cfg.Idempotency.Backend == "redis" {
+			return nil, fmt.Errorf("failed init redis: %w", err)
+		}
+		log.Printf("app: redis unavailable, using in-memory rate limit and replay guard:%v", err)
 	}
 
+	consumer := kafka.NewConsumer(cfg.Kafka)
 	kafka := kafka.NewProducer(cfg.Kafka)
 
-	worker := outbox.New(cfg.Outbox, kafka, postgres)
+	var notifier outbox.Notifier
+	if cfg.Outbox.Notify {
+		notifier = postgres.OutboxListener()
+	}
+	var elector outbox.Elector
+	if cfg.Outbox.LeaderElection {
+		elector = postgres.OutboxLeaderLock()
+	}
+	worker := outbox.New(cfg.Outbox, kafka, postgres, notifier, elector)
+	archiver := outboxarchive.New(cfg.Archive, postgres)
+	inbox := inbox.New(cfg.Inbox, cfg.Capture, consumer, postgres)
+	expiry := authexpiry.New(cfg.Capture, postgres)
+	webhooks := webhook.New(cfg.Webhooks, postgres)
+
+	// общий лимит через Redis, при его недоступности — в памяти инстанса
+	limiter := ratelimit.NewFallback(redisidem.NewLimiter(redis, cfg.RateLimit.Prefix), ratelimit.NewMemory(),
+		cfg.RateLimit.RedisTimeout)
 
-	server := web.New(cfg.HTTP, postgres, redis, kafka)
+	// подписи запросов — так же: Redis, при недоступности память инстанса
+	replayGuard := replay.NewFallback(redisidem.NewReplay(redis, cfg.Auth.ReplayPrefix), replay.NewMemory(),
+		cfg.Auth.ReplayTimeout)
+
+	idemStore, idemTx, sweeper, err := newIdempotency(cfg.Idempotency, postgres, redis)
+	if err != nil {
+		return nil, err
+	}
+
+	server := web.New(web.Deps{
+		HTTP:        cfg.HTTP,
+		Auth:        cfg.Auth,
+		RateLimit:   cfg.RateLimit,
+		Idempotency: cfg.Idempotency,
+		Archive:     cfg.Archive,
+		Webhooks:    cfg.Webhooks,
+		DB:          postgres,
+		IdemStore:   idemStore,
+		IdemTx:      idemTx,
+		Limiter:     limiter,
+		Replay:      replayGuard,
+		Producer:    kafka,
+		Outbox:      worker,
+	})
 
 	return &App{
 		config:   cfg,
 		postgres: postgres,
 		redis:    redis,
 		kafka:    kafka,
+		consumer: consumer,
 		worker:   worker,
+		archiver: archiver,
+		inbox:    inbox,
+		expiry:   expiry,
+		webhooks: webhooks,
+		sweeper:  sweeper,
 		server:   server,
 	}, nil
 }
@@ -64,7 +131,23 @@ func (a *App) Run(ctx context.Context) error {
 	}
 
 	go a.server.Run()
-	go a.worker.Run(ctx)
+
+	var wg sync.WaitGroup
+	run := func(f func(context.Context)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f(ctx)
+		}()
+	}
+	run(a.worker.Run)
+	run(a.archiver.Run)
+	run(a.inbox.Run)
+	run(a.expiry.Run)
+	run(a.webhooks.Run)
+	if a.sweeper != nil {
+		run(a.sweeper.Run)
+	}
 
 	<-ctx.Done()
 	log.Println("app: stop application...")
@@ -72,10 +155,43 @@ func (a *App) Run(ctx context.Context) error {
 	stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
 
-	a.redis.Close()
+	// сначала перестаём принимать запросы: обработчики ходят и в Redis, и в Postgres
 	a.server.Close(stopCtx)
-	a.postgres.Close()
+
+	// воркеры при остановке ещё пишут в базу (снятие lease, release доставок,
+	// коммит inbox) — закрываем хранилища только после них
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-stopCtx.Done():
+		log.Println("app: workers did not stop in time")
+	}
+
+	a.consumer.Close()
 	a.kafka.Close()
+	a.redis.Close()
+	a.postgres.Close()
 
 	return nil
 }
+
+// newIdempotency выбирает хранилище ключей по конфигу
+func newIdempotency(cfg config.Idempotency, db *postgres.PaymentsRepo, cache *redisidem.Store) (
+	idempotency.Store, idempotency.TxRunner, *idemsweep.Worker, error) {
+	switch cfg.Backend {
+	case "", "redis":
+		return cache, idempotency.NoTx{}, nil, nil
+	case "postgres":
+		store := postgres.NewIdempotencyStore(db)
+		return store, db, idemsweep.New(cfg, store), nil
+	case "memory":
+		store := memidem.New()
+		return store, idempotency.NoTx{}, idemsweep.New(cfg, store), nil
+	default:
+		return nil, nil, nil, fmt.Errorf("unknown idempotency backend %q", cfg.Backend)
+	}
+}
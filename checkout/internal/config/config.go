@@ -14,11 +14,18 @@ import (
 var Version = "unknown"
 
 type Config struct {
-	HTTP   HTTP     `mapstructure:"http"`
-	Redis  Redis    `mapstructure:"redis"`
-	DB     Database `mapstructure:"database"`
-	Kafka  Kafka    `mapstructure:"kafka"`
-	Outbox Outbox   `mapstructure:"outbox"`
+	HTTP        HTTP        `mapstructure:"http"`
+	Redis       Redis       `mapstructure:"redis"`
+	DB          Database    `mapstructure:"database"`
+	Kafka       Kafka       `mapstructure:"kafka"`
+	Outbox      Outbox      `mapstructure:"outbox"`
+	Archive     Archive     `mapstructure:"outbox_archive"`
+	Inbox       Inbox       `mapstructure:"inbox"`
+	Capture     Capture     `mapstructure:"capture"`
+	Auth        Auth        `mapstructure:"auth"`
+	Webhooks    Webhooks    `mapstructure:"webhooks"`
+	RateLimit   RateLimit   `mapstructure:"rate_limit"`
+	Idempotency Idempotency `mapstructure:"idempotency"`
 }
 
 type HTTP struct {
@@ -44,9 +51,19 @@ type Redis struct {
 type Kafka struct {
 	Brokers       []string      `mapstructure:"brokers"`
 	PaymentsTopic string        `mapstructure:"payments_topic"`
+	RefundsTopic  string        `mapstructure:"refunds_topic"`
 	ClientID      string        `mapstructure:"client_id"`
 	BatchSize     int           `mapstructure:"batch_size"`
 	BatchTimeout  time.Duration `mapstructure:"batch_timeout"`
+	Consumer      KafkaConsumer `mapstructure:"consumer"`
+}
+
+type KafkaConsumer struct {
+	GroupID                string `mapstructure:"group_id"`
+	PaymentsProcessedTopic string `mapstructure:"payments_processed_topic"`
+	PaymentsFailedTopic    string `mapstructure:"payments_failed_topic"`
+	RefundsProcessedTopic  string `mapstructure:"refunds_processed_topic"`
+	RefundsFailedTopic     string `mapstructure:"refunds_failed_topic"`
 }
 
 type Outbox struct {
@@ -56,6 +73,103 @@ type Outbox struct {
 	ResetEventsInterval time.Duration `mapstructure:"reset_events_interval"`
 	ResetEventsTimeout  time.Duration `mapstructure:"reset_events_timeout"`
 	MaxParallel         int           `mapstructure:"max_parallel"`
+	Notify              bool          `mapstructure:"notify"`       // будить воркер по LISTEN/NOTIFY, опрос — страховка
+	MaxAttempts         int           `mapstructure:"max_attempts"` // 0 — повторять бесконечно
+	BackoffBase         time.Duration `mapstructure:"backoff_base"`
+	BackoffMax          time.Duration `mapstructure:"backoff_max"`
+	BackoffJitter       float64       `mapstructure:"backoff_jitter"` // доля паузы, на которую она случайно сокращается, 0..1
+	WorkerID            string        `mapstructure:"worker_id"`      // пусто — hostname и случайный суффикс
+	HeartbeatInterval   time.Duration `mapstructure:"heartbeat_interval"`
+	OwnerTTL            time.Duration `mapstructure:"owner_ttl"`       // без heartbeat дольше — строки воркера сбрасываются
+	LeaderElection      bool          `mapstructure:"leader_election"` // отправляет только держатель advisory-блокировки
+	// собственные IN_PROGRESS-строки старше — отправлены, но не закрыты, сбрасываются
+	ReclaimAfter time.Duration `mapstructure:"reclaim_after"`
+	// строки outbox_workers без heartbeat дольше удаляются, 0 — не удалять
+	WorkerRetention time.Duration `mapstructure:"worker_retention"`
+}
+
+// Archive — фоновая чистка SENT-событий outbox старше RetentionDays
+type Archive struct {
+	Interval      time.Duration `mapstructure:"interval"`
+	Timeout       time.Duration `mapstructure:"timeout"` // на одну пачку
+	BatchSize     int           `mapstructure:"batch_size"`
+	RetentionDays int           `mapstructure:"retention_days"` // 0 — чистка выключена
+	Archive       bool          `mapstructure:"archive"`        // false — удалять без архива
+}
+
+type Capture struct {
+	AuthorizationTTL time.Duration `mapstructure:"authorization_ttl"` // через сколько авторизация отменяется
+	ExpiryInterval   time.Duration `mapstructure:"expiry_interval"`
+	ExpiryTimeout    time.Duration `mapstructure:"expiry_timeout"`
+	ExpiryBatchSize  int           `mapstructure:"expiry_batch_size"`
+	// после payment.void_failed авторизация снова AUTHORIZED: повторяем void не чаще
+	// ExpiryRetryAfter и не больше ExpiryMaxAttempts раз (0 — без ограничения), дальше — разбор вручную
+	ExpiryRetryAfter  time.Duration `mapstructure:"expiry_retry_after"`
+	ExpiryMaxAttempts int           `mapstructure:"expiry_max_attempts"`
+}
+
+type Auth struct {
+	RequireSignature   bool          `mapstructure:"require_signature"`   // подпись обязательна для всех запросов
+	SignatureTolerance time.Duration `mapstructure:"signature_tolerance"` // допустимое расхождение X-Timestamp
+	RotationOverlap    time.Duration `mapstructure:"rotation_overlap"`    // сколько старый ключ живёт после ротации
+	ReplayPrefix       string        `mapstructure:"replay_prefix"`       // ключи принятых подписей в Redis
+	ReplayTimeout      time.Duration `mapstructure:"replay_timeout"`      // дольше — считаем Redis недоступным
+	AdminToken         string
+}
+
+type Webhooks struct {
+	PollInterval   time.Duration `mapstructure:"poll_interval"`
+	PollTimeout    time.Duration `mapstructure:"poll_timeout"` // на каждый запрос к БД: выборку и запись итога
+	BatchSize      int           `mapstructure:"batch_size"`
+	MaxParallel    int           `mapstructure:"max_parallel"`
+	RequestTimeout time.Duration `mapstructure:"request_timeout"`
+	MaxAttempts    int           `mapstructure:"max_attempts"`
+	BackoffBase    time.Duration `mapstructure:"backoff_base"` // пауза после первой неудачи, дальше удваивается
+	BackoffMax     time.Duration `mapstructure:"backoff_max"`
+	ResetInterval  time.Duration `mapstructure:"reset_interval"`
+	// IN_PROGRESS дольше — воркер упал посреди отправки, доставку берут снова.
+	// Должно быть больше request_timeout
+	ResetAfter time.Duration `mapstructure:"reset_after"`
+	// только для локального запуска: endpoint'ы по http и на приватных адресах.
+	// Иначе мерчант мог бы направить запросы checkout во внутреннюю сеть
+	AllowInsecure bool `mapstructure:"allow_insecure"`
+}
+
+type RateLimit struct {
+	Enabled      bool            `mapstructure:"enabled"`
+	Prefix       string          `mapstructure:"prefix"`
+	RedisTimeout time.Duration   `mapstructure:"redis_timeout"` // дольше — считаем Redis недоступным
+	Default      RateLimitRule   `mapstructure:"default"`
+	Routes       []RateLimitRule `mapstructure:"routes"`
+	Merchants    []RateLimitRule `mapstructure:"merchants"` // индивидуальные лимиты мерчантов
+	// как часто перечитывать лимиты мерчантов из БД (checkout.merchant_rate_limits)
+	OverridesRefresh time.Duration `mapstructure:"overrides_refresh"`
+	// лимит на IP клиента до проверки ключа: перебор ключей не доходит до БД
+	PreAuth RateLimitRule `mapstructure:"pre_auth"`
+	// заголовок с адресом клиента от балансировщика (X-Real-IP), пусто — RemoteAddr
+	ClientIPHeader string `mapstructure:"client_ip_header"`
+}
+
+// RateLimitRule: пустой Route — все ручки, пустой MerchantID — все мерчанты
+type RateLimitRule struct {
+	MerchantID string  `mapstructure:"merchant_id"`
+	Route      string  `mapstructure:"route"` // шаблон ServeMux, например "POST /v1/payments"
+	Rate       float64 `mapstructure:"rate"`  // запросов в секунду
+	Burst      int     `mapstructure:"burst"`
+}
+
+// Backend: redis | postgres | memory
+type Idempotency struct {
+	Backend        string        `mapstructure:"backend"`
+	Lease          time.Duration `mapstructure:"lease"` // больше таймаута запроса, иначе ключ перехватят у живого владельца
+	SweepInterval  time.Duration `mapstructure:"sweep_interval"`
+	SweepTimeout   time.Duration `mapstructure:"sweep_timeout"`
+	SweepBatchSize int           `mapstructure:"sweep_batch_size"`
+}
+
+type Inbox struct {
+	HandleTimeout time.Duration `mapstructure:"handle_timeout"`
+	RetryInterval time.Duration `mapstructure:"retry_interval"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -90,6 +204,7 @@ func LoadConfig() (*Config, error) {
 	cfg.DB.User = v.GetString("pg.user")
 	cfg.DB.Pass = v.GetString("pg.pass")
 	cfg.Redis.Pass = v.GetString("redis.pass")
+	cfg.Auth.AdminToken = v.GetString("admin.token")
 
 	// env override для Docker
 	if brokers := v.GetString("kafka.brokers"); brokers != "" {
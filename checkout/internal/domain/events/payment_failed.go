@@ -0,0 +1,30 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type PaymentFailed struct {
+	EventID      string `json:"event_id"`
+	EventType    string `json:"event_type"`
+	EventVersion int    `json:"event_version"`
+	PaymentID    string `json:"payment_id"`
+	MerchantID   string `json:"merchant_id"`
+	OrderID      string `json:"order_id"`
+	Amount       string `json:"amount"`
+	Currency     string `json:"currency"`
+	OccurredAt   string `json:"occurred_at"`
+	ErrorDetails string `json:"error_details"`
+}
+
+func ParsePaymentFailed(data []byte) (PaymentFailed, error) {
+	var evn PaymentFailed
+	if err := json.Unmarshal(data, &evn); err != nil {
+		return PaymentFailed{}, fmt.Errorf("invalid JSON err:%v", err)
+	}
+	if evn.PaymentID == "" {
+		return PaymentFailed{}, fmt.Errorf("empty payment_id")
+	}
+	return evn, nil
+}
@@ -0,0 +1,105 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/currency"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
+	"github.com/google/uuid"
+	"github.com/shopspring/decimal"
+)
+
+// Причины отмены авторизации
+const (
+	VoidReasonMerchant = "merchant"
+	VoidReasonExpired  = "expired"
+)
+
+// Команда в provider: capture или void авторизованного платежа
+type PaymentOperationRequested struct {
+	EventID      string  `json:"event_id"`
+	EventType    string  `json:"event_type"`
+	EventVersion int     `json:"event_version"`
+	PaymentID    string  `json:"payment_id"`
+	MerchantID   string  `json:"merchant_id"`
+	OrderID      string  `json:"order_id"`
+	Amount       string  `json:"amount"`
+	Currency     string  `json:"currency"`
+	PSPRef       *string `json:"psp_reference"`
+	Reason       string  `json:"reason,omitempty"`
+	ChallengeID  string  `json:"challenge_id,omitempty"` // для confirm
+	OccurredAt   string  `json:"occurred_at"`
+}
+
+func NewPaymentCaptureRequestedEvent(pay payment.Payment, amount decimal.Decimal) (event.Envelope, error) {
+	return newOperationRequested(event.PaymentCaptureRequestedEvent, pay, amount, "", "")
+}
+
+func NewPaymentVoidRequestedEvent(pay payment.Payment, reason string) (event.Envelope, error) {
+	return newOperationRequested(event.PaymentVoidRequestedEvent, pay, pay.Amount, reason, "")
+}
+
+// Команда в provider: покупатель прошёл challenge, продолжить авторизацию
+func NewPaymentConfirmRequestedEvent(pay payment.Payment, challengeID string) (event.Envelope, error) {
+	return newOperationRequested(event.PaymentConfirmRequestedEvent, pay, pay.Amount, "", challengeID)
+}
+
+func newOperationRequested(t event.EnvelopeType, pay payment.Payment, amount decimal.Decimal,
+	reason, challengeID string) (event.Envelope, error) {
+	payload := PaymentOperationRequested{
+		EventID:      uuid.NewString(),
+		EventType:    string(t),
+		EventVersion: 1,
+		PaymentID:    pay.ID,
+		MerchantID:   pay.MerchantID,
+		OrderID:      pay.OrderID,
+		Amount:       currency.Format(amount, pay.Currency),
+		Currency:     pay.Currency,
+		PSPRef:       pay.PSPRef,
+		Reason:       reason,
+		ChallengeID:  challengeID,
+		OccurredAt:   time.Now().UTC().Format(time.RFC3339Nano),
+	}
+
+	value, err := json.Marshal(payload)
+	if err != nil {
+		return event.Envelope{}, err
+	}
+
+	return event.Envelope{
+		Type:    t,
+		Key:     pay.ID, // партиционирование по payment_id
+		Payload: value,
+		Headers: map[string]string{
+			"content-type": "application/json",
+		},
+	}, nil
+}
+
+// Результат capture/void от provider
+type PaymentOperationResult struct {
+	EventID      string  `json:"event_id"`
+	EventType    string  `json:"event_type"`
+	EventVersion int     `json:"event_version"`
+	PaymentID    string  `json:"payment_id"`
+	Amount       string  `json:"amount"`
+	Currency     string  `json:"currency"`
+	Status       string  `json:"status"`
+	PSPRef       *string `json:"psp_reference"`
+	OccurredAt   string  `json:"occurred_at"`
+	ErrorDetails string  `json:"error_details,omitempty"`
+}
+
+func ParsePaymentOperationResult(data []byte) (PaymentOperationResult, error) {
+	var evn PaymentOperationResult
+	if err := json.Unmarshal(data, &evn); err != nil {
+		return PaymentOperationResult{}, fmt.Errorf("invalid JSON err:%v", err)
+	}
+	if evn.PaymentID == "" {
+		return PaymentOperationResult{}, fmt.Errorf("empty payment_id")
+	}
+	return evn, nil
+}
@@ -0,0 +1,63 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+)
+
+// Статусы, которые присылает provider в payments.processed
+const (
+	PSPStatusAuthorized     = "AUTHORIZED"
+	PSPStatusDeclined       = "DECLINED"
+	PSPStatusRequiresAction = "REQUIRES_ACTION" // нужен challenge, итог — после confirm
+)
+
+type PaymentProcessed struct {
+	EventID       string  `json:"event_id"`
+	EventType     string  `json:"event_type"`
+	EventVersion  int     `json:"event_version"`
+	PaymentID     string  `json:"payment_id"`
+	MerchantID    string  `json:"merchant_id"`
+	OrderID       string  `json:"order_id"`
+	Amount        string  `json:"amount"`
+	Currency      string  `json:"currency"`
+	Status        string  `json:"status"`
+	PSPRef        *string `json:"psp_reference"`
+	CaptureMethod string  `json:"capture_method"`
+	OccurredAt    string  `json:"occurred_at"`
+
+	NextAction *payment.NextAction `json:"next_action,omitempty"` // для REQUIRES_ACTION
+}
+
+func ParsePaymentProcessed(data []byte) (PaymentProcessed, error) {
+	var evn PaymentProcessed
+	if err := json.Unmarshal(data, &evn); err != nil {
+		return PaymentProcessed{}, fmt.Errorf("invalid JSON err:%v", err)
+	}
+	if evn.PaymentID == "" {
+		return PaymentProcessed{}, fmt.Errorf("empty payment_id")
+	}
+	return evn, nil
+}
+
+// Статус платежа, к которому приводит событие
+func (e PaymentProcessed) PaymentStatus() (payment.PaymentStatus, error) {
+	switch e.Status {
+	case PSPStatusAuthorized:
+		if payment.CaptureMethod(e.CaptureMethod) == payment.CaptureManual {
+			return payment.StatusAuthorized, nil
+		}
+		return payment.StatusSucceeded, nil
+	case PSPStatusDeclined:
+		return payment.StatusFailed, nil
+	case PSPStatusRequiresAction:
+		if e.NextAction == nil {
+			return "", fmt.Errorf("psp status %q without next_action", e.Status)
+		}
+		return payment.StatusRequiresAction, nil
+	default:
+		return "", fmt.Errorf("unknown psp status %q", e.Status)
+	}
+}
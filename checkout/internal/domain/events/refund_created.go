@@ -0,0 +1,58 @@
+package events
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/refund"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/currency"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
+	"github.com/google/uuid"
+)
+
+type RefundCreated struct {
+	EventID       string  `json:"event_id"`
+	EventType     string  `json:"event_type"`
+	EventVersion  int     `json:"event_version"`
+	RefundID      string  `json:"refund_id"`
+	PaymentID     string  `json:"payment_id"`
+	MerchantID    string  `json:"merchant_id"`
+	Amount        string  `json:"amount"`
+	Currency      string  `json:"currency"`
+	PaymentPSPRef *string `json:"payment_psp_reference"`
+	Reason        string  `json:"reason,omitempty"`
+	OccurredAt    string  `json:"occurred_at"`
+}
+
+// Конструктор события из доменного объекта
+func NewRefundCreatedEvent(ref refund.Refund, pay payment.Payment) (event.Envelope, error) {
+	payload := RefundCreated{
+		EventID:       uuid.NewString(),
+		EventType:     string(event.RefundCreatedEvent),
+		EventVersion:  1,
+		RefundID:      ref.ID,
+		PaymentID:     ref.PaymentID,
+		MerchantID:    ref.MerchantID,
+		Amount:        currency.Format(ref.Amount, ref.Currency),
+		Currency:      ref.Currency,
+		PaymentPSPRef: pay.PSPRef,
+		Reason:        ref.Reason,
+		OccurredAt:    time.Now().UTC().Format(time.RFC3339Nano),
+	}
+
+	value, err := json.Marshal(payload)
+	if err != nil {
+		return event.Envelope{}, err
+	}
+
+	return event.Envelope{
+		Type:    event.RefundCreatedEvent,
+		Key:     ref.PaymentID, // партиционирование по payment_id: порядок с событиями платежа
+		Payload: value,
+		Headers: map[string]string{
+			"content-type":   "application/json",
+			"x-aggregate-id": ref.ID,
+		},
+	}, nil
+}
@@ -0,0 +1,30 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+type RefundFailed struct {
+	EventID      string `json:"event_id"`
+	EventType    string `json:"event_type"`
+	EventVersion int    `json:"event_version"`
+	RefundID     string `json:"refund_id"`
+	PaymentID    string `json:"payment_id"`
+	MerchantID   string `json:"merchant_id"`
+	Amount       string `json:"amount"`
+	Currency     string `json:"currency"`
+	OccurredAt   string `json:"occurred_at"`
+	ErrorDetails string `json:"error_details"`
+}
+
+func ParseRefundFailed(data []byte) (RefundFailed, error) {
+	var evn RefundFailed
+	if err := json.Unmarshal(data, &evn); err != nil {
+		return RefundFailed{}, fmt.Errorf("invalid JSON err:%v", err)
+	}
+	if evn.RefundID == "" {
+		return RefundFailed{}, fmt.Errorf("empty refund_id")
+	}
+	return evn, nil
+}
@@ -0,0 +1,51 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/refund"
+)
+
+// Статусы, которые присылает provider в refund.processed
+const (
+	PSPRefundStatusRefunded = "REFUNDED"
+	PSPRefundStatusDeclined = "DECLINED"
+)
+
+type RefundProcessed struct {
+	EventID      string  `json:"event_id"`
+	EventType    string  `json:"event_type"`
+	EventVersion int     `json:"event_version"`
+	RefundID     string  `json:"refund_id"`
+	PaymentID    string  `json:"payment_id"`
+	MerchantID   string  `json:"merchant_id"`
+	Amount       string  `json:"amount"`
+	Currency     string  `json:"currency"`
+	Status       string  `json:"status"`
+	PSPRef       *string `json:"psp_reference"`
+	OccurredAt   string  `json:"occurred_at"`
+}
+
+func ParseRefundProcessed(data []byte) (RefundProcessed, error) {
+	var evn RefundProcessed
+	if err := json.Unmarshal(data, &evn); err != nil {
+		return RefundProcessed{}, fmt.Errorf("invalid JSON err:%v", err)
+	}
+	if evn.RefundID == "" {
+		return RefundProcessed{}, fmt.Errorf("empty refund_id")
+	}
+	return evn, nil
+}
+
+// Статус возврата, к которому приводит событие
+func (e RefundProcessed) RefundStatus() (refund.Status, error) {
+	switch e.Status {
+	case PSPRefundStatusRefunded:
+		return refund.StatusSucceeded, nil
+	case PSPRefundStatusDeclined:
+		return refund.StatusFailed, nil
+	default:
+		return "", fmt.Errorf("unknown psp refund status %q", e.Status)
+	}
+}
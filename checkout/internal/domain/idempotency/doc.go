@@ -0,0 +1,22 @@
+// Package idempotency описывает протокол идемпотентных запросов с арендой ключа.
+//
+// Жизненный цикл ключа (merchant_id, Idempotency-Key):
+//
+//  1. Reserve. Обработчик генерирует owner-токен и занимает ключ в состоянии
+//     IN_PROGRESS с арендой до now+lease. Ключ целиком живёт ttl.
+//  2. Работа. Пока аренда не истекла, повторы с тем же ключом не выполняют
+//     запрос, а получают текущее состояние (202 или уже созданный объект).
+//  3. Завершение. Владелец пишет результат:
+//     - Finalize — DONE с кодом и телом ответа, повторы получают его же;
+//     - Fail — ERROR с флагом retryable. Невосстановимая ошибка (retryable=false)
+//     отдаётся повторам как DONE. Восстановимая разрешает следующему запросу
+//     сразу перехватить ключ.
+//  4. Перехват. Если процесс упал между Reserve и Finalize, ключ остаётся
+//     IN_PROGRESS только до конца аренды: следующий Reserve с тем же телом
+//     перехватывает его с новым owner. Запрос с другим телом перехват не
+//     получает и отвечает 422.
+//
+// Finalize и Fail проверяют owner: если аренду уже перехватили, они возвращают
+// ErrLeaseLost и ничего не меняют, результат запишет новый владелец. Поэтому
+// lease должен быть больше таймаута обработки запроса.
+package idempotency
@@ -5,4 +5,5 @@ import "errors"
 var (
 	ErrNotFound     = errors.New("idempotency record not found")
 	ErrBodyMismatch = errors.New("idempotency key reused with different payload")
+	ErrLeaseLost    = errors.New("idempotency lease taken over by another owner")
 )
@@ -0,0 +1,203 @@
+// Package idemtest — общий набор проверок протокола аренды ключей (см. idempotency)
+// для всех реализаций idempotency.Store
+package idemtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/idempotency"
+)
+
+const (
+	merchantID = "m_idemtest"
+	bodyHash   = "hash-a"
+	otherHash  = "hash-b"
+	lease      = 300 * time.Millisecond
+	ttl        = time.Minute
+)
+
+// Run прогоняет проверки на store. Ключи уникальны на каждый запуск,
+// поэтому внешнее хранилище можно не чистить
+func Run(t *testing.T, store idempotency.Store) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T, store idempotency.Store, key string)
+	}{
+		{"ConcurrentReserve", testConcurrentReserve},
+		{"BusyWithinLease", testBusyWithinLease},
+		{"TakeoverAfterLease", testTakeoverAfterLease},
+		{"ConcurrentTakeover", testConcurrentTakeover},
+		{"NoTakeoverWithOtherBody", testNoTakeoverWithOtherBody},
+		{"RetryableError", testRetryableError},
+		{"NonRetryableError", testNonRetryableError},
+		{"DoneIsFinal", testDoneIsFinal},
+	}
+	run := time.Now().UnixNano()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.fn(t, store, fmt.Sprintf("%s-%d", tt.name, run))
+		})
+	}
+}
+
+// из N одновременных Reserve ключ получает ровно один
+func testConcurrentReserve(t *testing.T, store idempotency.Store, key string) {
+	if winners := reserveConcurrently(t, store, key, 32); winners != 1 {
+		t.Fatalf("winners = %d, want 1", winners)
+	}
+}
+
+func testBusyWithinLease(t *testing.T, store idempotency.Store, key string) {
+	ctx := context.Background()
+	mustReserve(t, store, key, "a", true)
+	mustReserve(t, store, key, "b", false)
+
+	rec := mustLoad(t, store, key)
+	if rec.State != idempotency.StateInProgress || rec.Owner != "a" {
+		t.Fatalf("record = %+v, want IN_PROGRESS owned by a", rec)
+	}
+	if err := store.Finalize(ctx, merchantID, key, "b", bodyHash, 201, "pay_1", nil, ttl); !errors.Is(err, idempotency.ErrLeaseLost) {
+		t.Fatalf("foreign finalize err = %v, want ErrLeaseLost", err)
+	}
+}
+
+// владелец «упал»: после аренды ключ перехватывают, а запоздалый Finalize старого владельца отклоняется
+func testTakeoverAfterLease(t *testing.T, store idempotency.Store, key string) {
+	ctx := context.Background()
+	mustReserve(t, store, key, "a", true)
+	time.Sleep(lease + 100*time.Millisecond)
+	mustReserve(t, store, key, "b", true)
+
+	err := store.Finalize(ctx, merchantID, key, "a", bodyHash, 201, "pay_a", nil, ttl)
+	if !errors.Is(err, idempotency.ErrLeaseLost) {
+		t.Fatalf("stale finalize err = %v, want ErrLeaseLost", err)
+	}
+	if err := store.Finalize(ctx, merchantID, key, "b", bodyHash, 201, "pay_b", nil, ttl); err != nil {
+		t.Fatalf("finalize: %v", err)
+	}
+
+	rec := mustLoad(t, store, key)
+	if rec.State != idempotency.StateDone || rec.PaymentID != "pay_b" {
+		t.Fatalf("record = %+v, want DONE with pay_b", rec)
+	}
+}
+
+func testConcurrentTakeover(t *testing.T, store idempotency.Store, key string) {
+	mustReserve(t, store, key, "a", true)
+	time.Sleep(lease + 100*time.Millisecond)
+	if winners := reserveConcurrently(t, store, key, 32); winners != 1 {
+		t.Fatalf("winners = %d, want 1", winners)
+	}
+}
+
+func testNoTakeoverWithOtherBody(t *testing.T, store idempotency.Store, key string) {
+	ctx := context.Background()
+	mustReserve(t, store, key, "a", true)
+	time.Sleep(lease + 100*time.Millisecond)
+
+	created, err := store.Reserve(ctx, merchantID, key, otherHash, "b", lease, ttl)
+	if err != nil {
+		t.Fatalf("reserve: %v", err)
+	}
+	if created {
+		t.Fatal("key taken over by request with different body")
+	}
+}
+
+// восстановимая ошибка отдаёт ключ следующему запросу, не дожидаясь аренды
+func testRetryableError(t *testing.T, store idempotency.Store, key string) {
+	ctx := context.Background()
+	mustReserve(t, store, key, "a", true)
+	if err := store.Fail(ctx, merchantID, key, "a", bodyHash, true, 0, nil, ttl); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+
+	rec := mustLoad(t, store, key)
+	if rec.State != idempotency.StateError || !rec.Retryable {
+		t.Fatalf("record = %+v, want retryable ERROR", rec)
+	}
+	mustReserve(t, store, key, "b", true)
+}
+
+func testNonRetryableError(t *testing.T, store idempotency.Store, key string) {
+	ctx := context.Background()
+	mustReserve(t, store, key, "a", true)
+	resp := map[string]any{"error": "payment already exists"}
+	if err := store.Fail(ctx, merchantID, key, "a", bodyHash, false, 409, resp, ttl); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+	time.Sleep(lease + 100*time.Millisecond)
+	mustReserve(t, store, key, "b", false)
+
+	rec := mustLoad(t, store, key)
+	if rec.State != idempotency.StateError || rec.Retryable || rec.HTTPCode != 409 || rec.Response["error"] != resp["error"] {
+		t.Fatalf("record = %+v, want non-retryable ERROR 409", rec)
+	}
+}
+
+func testDoneIsFinal(t *testing.T, store idempotency.Store, key string) {
+	ctx := context.Background()
+	mustReserve(t, store, key, "a", true)
+	if err := store.Finalize(ctx, merchantID, key, "a", bodyHash, 201, "pay_1", nil, ttl); err != nil {
+		t.Fatalf("finalize: %v", err)
+	}
+	time.Sleep(lease + 100*time.Millisecond)
+	mustReserve(t, store, key, "b", false)
+}
+
+func reserveConcurrently(t *testing.T, store idempotency.Store, key string, n int) int64 {
+	t.Helper()
+	var (
+		wg      sync.WaitGroup
+		winners atomic.Int64
+		start   = make(chan struct{})
+	)
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			created, err := store.Reserve(context.Background(), merchantID, key, bodyHash, fmt.Sprintf("owner-%d", i), lease, ttl)
+			if err != nil {
+				t.Errorf("reserve: %v", err)
+				return
+			}
+			if created {
+				winners.Add(1)
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+	return winners.Load()
+}
+
+func mustReserve(t *testing.T, store idempotency.Store, key, owner string, want bool) {
+	t.Helper()
+	created, err := store.Reserve(context.Background(), merchantID, key, bodyHash, owner, lease, ttl)
+	if err != nil {
+		t.Fatalf("reserve by %s: %v", owner, err)
+	}
+	if created != want {
+		t.Fatalf("reserve by %s: created = %v, want %v", owner, created, want)
+	}
+}
+
+func mustLoad(t *testing.T, store idempotency.Store, key string) *idempotency.Record {
+	t.Helper()
+	rec, err := store.Load(context.Background(), merchantID, key)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if rec == nil {
+		t.Fatal("record not found")
+	}
+	return rec
+}
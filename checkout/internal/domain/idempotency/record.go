@@ -12,11 +12,30 @@ const (
 
 const TTL = time.Duration(24 * time.Hour)
 
+// DefaultLease — аренда ключа, если в конфиге она не задана
+const DefaultLease = 30 * time.Second
+
 type Record struct {
-	State     State          `json:"state"`
-	BodyHash  string         `json:"body_hash"`
-	PaymentID string         `json:"payment_id,omitempty"`
-	HTTPCode  int            `json:"http_code,omitempty"`
-	Response  map[string]any `json:"response,omitempty"`
-	UpdatedAt int64          `json:"updated_at"`
+	State      State          `json:"state"`
+	BodyHash   string         `json:"body_hash"`
+	PaymentID  string         `json:"payment_id,omitempty"`
+	HTTPCode   int            `json:"http_code,omitempty"`
+	Response   map[string]any `json:"response,omitempty"`
+	UpdatedAt  int64          `json:"updated_at"`
+	Owner      string         `json:"owner,omitempty"`       // токен текущего владельца аренды
+	LeaseUntil int64          `json:"lease_until,omitempty"` // unix ms, до какого момента ключ занят
+	Retryable  bool           `json:"retryable,omitempty"`   // для StateError: можно ли повторить запрос
+}
+
+// LeaseExpired — владелец IN_PROGRESS-ключа не уложился в аренду
+func (r Record) LeaseExpired(now time.Time) bool {
+	return r.State == StateInProgress && now.UnixMilli() >= r.LeaseUntil
+}
+
+// CanTakeOver — можно ли занять существующий ключ запросом с bodyHash
+func (r Record) CanTakeOver(bodyHash string, now time.Time) bool {
+	if r.BodyHash != bodyHash {
+		return false
+	}
+	return r.LeaseExpired(now) || (r.State == StateError && r.Retryable)
 }
@@ -5,9 +5,28 @@ import (
 	"time"
 )
 
-// Доменный интерфейс для идемпотентности
+// Доменный интерфейс для идемпотентности, протокол описан в doc.go
 type Store interface {
-	Reserve(ctx context.Context, merchantID, key, bodyHash string, ttl time.Duration) (created bool, err error)
-	Finalize(ctx context.Context, merchantID, key, bodyHash string, httpCode int, paymentID string, resp map[string]any, ttl time.Duration) error
+	// Reserve занимает ключ за owner на lease; created == false — ключ занят и перехватить его нельзя
+	Reserve(ctx context.Context, merchantID, key, bodyHash, owner string, lease, ttl time.Duration) (created bool, err error)
+	// Finalize записывает успешный ответ, ErrLeaseLost — ключ уже у другого владельца
+	Finalize(ctx context.Context, merchantID, key, owner, bodyHash string, httpCode int, paymentID string, resp map[string]any, ttl time.Duration) error
+	// Fail записывает StateError, ErrLeaseLost — ключ уже у другого владельца
+	Fail(ctx context.Context, merchantID, key, owner, bodyHash string, retryable bool, httpCode int, resp map[string]any, ttl time.Duration) error
 	Load(ctx context.Context, merchantID, key string) (*Record, error)
+	// Ping — для readiness: без хранилища ключей платежи не принимаются
+	Ping() error
+}
+
+// TxRunner объединяет резерв ключа, запись платежа и финализацию в одну
+// транзакцию, если ключи хранятся в той же БД, что и платежи
+type TxRunner interface {
+	WithinTx(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// NoTx — для хранилищ вне БД платежей: шаги выполняются по отдельности
+type NoTx struct{}
+
+func (NoTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
 }
@@ -0,0 +1,16 @@
+package merchant
+
+import "context"
+
+type ctxKey struct{}
+
+// WithID кладёт аутентифицированного мерчанта в контекст запроса
+func WithID(ctx context.Context, merchantID string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, merchantID)
+}
+
+// IDFromContext возвращает мерчанта, от имени которого пришёл запрос
+func IDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(ctxKey{}).(string)
+	return id, ok && id != ""
+}
@@ -0,0 +1,9 @@
+package merchant
+
+import "errors"
+
+var (
+	ErrNotFound    = errors.New("merchant not found")
+	ErrKeyNotFound = errors.New("api key not found")
+	ErrExists      = errors.New("merchant already exists")
+)
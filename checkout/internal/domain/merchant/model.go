@@ -0,0 +1,64 @@
+package merchant
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"slices"
+	"time"
+)
+
+// префикс секретного ключа, по нему ключ легко узнать в логах и конфигах
+const KeyPrefix = "sk_"
+
+type Merchant struct {
+	ID         string
+	Name       string
+	Currencies []string // разрешённые валюты, пусто — все
+	CreatedAt  time.Time
+}
+
+// AcceptsCurrency — можно ли мерчанту принимать платежи в валюте
+func (m Merchant) AcceptsCurrency(code string) bool {
+	if len(m.Currencies) == 0 {
+		return true
+	}
+	return slices.Contains(m.Currencies, code)
+}
+
+// APIKey хранится только в виде хэша, сам ключ отдаётся мерчанту один раз при выпуске.
+// При ротации старый ключ получает ValidUntil и работает параллельно с новым до этого момента.
+type APIKey struct {
+	ID         string
+	MerchantID string
+	Prefix     string // первые символы ключа для отображения
+	Hash       string
+	ValidFrom  time.Time
+	ValidUntil *time.Time
+	RevokedAt  *time.Time
+	CreatedAt  time.Time
+}
+
+// NewSecret генерирует новый ключ
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return KeyPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashSecret — по этому хэшу ключ ищется в БД
+func HashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// DisplayPrefix — безопасная для показа часть ключа
+func DisplayPrefix(secret string) string {
+	if len(secret) <= len(KeyPrefix)+6 {
+		return secret
+	}
+	return secret[:len(KeyPrefix)+6]
+}
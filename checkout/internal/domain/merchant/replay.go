@@ -0,0 +1,13 @@
+package merchant
+
+import (
+	"context"
+	"time"
+)
+
+// ReplayGuard помнит принятые подписи запросов, пока их timestamp в окне допуска:
+// перехваченный подписанный запрос нельзя отправить повторно
+type ReplayGuard interface {
+	// Remember возвращает false, если ключ уже был запомнен и ещё не истёк
+	Remember(ctx context.Context, key string, ttl time.Duration) (bool, error)
+}
@@ -0,0 +1,19 @@
+package merchant
+
+import (
+	"context"
+	"time"
+)
+
+type Repository interface {
+	// InsertMerchant заводит мерчанта и его первый ключ в одной транзакции
+	InsertMerchant(ctx context.Context, m Merchant, key APIKey) (Merchant, APIKey, error)
+	GetMerchant(ctx context.Context, id string) (Merchant, error)
+	SetCurrencies(ctx context.Context, id string, currencies []string) (Merchant, error)
+	// GetActiveAPIKey ищет действующий ключ: не отозван и now() в окне [valid_from, valid_until)
+	GetActiveAPIKey(ctx context.Context, hash string) (APIKey, error)
+	// RotateAPIKey добавляет ключ и ограничивает действующие ключи мерчанта сроком now()+overlap
+	RotateAPIKey(ctx context.Context, key APIKey, overlap time.Duration) (APIKey, error)
+	RevokeAPIKey(ctx context.Context, merchantID, keyID string) error
+	ListAPIKeys(ctx context.Context, merchantID string) ([]APIKey, error)
+}
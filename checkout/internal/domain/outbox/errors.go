@@ -0,0 +1,8 @@
+package outbox
+
+import "errors"
+
+var (
+	ErrNotFound     = errors.New("outbox event not found")
+	ErrNotRetryable = errors.New("outbox event is not FAILED or DEAD")
+)
@@ -0,0 +1,20 @@
+package outbox
+
+import "time"
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 500
+)
+
+// Фильтр поиска событий, пустые поля не участвуют.
+// Выдача отсортирована от новых к старым по id.
+type ListFilter struct {
+	Status        Status
+	AggregateType string
+	AggregateID   string
+	OlderThan     time.Duration // created_at не позже now()-OlderThan
+	NewerThan     time.Duration // created_at позже now()-NewerThan
+	BeforeID      int64         // курсор: последний отданный id
+	Limit         int
+}
@@ -0,0 +1,66 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
+)
+
+type Status string
+
+const (
+	StatusNew        Status = "NEW"
+	StatusInProgress Status = "IN_PROGRESS"
+	StatusSent       Status = "SENT"
+	StatusFailed     Status = "FAILED" // ждёт следующей попытки
+	StatusDead       Status = "DEAD"   // попытки исчерпаны, воркер его больше не берёт
+)
+
+// Message — событие, взятое воркером в отправку
+type Message struct {
+	ID       int64
+	Attempt  int // сколько попыток уже было до этой
+	Envelope event.Envelope
+	// строку не удалось разобрать в Envelope: повтор не поможет, сразу DEAD
+	DecodeErr error
+}
+
+// Failure — итог неудачной отправки. NextAttemptAt == nil — событие уходит в DEAD
+type Failure struct {
+	ID            int64
+	Attempt       int
+	Error         string
+	NextAttemptAt *time.Time
+}
+
+// Event — строка outbox целиком, для служебных ручек
+type Event struct {
+	ID            int64
+	AggregateType string // payment | refund
+	AggregateID   string
+	EventType     string
+	EventVersion  int
+	Key           string
+	Payload       []byte
+	Headers       map[string]string
+	RawHeaders    []byte // как в БД: для разбора вручную, если Headers не декодировались
+	DecodeErr     error  // строка повреждена, но отдаётся целиком
+	Status        Status
+	Attempt       int
+	NextAttemptAt time.Time
+	LastError     *string
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Retryable — событие можно вернуть в очередь вручную
+func (e Event) Retryable() bool {
+	return e.Status == StatusFailed || e.Status == StatusDead
+}
+
+// WorkerStatus — состояние outbox-воркера инстанса для readiness
+type WorkerStatus struct {
+	WorkerID       string
+	Active         bool // отправляет события: лидер или выборы выключены
+	LeaderElection bool
+}
@@ -0,0 +1,19 @@
+package outbox
+
+import (
+	"context"
+	"time"
+)
+
+// Repository — служебный доступ к outbox; отправкой занимается воркер со своим интерфейсом
+type Repository interface {
+	ListEvents(ctx context.Context, f ListFilter) ([]Event, error)
+	GetEvent(ctx context.Context, id int64) (Event, error)
+	// RetryEvent возвращает FAILED/DEAD событие в очередь с обнулённым счётчиком попыток
+	RetryEvent(ctx context.Context, id int64) (Event, error)
+	// RetryEvents делает то же для всех событий в статусе FAILED или DEAD, возвращает сколько
+	RetryEvents(ctx context.Context, status Status) (int64, error)
+	// ArchiveSent переносит (или удаляет, если archive == false) не больше batch
+	// SENT-событий старше olderThan, возвращает сколько обработано
+	ArchiveSent(ctx context.Context, olderThan time.Duration, batch int, archive bool) (int64, error)
+}
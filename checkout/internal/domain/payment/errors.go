@@ -0,0 +1,9 @@
+package payment
+
+import "errors"
+
+var (
+	ErrNotFound       = errors.New("payment not found")
+	ErrDuplicateEvent = errors.New("event already applied")
+	ErrStatusConflict = errors.New("payment status changed concurrently")
+)
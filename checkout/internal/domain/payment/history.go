@@ -0,0 +1,14 @@
+package payment
+
+import "time"
+
+// Запись в истории статусов платежа
+type StatusChange struct {
+	PaymentID    string
+	From         *PaymentStatus // nil — создание платежа
+	To           PaymentStatus
+	Source       string
+	EventID      *string
+	ErrorDetails *string
+	OccurredAt   time.Time
+}
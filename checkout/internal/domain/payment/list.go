@@ -0,0 +1,27 @@
+package payment
+
+import "time"
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+)
+
+// Позиция в выдаче: последний отданный платёж (created_at, payment_id)
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Фильтр поиска платежей, пустые поля не участвуют.
+// Выдача отсортирована от новых к старым.
+type ListFilter struct {
+	MerchantID  string
+	Status      PaymentStatus
+	Currency    string
+	OrderID     string
+	CreatedFrom *time.Time // включительно
+	CreatedTo   *time.Time // не включительно
+	After       *Cursor
+	Limit       int
+}
@@ -13,6 +13,20 @@ const (
 	StatusProcessing PaymentStatus = "PROCESSING"
 	StatusSucceeded  PaymentStatus = "SUCCEEDED"
 	StatusFailed     PaymentStatus = "FAILED"
+	// двухстадийные платежи (capture_method=manual)
+	StatusAuthorized PaymentStatus = "AUTHORIZED"
+	StatusCapturing  PaymentStatus = "CAPTURING"
+	StatusVoiding    PaymentStatus = "VOIDING"
+	StatusVoided     PaymentStatus = "VOIDED"
+	// PSP требует действия покупателя (3-D Secure): платёж ждёт confirm
+	StatusRequiresAction PaymentStatus = "REQUIRES_ACTION"
+)
+
+type CaptureMethod string
+
+const (
+	CaptureAutomatic CaptureMethod = "automatic" // списание сразу после авторизации
+	CaptureManual    CaptureMethod = "manual"    // мерчант вызывает capture сам
 )
 
 type Payment struct {
@@ -26,4 +40,28 @@ type Payment struct {
 	PSPRef      *string
 	CreatedAt   time.Time
 	UpdatedAt   time.Time
+
+	CaptureMethod          CaptureMethod
+	AmountCaptured         *decimal.Decimal // nil, пока деньги не списаны
+	AuthorizationExpiresAt *time.Time       // только для AUTHORIZED
+	NextAction             *NextAction      // только для REQUIRES_ACTION
+}
+
+// Тип действия покупателя
+const NextActionRedirect = "redirect"
+
+// NextAction — что должен сделать покупатель, чтобы PSP продолжил авторизацию:
+// пройти challenge по RedirectURL, затем мерчант вызывает confirm с ChallengeID
+type NextAction struct {
+	Type        string `json:"type"`
+	RedirectURL string `json:"redirect_url"`
+	ChallengeID string `json:"challenge_id"`
+}
+
+// Сумма, доступная для возврата: списанная, а для старых платежей — вся
+func (p Payment) CapturedOrAmount() decimal.Decimal {
+	if p.AmountCaptured != nil {
+		return *p.AmountCaptured
+	}
+	return p.Amount
 }
@@ -10,4 +10,7 @@ type Repository interface {
 	InsertPayment(ctx context.Context, payment Payment, out event.Envelope) error
 	GetPaymentByID(ctx context.Context, id string) (Payment, error)
 	GetPaymentByUniqKeys(ctx context.Context, merchantID, orderID string) (Payment, error)
+	Transition(ctx context.Context, tr Transition) (Payment, error)
+	GetStatusHistory(ctx context.Context, paymentID string) ([]StatusChange, error)
+	ListPayments(ctx context.Context, filter ListFilter) ([]Payment, error)
 }
@@ -0,0 +1,127 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
+	"github.com/shopspring/decimal"
+)
+
+// Допустимые переходы статусов платежа
+var transitions = map[PaymentStatus][]PaymentStatus{
+	StatusPending:    {StatusProcessing, StatusRequiresAction, StatusAuthorized, StatusSucceeded, StatusFailed},
+	StatusProcessing: {StatusRequiresAction, StatusAuthorized, StatusSucceeded, StatusFailed},
+	// confirm уводит в PROCESSING; итог может прийти и без confirm (webhook PSP),
+	// брошенный challenge provider проваливает по таймауту
+	StatusRequiresAction: {StatusProcessing, StatusAuthorized, StatusSucceeded, StatusFailed},
+	StatusAuthorized:     {StatusCapturing, StatusVoiding},
+	StatusCapturing:      {StatusSucceeded, StatusAuthorized}, // отказ в capture возвращает в AUTHORIZED
+	StatusVoiding:        {StatusVoided, StatusAuthorized},
+	StatusSucceeded:      {},
+	StatusFailed:         {},
+	StatusVoided:         {},
+}
+
+func CanTransition(from, to PaymentStatus) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Финальный статус — из него переходов нет
+func (s PaymentStatus) IsFinal() bool {
+	next, ok := transitions[s]
+	return ok && len(next) == 0
+}
+
+// Reached — платёж в статусе to или уже прошёл дальше. Дальше — значит достижим
+// из to, не возвращаясь туда, откуда в to можно попасть снова: для CAPTURING это
+// SUCCEEDED, но не AUTHORIZED после отказа
+func (s PaymentStatus) Reached(to PaymentStatus) bool {
+	if s == to {
+		return true
+	}
+	seen := map[PaymentStatus]bool{to: true}
+	queue := []PaymentStatus{to}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range transitions[cur] {
+			if seen[next] || reachable(next, to) {
+				continue
+			}
+			if next == s {
+				return true
+			}
+			seen[next] = true
+			queue = append(queue, next)
+		}
+	}
+	return false
+}
+
+// reachable — есть ли путь из from в to
+func reachable(from, to PaymentStatus) bool {
+	seen := map[PaymentStatus]bool{from: true}
+	queue := []PaymentStatus{from}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for _, next := range transitions[cur] {
+			if next == to {
+				return true
+			}
+			if !seen[next] {
+				seen[next] = true
+				queue = append(queue, next)
+			}
+		}
+	}
+	return false
+}
+
+var ErrInvalidTransition = errors.New("invalid payment status transition")
+
+type TransitionError struct {
+	PaymentID string
+	From      PaymentStatus
+	To        PaymentStatus
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("payment %s: transition %s -> %s not allowed", e.PaymentID, e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// Запрос на смену статуса. Единственный способ изменить статус платежа —
+// Repository.Transition, который проверяет переход по автомату и
+// обновляет строку только если текущий статус равен From.
+type Transition struct {
+	PaymentID string
+	From      PaymentStatus // ожидаемый текущий статус, пусто — текущий из БД
+	To        PaymentStatus
+	PSPRef    *string
+	EventID   string // ключ дедупликации источника, может быть пустым
+	EventType string // источник изменения: событие, http, admin
+	Reason    string // детали ошибки для истории, может быть пустым
+
+	AmountCaptured         *decimal.Decimal // для SUCCEEDED; nil — вся сумма платежа
+	AuthorizationExpiresAt *time.Time       // для AUTHORIZED
+	NextAction             *NextAction      // для REQUIRES_ACTION
+	Out                    *event.Envelope  // событие в outbox в той же транзакции
+}
+
+func ValidateTransition(paymentID string, from, to PaymentStatus) error {
+	if !CanTransition(from, to) {
+		return &TransitionError{PaymentID: paymentID, From: from, To: to}
+	}
+	return nil
+}
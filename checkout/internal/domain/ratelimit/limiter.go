@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit — token bucket: Rate токенов в секунду, не больше Burst в запасе
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Decision — итог списания токена и данные для заголовков RateLimit-*
+type Decision struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	RetryAfter time.Duration // через сколько появится токен, если Allowed == false
+	Reset      time.Duration // через сколько бакет заполнится полностью
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, key string, l Limit) (Decision, error)
+}
+
+// Override — индивидуальный лимит мерчанта из БД, пустой Route — все ручки
+type Override struct {
+	MerchantID string
+	Route      string
+	Limit
+}
+
+// OverrideSource отдаёт все индивидуальные лимиты мерчантов разом
+type OverrideSource interface {
+	ListRateLimitOverrides(ctx context.Context) ([]Override, error)
+}
+
+// NewDecision считает решение по остатку токенов после попытки списания
+func NewDecision(l Limit, tokens float64, allowed bool) Decision {
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     l.Burst,
+		Remaining: int(math.Floor(tokens)),
+		Reset:     seconds((float64(l.Burst) - tokens) / l.Rate),
+	}
+	if !allowed {
+		d.RetryAfter = seconds((1 - tokens) / l.Rate)
+	}
+	return d
+}
+
+func seconds(s float64) time.Duration {
+	if s <= 0 {
+		return 0
+	}
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,10 @@
+package refund
+
+import "errors"
+
+var (
+	ErrNotFound             = errors.New("refund not found")
+	ErrExceedsRefundable    = errors.New("refund amount exceeds refundable amount")
+	ErrPaymentNotRefundable = errors.New("payment is not refundable")
+	ErrStatusConflict       = errors.New("refund status changed concurrently")
+)
@@ -0,0 +1,40 @@
+package refund
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type Status string
+
+const (
+	StatusPending   Status = "PENDING"
+	StatusSucceeded Status = "SUCCEEDED"
+	StatusFailed    Status = "FAILED"
+)
+
+type Refund struct {
+	ID             string
+	PaymentID      string
+	MerchantID     string
+	Amount         decimal.Decimal
+	Currency       string
+	Reason         string
+	Status         Status
+	PSPRef         *string
+	FailureReason  *string
+	IdempotencyKey string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+// Остаток, который ещё можно вернуть: списанная сумма платежа минус
+// возвраты в статусах PENDING и SUCCEEDED
+func Remaining(paid, refunded decimal.Decimal) decimal.Decimal {
+	rest := paid.Sub(refunded)
+	if rest.IsNegative() {
+		return decimal.Zero
+	}
+	return rest
+}
@@ -0,0 +1,18 @@
+package refund
+
+import (
+	"context"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
+	"github.com/shopspring/decimal"
+)
+
+type Repository interface {
+	// InsertRefund под блокировкой платежа проверяет остаток и вместе
+	// с возвратом пишет событие в outbox
+	InsertRefund(ctx context.Context, refund Refund, out event.Envelope) error
+	GetRefundByID(ctx context.Context, id string) (Refund, error)
+	GetRefundByIdemKey(ctx context.Context, paymentID, idemKey string) (Refund, error)
+	GetRefundedAmount(ctx context.Context, paymentID string) (decimal.Decimal, error)
+	TransitionRefund(ctx context.Context, tr Transition) (Refund, error)
+}
@@ -0,0 +1,56 @@
+package refund
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Допустимые переходы статусов возврата
+var transitions = map[Status][]Status{
+	StatusPending:   {StatusSucceeded, StatusFailed},
+	StatusSucceeded: {},
+	StatusFailed:    {},
+}
+
+func CanTransition(from, to Status) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+var ErrInvalidTransition = errors.New("invalid refund status transition")
+
+type TransitionError struct {
+	RefundID string
+	From     Status
+	To       Status
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("refund %s: transition %s -> %s not allowed", e.RefundID, e.From, e.To)
+}
+
+func (e *TransitionError) Is(target error) bool {
+	return target == ErrInvalidTransition
+}
+
+// Запрос на смену статуса возврата, аналог payment.Transition
+type Transition struct {
+	RefundID  string
+	PaymentID string
+	To        Status
+	PSPRef    *string
+	EventID   string
+	EventType string
+	Reason    string
+}
+
+func ValidateTransition(refundID string, from, to Status) error {
+	if !CanTransition(from, to) {
+		return &TransitionError{RefundID: refundID, From: from, To: to}
+	}
+	return nil
+}
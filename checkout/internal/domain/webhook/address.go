@@ -0,0 +1,29 @@
+package webhook
+
+import (
+	"errors"
+	"net/netip"
+)
+
+var ErrPrivateAddress = errors.New("webhook endpoint resolves to a non-public address")
+
+// сети, которые IsPrivate не покрывает: "эта" сеть и адреса провайдера (CGNAT)
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// PublicAddr — адрес в интернете: не loopback, не приватная сеть, не link-local
+// (там метаданные облака) и не служебный. Уведомления уходят только на такие
+func PublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsValid() || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublic {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,12 @@
+package webhook
+
+import "errors"
+
+var (
+	ErrEndpointNotFound = errors.New("webhook endpoint not found")
+	ErrDeliveryNotFound = errors.New("webhook delivery not found")
+	ErrDeliveryBusy     = errors.New("webhook delivery in progress")
+	ErrEndpointDisabled = errors.New("webhook endpoint disabled")
+	// ErrDeliveryLost — пока шла отправка, доставку забрал другой воркер или reset
+	ErrDeliveryLost = errors.New("webhook delivery no longer owned by worker")
+)
@@ -0,0 +1,25 @@
+package webhook
+
+import "time"
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+)
+
+// Cursor — позиция последней отданной доставки
+type Cursor struct {
+	CreatedAt time.Time
+	ID        string
+}
+
+// Фильтр поиска доставок мерчанта, пустые поля не участвуют.
+// Выдача отсортирована от новых к старым
+type DeliveryFilter struct {
+	MerchantID string
+	EndpointID string
+	EventID    string
+	Status     DeliveryStatus
+	After      *Cursor
+	Limit      int
+}
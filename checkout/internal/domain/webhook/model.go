@@ -0,0 +1,71 @@
+package webhook
+
+import "time"
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending    DeliveryStatus = "PENDING"
+	DeliveryInProgress DeliveryStatus = "IN_PROGRESS"
+	DeliveryDelivered  DeliveryStatus = "DELIVERED"
+	DeliveryFailed     DeliveryStatus = "FAILED" // ждёт следующей попытки
+	DeliveryDead       DeliveryStatus = "DEAD"   // попытки исчерпаны, только redeliver
+)
+
+// Endpoint — адрес мерчанта, куда уходят уведомления о смене статусов
+type Endpoint struct {
+	ID         string
+	MerchantID string
+	URL        string
+	Secret     string // ключ подписи, мерчант получает его при создании
+	Enabled    bool
+	CreatedAt  time.Time
+}
+
+// Delivery — одно уведомление на один endpoint, пишется в той же транзакции,
+// что и смена статуса, и доставляется воркером (как outbox)
+type Delivery struct {
+	ID             string
+	EndpointID     string
+	MerchantID     string
+	EventID        string
+	EventType      string
+	Payload        []byte
+	Status         DeliveryStatus
+	Attempt        int
+	NextAttemptAt  time.Time
+	LastStatusCode *int
+	LastError      *string
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+// Attempt — запись журнала доставки
+type Attempt struct {
+	DeliveryID string
+	Attempt    int
+	StatusCode *int
+	Error      *string
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
+
+// Job — доставка вместе с адресом и секретом endpoint'а, её забирает воркер
+type Job struct {
+	Delivery
+	AttemptBase int // попыток до последнего redeliver, от них считаются паузы и лимит
+	URL         string
+	Secret      string
+}
+
+// Result — итог попытки. NextAttemptAt == nil при неудаче — попытки исчерпаны
+type Result struct {
+	DeliveryID    string
+	Attempt       int
+	StatusCode    *int
+	Error         *string
+	Duration      time.Duration
+	Delivered     bool
+	NextAttemptAt *time.Time
+}
@@ -0,0 +1,85 @@
+package webhook
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/refund"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/currency"
+	"github.com/google/uuid"
+)
+
+// Notification — тело уведомления, одно на все endpoint'ы мерчанта
+type Notification struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"` // payment.succeeded, refund.failed, ...
+	MerchantID string          `json:"merchant_id"`
+	CreatedAt  string          `json:"created_at"`
+	Data       json.RawMessage `json:"data"`
+}
+
+type paymentData struct {
+	PaymentID      string  `json:"payment_id"`
+	OrderID        string  `json:"order_id"`
+	Amount         string  `json:"amount"`
+	Currency       string  `json:"currency"`
+	Status         string  `json:"status"`
+	PSPRef         *string `json:"psp_reference"`
+	CaptureMethod  string  `json:"capture_method"`
+	AmountCaptured *string `json:"amount_captured,omitempty"`
+	UpdatedAt      string  `json:"updated_at"`
+
+	NextAction *payment.NextAction `json:"next_action,omitempty"`
+}
+
+type refundData struct {
+	RefundID      string  `json:"refund_id"`
+	PaymentID     string  `json:"payment_id"`
+	Amount        string  `json:"amount"`
+	Currency      string  `json:"currency"`
+	Status        string  `json:"status"`
+	FailureReason *string `json:"failure_reason,omitempty"`
+	UpdatedAt     string  `json:"updated_at"`
+}
+
+func NewPaymentNotification(p payment.Payment) (Notification, error) {
+	data := paymentData{
+		PaymentID: p.ID, OrderID: p.OrderID,
+		Amount: currency.Format(p.Amount, p.Currency), Currency: p.Currency,
+		Status: string(p.Status), PSPRef: p.PSPRef,
+		CaptureMethod: string(p.CaptureMethod),
+		UpdatedAt:     p.UpdatedAt.UTC().Format(time.RFC3339),
+		NextAction:    p.NextAction,
+	}
+	if p.AmountCaptured != nil {
+		captured := currency.Format(*p.AmountCaptured, p.Currency)
+		data.AmountCaptured = &captured
+	}
+	return newNotification("payment."+strings.ToLower(string(p.Status)), p.MerchantID, data)
+}
+
+func NewRefundNotification(r refund.Refund) (Notification, error) {
+	data := refundData{
+		RefundID: r.ID, PaymentID: r.PaymentID,
+		Amount: currency.Format(r.Amount, r.Currency), Currency: r.Currency,
+		Status: string(r.Status), FailureReason: r.FailureReason,
+		UpdatedAt: r.UpdatedAt.UTC().Format(time.RFC3339),
+	}
+	return newNotification("refund."+strings.ToLower(string(r.Status)), r.MerchantID, data)
+}
+
+func newNotification(typ, merchantID string, data any) (Notification, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return Notification{}, err
+	}
+	return Notification{
+		ID:         "evt_" + uuid.NewString(),
+		Type:       typ,
+		MerchantID: merchantID,
+		CreatedAt:  time.Now().UTC().Format(time.RFC3339),
+		Data:       raw,
+	}, nil
+}
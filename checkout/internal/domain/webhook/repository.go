@@ -0,0 +1,17 @@
+package webhook
+
+import "context"
+
+type Repository interface {
+	InsertEndpoint(ctx context.Context, e Endpoint) (Endpoint, error)
+	ListEndpoints(ctx context.Context, merchantID string) ([]Endpoint, error)
+	// DisableEndpoint также снимает с очереди его неотправленные доставки
+	DisableEndpoint(ctx context.Context, merchantID, endpointID string) error
+	GetDelivery(ctx context.Context, merchantID, deliveryID string) (Delivery, error)
+	ListDeliveries(ctx context.Context, f DeliveryFilter) ([]Delivery, error)
+	ListAttempts(ctx context.Context, deliveryID string) ([]Attempt, error)
+	// Redeliver ставит доставку в очередь заново: номера попыток продолжаются,
+	// паузы и лимит попыток считаются с начала,
+	// ErrEndpointDisabled — endpoint отключён
+	Redeliver(ctx context.Context, merchantID, deliveryID string) (Delivery, error)
+}
@@ -0,0 +1,66 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SignatureHeader: "t=<unix>,v1=<hex(HMAC-SHA256(secret, t + "." + body))>"
+const SignatureHeader = "X-Webhook-Signature"
+
+func NewSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Sign формирует значение заголовка подписи
+func Sign(secret string, ts time.Time, payload []byte) string {
+	unix := strconv.FormatInt(ts.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", unix, hex.EncodeToString(mac(secret, unix, payload)))
+}
+
+// Verify — проверка на стороне получателя, tolerance ограничивает возраст подписи
+func Verify(secret, header string, payload []byte, tolerance time.Duration) error {
+	var unix, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			unix = v
+		case "v1":
+			sig = v
+		}
+	}
+
+	ts, err := strconv.ParseInt(unix, 10, 64)
+	if err != nil {
+		return errors.New("invalid signature timestamp")
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > tolerance || age < -tolerance {
+		return errors.New("signature timestamp outside tolerance")
+	}
+
+	got, err := hex.DecodeString(sig)
+	if err != nil || !hmac.Equal(got, mac(secret, unix, payload)) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func mac(secret, unix string, payload []byte) []byte {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write([]byte(unix + "."))
+	m.Write(payload)
+	return m.Sum(nil)
+}
@@ -0,0 +1,88 @@
+package authexpiry
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/events"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+)
+
+type Repository interface {
+	ListExpiredAuthorizations(ctx context.Context, limit, maxAttempts int, retryAfter time.Duration) ([]payment.Payment, error)
+	Transition(ctx context.Context, tr payment.Transition) (payment.Payment, error)
+}
+
+// источник перехода в истории статусов: по нему считаются попытки отмены
+const eventExpired = "authorization.expired"
+
+// Worker отменяет авторизации, которые мерчант так и не списал
+type Worker struct {
+	repo Repository
+	cfg  config.Capture
+}
+
+func New(cfg config.Capture, repo Repository) *Worker {
+	return &Worker{
+		cfg:  cfg,
+		repo: repo,
+	}
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.ExpiryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			runCtx, cancel := context.WithTimeout(ctx, w.cfg.ExpiryTimeout)
+
+			w.VoidExpired(runCtx)
+
+			cancel()
+		case <-ctx.Done():
+			log.Println("Authorization expiry worker closed...")
+			return
+		}
+	}
+}
+
+func (w *Worker) VoidExpired(ctx context.Context) {
+	pays, err := w.repo.ListExpiredAuthorizations(ctx, w.cfg.ExpiryBatchSize, w.cfg.ExpiryMaxAttempts,
+		w.cfg.ExpiryRetryAfter)
+	if err != nil {
+		log.Printf("authexpiry: error list expired authorizations:%v", err)
+		return
+	}
+
+	for _, pay := range pays {
+		env, err := events.NewPaymentVoidRequestedEvent(pay, events.VoidReasonExpired)
+		if err != nil {
+			log.Printf("authexpiry: can't create void event payment_id=%s:%v", pay.ID, err)
+			continue
+		}
+
+		_, err = w.repo.Transition(ctx, payment.Transition{
+			PaymentID: pay.ID,
+			From:      payment.StatusAuthorized,
+			To:        payment.StatusVoiding,
+			EventType: eventExpired,
+			Reason:    "authorization expired",
+			Out:       &env,
+		})
+		if err != nil {
+			// мерчант успел сделать capture/void — это нормально
+			if errors.Is(err, payment.ErrStatusConflict) {
+				continue
+			}
+			log.Printf("authexpiry: error void payment_id=%s:%v", pay.ID, err)
+			continue
+		}
+
+		log.Printf("authexpiry: authorization expired, void requested payment_id=%s", pay.ID)
+	}
+}
@@ -0,0 +1,57 @@
+package authexpiry
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+)
+
+// fakeRepo отдаёт заданные платежи и запоминает переходы
+type fakeRepo struct {
+	pays        []payment.Payment
+	conflict    map[string]bool
+	maxAttempts int
+	retryAfter  time.Duration
+	transitions []payment.Transition
+}
+
+func (r *fakeRepo) ListExpiredAuthorizations(ctx context.Context, limit, maxAttempts int,
+	retryAfter time.Duration) ([]payment.Payment, error) {
+	r.maxAttempts, r.retryAfter = maxAttempts, retryAfter
+	return r.pays, nil
+}
+
+func (r *fakeRepo) Transition(ctx context.Context, tr payment.Transition) (payment.Payment, error) {
+	if r.conflict[tr.PaymentID] {
+		return payment.Payment{}, payment.ErrStatusConflict
+	}
+	r.transitions = append(r.transitions, tr)
+	return payment.Payment{ID: tr.PaymentID, Status: tr.To}, nil
+}
+
+func TestVoidExpired(t *testing.T) {
+	repo := &fakeRepo{
+		pays: []payment.Payment{
+			{ID: "pay_1", MerchantID: "m_1", Status: payment.StatusAuthorized, CaptureMethod: payment.CaptureManual},
+			{ID: "pay_2", MerchantID: "m_1", Status: payment.StatusAuthorized, CaptureMethod: payment.CaptureManual},
+		},
+		conflict: map[string]bool{"pay_2": true}, // мерчант успел сделать capture
+	}
+	cfg := config.Capture{ExpiryBatchSize: 10, ExpiryMaxAttempts: 5, ExpiryRetryAfter: 10 * time.Minute}
+	New(cfg, repo).VoidExpired(context.Background())
+
+	// лимит попыток и пауза после void_failed — в выборке
+	if repo.maxAttempts != 5 || repo.retryAfter != 10*time.Minute {
+		t.Fatalf("retry limits not passed: %d %s", repo.maxAttempts, repo.retryAfter)
+	}
+	if len(repo.transitions) != 1 {
+		t.Fatalf("expected one void, got %d", len(repo.transitions))
+	}
+	tr := repo.transitions[0]
+	if tr.PaymentID != "pay_1" || tr.To != payment.StatusVoiding || tr.EventType != eventExpired || tr.Out == nil {
+		t.Fatalf("unexpected transition %+v", tr)
+	}
+}
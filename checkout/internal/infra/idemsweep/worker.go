@@ -0,0 +1,62 @@
+package idemsweep
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+)
+
+// Sweeper — хранилище ключей без собственного TTL (Postgres, память)
+type Sweeper interface {
+	Sweep(ctx context.Context, batch int) (int64, error)
+}
+
+// Worker периодически удаляет истёкшие ключи идемпотентности
+type Worker struct {
+	store Sweeper
+	cfg   config.Idempotency
+}
+
+func New(cfg config.Idempotency, store Sweeper) *Worker {
+	return &Worker{store: store, cfg: cfg}
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.sweep(ctx)
+		case <-ctx.Done():
+			log.Println("Idempotency sweeper closed...")
+			return
+		}
+	}
+}
+
+// удаляем пачками, пока есть что удалять: короткие транзакции не держат блокировки
+func (w *Worker) sweep(ctx context.Context) {
+	var total int64
+	for {
+		sweepCtx, cancel := context.WithTimeout(ctx, w.cfg.SweepTimeout)
+		n, err := w.store.Sweep(sweepCtx, w.cfg.SweepBatchSize)
+		cancel()
+
+		if err != nil {
+			log.Printf("idempotency sweeper: error while sweep:%v", err)
+			return
+		}
+		total += n
+		if n < int64(w.cfg.SweepBatchSize) {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("idempotency sweeper: removed %d expired keys", total)
+	}
+}
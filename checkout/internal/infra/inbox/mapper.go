@@ -0,0 +1,142 @@
+package inbox
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/events"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/refund"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
+	"github.com/shopspring/decimal"
+)
+
+// event -> domain. authTTL — срок жизни авторизации для capture_method=manual
+func toTransition(env event.Envelope, authTTL time.Duration) (payment.Transition, error) {
+	switch env.Type {
+	case event.PaymentProcessedEvent:
+		evn, err := events.ParsePaymentProcessed(env.Payload)
+		if err != nil {
+			return payment.Transition{}, err
+		}
+		status, err := evn.PaymentStatus()
+		if err != nil {
+			return payment.Transition{}, err
+		}
+		tr := payment.Transition{
+			EventID:   eventID(evn.EventID, env),
+			EventType: string(env.Type),
+			PaymentID: evn.PaymentID,
+			To:        status,
+			PSPRef:    evn.PSPRef,
+			Reason:    declineReason(evn),
+		}
+		switch status {
+		case payment.StatusAuthorized:
+			expiresAt := time.Now().Add(authTTL)
+			tr.AuthorizationExpiresAt = &expiresAt
+		case payment.StatusRequiresAction:
+			tr.NextAction = evn.NextAction
+		}
+		return tr, nil
+	case event.PaymentFailedEvent:
+		evn, err := events.ParsePaymentFailed(env.Payload)
+		if err != nil {
+			return payment.Transition{}, err
+		}
+		return payment.Transition{
+			EventID:   eventID(evn.EventID, env),
+			EventType: string(env.Type),
+			PaymentID: evn.PaymentID,
+			To:        payment.StatusFailed,
+			Reason:    evn.ErrorDetails,
+		}, nil
+	case event.PaymentCapturedEvent, event.PaymentCaptureFailedEvent,
+		event.PaymentVoidedEvent, event.PaymentVoidFailedEvent:
+		evn, err := events.ParsePaymentOperationResult(env.Payload)
+		if err != nil {
+			return payment.Transition{}, err
+		}
+		tr := payment.Transition{
+			EventID:   eventID(evn.EventID, env),
+			EventType: string(env.Type),
+			PaymentID: evn.PaymentID,
+			PSPRef:    evn.PSPRef,
+			Reason:    evn.ErrorDetails,
+		}
+		switch env.Type {
+		case event.PaymentCapturedEvent:
+			amount, err := decimal.NewFromString(evn.Amount)
+			if err != nil {
+				return payment.Transition{}, fmt.Errorf("invalid amount %q", evn.Amount)
+			}
+			tr.To = payment.StatusSucceeded
+			tr.AmountCaptured = &amount
+		case event.PaymentVoidedEvent:
+			tr.To = payment.StatusVoided
+		default:
+			// отказ в capture/void: авторизация остаётся в силе
+			tr.To = payment.StatusAuthorized
+		}
+		return tr, nil
+	default:
+		return payment.Transition{}, fmt.Errorf("unsupported event type %q", env.Type)
+	}
+}
+
+// event_id из payload, для старых событий — координаты сообщения в kafka
+func eventID(id string, env event.Envelope) string {
+	if id != "" {
+		return id
+	}
+	return env.Headers["x-message-id"]
+}
+
+func toRefundTransition(env event.Envelope) (refund.Transition, error) {
+	switch env.Type {
+	case event.RefundProcessedEvent:
+		evn, err := events.ParseRefundProcessed(env.Payload)
+		if err != nil {
+			return refund.Transition{}, err
+		}
+		status, err := evn.RefundStatus()
+		if err != nil {
+			return refund.Transition{}, err
+		}
+		var reason string
+		if evn.Status == events.PSPRefundStatusDeclined {
+			reason = "declined by psp"
+		}
+		return refund.Transition{
+			EventID:   eventID(evn.EventID, env),
+			EventType: string(env.Type),
+			RefundID:  evn.RefundID,
+			PaymentID: evn.PaymentID,
+			To:        status,
+			PSPRef:    evn.PSPRef,
+			Reason:    reason,
+		}, nil
+	case event.RefundFailedEvent:
+		evn, err := events.ParseRefundFailed(env.Payload)
+		if err != nil {
+			return refund.Transition{}, err
+		}
+		return refund.Transition{
+			EventID:   eventID(evn.EventID, env),
+			EventType: string(env.Type),
+			RefundID:  evn.RefundID,
+			PaymentID: evn.PaymentID,
+			To:        refund.StatusFailed,
+			Reason:    evn.ErrorDetails,
+		}, nil
+	default:
+		return refund.Transition{}, fmt.Errorf("unsupported event type %q", env.Type)
+	}
+}
+
+func declineReason(evn events.PaymentProcessed) string {
+	if evn.Status == events.PSPStatusDeclined {
+		return "declined by psp"
+	}
+	return ""
+}
@@ -0,0 +1,137 @@
+package inbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/refund"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
+)
+
+var errPoisonEvent = errors.New("invalid event")
+
+type Consumer interface {
+	ConsumeEvent(ctx context.Context) (event.Envelope, error)
+	FinalizeEvent(ctx context.Context) error
+}
+
+type Repository interface {
+	Transition(ctx context.Context, tr payment.Transition) (payment.Payment, error)
+	TransitionRefund(ctx context.Context, tr refund.Transition) (refund.Refund, error)
+}
+
+// Worker читает результаты от provider и переводит платежи и возвраты в финальный статус
+type Worker struct {
+	con     Consumer
+	repo    Repository
+	cfg     config.Inbox
+	authTTL time.Duration
+}
+
+func New(cfg config.Inbox, capture config.Capture, con Consumer, repo Repository) *Worker {
+	return &Worker{
+		cfg:     cfg,
+		con:     con,
+		repo:    repo,
+		authTTL: capture.AuthorizationTTL,
+	}
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	log.Println("inbox: worker started")
+	defer log.Println("Inbox worker closed...")
+
+	for {
+		env, err := w.con.ConsumeEvent(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			log.Printf("inbox: error while consume event:%v", err)
+			continue
+		}
+
+		if !w.handleWithRetry(ctx, env) {
+			return
+		}
+
+		if err := w.con.FinalizeEvent(ctx); err != nil {
+			log.Printf("inbox: error while finalize event key=%s:%v", env.Key, err)
+			if ctx.Err() != nil {
+				return
+			}
+		}
+	}
+}
+
+// Повторяет обработку, пока ошибка временная. false — контекст отменён.
+func (w *Worker) handleWithRetry(ctx context.Context, env event.Envelope) bool {
+	for {
+		handleCtx, cancel := context.WithTimeout(ctx, w.cfg.HandleTimeout)
+		err := w.Handle(handleCtx, env)
+		cancel()
+
+		if err == nil {
+			return true
+		}
+
+		var (
+			trErr    *payment.TransitionError
+			refTrErr *refund.TransitionError
+		)
+		switch {
+		case errors.Is(err, payment.ErrDuplicateEvent):
+			log.Printf("inbox: duplicate event skipped key=%s", env.Key)
+			return true
+		case errors.As(err, &trErr) && trErr.From == trErr.To:
+			log.Printf("inbox: payment_id=%s already %s, event skipped", trErr.PaymentID, trErr.To)
+			return true
+		case errors.As(err, &refTrErr) && refTrErr.From == refTrErr.To:
+			log.Printf("inbox: refund_id=%s already %s, event skipped", refTrErr.RefundID, refTrErr.To)
+			return true
+		case errors.Is(err, payment.ErrInvalidTransition), errors.Is(err, refund.ErrInvalidTransition):
+			log.Printf("inbox: out-of-order event rejected type=%s:%v", env.Type, err)
+			return true
+		case errors.Is(err, payment.ErrNotFound), errors.Is(err, refund.ErrNotFound),
+			errors.Is(err, errPoisonEvent):
+			log.Printf("inbox: event dropped key=%s:%v", env.Key, err)
+			return true
+		}
+
+		log.Printf("inbox: error while handle event key=%s, retry in %s:%v", env.Key, w.cfg.RetryInterval, err)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-time.After(w.cfg.RetryInterval):
+		}
+	}
+}
+
+func (w *Worker) Handle(ctx context.Context, env event.Envelope) error {
+	switch env.Type {
+	case event.RefundProcessedEvent, event.RefundFailedEvent:
+		tr, err := toRefundTransition(env)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errPoisonEvent, err)
+		}
+		if _, err := w.repo.TransitionRefund(ctx, tr); err != nil {
+			return err
+		}
+		log.Printf("inbox: refund_id=%s moved to %s", tr.RefundID, tr.To)
+	default:
+		tr, err := toTransition(env, w.authTTL)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errPoisonEvent, err)
+		}
+		if _, err := w.repo.Transition(ctx, tr); err != nil {
+			return err
+		}
+		log.Printf("inbox: payment_id=%s moved to %s", tr.PaymentID, tr.To)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+package kafka
+
+import (
+	"context"
+	"log"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
+	"github.com/segmentio/kafka-go"
+)
+
+type Consumer struct {
+	r   *kafka.Reader
+	cfg config.KafkaConsumer
+	msg *kafka.Message // прочитано, но ещё не закоммичено
+}
+
+func NewConsumer(cfg config.Kafka) *Consumer {
+	return &Consumer{
+		r: kafka.NewReader(kafka.ReaderConfig{
+			Brokers: cfg.Brokers,
+			GroupID: cfg.Consumer.GroupID,
+			GroupTopics: []string{
+				cfg.Consumer.PaymentsProcessedTopic,
+				cfg.Consumer.PaymentsFailedTopic,
+				cfg.Consumer.RefundsProcessedTopic,
+				cfg.Consumer.RefundsFailedTopic,
+			},
+		}),
+		cfg: cfg.Consumer,
+	}
+}
+
+func (c *Consumer) Close() {
+	if err := c.r.Close(); err != nil {
+		log.Printf("kafka: error while closing consumer:%v", err)
+		return
+	}
+	log.Println("Kafka consumer closed...")
+}
+
+// Функция блокирует поток пока не прочитано новое сообщение или отменился контекст.
+// Сообщение коммитится только через FinalizeEvent, незакоммиченное придёт повторно.
+func (c *Consumer) ConsumeEvent(ctx context.Context) (event.Envelope, error) {
+	msg, err := c.r.FetchMessage(ctx)
+	if err != nil {
+		return event.Envelope{}, err
+	}
+	c.msg = &msg
+
+	return c.toEvent(msg), nil
+}
+
+func (c *Consumer) FinalizeEvent(ctx context.Context) error {
+	if c.msg == nil {
+		return nil
+	}
+	if err := c.r.CommitMessages(ctx, *c.msg); err != nil {
+		return err
+	}
+	c.msg = nil
+	return nil
+}
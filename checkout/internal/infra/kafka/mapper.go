@@ -1,12 +1,19 @@
 package kafka
 
 import (
+	"fmt"
+
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
 	"github.com/segmentio/kafka-go"
 )
 
-func (p *Producer) toKafkaMessage(evt event.Envelope) kafka.Message {
+// toKafkaMessage: событие без топика — ошибка, а не запись в пустой топик
+func (p *Producer) toKafkaMessage(evt event.Envelope) (kafka.Message, error) {
+	if evt.Headers == nil {
+		evt.Headers = make(map[string]string, 2)
+	}
 	evt.Headers["client-id"] = p.cfg.ClientID
+	evt.Headers[event.TypeHeader] = string(evt.Type)
 	headers := make([]kafka.Header, 0, len(evt.Headers))
 	for k, v := range evt.Headers {
 		headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
@@ -17,8 +24,15 @@ func (p *Producer) toKafkaMessage(evt event.Envelope) kafka.Message {
 
 	var topic string
 	switch evt.Type {
-	case event.PaymentCreatedEvent:
+	case event.PaymentCreatedEvent, event.PaymentCaptureRequestedEvent, event.PaymentVoidRequestedEvent,
+		event.PaymentConfirmRequestedEvent:
+		// один топик: команды по платежу читаются provider'ом по порядку
 		topic = p.cfg.PaymentsTopic
+	case event.RefundCreatedEvent:
+		topic = p.cfg.RefundsTopic
+	}
+	if topic == "" {
+		return kafka.Message{}, fmt.Errorf("no topic for event type %q", evt.Type)
 	}
 
 	return kafka.Message{
@@ -26,5 +40,36 @@ func (p *Producer) toKafkaMessage(evt event.Envelope) kafka.Message {
 		Key:     []byte(evt.Key),
 		Value:   evt.Payload,
 		Headers: headers,
+	}, nil
+}
+
+func (c *Consumer) toEvent(msg kafka.Message) event.Envelope {
+	headers := make(map[string]string, len(msg.Headers)+1)
+	for _, h := range msg.Headers {
+		headers[string(h.Key)] = string(h.Value)
+	}
+	// координаты сообщения — запасной ключ дедупликации
+	headers["x-message-id"] = fmt.Sprintf("%s/%d/%d", msg.Topic, msg.Partition, msg.Offset)
+
+	var evnType event.EnvelopeType
+	switch msg.Topic {
+	case c.cfg.PaymentsProcessedTopic:
+		evnType = event.PaymentProcessedEvent
+	case c.cfg.PaymentsFailedTopic:
+		evnType = event.PaymentFailedEvent
+	case c.cfg.RefundsProcessedTopic:
+		evnType = event.RefundProcessedEvent
+	case c.cfg.RefundsFailedTopic:
+		evnType = event.RefundFailedEvent
+	}
+	if t, _ := event.StringToType(headers[event.TypeHeader]); t != "" {
+		evnType = t
+	}
+
+	return event.Envelope{
+		Type:    evnType,
+		Key:     string(msg.Key),
+		Payload: msg.Value,
+		Headers: headers,
 	}
 }
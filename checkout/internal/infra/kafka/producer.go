@@ -36,13 +36,16 @@ func NewProducer(cfg config.Kafka) *Producer {
 
 func (p *Producer) Close() {
 	if err := p.w.Close(); err != nil {
-		log.Printf("kafka: error while closing producer:%w", err)
+		log.Printf("kafka: error while closing producer:%v", err)
 		return
 	}
 	log.Println("Kafka producer closed...")
 }
 
 func (p *Producer) Publish(ctx context.Context, event event.Envelope) error {
-	msg := p.toKafkaMessage(event)
+	msg, err := p.toKafkaMessage(event)
+	if err != nil {
+		return err
+	}
 	return p.w.WriteMessages(ctx, msg)
 }
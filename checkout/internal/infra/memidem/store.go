@@ -0,0 +1,127 @@
+package memidem
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/idempotency"
+)
+
+type entry struct {
+	rec       idempotency.Record
+	expiresAt time.Time
+}
+
+// Store — хранилище ключей в памяти процесса: для локального запуска и тестов
+// обработчиков без Redis. Ключи не переживают рестарт и не видны другим инстансам
+type Store struct {
+	mu      sync.Mutex
+	entries map[string]entry
+	now     func() time.Time
+}
+
+func New() *Store {
+	return &Store{entries: make(map[string]entry), now: time.Now}
+}
+
+// Ping: память доступна всегда
+func (s *Store) Ping() error { return nil }
+
+func (s *Store) Reserve(ctx context.Context, merchantID, key, bodyHash, owner string, lease, ttl time.Duration) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	k := s.key(merchantID, key)
+	if e, ok := s.entries[k]; ok && now.Before(e.expiresAt) && !e.rec.CanTakeOver(bodyHash, now) {
+		return false, nil
+	}
+
+	s.entries[k] = entry{
+		rec: idempotency.Record{
+			State:      idempotency.StateInProgress,
+			BodyHash:   bodyHash,
+			UpdatedAt:  now.Unix(),
+			Owner:      owner,
+			LeaseUntil: now.Add(lease).UnixMilli(),
+		},
+		expiresAt: now.Add(ttl),
+	}
+	return true, nil
+}
+
+func (s *Store) Finalize(ctx context.Context, merchantID, key, owner, bodyHash string, httpCode int, paymentID string,
+	resp map[string]any, ttl time.Duration) error {
+	return s.complete(merchantID, key, idempotency.Record{
+		State:     idempotency.StateDone,
+		BodyHash:  bodyHash,
+		PaymentID: paymentID,
+		HTTPCode:  httpCode,
+		Response:  resp,
+		Owner:     owner,
+	}, ttl)
+}
+
+func (s *Store) Fail(ctx context.Context, merchantID, key, owner, bodyHash string, retryable bool, httpCode int,
+	resp map[string]any, ttl time.Duration) error {
+	return s.complete(merchantID, key, idempotency.Record{
+		State:     idempotency.StateError,
+		BodyHash:  bodyHash,
+		HTTPCode:  httpCode,
+		Response:  resp,
+		Owner:     owner,
+		Retryable: retryable,
+	}, ttl)
+}
+
+// complete пишет итог, только пока ключ у того же владельца или уже истёк
+func (s *Store) complete(merchantID, key string, rec idempotency.Record, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	k := s.key(merchantID, key)
+	if e, ok := s.entries[k]; ok && now.Before(e.expiresAt) && e.rec.Owner != rec.Owner {
+		return idempotency.ErrLeaseLost
+	}
+
+	rec.UpdatedAt = now.Unix()
+	s.entries[k] = entry{rec: rec, expiresAt: now.Add(ttl)}
+	return nil
+}
+
+func (s *Store) Load(ctx context.Context, merchantID, key string) (*idempotency.Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[s.key(merchantID, key)]
+	if !ok || !s.now().Before(e.expiresAt) {
+		return nil, nil
+	}
+	rec := e.rec
+	return &rec, nil
+}
+
+// Sweep удаляет истёкшие ключи, не больше batch за вызов
+func (s *Store) Sweep(ctx context.Context, batch int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var n int64
+	for k, e := range s.entries {
+		if n >= int64(batch) {
+			break
+		}
+		if !now.Before(e.expiresAt) {
+			delete(s.entries, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) key(merchantID, key string) string {
+	return merchantID + ":" + key
+}
@@ -0,0 +1,11 @@
+package memidem
+
+import (
+	"testing"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/idempotency/idemtest"
+)
+
+func TestStore(t *testing.T) {
+	idemtest.Run(t, New())
+}
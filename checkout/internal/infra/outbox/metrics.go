@@ -0,0 +1,13 @@
+package outbox
+
+import "expvar"
+
+// счётчики воркера, отдаются через expvar (/admin/v1/metrics)
+var metrics = expvar.NewMap("outbox")
+
+const (
+	metricPublished  = "published"
+	metricFailed     = "failed"
+	metricDead       = "dead"
+	metricMarkErrors = "mark_errors"
+)
@@ -2,37 +2,88 @@ package outbox
 
 import (
 	"context"
+	"errors"
 	"log"
+	"math/rand/v2"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/events"
-	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/outbox"
+	"github.com/google/uuid"
 )
 
 type Repository interface {
-	PickBatch(ctx context.Context, count int) (map[int64]event.Envelope, error)
+	// PickBatch отдаёт готовые к отправке события, не больше одного на key:
+	// следующее событие key не выдаётся, пока предыдущее не SENT. Взятые события
+	// помечаются workerID
+	PickBatch(ctx context.Context, count int, workerID string) ([]outbox.Message, error)
 	MarkSent(ctx context.Context, ids []int64) error
-	MarkFailed(ctx context.Context, ids []int64) error
-	ResetEvents(ctx context.Context) error
+	MarkFailed(ctx context.Context, failures []outbox.Failure) error
+	// ResetEvents забирает IN_PROGRESS-события воркеров без heartbeat дольше ownerTTL
+	// и собственные, не закрытые дольше reclaimAfter
+	ResetEvents(ctx context.Context, workerID string, ownerTTL, reclaimAfter time.Duration) ([]outbox.Message, error)
+	Heartbeat(ctx context.Context, workerID string, leader bool) error
+	PruneWorkers(ctx context.Context, olderThan time.Duration) (int64, error)
+	Deregister(ctx context.Context, workerID string) error
+}
+
+// Notifier будит воркер, когда в outbox появились события (Postgres LISTEN/NOTIFY)
+type Notifier interface {
+	Listen(ctx context.Context, wake chan<- struct{})
+}
+
+// Elector — выбор единственного активного воркера среди реплик (advisory-блокировка)
+type Elector interface {
+	TryLock(ctx context.Context) (bool, error)
+	Unlock(ctx context.Context)
 }
 
 type Worker struct {
-	repo Repository
-	pub  events.Publisher
-	cfg  config.Outbox
+	id       string
+	repo     Repository
+	pub      events.Publisher
+	notifier Notifier // nil — только опрос по PollInterval
+	elector  Elector  // nil — активны все реплики, их разводит SKIP LOCKED
+	active   atomic.Bool
+	cfg      config.Outbox
 }
 
-func New(cfg config.Outbox, pub events.Publisher, repo Repository) *Worker {
+func New(cfg config.Outbox, pub events.Publisher, repo Repository, notifier Notifier, elector Elector) *Worker {
+	id := cfg.WorkerID
+	if id == "" {
+		id = defaultWorkerID()
+	}
 	return &Worker{
-		cfg:  cfg,
-		pub:  pub,
-		repo: repo,
+		id:       id,
+		cfg:      cfg,
+		pub:      pub,
+		repo:     repo,
+		notifier: notifier,
+		elector:  elector,
 	}
 }
 
+// Status — для readiness: какой воркер этого инстанса и отправляет ли он события
+func (w *Worker) Status() outbox.WorkerStatus {
+	return outbox.WorkerStatus{WorkerID: w.id, Active: w.active.Load(), LeaderElection: w.elector != nil}
+}
+
 func (w *Worker) Run(ctx context.Context) {
+	// heartbeat до первой выборки: иначе соседи сочтут наши строки брошенными
+	w.heartbeat(ctx)
+
+	// heartbeat — своей горутиной: пока poll разбирает длинную очередь,
+	// соседи не должны счесть воркер упавшим и забрать его строки
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		w.runHeartbeat(ctx)
+	}()
+
 	tickerPoll := time.NewTicker(w.cfg.PollInterval)
 	tickerReset := time.NewTicker(w.cfg.ResetEventsInterval)
 	defer func() {
@@ -40,92 +91,258 @@ func (w *Worker) Run(ctx context.Context) {
 		tickerReset.Stop()
 	}()
 
+	// с NOTIFY опрос остаётся страховкой на потерянные уведомления
+	wake := make(chan struct{}, 1)
+	if w.notifier != nil {
+		go w.notifier.Listen(ctx, wake)
+	}
+
 	for {
 		select {
 		case <-tickerPoll.C:
-			pollCtx, cancel := context.WithTimeout(ctx, w.cfg.PollTimeout)
-
-			w.PollBatch(pollCtx)
-
-			cancel()
+			w.poll(ctx, wake)
+		case <-wake:
+			w.poll(ctx, wake)
 		case <-tickerReset.C:
+			if !w.active.Load() {
+				continue
+			}
 			ctxReset, cancel := context.WithTimeout(ctx, w.cfg.ResetEventsTimeout)
 
-			if err := w.repo.ResetEvents(ctxReset); err != nil {
-				log.Printf("worker: error while reset events:%v", err)
-			}
+			w.resetStuck(ctxReset)
 
 			cancel()
 		case <-ctx.Done():
+			// после последнего heartbeat, иначе он вернёт запись о воркере
+			<-heartbeatDone
+			w.stop()
 			log.Println("Outbox worker closed...")
 			return
 		}
 	}
 }
 
-func (w *Worker) PollBatch(ctx context.Context) {
-	envs, err := w.repo.PickBatch(ctx, w.cfg.BatchSize)
+func (w *Worker) runHeartbeat(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.heartbeat(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// heartbeat переизбирает лидера (если выборы включены) и отмечает воркер живым.
+// Активный воркер заодно удаляет записи давно упавших соседей
+func (w *Worker) heartbeat(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.HeartbeatInterval)
+	defer cancel()
+
+	active := true
+	if w.elector != nil {
+		locked, err := w.elector.TryLock(ctx)
+		if err != nil {
+			log.Printf("worker: leader election error:%v", err)
+		}
+		active = locked
+	}
+	if was := w.active.Swap(active); was != active {
+		log.Printf("worker: %s active=%t", w.id, active)
+	}
+
+	if err := w.repo.Heartbeat(ctx, w.id, active); err != nil {
+		log.Printf("worker: heartbeat error:%v", err)
+	}
+
+	if !active || w.cfg.WorkerRetention <= 0 {
+		return
+	}
+	n, err := w.repo.PruneWorkers(ctx, w.cfg.WorkerRetention)
 	if err != nil {
-		log.Printf("worker: error pick batch:%v", err)
+		log.Printf("worker: prune workers error:%v", err)
 		return
 	}
+	if n > 0 {
+		log.Printf("worker: pruned %d stale workers", n)
+	}
+}
 
-	if len(envs) == 0 {
-		return
+func (w *Worker) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	w.active.Store(false)
+	if w.elector != nil {
+		w.elector.Unlock(ctx)
+	}
+	if err := w.repo.Deregister(ctx, w.id); err != nil {
+		log.Printf("worker: deregister error:%v", err)
+	}
+}
+
+func defaultWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "checkout"
+	}
+	return host + "-" + uuid.NewString()[:8]
+}
+
+// poll выбирает очередь, пока она не опустеет: PickBatch отдаёт только
+// голову каждого key, следующее событие key станет доступно после отправки
+// текущего, а нового NOTIFY на него не будет. Не дольше PollInterval: остаток
+// разберёт следующий проход через wake, а Run успеет к сбросу и остановке
+func (w *Worker) poll(ctx context.Context, wake chan struct{}) {
+	deadline := time.Now().Add(w.cfg.PollInterval)
+	for ctx.Err() == nil && w.active.Load() {
+		pollCtx, cancel := context.WithTimeout(ctx, w.cfg.PollTimeout)
+		n := w.PollBatch(pollCtx)
+		cancel()
+
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+			return
+		}
+	}
+}
+
+// PollBatch отправляет одну пачку, возвращает сколько событий взято.
+// В пачке не больше одного события на key (см. Repository.PickBatch),
+// поэтому параллельная отправка не нарушает порядок внутри key
+func (w *Worker) PollBatch(ctx context.Context) int {
+	msgs, err := w.repo.PickBatch(ctx, w.cfg.BatchSize, w.id)
+	if err != nil {
+		log.Printf("worker: error pick batch:%v", err)
+		return 0
+	}
+
+	if len(msgs) == 0 {
+		return 0
 	}
 
 	var (
-		muSent   sync.Mutex
-		muFailed sync.Mutex
-		sent     = make([]int64, 0, len(envs))
-		failed   = make([]int64, 0, len(envs))
-		wg       sync.WaitGroup
+		mu     sync.Mutex
+		sent   = make([]int64, 0, len(msgs))
+		failed = make([]outbox.Failure, 0)
+		wg     sync.WaitGroup
 	)
 
 	semaphore := make(chan struct{}, w.cfg.MaxParallel)
 
-	wg.Add(len(envs))
-	for id, env := range envs {
-		go func(int64, event.Envelope) {
+	for _, msg := range msgs {
+		wg.Add(1)
+		go func(msg outbox.Message) {
+			defer wg.Done()
+
 			select {
 			case semaphore <- struct{}{}:
 				// заняли
 			case <-ctx.Done():
-				wg.Done()
 				return
 			}
+			defer func() { <-semaphore }() // освободить
 
-			defer func() {
-				<-semaphore // освободить
-				wg.Done()
-			}()
-
-			if err := w.pub.Publish(ctx, env); err != nil {
-				log.Printf("worker: kafka: publish failed key=%s, event_id=%d error:%v", env.Key, id, err)
-				muFailed.Lock()
-				failed = append(failed, id)
-				muFailed.Unlock()
+			err := msg.DecodeErr
+			if err == nil {
+				err = w.pub.Publish(ctx, msg.Envelope)
+			}
+			if err != nil {
+				log.Printf("worker: kafka: publish failed key=%s, event_id=%d attempt=%d error:%v",
+					msg.Envelope.Key, msg.ID, msg.Attempt+1, err)
+				mu.Lock()
+				failed = append(failed, w.failure(msg, err))
+				mu.Unlock()
 				return
 			}
-			muSent.Lock()
-			sent = append(sent, id)
-			muSent.Unlock()
-			log.Printf("worker: kafka: published key=%s, event_id=%d", env.Key, id)
-
-		}(id, env)
+			mu.Lock()
+			sent = append(sent, msg.ID)
+			mu.Unlock()
+			log.Printf("worker: kafka: published key=%s, event_id=%d", msg.Envelope.Key, msg.ID)
+		}(msg)
 	}
 
 	wg.Wait()
 
 	if len(sent) > 0 {
 		if err := w.repo.MarkSent(ctx, sent); err != nil {
+			metrics.Add(metricMarkErrors, 1)
 			log.Printf("worker: error update sent:%v", err)
+		} else {
+			metrics.Add(metricPublished, int64(len(sent)))
 		}
 	}
 
-	if len(failed) > 0 {
-		if err := w.repo.MarkFailed(ctx, failed); err != nil {
-			log.Printf("worker: error update failed:%v", err)
+	w.markFailed(ctx, failed)
+
+	return len(msgs)
+}
+
+// resetStuck засчитывает зависшим в IN_PROGRESS событиям неудачную попытку
+func (w *Worker) resetStuck(ctx context.Context) {
+	msgs, err := w.repo.ResetEvents(ctx, w.id, w.cfg.OwnerTTL, w.cfg.ReclaimAfter)
+	if err != nil {
+		log.Printf("worker: error while reset events:%v", err)
+		return
+	}
+
+	failed := make([]outbox.Failure, 0, len(msgs))
+	for _, msg := range msgs {
+		failed = append(failed, w.failure(msg, errors.New("publish result lost: stuck in progress")))
+	}
+	w.markFailed(ctx, failed)
+}
+
+func (w *Worker) markFailed(ctx context.Context, failed []outbox.Failure) {
+	if len(failed) == 0 {
+		return
+	}
+
+	if err := w.repo.MarkFailed(ctx, failed); err != nil {
+		metrics.Add(metricMarkErrors, 1)
+		log.Printf("worker: error update failed:%v", err)
+		return
+	}
+
+	for _, f := range failed {
+		if f.NextAttemptAt != nil {
+			metrics.Add(metricFailed, 1)
+			continue
 		}
+		metrics.Add(metricDead, 1)
+		log.Printf("worker: event_id=%d dead after %d attempts, last error:%s", f.ID, f.Attempt, f.Error)
+	}
+}
+
+// failure: без DecodeErr и пока не исчерпан MaxAttempts — повтор через backoff, иначе DEAD
+func (w *Worker) failure(msg outbox.Message, err error) outbox.Failure {
+	f := outbox.Failure{ID: msg.ID, Attempt: msg.Attempt + 1, Error: err.Error()}
+	if msg.DecodeErr == nil && (w.cfg.MaxAttempts <= 0 || f.Attempt < w.cfg.MaxAttempts) {
+		next := time.Now().Add(w.backoff(f.Attempt))
+		f.NextAttemptAt = &next
+	}
+	return f
+}
+
+// backoff: BackoffBase * 2^(attempt-1), не больше BackoffMax, минус случайная доля
+// BackoffJitter — события, упавшие одной пачкой, не повторяются одной пачкой
+func (w *Worker) backoff(attempt int) time.Duration {
+	d := w.cfg.BackoffBase
+	for i := 1; i < attempt && d < w.cfg.BackoffMax; i++ {
+		d *= 2
+	}
+	d = min(d, w.cfg.BackoffMax)
+	if w.cfg.BackoffJitter > 0 {
+		d -= time.Duration(rand.Float64() * min(w.cfg.BackoffJitter, 1) * float64(d))
 	}
+	return d
 }
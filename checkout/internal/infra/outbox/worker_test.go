@@ -0,0 +1,377 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/outbox"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
+)
+
+// fakeRepo отдаёт заранее заданные события и запоминает вызовы
+type fakeRepo struct {
+	mu sync.Mutex
+	// endless — PickBatch всегда отдаёт событие: очередь не кончается
+	endless    bool
+	batches    [][]outbox.Message
+	stuck      []outbox.Message
+	sent       []int64
+	failed     []outbox.Failure
+	heartbeats []bool // leader каждого heartbeat
+	pruned     int
+	resetArgs  []time.Duration
+	calls      []string
+}
+
+func (r *fakeRepo) PickBatch(ctx context.Context, count int, workerID string) ([]outbox.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.endless {
+		return []outbox.Message{newMessage(int64(len(r.sent)+1), "pay_1", 0)}, nil
+	}
+	if len(r.batches) == 0 {
+		return nil, nil
+	}
+	batch := r.batches[0]
+	r.batches = r.batches[1:]
+	return batch, nil
+}
+
+func (r *fakeRepo) MarkSent(ctx context.Context, ids []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, ids...)
+	return nil
+}
+
+func (r *fakeRepo) MarkFailed(ctx context.Context, failures []outbox.Failure) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed = append(r.failed, failures...)
+	return nil
+}
+
+func (r *fakeRepo) ResetEvents(ctx context.Context, workerID string, ownerTTL, reclaimAfter time.Duration) ([]outbox.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resetArgs = []time.Duration{ownerTTL, reclaimAfter}
+	stuck := r.stuck
+	r.stuck = nil
+	return stuck, nil
+}
+
+func (r *fakeRepo) Heartbeat(ctx context.Context, workerID string, leader bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.heartbeats = append(r.heartbeats, leader)
+	r.calls = append(r.calls, "heartbeat")
+	return nil
+}
+
+func (r *fakeRepo) PruneWorkers(ctx context.Context, olderThan time.Duration) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruned++
+	return 0, nil
+}
+
+func (r *fakeRepo) Deregister(ctx context.Context, workerID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, "deregister")
+	return nil
+}
+
+func (r *fakeRepo) heartbeatCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.heartbeats)
+}
+
+// fakeElector отдаёт блокировку по флагу locked
+type fakeElector struct {
+	mu     sync.Mutex
+	locked bool
+	err    error
+}
+
+func (e *fakeElector) TryLock(ctx context.Context) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.locked, e.err
+}
+
+func (e *fakeElector) Unlock(ctx context.Context) {}
+
+// fakePublisher падает на событиях с key из fail
+type fakePublisher struct {
+	mu        sync.Mutex
+	fail      map[string]bool
+	published []string
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, evn event.Envelope) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail[evn.Key] {
+		return errors.New("broker unavailable")
+	}
+	p.published = append(p.published, evn.Key)
+	return nil
+}
+
+func newMessage(id int64, key string, attempt int) outbox.Message {
+	return outbox.Message{ID: id, Attempt: attempt, Envelope: event.Envelope{Key: key, Payload: []byte(`{}`)}}
+}
+
+func testConfig() config.Outbox {
+	return config.Outbox{
+		PollInterval:        10 * time.Millisecond,
+		PollTimeout:         time.Second,
+		BatchSize:           10,
+		ResetEventsInterval: time.Hour,
+		ResetEventsTimeout:  time.Second,
+		MaxParallel:         2,
+		MaxAttempts:         3,
+		BackoffBase:         time.Second,
+		BackoffMax:          time.Minute,
+		WorkerID:            "w_test",
+		HeartbeatInterval:   5 * time.Millisecond,
+		OwnerTTL:            30 * time.Second,
+		ReclaimAfter:        5 * time.Minute,
+		WorkerRetention:     time.Hour,
+	}
+}
+
+func TestHeartbeatFollowsElection(t *testing.T) {
+	repo := &fakeRepo{}
+	elector := &fakeElector{}
+	w := New(testConfig(), &fakePublisher{}, repo, nil, elector)
+	ctx := context.Background()
+
+	w.heartbeat(ctx)
+	if w.Status().Active {
+		t.Fatal("worker active without the lock")
+	}
+
+	elector.locked = true
+	w.heartbeat(ctx)
+	if !w.Status().Active {
+		t.Fatal("worker not active with the lock")
+	}
+
+	// ошибка выборов — воркер уступает, чтобы не отправлять вдвоём
+	elector.locked, elector.err = false, errors.New("connection lost")
+	w.heartbeat(ctx)
+	if w.Status().Active {
+		t.Fatal("worker active after election error")
+	}
+
+	if got := repo.heartbeats; len(got) != 3 || got[0] || !got[1] || got[2] {
+		t.Fatalf("heartbeat leader flags = %v", got)
+	}
+	// чистит записи соседей только активный воркер
+	if repo.pruned != 1 {
+		t.Fatalf("pruned %d times, want 1", repo.pruned)
+	}
+}
+
+func TestPollSkippedWhenNotLeader(t *testing.T) {
+	repo := &fakeRepo{batches: [][]outbox.Message{{newMessage(1, "pay_1", 0)}}}
+	w := New(testConfig(), &fakePublisher{}, repo, nil, &fakeElector{})
+	w.heartbeat(context.Background())
+
+	w.poll(context.Background(), make(chan struct{}, 1))
+	if len(repo.sent) != 0 || len(repo.batches) != 1 {
+		t.Fatal("follower picked events")
+	}
+}
+
+// Длинная очередь не задерживает heartbeat: иначе соседи сочтут воркер
+// упавшим и заберут его строки
+func TestHeartbeatNotStarvedByPoll(t *testing.T) {
+	repo := &fakeRepo{endless: true}
+	w := New(testConfig(), &fakePublisher{}, repo, nil, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop while draining the queue")
+	}
+
+	if n := repo.heartbeatCount(); n < 5 {
+		t.Fatalf("only %d heartbeats while draining", n)
+	}
+	if calls := repo.calls; calls[len(calls)-1] != "deregister" {
+		t.Fatalf("heartbeat after deregister: %v", calls[len(calls)-3:])
+	}
+}
+
+func TestPollBoundedByInterval(t *testing.T) {
+	repo := &fakeRepo{endless: true}
+	w := New(testConfig(), &fakePublisher{}, repo, nil, nil)
+	w.heartbeat(context.Background())
+
+	wake := make(chan struct{}, 1)
+	start := time.Now()
+	w.poll(context.Background(), wake)
+
+	if time.Since(start) > time.Second {
+		t.Fatal("poll drained endless queue without a bound")
+	}
+	select {
+	case <-wake:
+	default:
+		t.Fatal("rest of the queue not scheduled")
+	}
+}
+
+func TestResetStuckCountsAttempt(t *testing.T) {
+	repo := &fakeRepo{stuck: []outbox.Message{
+		newMessage(1, "pay_1", 0),
+		newMessage(2, "pay_2", 2), // третья попытка из трёх
+		{ID: 3, DecodeErr: errors.New("bad headers")},
+	}}
+	cfg := testConfig()
+	w := New(cfg, &fakePublisher{}, repo, nil, nil)
+
+	w.resetStuck(context.Background())
+
+	if repo.resetArgs[0] != cfg.OwnerTTL || repo.resetArgs[1] != cfg.ReclaimAfter {
+		t.Fatalf("reset called with %v", repo.resetArgs)
+	}
+	if len(repo.failed) != 3 {
+		t.Fatalf("expected 3 failures, got %d", len(repo.failed))
+	}
+	if f := repo.failed[0]; f.Attempt != 1 || f.NextAttemptAt == nil {
+		t.Fatalf("stuck event not rescheduled: %+v", f)
+	}
+	if f := repo.failed[1]; f.Attempt != 3 || f.NextAttemptAt != nil {
+		t.Fatalf("stuck event with exhausted attempts not dead: %+v", f)
+	}
+	if f := repo.failed[2]; f.NextAttemptAt != nil {
+		t.Fatalf("undecodable event not dead: %+v", f)
+	}
+}
+
+func TestPollBatchFailures(t *testing.T) {
+	repo := &fakeRepo{batches: [][]outbox.Message{{
+		newMessage(1, "pay_1", 0),
+		newMessage(2, "pay_2", 0),
+		newMessage(3, "pay_3", 2), // третья попытка из трёх
+		{ID: 4, Envelope: event.Envelope{Key: "pay_4"}, DecodeErr: errors.New("bad headers")},
+	}}}
+	pub := &fakePublisher{fail: map[string]bool{"pay_2": true, "pay_3": true}}
+	w := New(testConfig(), pub, repo, nil, nil)
+
+	before := time.Now()
+	if n := w.PollBatch(context.Background()); n != 4 {
+		t.Fatalf("picked %d, want 4", n)
+	}
+
+	if len(repo.sent) != 1 || repo.sent[0] != 1 {
+		t.Fatalf("sent = %v, want [1]", repo.sent)
+	}
+	// событие с битыми заголовками не отправляется
+	for _, key := range pub.published {
+		if key == "pay_4" {
+			t.Fatal("undecodable event published")
+		}
+	}
+
+	failed := make(map[int64]outbox.Failure)
+	for _, f := range repo.failed {
+		failed[f.ID] = f
+	}
+	if len(failed) != 3 {
+		t.Fatalf("expected 3 failures, got %+v", repo.failed)
+	}
+	if f := failed[2]; f.Attempt != 1 || f.NextAttemptAt == nil || f.NextAttemptAt.Before(before.Add(time.Second)) {
+		t.Fatalf("failed event not rescheduled after backoff: %+v", f)
+	}
+	if f := failed[3]; f.Attempt != 3 || f.NextAttemptAt != nil {
+		t.Fatalf("event with exhausted attempts not dead: %+v", f)
+	}
+	if f := failed[4]; f.Attempt != 1 || f.NextAttemptAt != nil || f.Error != "bad headers" {
+		t.Fatalf("undecodable event not dead on first attempt: %+v", f)
+	}
+}
+
+func TestUnlimitedAttempts(t *testing.T) {
+	cfg := testConfig()
+	cfg.MaxAttempts = 0
+	w := New(cfg, &fakePublisher{}, &fakeRepo{}, nil, nil)
+
+	if f := w.failure(newMessage(1, "pay_1", 100), errors.New("broker unavailable")); f.NextAttemptAt == nil {
+		t.Fatalf("event dead with unlimited attempts: %+v", f)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	cfg := testConfig()
+	w := New(cfg, &fakePublisher{}, &fakeRepo{}, nil, nil)
+
+	for attempt, want := range map[int]time.Duration{
+		1:  time.Second,
+		2:  2 * time.Second,
+		4:  8 * time.Second,
+		6:  32 * time.Second,
+		7:  time.Minute,
+		50: time.Minute,
+	} {
+		if got := w.backoff(attempt); got != want {
+			t.Errorf("attempt %d: got %s, want %s", attempt, got, want)
+		}
+	}
+
+	// jitter только уменьшает задержку, не больше своей доли
+	cfg.BackoffJitter = 0.5
+	w = New(cfg, &fakePublisher{}, &fakeRepo{}, nil, nil)
+	for range 100 {
+		if got := w.backoff(2); got > 2*time.Second || got < time.Second {
+			t.Fatalf("jittered backoff %s out of [1s, 2s]", got)
+		}
+	}
+}
+
+// Упавшая голова key не помечается отправленной: PickBatch не отдаст
+// следующее событие key, пока эта не станет SENT, остальные key не ждут
+func TestFailedHeadKeepsKeyOrder(t *testing.T) {
+	repo := &fakeRepo{batches: [][]outbox.Message{
+		{newMessage(1, "pay_1", 0), newMessage(2, "pay_2", 0)},
+		{newMessage(1, "pay_1", 1), newMessage(3, "pay_2", 0)},
+	}}
+	pub := &fakePublisher{fail: map[string]bool{"pay_1": true}}
+	w := New(testConfig(), pub, repo, nil, nil)
+
+	w.PollBatch(context.Background())
+	if len(repo.sent) != 1 || repo.sent[0] != 2 {
+		t.Fatalf("first batch sent = %v, want [2]", repo.sent)
+	}
+	if len(repo.failed) != 1 || repo.failed[0].ID != 1 || repo.failed[0].NextAttemptAt == nil {
+		t.Fatalf("failed head not rescheduled: %+v", repo.failed)
+	}
+
+	pub.fail = nil
+	w.PollBatch(context.Background())
+	sent := map[int64]bool{}
+	for _, id := range repo.sent[1:] {
+		sent[id] = true
+	}
+	if len(repo.sent) != 3 || !sent[1] || !sent[3] {
+		t.Fatalf("second batch sent = %v, want 1 and 3", repo.sent[1:])
+	}
+}
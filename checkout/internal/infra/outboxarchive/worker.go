@@ -0,0 +1,68 @@
+package outboxarchive
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+)
+
+type Repository interface {
+	ArchiveSent(ctx context.Context, olderThan time.Duration, batch int, archive bool) (int64, error)
+}
+
+// Worker периодически переносит в архив (или удаляет) отправленные события outbox
+type Worker struct {
+	repo Repository
+	cfg  config.Archive
+}
+
+func New(cfg config.Archive, repo Repository) *Worker {
+	return &Worker{repo: repo, cfg: cfg}
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	if w.cfg.RetentionDays <= 0 {
+		log.Println("Outbox archiver disabled")
+		return
+	}
+
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.archive(ctx)
+		case <-ctx.Done():
+			log.Println("Outbox archiver closed...")
+			return
+		}
+	}
+}
+
+// обрабатываем пачками, пока есть что переносить: короткие транзакции не держат блокировки
+func (w *Worker) archive(ctx context.Context) {
+	olderThan := time.Duration(w.cfg.RetentionDays) * 24 * time.Hour
+
+	var total int64
+	for {
+		batchCtx, cancel := context.WithTimeout(ctx, w.cfg.Timeout)
+		n, err := w.repo.ArchiveSent(batchCtx, olderThan, w.cfg.BatchSize, w.cfg.Archive)
+		cancel()
+
+		if err != nil {
+			log.Printf("outbox archiver: error while archive:%v", err)
+			return
+		}
+		total += n
+		if n < int64(w.cfg.BatchSize) {
+			break
+		}
+	}
+
+	if total > 0 {
+		log.Printf("outbox archiver: processed %d sent events (archive=%t)", total, w.cfg.Archive)
+	}
+}
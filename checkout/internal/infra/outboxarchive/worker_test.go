@@ -0,0 +1,91 @@
+package outboxarchive
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+)
+
+// fakeRepo отдаёт заранее заданные размеры пачек
+type fakeRepo struct {
+	batches []int64
+	err     error
+	calls   int
+	archive []bool
+}
+
+func (r *fakeRepo) ArchiveSent(ctx context.Context, olderThan time.Duration, batch int, archive bool) (int64, error) {
+	r.calls++
+	r.archive = append(r.archive, archive)
+	if r.err != nil {
+		return 0, r.err
+	}
+	if len(r.batches) == 0 {
+		return 0, nil
+	}
+	n := r.batches[0]
+	r.batches = r.batches[1:]
+	return n, nil
+}
+
+func testConfig() config.Archive {
+	return config.Archive{Timeout: time.Second, BatchSize: 100, RetentionDays: 7, Archive: true}
+}
+
+func TestArchiveDrainsFullBatches(t *testing.T) {
+	repo := &fakeRepo{batches: []int64{100, 100, 40, 100}}
+	New(testConfig(), repo).archive(context.Background())
+
+	// неполная пачка — больше нечего переносить
+	if repo.calls != 3 {
+		t.Fatalf("expected 3 batches, got %d", repo.calls)
+	}
+	for _, a := range repo.archive {
+		if !a {
+			t.Fatal("archive flag not passed")
+		}
+	}
+}
+
+func TestArchiveStopsWhenLockedElsewhere(t *testing.T) {
+	// пачку держит другой инстанс: ArchiveSent возвращает 0
+	repo := &fakeRepo{}
+	New(testConfig(), repo).archive(context.Background())
+
+	if repo.calls != 1 {
+		t.Fatalf("expected single attempt, got %d", repo.calls)
+	}
+}
+
+func TestArchiveStopsOnError(t *testing.T) {
+	repo := &fakeRepo{batches: []int64{100, 100}, err: errors.New("db down")}
+	New(testConfig(), repo).archive(context.Background())
+
+	if repo.calls != 1 {
+		t.Fatalf("expected to stop after error, got %d calls", repo.calls)
+	}
+}
+
+func TestRunDisabled(t *testing.T) {
+	cfg := testConfig()
+	cfg.RetentionDays = 0
+	repo := &fakeRepo{}
+
+	done := make(chan struct{})
+	go func() {
+		New(cfg, repo).Run(context.Background())
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("disabled archiver did not return")
+	}
+	if repo.calls != 0 {
+		t.Fatalf("disabled archiver called repo %d times", repo.calls)
+	}
+}
@@ -0,0 +1,183 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/idempotency"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// IdempotencyStore хранит ключи в checkout.idempotency_keys. Внутри
+// PaymentsRepo.WithinTx резерв и финализация идут в той же транзакции, что и платёж
+type IdempotencyStore struct {
+	pool *pgxpool.Pool
+}
+
+func NewIdempotencyStore(repo *PaymentsRepo) *IdempotencyStore {
+	return &IdempotencyStore{pool: repo.pool}
+}
+
+// Reserve занимает новый или истёкший ключ, а также перехватывает ключ с тем же телом,
+// если аренда владельца истекла или его попытка завершилась восстановимой ошибкой.
+// Конкурентный Reserve в другой транзакции ждёт блокировку строки до её коммита
+func (s *IdempotencyStore) Reserve(ctx context.Context, merchantID, key, bodyHash, owner string,
+	lease, ttl time.Duration) (bool, error) {
+	var reserved bool
+	err := conn(ctx, s.pool).QueryRow(ctx,
+		`INSERT INTO checkout.idempotency_keys (merchant_id, idem_key, state, body_hash, owner, lease_until, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, now() + make_interval(secs => $6), now() + make_interval(secs => $7))
+		 ON CONFLICT (merchant_id, idem_key) DO UPDATE
+		 SET state = EXCLUDED.state, body_hash = EXCLUDED.body_hash, owner = EXCLUDED.owner,
+		     lease_until = EXCLUDED.lease_until, retryable = false, payment_id = NULL,
+		     http_code = NULL, response = NULL, updated_at = now(), expires_at = EXCLUDED.expires_at,
+		     created_at = CASE WHEN idempotency_keys.expires_at <= now() THEN now() ELSE idempotency_keys.created_at END
+		 WHERE idempotency_keys.expires_at <= now()
+		    OR (idempotency_keys.body_hash = EXCLUDED.body_hash AND (
+		          (idempotency_keys.state = 'IN_PROGRESS' AND coalesce(idempotency_keys.lease_until, '-infinity') <= now())
+		       OR (idempotency_keys.state = 'ERROR' AND idempotency_keys.retryable)))
+		 RETURNING true`,
+		merchantID, key, string(idempotency.StateInProgress), bodyHash, owner, lease.Seconds(), ttl.Seconds(),
+	).Scan(&reserved)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	return reserved, err
+}
+
+func (s *IdempotencyStore) Finalize(ctx context.Context, merchantID, key, owner, bodyHash string, httpCode int,
+	paymentID string, resp map[string]any, ttl time.Duration) error {
+	return s.complete(ctx, merchantID, key, idempotency.Record{
+		State:     idempotency.StateDone,
+		BodyHash:  bodyHash,
+		PaymentID: paymentID,
+		HTTPCode:  httpCode,
+		Response:  resp,
+		Owner:     owner,
+	}, ttl)
+}
+
+func (s *IdempotencyStore) Fail(ctx context.Context, merchantID, key, owner, bodyHash string, retryable bool,
+	httpCode int, resp map[string]any, ttl time.Duration) error {
+	return s.complete(ctx, merchantID, key, idempotency.Record{
+		State:     idempotency.StateError,
+		BodyHash:  bodyHash,
+		HTTPCode:  httpCode,
+		Response:  resp,
+		Owner:     owner,
+		Retryable: retryable,
+	}, ttl)
+}
+
+// complete пишет итог, только пока ключ у того же владельца или уже истёк.
+// Строки нет (например, транзакцию с резервом откатили) — вставляет её
+func (s *IdempotencyStore) complete(ctx context.Context, merchantID, key string, rec idempotency.Record,
+	ttl time.Duration) error {
+	var body []byte
+	if rec.Response != nil {
+		var err error
+		if body, err = json.Marshal(rec.Response); err != nil {
+			return err
+		}
+	}
+
+	var pid *string
+	if rec.PaymentID != "" {
+		pid = &rec.PaymentID
+	}
+	var httpCode *int
+	if rec.HTTPCode != 0 {
+		httpCode = &rec.HTTPCode
+	}
+
+	tag, err := conn(ctx, s.pool).Exec(ctx,
+		`INSERT INTO checkout.idempotency_keys
+		   (merchant_id, idem_key, state, body_hash, payment_id, http_code, response, owner, retryable, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, now() + make_interval(secs => $10))
+		 ON CONFLICT (merchant_id, idem_key) DO UPDATE
+		 SET state = EXCLUDED.state, body_hash = EXCLUDED.body_hash, payment_id = EXCLUDED.payment_id,
+		     http_code = EXCLUDED.http_code, response = EXCLUDED.response, owner = EXCLUDED.owner,
+		     retryable = EXCLUDED.retryable, lease_until = NULL,
+		     updated_at = now(), expires_at = EXCLUDED.expires_at
+		 WHERE idempotency_keys.owner = EXCLUDED.owner OR idempotency_keys.expires_at <= now()`,
+		merchantID, key, string(rec.State), rec.BodyHash, pid, httpCode, body, rec.Owner, rec.Retryable, ttl.Seconds())
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return idempotency.ErrLeaseLost
+	}
+	return nil
+}
+
+func (s *IdempotencyStore) Load(ctx context.Context, merchantID, key string) (*idempotency.Record, error) {
+	var (
+		rec        idempotency.Record
+		state      string
+		paymentID  *string
+		httpCode   *int
+		response   []byte
+		owner      *string
+		leaseUntil *time.Time
+		updatedAt  time.Time
+	)
+	err := conn(ctx, s.pool).QueryRow(ctx,
+		`SELECT state, body_hash, payment_id, http_code, response, owner, lease_until, retryable, updated_at
+		 FROM checkout.idempotency_keys
+		 WHERE merchant_id = $1 AND idem_key = $2 AND expires_at > now()`,
+		merchantID, key,
+	).Scan(&state, &rec.BodyHash, &paymentID, &httpCode, &response, &owner, &leaseUntil, &rec.Retryable, &updatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	rec.State = idempotency.State(state)
+	rec.UpdatedAt = updatedAt.Unix()
+	if paymentID != nil {
+		rec.PaymentID = *paymentID
+	}
+	if httpCode != nil {
+		rec.HTTPCode = *httpCode
+	}
+	if owner != nil {
+		rec.Owner = *owner
+	}
+	if leaseUntil != nil {
+		rec.LeaseUntil = leaseUntil.UnixMilli()
+	}
+	if response != nil {
+		if err := json.Unmarshal(response, &rec.Response); err != nil {
+			return nil, err
+		}
+	}
+
+	return &rec, nil
+}
+
+// Sweep удаляет истёкшие ключи пачкой, возвращает сколько удалено
+func (s *IdempotencyStore) Sweep(ctx context.Context, batch int) (int64, error) {
+	tag, err := s.pool.Exec(ctx,
+		`DELETE FROM checkout.idempotency_keys
+		 WHERE (merchant_id, idem_key) IN (
+		   SELECT merchant_id, idem_key FROM checkout.idempotency_keys
+		   WHERE expires_at <= now()
+		   LIMIT $1
+		 )`,
+		batch)
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+func (s *IdempotencyStore) Ping() error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	return s.pool.Ping(ctx)
+}
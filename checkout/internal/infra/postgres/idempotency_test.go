@@ -0,0 +1,26 @@
+package postgres
+
+import (
+	"os"
+	"testing"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/idempotency/idemtest"
+)
+
+// нужен живой Postgres: TEST_PG_DSN=postgres://... go test ./...
+func TestIdempotencyStore(t *testing.T) {
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	repo, err := NewPaymentsRepo(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(repo.Close)
+	if err := repo.RunMigrations(); err != nil {
+		t.Fatal(err)
+	}
+
+	idemtest.Run(t, NewIdempotencyStore(repo))
+}
@@ -0,0 +1,60 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ключ advisory-блокировки лидера outbox ("outbox" в ASCII)
+const outboxLeaderLockKey int64 = 0x6f7574626f78
+
+// AdvisoryLock — сессионная advisory-блокировка на отдельном соединении, изъятом
+// из пула. Блокировку держит тот, у кого живо соединение: при падении процесса или
+// обрыве связи Postgres снимает её сам. Не потокобезопасна, вызывается из одной горутины
+type AdvisoryLock struct {
+	pool *pgxpool.Pool
+	key  int64
+	conn *pgx.Conn
+}
+
+// OutboxLeaderLock — блокировка для выбора единственного активного outbox-воркера
+func (r *PaymentsRepo) OutboxLeaderLock() *AdvisoryLock {
+	return &AdvisoryLock{pool: r.pool, key: outboxLeaderLockKey}
+}
+
+// TryLock: true — блокировка наша (взята сейчас или раньше, и соединение живо)
+func (l *AdvisoryLock) TryLock(ctx context.Context) (bool, error) {
+	if l.conn != nil {
+		if err := l.conn.Ping(ctx); err == nil {
+			return true, nil
+		}
+		// соединение умерло — блокировка уже снята, пробуем взять заново
+		l.Unlock(ctx)
+	}
+
+	pc, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return false, err
+	}
+	conn := pc.Hijack()
+
+	var locked bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&locked); err != nil || !locked {
+		conn.Close(context.Background())
+		return false, err
+	}
+
+	l.conn = conn
+	return true, nil
+}
+
+// Unlock закрывает сессию — Postgres снимает блокировку вместе с ней
+func (l *AdvisoryLock) Unlock(ctx context.Context) {
+	if l.conn == nil {
+		return
+	}
+	l.conn.Close(ctx)
+	l.conn = nil
+}
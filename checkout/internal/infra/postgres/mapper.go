@@ -3,8 +3,13 @@ package postgres
 import (
 	"encoding/json"
 	"fmt"
+	"time"
 
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/merchant"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/outbox"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/refund"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/webhook"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
 )
 
@@ -16,6 +21,10 @@ func PaymentRowToDomain(row PaymentRow) payment.Payment {
 		Currency: row.Currency, Status: payment.PaymentStatus(row.Status),
 		PSPRef: row.PSPRef, MethodToken: row.MethodToken,
 		CreatedAt: row.CreatedAt, UpdatedAt: row.UpdatedAt,
+		CaptureMethod:          payment.CaptureMethod(row.CaptureMethod),
+		AmountCaptured:         row.AmountCaptured,
+		AuthorizationExpiresAt: row.AuthorizationExpiresAt,
+		NextAction:             NextActionFromJSON(row.NextAction),
 	}
 }
 
@@ -27,6 +36,117 @@ func PaymentToRow(p payment.Payment) PaymentRow {
 		Currency: p.Currency, Status: string(p.Status),
 		PSPRef: p.PSPRef, MethodToken: p.MethodToken,
 		CreatedAt: p.CreatedAt, UpdatedAt: p.UpdatedAt,
+		CaptureMethod:          string(p.CaptureMethod),
+		AmountCaptured:         p.AmountCaptured,
+		AuthorizationExpiresAt: p.AuthorizationExpiresAt,
+		NextAction:             NextActionToJSON(p.NextAction),
+	}
+}
+
+// jsonb next_action -> domain, пустое или битое значение — нет действия
+func NextActionFromJSON(data []byte) *payment.NextAction {
+	if len(data) == 0 {
+		return nil
+	}
+	var a payment.NextAction
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil
+	}
+	return &a
+}
+
+// domain -> jsonb next_action, nil — NULL
+func NextActionToJSON(a *payment.NextAction) []byte {
+	if a == nil {
+		return nil
+	}
+	data, _ := json.Marshal(a)
+	return data
+}
+
+// db -> domain
+func RefundRowToDomain(row RefundRow) refund.Refund {
+	return refund.Refund{
+		ID: row.ID, PaymentID: row.PaymentID,
+		MerchantID: row.MerchantID, Amount: row.Amount,
+		Currency: row.Currency, Reason: row.Reason,
+		Status: refund.Status(row.Status), PSPRef: row.PSPRef,
+		FailureReason: row.FailureReason, IdempotencyKey: row.IdempotencyKey,
+		CreatedAt: row.CreatedAt, UpdatedAt: row.UpdatedAt,
+	}
+}
+
+// domain -> row
+func RefundToRow(r refund.Refund) RefundRow {
+	return RefundRow{
+		ID: r.ID, PaymentID: r.PaymentID,
+		MerchantID: r.MerchantID, Amount: r.Amount,
+		Currency: r.Currency, Reason: r.Reason,
+		Status: string(r.Status), PSPRef: r.PSPRef,
+		FailureReason: r.FailureReason, IdempotencyKey: r.IdempotencyKey,
+		CreatedAt: r.CreatedAt, UpdatedAt: r.UpdatedAt,
+	}
+}
+
+// db -> domain
+func MerchantRowToDomain(row MerchantRow) merchant.Merchant {
+	return merchant.Merchant{ID: row.ID, Name: row.Name, Currencies: row.Currencies, CreatedAt: row.CreatedAt}
+}
+
+// db -> domain
+func APIKeyRowToDomain(row APIKeyRow) merchant.APIKey {
+	return merchant.APIKey{
+		ID: row.ID, MerchantID: row.MerchantID,
+		Prefix: row.Prefix, Hash: row.Hash,
+		ValidFrom: row.ValidFrom, ValidUntil: row.ValidUntil,
+		RevokedAt: row.RevokedAt, CreatedAt: row.CreatedAt,
+	}
+}
+
+// db -> domain
+func WebhookEndpointRowToDomain(row WebhookEndpointRow) webhook.Endpoint {
+	return webhook.Endpoint{
+		ID: row.ID, MerchantID: row.MerchantID,
+		URL: row.URL, Secret: row.Secret,
+		Enabled: row.Enabled, CreatedAt: row.CreatedAt,
+	}
+}
+
+// db -> domain
+func WebhookDeliveryRowToDomain(row WebhookDeliveryRow) webhook.Delivery {
+	return webhook.Delivery{
+		ID: row.ID, EndpointID: row.EndpointID,
+		MerchantID: row.MerchantID, EventID: row.EventID,
+		EventType: row.EventType, Payload: row.Payload,
+		Status: webhook.DeliveryStatus(row.Status), Attempt: row.Attempt,
+		NextAttemptAt: row.NextAttemptAt, LastStatusCode: row.LastStatusCode,
+		LastError: row.LastError, DeliveredAt: row.DeliveredAt,
+		CreatedAt: row.CreatedAt, UpdatedAt: row.UpdatedAt,
+	}
+}
+
+// db -> domain
+func WebhookAttemptRowToDomain(row WebhookAttemptRow) webhook.Attempt {
+	return webhook.Attempt{
+		DeliveryID: row.DeliveryID, Attempt: row.Attempt,
+		StatusCode: row.StatusCode, Error: row.Error,
+		Duration:  time.Duration(row.DurationMs) * time.Millisecond,
+		CreatedAt: row.CreatedAt,
+	}
+}
+
+// db -> domain
+func StatusHistoryRowToDomain(row StatusHistoryRow) payment.StatusChange {
+	var from *payment.PaymentStatus
+	if row.FromStatus != nil {
+		s := payment.PaymentStatus(*row.FromStatus)
+		from = &s
+	}
+	return payment.StatusChange{
+		PaymentID: row.PaymentID, From: from,
+		To: payment.PaymentStatus(row.ToStatus), Source: row.Source,
+		EventID: row.EventID, ErrorDetails: row.ErrorDetails,
+		OccurredAt: row.OccurredAt,
 	}
 }
 
@@ -50,6 +170,36 @@ func OutboxRowToEnvelope(row OutboxEventRow) (event.Envelope, error) {
 	}, nil
 }
 
+// row -> domain. Повреждённые заголовки не мешают отдать строку:
+// служебные ручки нужны как раз для разбора таких событий
+func OutboxRowToDomain(row OutboxEventRow) outbox.Event {
+	var decodeErr error
+	headers := map[string]string{}
+	if err := json.Unmarshal(row.Headers, &headers); err != nil {
+		headers = nil
+		decodeErr = fmt.Errorf("invalid headers, err:%v", err)
+	}
+
+	return outbox.Event{
+		ID:            row.ID,
+		AggregateType: row.AggregateType,
+		AggregateID:   row.AggregateID,
+		EventType:     row.EventType,
+		EventVersion:  row.EventVersion,
+		Key:           row.Key,
+		Payload:       row.Payload,
+		Headers:       headers,
+		RawHeaders:    row.Headers,
+		DecodeErr:     decodeErr,
+		Status:        outbox.Status(row.Status),
+		Attempt:       row.Attempt,
+		NextAttemptAt: row.NextAttemptAt,
+		LastError:     row.LastError,
+		CreatedAt:     row.CreatedAt,
+		UpdatedAt:     row.UpdatedAt,
+	}
+}
+
 // envelope -> row
 func EnvelopeToRow(env event.Envelope) (OutboxEventRow, error) {
 	headers, err := json.Marshal(env.Headers)
@@ -57,12 +207,26 @@ func EnvelopeToRow(env event.Envelope) (OutboxEventRow, error) {
 		return OutboxEventRow{}, err
 	}
 
+	aggregateID := env.Key
+	if id, ok := env.Headers["x-aggregate-id"]; ok {
+		aggregateID = id
+	}
+
 	return OutboxEventRow{
-		AggregateType: "payment",
-		AggregateID:   env.Key,
+		AggregateType: aggregateType(env.Type),
+		AggregateID:   aggregateID,
 		EventType:     string(env.Type),
 		Key:           env.Key,
 		Payload:       env.Payload,
 		Headers:       headers,
 	}, nil
 }
+
+func aggregateType(t event.EnvelopeType) string {
+	switch t {
+	case event.RefundCreatedEvent:
+		return "refund"
+	default:
+		return "payment"
+	}
+}
@@ -0,0 +1,33 @@
+package postgres
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOutboxRowToDomain(t *testing.T) {
+	row := OutboxEventRow{
+		ID: 7, AggregateType: "payment", AggregateID: "pay_1", EventType: "payments.created",
+		EventVersion: 1, Key: "pay_1", Payload: []byte(`{"payment_id":"pay_1"}`),
+		Headers: []byte(`{"trace_id":"t1"}`), Status: "SENT",
+		NextAttemptAt: time.Now(), CreatedAt: time.Now(), UpdatedAt: time.Now(),
+	}
+
+	evt := OutboxRowToDomain(row)
+	if evt.DecodeErr != nil || evt.Headers["trace_id"] != "t1" {
+		t.Fatalf("valid headers: %+v", evt)
+	}
+
+	// повреждённые заголовки: строка отдаётся целиком вместе с ошибкой
+	row.Headers = []byte(`{"retries":3}`)
+	evt = OutboxRowToDomain(row)
+	if evt.DecodeErr == nil {
+		t.Fatal("expected decode error")
+	}
+	if evt.Headers != nil || string(evt.RawHeaders) != `{"retries":3}` {
+		t.Fatalf("raw headers lost: %+v", evt)
+	}
+	if evt.ID != 7 || evt.AggregateID != "pay_1" || string(evt.Payload) != `{"payment_id":"pay_1"}` {
+		t.Fatalf("row fields lost: %+v", evt)
+	}
+}
@@ -0,0 +1,21 @@
+package postgres
+
+import "time"
+
+type MerchantRow struct {
+	ID         string    `db:"merchant_id"`
+	Name       string    `db:"name"`
+	Currencies []string  `db:"currencies"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+type APIKeyRow struct {
+	ID         string     `db:"key_id"`
+	MerchantID string     `db:"merchant_id"`
+	Prefix     string     `db:"key_prefix"`
+	Hash       string     `db:"key_hash"`
+	ValidFrom  time.Time  `db:"valid_from"`
+	ValidUntil *time.Time `db:"valid_until"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
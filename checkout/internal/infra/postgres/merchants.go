@@ -0,0 +1,208 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/merchant"
+	"github.com/jackc/pgx/v5"
+)
+
+const merchantColumns = `merchant_id, name, currencies, created_at`
+
+const apiKeyColumns = `key_id, merchant_id, key_prefix, key_hash, valid_from, valid_until, revoked_at, created_at`
+
+// InsertMerchant заводит мерчанта вместе с первым ключом: без ключа мерчант бесполезен,
+// а повтор создания вернул бы ErrExists
+func (r *PaymentsRepo) InsertMerchant(ctx context.Context, m merchant.Merchant, key merchant.APIKey) (merchant.Merchant, merchant.APIKey, error) {
+	currencies := m.Currencies
+	if currencies == nil {
+		currencies = []string{}
+	}
+
+	tx, err := begin(ctx, r.pool)
+	if err != nil {
+		return merchant.Merchant{}, merchant.APIKey{}, err
+	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	mrow, err := scanMerchant(tx.QueryRow(ctx,
+		`INSERT INTO checkout.merchants (merchant_id, name, currencies) VALUES ($1, $2, $3)
+		 ON CONFLICT (merchant_id) DO NOTHING
+		 RETURNING `+merchantColumns,
+		m.ID, m.Name, currencies))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return merchant.Merchant{}, merchant.APIKey{}, merchant.ErrExists
+	}
+	if err != nil {
+		return merchant.Merchant{}, merchant.APIKey{}, err
+	}
+
+	krow, err := scanAPIKey(tx.QueryRow(ctx,
+		`INSERT INTO checkout.api_keys (key_id, merchant_id, key_prefix, key_hash)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+apiKeyColumns,
+		key.ID, m.ID, key.Prefix, key.Hash))
+	if err != nil {
+		return merchant.Merchant{}, merchant.APIKey{}, fmt.Errorf("insert first key: %w", err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return merchant.Merchant{}, merchant.APIKey{}, err
+	}
+
+	return MerchantRowToDomain(mrow), APIKeyRowToDomain(krow), nil
+}
+
+func (r *PaymentsRepo) GetMerchant(ctx context.Context, id string) (merchant.Merchant, error) {
+	row, err := scanMerchant(r.pool.QueryRow(ctx,
+		`SELECT `+merchantColumns+` FROM checkout.merchants WHERE merchant_id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return merchant.Merchant{}, merchant.ErrNotFound
+	}
+	if err != nil {
+		return merchant.Merchant{}, err
+	}
+	return MerchantRowToDomain(row), nil
+}
+
+func (r *PaymentsRepo) SetCurrencies(ctx context.Context, id string, currencies []string) (merchant.Merchant, error) {
+	if currencies == nil {
+		currencies = []string{}
+	}
+	row, err := scanMerchant(r.pool.QueryRow(ctx,
+		`UPDATE checkout.merchants SET currencies = $2 WHERE merchant_id = $1
+		 RETURNING `+merchantColumns,
+		id, currencies))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return merchant.Merchant{}, merchant.ErrNotFound
+	}
+	if err != nil {
+		return merchant.Merchant{}, err
+	}
+	return MerchantRowToDomain(row), nil
+}
+
+func (r *PaymentsRepo) GetActiveAPIKey(ctx context.Context, hash string) (merchant.APIKey, error) {
+	row, err := scanAPIKey(r.pool.QueryRow(ctx,
+		`SELECT `+apiKeyColumns+` FROM checkout.api_keys
+		 WHERE key_hash = $1 AND revoked_at IS NULL
+		   AND valid_from <= now() AND (valid_until IS NULL OR valid_until > now())`,
+		hash))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return merchant.APIKey{}, merchant.ErrKeyNotFound
+	}
+	if err != nil {
+		return merchant.APIKey{}, err
+	}
+	return APIKeyRowToDomain(row), nil
+}
+
+// RotateAPIKey: новый ключ начинает действовать сразу, старые доживают overlap
+func (r *PaymentsRepo) RotateAPIKey(ctx context.Context, key merchant.APIKey, overlap time.Duration) (merchant.APIKey, error) {
+	tx, err := begin(ctx, r.pool)
+	if err != nil {
+		return merchant.APIKey{}, err
+	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	// блокируем мерчанта: параллельные ротации выполняются по очереди
+	var merchantID string
+	err = tx.QueryRow(ctx,
+		`SELECT merchant_id FROM checkout.merchants WHERE merchant_id = $1 FOR UPDATE`, key.MerchantID,
+	).Scan(&merchantID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return merchant.APIKey{}, merchant.ErrNotFound
+	}
+	if err != nil {
+		return merchant.APIKey{}, err
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE checkout.api_keys
+		 SET valid_until = now() + make_interval(secs => $2)
+		 WHERE merchant_id = $1 AND revoked_at IS NULL
+		   AND (valid_until IS NULL OR valid_until > now() + make_interval(secs => $2))`,
+		key.MerchantID, overlap.Seconds())
+	if err != nil {
+		return merchant.APIKey{}, fmt.Errorf("limit old keys: %w", err)
+	}
+
+	row, err := scanAPIKey(tx.QueryRow(ctx,
+		`INSERT INTO checkout.api_keys (key_id, merchant_id, key_prefix, key_hash)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+apiKeyColumns,
+		key.ID, key.MerchantID, key.Prefix, key.Hash))
+	if err != nil {
+		return merchant.APIKey{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return merchant.APIKey{}, err
+	}
+
+	return APIKeyRowToDomain(row), nil
+}
+
+func (r *PaymentsRepo) RevokeAPIKey(ctx context.Context, merchantID, keyID string) error {
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE checkout.api_keys SET revoked_at = now()
+		 WHERE key_id = $1 AND merchant_id = $2 AND revoked_at IS NULL`,
+		keyID, merchantID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return merchant.ErrKeyNotFound
+	}
+	return nil
+}
+
+func (r *PaymentsRepo) ListAPIKeys(ctx context.Context, merchantID string) ([]merchant.APIKey, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+apiKeyColumns+` FROM checkout.api_keys
+		 WHERE merchant_id = $1 ORDER BY created_at`,
+		merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []merchant.APIKey
+	for rows.Next() {
+		row, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("cant parse row to apiKeyRow, err:%w", err)
+		}
+		keys = append(keys, APIKeyRowToDomain(row))
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error with rows: %w", rows.Err())
+	}
+
+	return keys, nil
+}
+
+func scanMerchant(row pgx.Row) (MerchantRow, error) {
+	var m MerchantRow
+	err := row.Scan(&m.ID, &m.Name, &m.Currencies, &m.CreatedAt)
+	return m, err
+}
+
+func scanAPIKey(row pgx.Row) (APIKeyRow, error) {
+	var k APIKeyRow
+	err := row.Scan(
+		&k.ID,
+		&k.MerchantID,
+		&k.Prefix,
+		&k.Hash,
+		&k.ValidFrom,
+		&k.ValidUntil,
+		&k.RevokedAt,
+		&k.CreatedAt,
+	)
+	return k, err
+}
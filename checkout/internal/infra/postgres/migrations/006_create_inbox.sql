@@ -0,0 +1,9 @@
+-- входящие события от provider (дедупликация повторных доставок)
+CREATE TABLE IF NOT EXISTS checkout.inbox_events (
+    event_id     TEXT        PRIMARY KEY,             -- event_id или topic/partition/offset
+    event_type   TEXT        NOT NULL,                -- "payments.processed" | "payments.failed"
+    payment_id   TEXT        NOT NULL,
+    received_at  TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS inbox_payment_idx ON checkout.inbox_events (payment_id);
@@ -0,0 +1,2 @@
+-- статус PROCESSING есть в домене, но отсутствовал в enum
+ALTER TYPE checkout.payment_status ADD VALUE IF NOT EXISTS 'PROCESSING' AFTER 'PENDING';
@@ -0,0 +1,29 @@
+-- история смены статусов платежа (только добавление)
+CREATE TABLE IF NOT EXISTS checkout.payment_status_history (
+    id            BIGSERIAL   PRIMARY KEY,
+    payment_id    TEXT        NOT NULL REFERENCES checkout.payments (payment_id),
+    from_status   checkout.payment_status,                  -- NULL для создания платежа
+    to_status     checkout.payment_status NOT NULL,
+    source        TEXT        NOT NULL,                     -- "payment.created" | "payments.processed" | ...
+    event_id      TEXT,                                     -- id события-источника
+    error_details TEXT,                                     -- PaymentFailed.ErrorDetails
+    occurred_at   TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS status_history_payment_idx
+ON checkout.payment_status_history (payment_id, id);
+
+CREATE OR REPLACE FUNCTION checkout.forbid_status_history_change() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'payment_status_history is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER status_history_append_only
+BEFORE UPDATE OR DELETE ON checkout.payment_status_history
+FOR EACH ROW EXECUTE FUNCTION checkout.forbid_status_history_change();
+
+-- для уже существующих платежей сохраняем текущий статус
+INSERT INTO checkout.payment_status_history (payment_id, to_status, source, occurred_at)
+SELECT payment_id, status, 'migration', updated_at
+FROM checkout.payments;
@@ -0,0 +1,22 @@
+CREATE TYPE checkout.refund_status AS ENUM ('PENDING', 'SUCCEEDED', 'FAILED');
+
+CREATE TABLE IF NOT EXISTS checkout.refunds (
+    refund_id       text PRIMARY KEY,
+    payment_id      text NOT NULL REFERENCES checkout.payments (payment_id),
+    merchant_id     text NOT NULL,
+    amount          numeric(20,2) NOT NULL CHECK (amount > 0),
+    currency        text NOT NULL CHECK (char_length(currency) = 3),
+    reason          text NOT NULL DEFAULT '',
+    status          checkout.refund_status NOT NULL DEFAULT 'PENDING',
+    psp_reference   text,
+    failure_reason  text,
+    idempotency_key text NOT NULL,
+    created_at      timestamptz NOT NULL DEFAULT now(),
+    updated_at      timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS refunds_payment_idx ON checkout.refunds (payment_id);
+
+-- один Idempotency-Key — один возврат в рамках платежа
+CREATE UNIQUE INDEX IF NOT EXISTS ux_checkout_refunds_payment_idem
+ON checkout.refunds (payment_id, idempotency_key);
@@ -0,0 +1,18 @@
+-- двухстадийные платежи: авторизация -> capture | void
+ALTER TYPE checkout.payment_status ADD VALUE IF NOT EXISTS 'AUTHORIZED';
+ALTER TYPE checkout.payment_status ADD VALUE IF NOT EXISTS 'CAPTURING';
+ALTER TYPE checkout.payment_status ADD VALUE IF NOT EXISTS 'VOIDING';
+ALTER TYPE checkout.payment_status ADD VALUE IF NOT EXISTS 'VOIDED';
+
+ALTER TABLE checkout.payments
+    ADD COLUMN IF NOT EXISTS capture_method text NOT NULL DEFAULT 'automatic'
+        CHECK (capture_method IN ('automatic', 'manual')),
+    ADD COLUMN IF NOT EXISTS amount_captured numeric(20,2),
+    ADD COLUMN IF NOT EXISTS authorization_expires_at timestamptz;
+
+UPDATE checkout.payments SET amount_captured = amount WHERE status = 'SUCCEEDED';
+
+-- поиск просроченных авторизаций
+CREATE INDEX IF NOT EXISTS payments_auth_expiry_idx
+ON checkout.payments (authorization_expires_at)
+WHERE authorization_expires_at IS NOT NULL;
@@ -0,0 +1,10 @@
+-- keyset-пагинация GET /v1/payments: (created_at, payment_id) от новых к старым
+CREATE INDEX IF NOT EXISTS payments_created_idx
+ON checkout.payments (created_at DESC, payment_id DESC);
+
+-- основной сценарий сверки: выдача по мерчанту с фильтром по статусу
+CREATE INDEX IF NOT EXISTS payments_merchant_created_idx
+ON checkout.payments (merchant_id, created_at DESC, payment_id DESC);
+
+CREATE INDEX IF NOT EXISTS payments_merchant_status_created_idx
+ON checkout.payments (merchant_id, status, created_at DESC, payment_id DESC);
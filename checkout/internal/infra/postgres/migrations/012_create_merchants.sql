@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS checkout.merchants (
+    merchant_id text PRIMARY KEY,
+    name        text NOT NULL DEFAULT '',
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+
+-- храним только sha256 ключа, сам ключ мерчант получает один раз
+CREATE TABLE IF NOT EXISTS checkout.api_keys (
+    key_id      text PRIMARY KEY,
+    merchant_id text NOT NULL REFERENCES checkout.merchants (merchant_id),
+    key_prefix  text NOT NULL,
+    key_hash    text NOT NULL UNIQUE,
+    valid_from  timestamptz NOT NULL DEFAULT now(),
+    valid_until timestamptz, -- NULL — бессрочно; при ротации старый ключ доживает до valid_until
+    revoked_at  timestamptz,
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_merchant_idx ON checkout.api_keys (merchant_id);
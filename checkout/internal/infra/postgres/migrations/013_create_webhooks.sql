@@ -0,0 +1,46 @@
+CREATE TABLE IF NOT EXISTS checkout.webhook_endpoints (
+    endpoint_id text PRIMARY KEY,
+    merchant_id text NOT NULL,
+    url         text NOT NULL,
+    secret      text NOT NULL,
+    enabled     boolean NOT NULL DEFAULT true,
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_endpoints_merchant_idx
+ON checkout.webhook_endpoints (merchant_id) WHERE enabled;
+
+-- очередь доставок: пишется в транзакции смены статуса, как outbox_events
+CREATE TABLE IF NOT EXISTS checkout.webhook_deliveries (
+    delivery_id      text PRIMARY KEY,
+    endpoint_id      text NOT NULL REFERENCES checkout.webhook_endpoints (endpoint_id),
+    merchant_id      text NOT NULL,
+    event_id         text NOT NULL,
+    event_type       text NOT NULL,
+    payload          jsonb NOT NULL,
+    status           text NOT NULL DEFAULT 'PENDING', -- PENDING|IN_PROGRESS|DELIVERED|FAILED|DEAD
+    attempt          int NOT NULL DEFAULT 0,
+    next_attempt_at  timestamptz NOT NULL DEFAULT now(),
+    last_status_code int,
+    last_error       text,
+    delivered_at     timestamptz,
+    created_at       timestamptz NOT NULL DEFAULT now(),
+    updated_at       timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_status_idx
+ON checkout.webhook_deliveries (status, next_attempt_at);
+
+-- журнал попыток доставки
+CREATE TABLE IF NOT EXISTS checkout.webhook_delivery_attempts (
+    id          bigserial PRIMARY KEY,
+    delivery_id text NOT NULL REFERENCES checkout.webhook_deliveries (delivery_id),
+    attempt     int NOT NULL,
+    status_code int,
+    error       text,
+    duration_ms int NOT NULL,
+    created_at  timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS webhook_delivery_attempts_delivery_idx
+ON checkout.webhook_delivery_attempts (delivery_id, id);
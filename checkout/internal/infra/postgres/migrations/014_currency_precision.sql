@@ -0,0 +1,12 @@
+-- суммы храним с точностью самой «мелкой» валюты ISO 4217 (CLF, UYW — 4 знака),
+-- число знаков при выдаче определяется валютой
+ALTER TABLE checkout.payments
+    ALTER COLUMN amount TYPE numeric(22,4),
+    ALTER COLUMN amount_captured TYPE numeric(22,4);
+
+ALTER TABLE checkout.refunds
+    ALTER COLUMN amount TYPE numeric(22,4);
+
+-- пустой список — мерчанту доступны все валюты
+ALTER TABLE checkout.merchants
+    ADD COLUMN IF NOT EXISTS currencies text[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,16 @@
+-- ключи идемпотентности, переживают рестарт в отличие от Redis без персистентности
+CREATE TABLE IF NOT EXISTS checkout.idempotency_keys (
+    merchant_id text NOT NULL,
+    idem_key    text NOT NULL,
+    state       text NOT NULL,           -- IN_PROGRESS|DONE|ERROR
+    body_hash   text NOT NULL,
+    payment_id  text,
+    http_code   int,
+    response    jsonb,
+    created_at  timestamptz NOT NULL DEFAULT now(),
+    updated_at  timestamptz NOT NULL DEFAULT now(),
+    expires_at  timestamptz NOT NULL,
+    PRIMARY KEY (merchant_id, idem_key)
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_idx ON checkout.idempotency_keys (expires_at);
@@ -0,0 +1,5 @@
+-- аренда ключа: владелец, срок аренды и признак восстановимой ошибки
+ALTER TABLE checkout.idempotency_keys
+    ADD COLUMN IF NOT EXISTS owner       text,
+    ADD COLUMN IF NOT EXISTS lease_until timestamptz,
+    ADD COLUMN IF NOT EXISTS retryable   boolean NOT NULL DEFAULT false;
@@ -0,0 +1,6 @@
+-- статус DEAD и последняя ошибка отправки
+ALTER TABLE checkout.outbox_events ADD COLUMN IF NOT EXISTS last_error text;
+
+COMMENT ON COLUMN checkout.outbox_events.status IS 'NEW|IN_PROGRESS|SENT|FAILED|DEAD';
+
+CREATE INDEX IF NOT EXISTS outbox_dead_idx ON checkout.outbox_events (updated_at) WHERE status = 'DEAD';
@@ -0,0 +1,24 @@
+-- архив отправленных событий: основная таблица и outbox_status_idx не растут бесконечно
+CREATE TABLE IF NOT EXISTS checkout.outbox_events_archive (
+    id              BIGINT      PRIMARY KEY,
+    aggregate_type  TEXT        NOT NULL,
+    aggregate_id    TEXT        NOT NULL,
+    event_type      TEXT        NOT NULL,
+    event_version   INT         NOT NULL,
+    key             TEXT        NOT NULL,
+    payload         JSONB       NOT NULL,
+    headers         JSONB       NOT NULL,
+    status          TEXT        NOT NULL,
+    attempt         INT         NOT NULL,
+    next_attempt_at TIMESTAMPTZ NOT NULL,
+    last_error      TEXT,
+    created_at      TIMESTAMPTZ NOT NULL,
+    updated_at      TIMESTAMPTZ NOT NULL,
+    archived_at     TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS outbox_archive_aggregate_idx ON checkout.outbox_events_archive (aggregate_type, aggregate_id);
+
+-- выборка SENT-событий к архивации и фильтры служебных ручек
+CREATE INDEX IF NOT EXISTS outbox_sent_idx ON checkout.outbox_events (updated_at) WHERE status = 'SENT';
+CREATE INDEX IF NOT EXISTS outbox_aggregate_idx ON checkout.outbox_events (aggregate_type, aggregate_id);
@@ -0,0 +1,2 @@
+-- порядок по ключу: поиск более раннего неотправленного события того же key
+CREATE INDEX IF NOT EXISTS outbox_key_pending_idx ON checkout.outbox_events (key, id) WHERE status <> 'SENT';
@@ -0,0 +1,12 @@
+-- владелец IN_PROGRESS-события и heartbeat воркеров: сбрасываются только строки
+-- воркеров, переставших отмечаться
+ALTER TABLE checkout.outbox_events ADD COLUMN IF NOT EXISTS locked_by text;
+
+CREATE TABLE IF NOT EXISTS checkout.outbox_workers (
+    worker_id    text        PRIMARY KEY,
+    leader       boolean     NOT NULL DEFAULT false, -- держит advisory-блокировку (если выборы включены)
+    started_at   timestamptz NOT NULL DEFAULT now(),
+    heartbeat_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS outbox_in_progress_idx ON checkout.outbox_events (locked_by) WHERE status = 'IN_PROGRESS';
@@ -0,0 +1,4 @@
+-- 3-D Secure: платёж ждёт действия покупателя, next_action — куда его отправить
+ALTER TYPE checkout.payment_status ADD VALUE IF NOT EXISTS 'REQUIRES_ACTION';
+
+ALTER TABLE checkout.payments ADD COLUMN IF NOT EXISTS next_action jsonb;
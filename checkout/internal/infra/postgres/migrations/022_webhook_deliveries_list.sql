@@ -0,0 +1,3 @@
+-- выдача доставок мерчанта от новых к старым (GET /v1/webhooks/deliveries)
+CREATE INDEX IF NOT EXISTS webhook_deliveries_merchant_idx
+ON checkout.webhook_deliveries (merchant_id, created_at DESC, delivery_id DESC);
@@ -0,0 +1,3 @@
+-- redeliver не обнуляет attempt (номера попыток в журнале не повторяются),
+-- а запоминает, с какой попытки считать паузы и лимит заново
+ALTER TABLE checkout.webhook_deliveries ADD COLUMN IF NOT EXISTS attempt_base int NOT NULL DEFAULT 0;
@@ -0,0 +1,9 @@
+-- индивидуальные лимиты мерчантов: меняются без перезапуска, сервис перечитывает
+-- таблицу раз в rate_limit.overrides_refresh. Пустой route — все ручки мерчанта
+CREATE TABLE IF NOT EXISTS checkout.merchant_rate_limits (
+    merchant_id text NOT NULL REFERENCES checkout.merchants (merchant_id),
+    route       text NOT NULL DEFAULT '',
+    rate        double precision NOT NULL CHECK (rate > 0),
+    burst       int NOT NULL CHECK (burst > 0),
+    PRIMARY KEY (merchant_id, route)
+);
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// OutboxChannel — канал NOTIFY, в который пишет insertOutboxEvent
+const OutboxChannel = "checkout_outbox"
+
+// OutboxListener будит outbox-воркер по NOTIFY. LISTEN держится на отдельном
+// соединении, изъятом из пула, чтобы не занимать его у запросов
+type OutboxListener struct {
+	pool  *pgxpool.Pool
+	retry time.Duration
+}
+
+func (r *PaymentsRepo) OutboxListener() *OutboxListener {
+	return &OutboxListener{pool: r.pool, retry: time.Second}
+}
+
+// Listen блокируется до отмены ctx. На каждое уведомление шлёт в wake, не блокируясь:
+// несколько NOTIFY подряд схлопываются в одно пробуждение. После обрыва соединения
+// переподключается и будит воркер — уведомления за время обрыва потеряны
+func (l *OutboxListener) Listen(ctx context.Context, wake chan<- struct{}) {
+	for {
+		err := l.listen(ctx, wake)
+		if ctx.Err() != nil {
+			log.Println("Outbox listener closed...")
+			return
+		}
+		log.Printf("outbox listener: connection lost, retry in %s:%v", l.retry, err)
+
+		select {
+		case <-time.After(l.retry):
+		case <-ctx.Done():
+			log.Println("Outbox listener closed...")
+			return
+		}
+		notify(wake)
+	}
+}
+
+func (l *OutboxListener) listen(ctx context.Context, wake chan<- struct{}) error {
+	pc, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	conn := pc.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+OutboxChannel); err != nil {
+		return err
+	}
+
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return err
+		}
+		notify(wake)
+	}
+}
+
+func notify(wake chan<- struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,191 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/outbox"
+	"github.com/jackc/pgx/v5"
+)
+
+const outboxColumns = `id, aggregate_type, aggregate_id, event_type, event_version, key, payload, headers,
+	status, attempt, next_attempt_at, last_error, created_at, updated_at`
+
+// ключ advisory-блокировки архивации ("chkarc" в ASCII)
+const archiveLockKey int64 = 0x63686b617263
+
+// SENT-события старше $1 секунд, не больше $2 за раз
+const pickSentSQL = `
+SELECT id FROM checkout.outbox_events
+WHERE status = 'SENT' AND updated_at < now() - make_interval(secs => $1)
+ORDER BY id
+LIMIT $2
+FOR UPDATE SKIP LOCKED
+`
+
+func (r *PaymentsRepo) ListEvents(ctx context.Context, f outbox.ListFilter) ([]outbox.Event, error) {
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.Status != "" {
+		add("status = $%d", string(f.Status))
+	}
+	if f.AggregateType != "" {
+		add("aggregate_type = $%d", f.AggregateType)
+	}
+	if f.AggregateID != "" {
+		add("aggregate_id = $%d", f.AggregateID)
+	}
+	if f.OlderThan > 0 {
+		add("created_at <= now() - make_interval(secs => $%d)", f.OlderThan.Seconds())
+	}
+	if f.NewerThan > 0 {
+		add("created_at > now() - make_interval(secs => $%d)", f.NewerThan.Seconds())
+	}
+	if f.BeforeID > 0 {
+		add("id < $%d", f.BeforeID)
+	}
+
+	query := `SELECT ` + outboxColumns + ` FROM checkout.outbox_events`
+	if len(conds) > 0 {
+		query += ` WHERE ` + strings.Join(conds, " AND ")
+	}
+	args = append(args, f.Limit)
+	query += fmt.Sprintf(` ORDER BY id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	evts := make([]outbox.Event, 0, f.Limit)
+	for rows.Next() {
+		row, err := scanOutboxEvent(rows)
+		if err != nil {
+			return nil, fmt.Errorf("cant parse row to outboxEventRow, err:%w", err)
+		}
+		evts = append(evts, OutboxRowToDomain(row))
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error with rows: %w", rows.Err())
+	}
+
+	return evts, nil
+}
+
+func (r *PaymentsRepo) GetEvent(ctx context.Context, id int64) (outbox.Event, error) {
+	row, err := scanOutboxEvent(r.pool.QueryRow(ctx,
+		`SELECT `+outboxColumns+` FROM checkout.outbox_events WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return outbox.Event{}, outbox.ErrNotFound
+	}
+	if err != nil {
+		return outbox.Event{}, err
+	}
+	return OutboxRowToDomain(row), nil
+}
+
+func (r *PaymentsRepo) RetryEvent(ctx context.Context, id int64) (outbox.Event, error) {
+	row, err := scanOutboxEvent(r.pool.QueryRow(ctx,
+		`UPDATE checkout.outbox_events
+		 SET status = 'NEW', attempt = 0, next_attempt_at = now(), updated_at = now()
+		 WHERE id = $1 AND status IN ('FAILED', 'DEAD')
+		 RETURNING `+outboxColumns, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		// отличаем несуществующее событие от события в другом статусе
+		if _, err := r.GetEvent(ctx, id); err != nil {
+			return outbox.Event{}, err
+		}
+		return outbox.Event{}, outbox.ErrNotRetryable
+	}
+	if err != nil {
+		return outbox.Event{}, err
+	}
+	return OutboxRowToDomain(row), nil
+}
+
+func (r *PaymentsRepo) RetryEvents(ctx context.Context, status outbox.Status) (int64, error) {
+	if status != outbox.StatusFailed && status != outbox.StatusDead {
+		return 0, outbox.ErrNotRetryable
+	}
+	tag, err := r.pool.Exec(ctx,
+		`UPDATE checkout.outbox_events
+		 SET status = 'NEW', attempt = 0, next_attempt_at = now(), updated_at = now()
+		 WHERE status = $1`, string(status))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// ArchiveSent переносит пачку в архив одной командой: DELETE ... RETURNING + INSERT.
+// Пачку берёт один инстанс (advisory-блокировка транзакции), остальные получают 0
+func (r *PaymentsRepo) ArchiveSent(ctx context.Context, olderThan time.Duration, batch int, archive bool) (int64, error) {
+	tx, err := begin(ctx, r.pool)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	var locked bool
+	if err := tx.QueryRow(ctx, `SELECT pg_try_advisory_xact_lock($1)`, archiveLockKey).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+
+	moved := `
+WITH moved AS (
+  DELETE FROM checkout.outbox_events
+  WHERE id IN (` + pickSentSQL + `)
+  RETURNING ` + outboxColumns + `
+)
+`
+	var n int64
+	if archive {
+		tag, err := tx.Exec(ctx, moved+`
+INSERT INTO checkout.outbox_events_archive (`+outboxColumns+`)
+SELECT `+outboxColumns+` FROM moved`, olderThan.Seconds(), batch)
+		if err != nil {
+			return 0, err
+		}
+		n = tag.RowsAffected()
+	} else if err := tx.QueryRow(ctx, moved+`SELECT count(*) FROM moved`, olderThan.Seconds(), batch).Scan(&n); err != nil {
+		return 0, err
+	}
+
+	return n, tx.Commit(ctx)
+}
+
+func scanOutboxEvent(row pgx.Row) (OutboxEventRow, error) {
+	var e OutboxEventRow
+	err := row.Scan(
+		&e.ID,
+		&e.AggregateType,
+		&e.AggregateID,
+		&e.EventType,
+		&e.EventVersion,
+		&e.Key,
+		&e.Payload,
+		&e.Headers,
+		&e.Status,
+		&e.Attempt,
+		&e.NextAttemptAt,
+		&e.LastError,
+		&e.CreatedAt,
+		&e.UpdatedAt,
+	)
+	return e, err
+}
@@ -7,13 +7,14 @@ type OutboxEventRow struct {
 	AggregateType string    `db:"aggregate_type"`
 	AggregateID   string    `db:"aggregate_id"`
 	EventType     string    `db:"event_type"`
-	EventVersion  string    `db:"event_version"`
+	EventVersion  int       `db:"event_version"`
 	Key           string    `db:"key"`
 	Payload       []byte    `db:"payload"`
 	Headers       []byte    `db:"headers"`
 	Status        string    `db:"status"`
 	Attempt       int       `db:"attempt"`
 	NextAttemptAt time.Time `db:"next_attempt_at"`
+	LastError     *string   `db:"last_error"`
 	CreatedAt     time.Time `db:"created_at"`
 	UpdatedAt     time.Time `db:"updated_at"`
 }
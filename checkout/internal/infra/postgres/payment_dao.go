@@ -17,4 +17,9 @@ type PaymentRow struct {
 	PSPRef      *string         `db:"psp_reference"`
 	CreatedAt   time.Time       `db:"created_at"`
 	UpdatedAt   time.Time       `db:"updated_at"`
+
+	CaptureMethod          string           `db:"capture_method"`
+	AmountCaptured         *decimal.Decimal `db:"amount_captured"`
+	AuthorizationExpiresAt *time.Time       `db:"authorization_expires_at"`
+	NextAction             []byte           `db:"next_action"`
 }
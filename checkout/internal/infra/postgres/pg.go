@@ -3,6 +3,7 @@ package postgres
 import (
 	"context"
 	"embed"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
@@ -10,39 +11,59 @@ import (
 	"strings"
 	"time"
 
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/outbox"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/webhook"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 // PickBatch: статус NEW/FAILED, время пришло, отметим IN_PROGRESS и вернём.
+// Берётся только голова каждого key — событие, раньше которого по этому key
+// нет неотправленных (NEW, IN_PROGRESS, FAILED, DEAD). Так события одного
+// платежа уходят в Kafka строго по порядку, а разные key — параллельно.
+// DEAD тоже держит очередь key, пока его не вернут в работу через админку
 const pickSQL = `
 WITH cte AS (
-  SELECT id
-  FROM checkout.outbox_events
-  WHERE status IN ('NEW','FAILED') AND next_attempt_at <= now()
-  ORDER BY id
+  SELECT o.id
+  FROM checkout.outbox_events o
+  WHERE o.status IN ('NEW','FAILED') AND o.next_attempt_at <= now()
+    AND NOT EXISTS (
+      SELECT 1 FROM checkout.outbox_events p
+      WHERE p.key = o.key AND p.id < o.id AND p.status <> 'SENT'
+    )
+  ORDER BY o.id
   FOR UPDATE SKIP LOCKED
   LIMIT $1
 )
 UPDATE checkout.outbox_events o
-SET status='IN_PROGRESS', updated_at=now()
+SET status='IN_PROGRESS', locked_by=$2, updated_at=now()
 FROM cte
 WHERE o.id = cte.id
-RETURNING o.id, o.event_type, o.key, o.payload, o.headers;
+RETURNING o.id, o.attempt, o.event_type, o.key, o.payload, o.headers;
 `
 
+// resetSQL забирает себе ($1) события, зависшие в IN_PROGRESS: их владелец
+// перестал слать heartbeat дольше $2 секунд (упал посреди отправки), либо это
+// собственные строки старше $3 секунд, которые не удалось закрыть после отправки. Воркер засчитает
+// им неудачную попытку. Строки живых чужих воркеров не трогаются
 const resetSQL = `
 UPDATE checkout.outbox_events o
-SET status='FAILED',
-    attempt = attempt + 1,
-	next_attempt_at = now() + interval '30 sec',
-    updated_at=now()
-WHERE o.updated_at < now() - interval '5 min' AND
-	o.status = 'IN_PROGRESS'
+SET locked_by=$1, updated_at=now()
+WHERE o.status = 'IN_PROGRESS' AND (
+	NOT EXISTS (
+	  SELECT 1 FROM checkout.outbox_workers w
+	  WHERE w.worker_id = o.locked_by AND w.heartbeat_at > now() - make_interval(secs => $2)
+	)
+	OR (o.locked_by = $1 AND o.updated_at < now() - make_interval(secs => $3))
+)
+RETURNING o.id, o.attempt, o.event_type, o.key, o.payload, o.headers;
 `
 
+const paymentColumns = `payment_id, merchant_id, order_id, amount, currency, method_token, status,
+	psp_reference, capture_method, amount_captured, authorization_expires_at, next_action, created_at, updated_at`
+
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
@@ -143,35 +164,38 @@ func (r *PaymentsRepo) RunMigrations() error {
 	return nil
 }
 
-func (r *PaymentsRepo) InsertPayment(ctx context.Context, payment payment.Payment, env event.Envelope) error {
+func (r *PaymentsRepo) InsertPayment(ctx context.Context, pay payment.Payment, env event.Envelope) error {
 	eventRow, err := EnvelopeToRow(env)
 	if err != nil {
 		return fmt.Errorf("invalid event, can't parse to row %w", err)
 	}
-	payRow := PaymentToRow(payment)
+	payRow := PaymentToRow(pay)
 
-	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{})
+	tx, err := begin(ctx, r.pool)
 	if err != nil {
 		return err
 	}
 	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
 
 	_, err = tx.Exec(ctx,
-		`INSERT INTO checkout.payments (payment_id, merchant_id, order_id, amount, currency, method_token, psp_reference)
-  		 VALUES ($1,$2,$3,$4,$5,$6,$7)`,
-		payRow.ID, payRow.MerchantID, payRow.OrderID, payRow.Amount, payRow.Currency, payRow.MethodToken, payRow.PSPRef)
+		`INSERT INTO checkout.payments (payment_id, merchant_id, order_id, amount, currency, method_token, psp_reference, capture_method)
+  		 VALUES ($1,$2,$3,$4,$5,$6,$7,$8)`,
+		payRow.ID, payRow.MerchantID, payRow.OrderID, payRow.Amount, payRow.Currency, payRow.MethodToken, payRow.PSPRef,
+		payRow.CaptureMethod)
 
 	if err != nil {
 		return err
 	}
 
-	_, err = tx.Exec(ctx,
-		`INSERT INTO checkout.outbox_events (aggregate_type, aggregate_id, event_type, key, payload, headers)
-  		 VALUES ($1,$2,$3,$4,$5,$6)`,
-		eventRow.AggregateType, eventRow.AggregateID, eventRow.EventType,
-		eventRow.Key, eventRow.Payload, eventRow.Headers)
+	if err := insertStatusHistory(ctx, tx, payment.StatusChange{
+		PaymentID: payRow.ID,
+		To:        payment.PaymentStatus(payRow.Status),
+		Source:    eventRow.EventType,
+	}); err != nil {
+		return err
+	}
 
-	if err != nil {
+	if err := insertOutboxEvent(ctx, tx, eventRow); err != nil {
 		return err
 	}
 
@@ -183,116 +207,434 @@ func (r *PaymentsRepo) InsertPayment(ctx context.Context, payment payment.Paymen
 }
 
 func (r *PaymentsRepo) GetPaymentByID(ctx context.Context, id string) (payment.Payment, error) {
-	var row PaymentRow
-
-	err := r.pool.QueryRow(ctx,
-		`SELECT payment_id, merchant_id, order_id, amount, currency, status, psp_reference, created_at, updated_at
+	row, err := scanPayment(r.pool.QueryRow(ctx,
+		`SELECT `+paymentColumns+`
          FROM checkout.payments
          WHERE payment_id = $1`, id,
-	).Scan(
-		&row.ID,
-		&row.MerchantID,
-		&row.OrderID,
-		&row.Amount,
-		&row.Currency,
-		&row.Status,
-		&row.PSPRef,
-		&row.CreatedAt,
-		&row.UpdatedAt,
-	)
+	))
 
 	return PaymentRowToDomain(row), err
 }
 
 func (r *PaymentsRepo) GetPaymentByUniqKeys(ctx context.Context, merchantID, orderID string) (payment.Payment, error) {
-	var row PaymentRow
-
-	err := r.pool.QueryRow(ctx,
-		`SELECT payment_id, merchant_id, order_id, amount, currency, status, psp_reference, created_at, updated_at
+	row, err := scanPayment(r.pool.QueryRow(ctx,
+		`SELECT `+paymentColumns+`
          FROM checkout.payments
          WHERE merchant_id = $1 AND order_id = $2`, merchantID, orderID,
-	).Scan(
-		&row.ID,
-		&row.MerchantID,
-		&row.OrderID,
-		&row.Amount,
-		&row.Currency,
-		&row.Status,
-		&row.PSPRef,
-		&row.CreatedAt,
-		&row.UpdatedAt,
-	)
+	))
 
 	return PaymentRowToDomain(row), err
 }
 
-func (r *PaymentsRepo) PickBatch(ctx context.Context, count int) (map[int64]event.Envelope, error) {
-	tx, err := r.pool.BeginTx(ctx, pgx.TxOptions{})
+// Transition меняет статус платежа по автомату переходов.
+// UPDATE выполняется с условием на ожидаемый текущий статус, поэтому
+// конкурентная смена статуса даёт payment.ErrStatusConflict, а не перезапись.
+// Если задан EventID, событие дедуплицируется через checkout.inbox_events.
+func (r *PaymentsRepo) Transition(ctx context.Context, tr payment.Transition) (payment.Payment, error) {
+	tx, err := begin(ctx, r.pool)
 	if err != nil {
-		return nil, err
+		return payment.Payment{}, err
 	}
 	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
 
-	rows, err := tx.Query(ctx, pickSQL, count)
+	if tr.EventID != "" {
+		inserted, err := insertInboxEvent(ctx, tx, tr.EventID, tr.EventType, tr.PaymentID)
+		if err != nil {
+			return payment.Payment{}, err
+		}
+		if !inserted {
+			return payment.Payment{}, payment.ErrDuplicateEvent
+		}
+	}
+
+	from := tr.From
+	if from == "" {
+		var current string
+		err := tx.QueryRow(ctx,
+			`SELECT status FROM checkout.payments WHERE payment_id = $1`, tr.PaymentID,
+		).Scan(&current)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return payment.Payment{}, payment.ErrNotFound
+		}
+		if err != nil {
+			return payment.Payment{}, err
+		}
+		from = payment.PaymentStatus(current)
+	}
+
+	if err := payment.ValidateTransition(tr.PaymentID, from, tr.To); err != nil {
+		return payment.Payment{}, err
+	}
+
+	row, err := scanPayment(tx.QueryRow(ctx,
+		`UPDATE checkout.payments
+		 SET status = $3,
+		     psp_reference = COALESCE($4, psp_reference),
+		     amount_captured = CASE WHEN $3 = 'SUCCEEDED' THEN COALESCE($5, amount) ELSE amount_captured END,
+		     authorization_expires_at = CASE WHEN $3 IN ('SUCCEEDED', 'FAILED', 'VOIDED') THEN NULL
+		                                     ELSE COALESCE($6, authorization_expires_at) END,
+		     next_action = CASE WHEN $3 = 'REQUIRES_ACTION' THEN $7::jsonb ELSE NULL END,
+		     updated_at = now()
+		 WHERE payment_id = $1 AND status = $2
+		 RETURNING `+paymentColumns,
+		tr.PaymentID, string(from), string(tr.To), tr.PSPRef, tr.AmountCaptured, tr.AuthorizationExpiresAt,
+		NextActionToJSON(tr.NextAction),
+	))
+	if errors.Is(err, pgx.ErrNoRows) {
+		// статус не совпал с ожидаемым (или платежа нет при заданном From)
+		return payment.Payment{}, payment.ErrStatusConflict
+	}
+	if err != nil {
+		return payment.Payment{}, err
+	}
+
+	change := payment.StatusChange{
+		PaymentID: tr.PaymentID,
+		From:      &from,
+		To:        tr.To,
+		Source:    tr.EventType,
+	}
+	if tr.EventID != "" {
+		change.EventID = &tr.EventID
+	}
+	if tr.Reason != "" {
+		change.ErrorDetails = &tr.Reason
+	}
+	if err := insertStatusHistory(ctx, tx, change); err != nil {
+		return payment.Payment{}, err
+	}
+
+	// уведомления мерчанту — в той же транзакции, что и смена статуса
+	notification, err := webhook.NewPaymentNotification(PaymentRowToDomain(row))
+	if err != nil {
+		return payment.Payment{}, err
+	}
+	if err := insertWebhookDeliveries(ctx, tx, notification); err != nil {
+		return payment.Payment{}, err
+	}
+
+	if tr.Out != nil {
+		eventRow, err := EnvelopeToRow(*tr.Out)
+		if err != nil {
+			return payment.Payment{}, fmt.Errorf("invalid event, can't parse to row %w", err)
+		}
+		if err := insertOutboxEvent(ctx, tx, eventRow); err != nil {
+			return payment.Payment{}, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return payment.Payment{}, err
+	}
+
+	return PaymentRowToDomain(row), nil
+}
+
+// ListPayments — keyset-пагинация по (created_at, payment_id) от новых к старым
+func (r *PaymentsRepo) ListPayments(ctx context.Context, f payment.ListFilter) ([]payment.Payment, error) {
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	if f.MerchantID != "" {
+		add("merchant_id = $%d", f.MerchantID)
+	}
+	if f.Status != "" {
+		add("status = $%d", string(f.Status))
+	}
+	if f.Currency != "" {
+		add("currency = $%d", f.Currency)
+	}
+	if f.OrderID != "" {
+		add("order_id = $%d", f.OrderID)
+	}
+	if f.CreatedFrom != nil {
+		add("created_at >= $%d", *f.CreatedFrom)
+	}
+	if f.CreatedTo != nil {
+		add("created_at < $%d", *f.CreatedTo)
+	}
+	if f.After != nil {
+		args = append(args, f.After.CreatedAt, f.After.ID)
+		conds = append(conds, fmt.Sprintf("(created_at, payment_id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	query := `SELECT ` + paymentColumns + ` FROM checkout.payments`
+	if len(conds) > 0 {
+		query += ` WHERE ` + strings.Join(conds, " AND ")
+	}
+	args = append(args, f.Limit)
+	query += fmt.Sprintf(` ORDER BY created_at DESC, payment_id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	envs := make(map[int64]event.Envelope, count)
+	pays := make([]payment.Payment, 0, f.Limit)
+	for rows.Next() {
+		row, err := scanPayment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("cant parse row to paymentRow, err:%w", err)
+		}
+		pays = append(pays, PaymentRowToDomain(row))
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error with rows: %w", rows.Err())
+	}
 
+	return pays, nil
+}
+
+// ListExpiredAuthorizations — AUTHORIZED платежи, у которых истёк срок авторизации.
+// Попытки отмены видны в истории статусов (source authorization.expired): платёж
+// берётся, если их меньше maxAttempts (0 — без ограничения) и последняя была раньше retryAfter
+func (r *PaymentsRepo) ListExpiredAuthorizations(ctx context.Context, limit, maxAttempts int,
+	retryAfter time.Duration) ([]payment.Payment, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+paymentColumns+`
+		 FROM checkout.payments p
+		 CROSS JOIN LATERAL (
+		   SELECT count(*) AS attempts, max(h.occurred_at) AS last_at
+		   FROM checkout.payment_status_history h
+		   WHERE h.payment_id = p.payment_id AND h.source = 'authorization.expired'
+		 ) v
+		 WHERE p.status = 'AUTHORIZED' AND p.authorization_expires_at <= now()
+		   AND ($2 <= 0 OR v.attempts < $2)
+		   AND (v.last_at IS NULL OR v.last_at <= now() - make_interval(secs => $3))
+		 ORDER BY p.authorization_expires_at
+		 LIMIT $1`, limit, maxAttempts, retryAfter.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pays := make([]payment.Payment, 0)
 	for rows.Next() {
-		var outRow OutboxEventRow
-		err := rows.Scan(&outRow.ID, &outRow.EventType, &outRow.Key, &outRow.Payload, &outRow.Headers)
+		row, err := scanPayment(rows)
 		if err != nil {
-			return nil, fmt.Errorf("cant parse row to outboxEventRow, err:%w", err)
+			return nil, fmt.Errorf("cant parse row to paymentRow, err:%w", err)
 		}
-		env, err := OutboxRowToEnvelope(outRow)
+		pays = append(pays, PaymentRowToDomain(row))
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error with rows: %w", rows.Err())
+	}
+
+	return pays, nil
+}
+
+func (r *PaymentsRepo) GetStatusHistory(ctx context.Context, paymentID string) ([]payment.StatusChange, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT id, payment_id, from_status, to_status, source, event_id, error_details, occurred_at
+		 FROM checkout.payment_status_history
+		 WHERE payment_id = $1
+		 ORDER BY id`, paymentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history := make([]payment.StatusChange, 0)
+	for rows.Next() {
+		var row StatusHistoryRow
+		err := rows.Scan(&row.ID, &row.PaymentID, &row.FromStatus, &row.ToStatus,
+			&row.Source, &row.EventID, &row.ErrorDetails, &row.OccurredAt)
 		if err != nil {
-			return nil, fmt.Errorf("cant parse outboxEventRow to envelope, err:%w", err)
+			return nil, fmt.Errorf("cant parse row to statusHistoryRow, err:%w", err)
 		}
-		envs[outRow.ID] = env
+		history = append(history, StatusHistoryRowToDomain(row))
 	}
 
 	if rows.Err() != nil {
 		return nil, fmt.Errorf("error with rows: %w", rows.Err())
 	}
 
-	err = tx.Commit(ctx)
+	return history, nil
+}
 
+func scanPayment(row pgx.Row) (PaymentRow, error) {
+	var p PaymentRow
+	err := row.Scan(
+		&p.ID,
+		&p.MerchantID,
+		&p.OrderID,
+		&p.Amount,
+		&p.Currency,
+		&p.MethodToken,
+		&p.Status,
+		&p.PSPRef,
+		&p.CaptureMethod,
+		&p.AmountCaptured,
+		&p.AuthorizationExpiresAt,
+		&p.NextAction,
+		&p.CreatedAt,
+		&p.UpdatedAt,
+	)
+	return p, err
+}
+
+// insertOutboxEvent пишет событие и NOTIFY в канал outbox одной командой:
+// уведомление уходит слушателям только при коммите транзакции
+func insertOutboxEvent(ctx context.Context, tx pgx.Tx, row OutboxEventRow) error {
+	_, err := tx.Exec(ctx,
+		`WITH ins AS (
+		   INSERT INTO checkout.outbox_events (aggregate_type, aggregate_id, event_type, key, payload, headers)
+		   VALUES ($1,$2,$3,$4,$5,$6)
+		   RETURNING id
+		 )
+		 SELECT pg_notify('`+OutboxChannel+`', id::text) FROM ins`,
+		row.AggregateType, row.AggregateID, row.EventType,
+		row.Key, row.Payload, row.Headers)
+	return err
+}
+
+// false — событие уже обработано
+func insertInboxEvent(ctx context.Context, tx pgx.Tx, eventID, eventType, paymentID string) (bool, error) {
+	res, err := tx.Exec(ctx,
+		`INSERT INTO checkout.inbox_events (event_id, event_type, payment_id)
+		 VALUES ($1,$2,$3)
+		 ON CONFLICT (event_id) DO NOTHING`,
+		eventID, eventType, paymentID)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+func insertStatusHistory(ctx context.Context, tx pgx.Tx, c payment.StatusChange) error {
+	var from *string
+	if c.From != nil {
+		s := string(*c.From)
+		from = &s
+	}
+	_, err := tx.Exec(ctx,
+		`INSERT INTO checkout.payment_status_history (payment_id, from_status, to_status, source, event_id, error_details)
+		 VALUES ($1,$2,$3,$4,$5,$6)`,
+		c.PaymentID, from, string(c.To), c.Source, c.EventID, c.ErrorDetails)
+	return err
+}
+
+func (r *PaymentsRepo) PickBatch(ctx context.Context, count int, workerID string) ([]outbox.Message, error) {
+	tx, err := begin(ctx, r.pool)
 	if err != nil {
 		return nil, err
 	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	msgs, err := queryOutboxMessages(ctx, tx, pickSQL, count, workerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
 
-	return envs, nil
+	return msgs, nil
 }
 
 func (r *PaymentsRepo) MarkSent(ctx context.Context, ids []int64) error {
 	_, err := r.pool.Exec(ctx, `
         UPDATE checkout.outbox_events
-        SET status='SENT', updated_at=now()
+        SET status='SENT', last_error = NULL, locked_by = NULL, updated_at=now()
         WHERE id = ANY($1)
     `, ids)
 	return err
 }
 
-func (r *PaymentsRepo) MarkFailed(ctx context.Context, ids []int64) error {
+// MarkFailed: NextAttemptAt == nil переводит событие в DEAD
+func (r *PaymentsRepo) MarkFailed(ctx context.Context, failures []outbox.Failure) error {
+	var (
+		ids      = make([]int64, len(failures))
+		attempts = make([]int32, len(failures))
+		errs     = make([]string, len(failures))
+		next     = make([]*time.Time, len(failures))
+	)
+	for i, f := range failures {
+		ids[i], attempts[i], errs[i], next[i] = f.ID, int32(f.Attempt), f.Error, f.NextAttemptAt
+	}
+
 	_, err := r.pool.Exec(ctx, `
-        UPDATE checkout.outbox_events
-        SET status='FAILED',
-            attempt = attempt + 1,
-            next_attempt_at = now() + interval '30 sec',
+        UPDATE checkout.outbox_events o
+        SET status = CASE WHEN f.next_at IS NULL THEN 'DEAD' ELSE 'FAILED' END,
+            attempt = f.attempt,
+            last_error = f.err,
+            next_attempt_at = COALESCE(f.next_at, o.next_attempt_at),
+            locked_by = NULL,
             updated_at = now()
-        WHERE id = ANY($1)
-    `, ids)
+        FROM unnest($1::bigint[], $2::int[], $3::text[], $4::timestamptz[]) AS f(id, attempt, err, next_at)
+        WHERE o.id = f.id
+    `, ids, attempts, errs, next)
 	return err
 }
 
-func (r *PaymentsRepo) ResetEvents(ctx context.Context) error {
-	if _, err := r.pool.Exec(ctx, resetSQL); err != nil {
-		return err
+func (r *PaymentsRepo) ResetEvents(ctx context.Context, workerID string, ownerTTL, reclaimAfter time.Duration) ([]outbox.Message, error) {
+	return queryOutboxMessages(ctx, r.pool, resetSQL, workerID, ownerTTL.Seconds(), reclaimAfter.Seconds())
+}
+
+// Heartbeat отмечает, что воркер жив; его IN_PROGRESS-строки не сбрасываются
+func (r *PaymentsRepo) Heartbeat(ctx context.Context, workerID string, leader bool) error {
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO checkout.outbox_workers (worker_id, leader) VALUES ($1, $2)
+		 ON CONFLICT (worker_id) DO UPDATE SET leader = EXCLUDED.leader, heartbeat_at = now()`,
+		workerID, leader)
+	return err
+}
+
+// PruneWorkers удаляет воркеров без heartbeat дольше olderThan: упавшие
+// не успели Deregister. Их строки resetSQL забирает и без записи о воркере
+func (r *PaymentsRepo) PruneWorkers(ctx context.Context, olderThan time.Duration) (int64, error) {
+	res, err := r.pool.Exec(ctx,
+		`DELETE FROM checkout.outbox_workers WHERE heartbeat_at < now() - make_interval(secs => $1)`,
+		olderThan.Seconds())
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	return res.RowsAffected(), nil
+}
+
+// Deregister при остановке: строки воркера сразу можно забирать
+func (r *PaymentsRepo) Deregister(ctx context.Context, workerID string) error {
+	_, err := r.pool.Exec(ctx, `DELETE FROM checkout.outbox_workers WHERE worker_id = $1`, workerID)
+	return err
+}
+
+func queryOutboxMessages(ctx context.Context, q querier, sql string, args ...any) ([]outbox.Message, error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []outbox.Message
+	for rows.Next() {
+		var outRow OutboxEventRow
+		err := rows.Scan(&outRow.ID, &outRow.Attempt, &outRow.EventType, &outRow.Key, &outRow.Payload, &outRow.Headers)
+		if err != nil {
+			return nil, fmt.Errorf("cant parse row to outboxEventRow, err:%w", err)
+		}
+		// битая строка не должна блокировать остальную пачку
+		env, err := OutboxRowToEnvelope(outRow)
+		if err != nil {
+			err = fmt.Errorf("cant parse outboxEventRow to envelope, err:%w", err)
+		}
+		msgs = append(msgs, outbox.Message{ID: outRow.ID, Attempt: outRow.Attempt, Envelope: env, DecodeErr: err})
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error with rows: %w", rows.Err())
+	}
+
+	return msgs, nil
 }
 
 func newPostgresPool(dsn string) (*pgxpool.Pool, error) {
@@ -0,0 +1,34 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/ratelimit"
+)
+
+// ListRateLimitOverrides отдаёт все индивидуальные лимиты: их немного,
+// лимитер держит их в памяти и перечитывает целиком
+func (r *PaymentsRepo) ListRateLimitOverrides(ctx context.Context) ([]ratelimit.Override, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT merchant_id, route, rate, burst FROM checkout.merchant_rate_limits`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var overrides []ratelimit.Override
+	for rows.Next() {
+		var o ratelimit.Override
+		if err := rows.Scan(&o.MerchantID, &o.Route, &o.Rate, &o.Burst); err != nil {
+			return nil, fmt.Errorf("cant parse row to rate limit override, err:%w", err)
+		}
+		overrides = append(overrides, o)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error with rows: %w", rows.Err())
+	}
+
+	return overrides, nil
+}
@@ -0,0 +1,22 @@
+package postgres
+
+import (
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+type RefundRow struct {
+	ID             string          `db:"refund_id"`
+	PaymentID      string          `db:"payment_id"`
+	MerchantID     string          `db:"merchant_id"`
+	Amount         decimal.Decimal `db:"amount"`
+	Currency       string          `db:"currency"`
+	Reason         string          `db:"reason"`
+	Status         string          `db:"status"`
+	PSPRef         *string         `db:"psp_reference"`
+	FailureReason  *string         `db:"failure_reason"`
+	IdempotencyKey string          `db:"idempotency_key"`
+	CreatedAt      time.Time       `db:"created_at"`
+	UpdatedAt      time.Time       `db:"updated_at"`
+}
@@ -0,0 +1,191 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/refund"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/webhook"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+const refundColumns = `refund_id, payment_id, merchant_id, amount, currency, reason, status,
+	psp_reference, failure_reason, idempotency_key, created_at, updated_at`
+
+// возвраты, которые уменьшают остаток платежа
+const refundedAmountSQL = `
+SELECT COALESCE(SUM(amount), 0)
+FROM checkout.refunds
+WHERE payment_id = $1 AND status IN ('PENDING', 'SUCCEEDED')
+`
+
+func (r *PaymentsRepo) InsertRefund(ctx context.Context, ref refund.Refund, env event.Envelope) error {
+	eventRow, err := EnvelopeToRow(env)
+	if err != nil {
+		return fmt.Errorf("invalid event, can't parse to row %w", err)
+	}
+	row := RefundToRow(ref)
+
+	tx, err := begin(ctx, r.pool)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	// блокируем платёж: конкурентные возвраты считают остаток по очереди
+	var (
+		paid   decimal.Decimal
+		status string
+	)
+	err = tx.QueryRow(ctx,
+		`SELECT COALESCE(amount_captured, amount), status FROM checkout.payments WHERE payment_id = $1 FOR UPDATE`,
+		row.PaymentID,
+	).Scan(&paid, &status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return payment.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if payment.PaymentStatus(status) != payment.StatusSucceeded {
+		return refund.ErrPaymentNotRefundable
+	}
+
+	var refunded decimal.Decimal
+	if err := tx.QueryRow(ctx, refundedAmountSQL, row.PaymentID).Scan(&refunded); err != nil {
+		return err
+	}
+	if row.Amount.GreaterThan(refund.Remaining(paid, refunded)) {
+		return refund.ErrExceedsRefundable
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO checkout.refunds (refund_id, payment_id, merchant_id, amount, currency, reason, idempotency_key)
+		 VALUES ($1,$2,$3,$4,$5,$6,$7)`,
+		row.ID, row.PaymentID, row.MerchantID, row.Amount, row.Currency, row.Reason, row.IdempotencyKey)
+	if err != nil {
+		return err
+	}
+
+	if err := insertOutboxEvent(ctx, tx, eventRow); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *PaymentsRepo) GetRefundByID(ctx context.Context, id string) (refund.Refund, error) {
+	row, err := scanRefund(r.pool.QueryRow(ctx,
+		`SELECT `+refundColumns+` FROM checkout.refunds WHERE refund_id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return refund.Refund{}, refund.ErrNotFound
+	}
+	return RefundRowToDomain(row), err
+}
+
+func (r *PaymentsRepo) GetRefundByIdemKey(ctx context.Context, paymentID, idemKey string) (refund.Refund, error) {
+	row, err := scanRefund(r.pool.QueryRow(ctx,
+		`SELECT `+refundColumns+` FROM checkout.refunds WHERE payment_id = $1 AND idempotency_key = $2`,
+		paymentID, idemKey))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return refund.Refund{}, refund.ErrNotFound
+	}
+	return RefundRowToDomain(row), err
+}
+
+func (r *PaymentsRepo) GetRefundedAmount(ctx context.Context, paymentID string) (decimal.Decimal, error) {
+	var refunded decimal.Decimal
+	err := r.pool.QueryRow(ctx, refundedAmountSQL, paymentID).Scan(&refunded)
+	return refunded, err
+}
+
+// TransitionRefund меняет статус возврата с guard'ом на текущий статус,
+// аналогично PaymentsRepo.Transition
+func (r *PaymentsRepo) TransitionRefund(ctx context.Context, tr refund.Transition) (refund.Refund, error) {
+	tx, err := begin(ctx, r.pool)
+	if err != nil {
+		return refund.Refund{}, err
+	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	if tr.EventID != "" {
+		inserted, err := insertInboxEvent(ctx, tx, tr.EventID, tr.EventType, tr.PaymentID)
+		if err != nil {
+			return refund.Refund{}, err
+		}
+		if !inserted {
+			return refund.Refund{}, payment.ErrDuplicateEvent
+		}
+	}
+
+	var current string
+	err = tx.QueryRow(ctx,
+		`SELECT status FROM checkout.refunds WHERE refund_id = $1`, tr.RefundID,
+	).Scan(&current)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return refund.Refund{}, refund.ErrNotFound
+	}
+	if err != nil {
+		return refund.Refund{}, err
+	}
+
+	if err := refund.ValidateTransition(tr.RefundID, refund.Status(current), tr.To); err != nil {
+		return refund.Refund{}, err
+	}
+
+	var failureReason *string
+	if tr.Reason != "" {
+		failureReason = &tr.Reason
+	}
+
+	row, err := scanRefund(tx.QueryRow(ctx,
+		`UPDATE checkout.refunds
+		 SET status = $3, psp_reference = COALESCE($4, psp_reference),
+		     failure_reason = COALESCE($5, failure_reason), updated_at = now()
+		 WHERE refund_id = $1 AND status = $2
+		 RETURNING `+refundColumns,
+		tr.RefundID, current, string(tr.To), tr.PSPRef, failureReason))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return refund.Refund{}, refund.ErrStatusConflict
+	}
+	if err != nil {
+		return refund.Refund{}, err
+	}
+
+	notification, err := webhook.NewRefundNotification(RefundRowToDomain(row))
+	if err != nil {
+		return refund.Refund{}, err
+	}
+	if err := insertWebhookDeliveries(ctx, tx, notification); err != nil {
+		return refund.Refund{}, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return refund.Refund{}, err
+	}
+
+	return RefundRowToDomain(row), nil
+}
+
+func scanRefund(row pgx.Row) (RefundRow, error) {
+	var r RefundRow
+	err := row.Scan(
+		&r.ID,
+		&r.PaymentID,
+		&r.MerchantID,
+		&r.Amount,
+		&r.Currency,
+		&r.Reason,
+		&r.Status,
+		&r.PSPRef,
+		&r.FailureReason,
+		&r.IdempotencyKey,
+		&r.CreatedAt,
+		&r.UpdatedAt,
+	)
+	return r, err
+}
@@ -0,0 +1,14 @@
+package postgres
+
+import "time"
+
+type StatusHistoryRow struct {
+	ID           int64     `db:"id"`
+	PaymentID    string    `db:"payment_id"`
+	FromStatus   *string   `db:"from_status"`
+	ToStatus     string    `db:"to_status"`
+	Source       string    `db:"source"`
+	EventID      *string   `db:"event_id"`
+	ErrorDetails *string   `db:"error_details"`
+	OccurredAt   time.Time `db:"occurred_at"`
+}
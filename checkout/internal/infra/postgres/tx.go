@@ -0,0 +1,50 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type txKey struct{}
+
+// общее у pgxpool.Pool и pgx.Tx
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// WithinTx выполняет fn в одной транзакции: методы репозиториев пакета,
+// получившие ctx из fn, работают внутри неё
+func (r *PaymentsRepo) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	tx, err := begin(ctx, r.pool)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	if err := fn(context.WithValue(ctx, txKey{}, tx)); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// begin открывает транзакцию, а внутри WithinTx — savepoint во внешней
+func begin(ctx context.Context, pool *pgxpool.Pool) (pgx.Tx, error) {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx.Begin(ctx)
+	}
+	return pool.BeginTx(ctx, pgx.TxOptions{})
+}
+
+// conn — внешняя транзакция из ctx или пул
+func conn(ctx context.Context, pool *pgxpool.Pool) querier {
+	if tx, ok := ctx.Value(txKey{}).(pgx.Tx); ok {
+		return tx
+	}
+	return pool
+}
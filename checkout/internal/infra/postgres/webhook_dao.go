@@ -0,0 +1,38 @@
+package postgres
+
+import "time"
+
+type WebhookEndpointRow struct {
+	ID         string    `db:"endpoint_id"`
+	MerchantID string    `db:"merchant_id"`
+	URL        string    `db:"url"`
+	Secret     string    `db:"secret"`
+	Enabled    bool      `db:"enabled"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+type WebhookDeliveryRow struct {
+	ID             string     `db:"delivery_id"`
+	EndpointID     string     `db:"endpoint_id"`
+	MerchantID     string     `db:"merchant_id"`
+	EventID        string     `db:"event_id"`
+	EventType      string     `db:"event_type"`
+	Payload        []byte     `db:"payload"`
+	Status         string     `db:"status"`
+	Attempt        int        `db:"attempt"`
+	NextAttemptAt  time.Time  `db:"next_attempt_at"`
+	LastStatusCode *int       `db:"last_status_code"`
+	LastError      *string    `db:"last_error"`
+	DeliveredAt    *time.Time `db:"delivered_at"`
+	CreatedAt      time.Time  `db:"created_at"`
+	UpdatedAt      time.Time  `db:"updated_at"`
+}
+
+type WebhookAttemptRow struct {
+	DeliveryID string    `db:"delivery_id"`
+	Attempt    int       `db:"attempt"`
+	StatusCode *int      `db:"status_code"`
+	Error      *string   `db:"error"`
+	DurationMs int       `db:"duration_ms"`
+	CreatedAt  time.Time `db:"created_at"`
+}
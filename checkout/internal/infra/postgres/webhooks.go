@@ -0,0 +1,387 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/webhook"
+	"github.com/jackc/pgx/v5"
+)
+
+const webhookEndpointColumns = `endpoint_id, merchant_id, url, secret, enabled, created_at`
+
+const webhookDeliveryColumns = `delivery_id, endpoint_id, merchant_id, event_id, event_type, payload, status,
+	attempt, next_attempt_at, last_status_code, last_error, delivered_at, created_at, updated_at`
+
+// те же колонки для UPDATE ... FROM, где имена неоднозначны
+const webhookDeliveryReturning = `d.delivery_id, d.endpoint_id, d.merchant_id, d.event_id, d.event_type, d.payload,
+	d.status, d.attempt, d.next_attempt_at, d.last_status_code, d.last_error, d.delivered_at, d.created_at, d.updated_at`
+
+// PickDeliveries: как PickBatch для outbox — забираем готовые к отправке и помечаем IN_PROGRESS.
+// Доставки отключённых endpoint'ов не берутся
+const pickDeliveriesSQL = `
+WITH cte AS (
+  SELECT d.delivery_id
+  FROM checkout.webhook_deliveries d
+  JOIN checkout.webhook_endpoints e ON e.endpoint_id = d.endpoint_id
+  WHERE d.status IN ('PENDING','FAILED') AND d.next_attempt_at <= now() AND e.enabled
+  ORDER BY d.next_attempt_at
+  FOR UPDATE OF d SKIP LOCKED
+  LIMIT $1
+)
+UPDATE checkout.webhook_deliveries d
+SET status='IN_PROGRESS', attempt = attempt + 1, updated_at=now()
+FROM cte, checkout.webhook_endpoints e
+WHERE d.delivery_id = cte.delivery_id AND e.endpoint_id = d.endpoint_id
+RETURNING d.delivery_id, d.endpoint_id, d.merchant_id, d.event_id, d.event_type, d.payload,
+	d.attempt, d.attempt_base, e.url, e.secret;
+`
+
+// доставки, зависшие в IN_PROGRESS дольше $1 секунд (упал воркер), возвращаем в очередь
+const resetDeliveriesSQL = `
+UPDATE checkout.webhook_deliveries
+SET status='FAILED', next_attempt_at = now(), updated_at=now()
+WHERE status = 'IN_PROGRESS' AND updated_at < now() - make_interval(secs => $1)
+`
+
+// доставки, которые воркер забрал, но не начал отправлять: попытка не считается
+const releaseDeliveriesSQL = `
+UPDATE checkout.webhook_deliveries
+SET status = CASE WHEN attempt - attempt_base > 1 THEN 'FAILED' ELSE 'PENDING' END,
+	attempt = attempt - 1, next_attempt_at = now(), updated_at = now()
+WHERE delivery_id = ANY($1) AND status = 'IN_PROGRESS'
+`
+
+func (r *PaymentsRepo) InsertEndpoint(ctx context.Context, e webhook.Endpoint) (webhook.Endpoint, error) {
+	row, err := scanWebhookEndpoint(r.pool.QueryRow(ctx,
+		`INSERT INTO checkout.webhook_endpoints (endpoint_id, merchant_id, url, secret)
+		 VALUES ($1, $2, $3, $4)
+		 RETURNING `+webhookEndpointColumns,
+		e.ID, e.MerchantID, e.URL, e.Secret))
+	if err != nil {
+		return webhook.Endpoint{}, err
+	}
+	return WebhookEndpointRowToDomain(row), nil
+}
+
+func (r *PaymentsRepo) ListEndpoints(ctx context.Context, merchantID string) ([]webhook.Endpoint, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+webhookEndpointColumns+` FROM checkout.webhook_endpoints
+		 WHERE merchant_id = $1 AND enabled ORDER BY created_at`,
+		merchantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var endpoints []webhook.Endpoint
+	for rows.Next() {
+		row, err := scanWebhookEndpoint(rows)
+		if err != nil {
+			return nil, fmt.Errorf("cant parse row to webhookEndpointRow, err:%w", err)
+		}
+		endpoints = append(endpoints, WebhookEndpointRowToDomain(row))
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error with rows: %w", rows.Err())
+	}
+
+	return endpoints, nil
+}
+
+// DisableEndpoint не удаляет endpoint: на него ссылается журнал доставок.
+// Неотправленные доставки становятся DEAD, их можно вернуть redeliver'ом
+// после повторного включения
+func (r *PaymentsRepo) DisableEndpoint(ctx context.Context, merchantID, endpointID string) error {
+	tx, err := begin(ctx, r.pool)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE checkout.webhook_endpoints SET enabled = false
+		 WHERE endpoint_id = $1 AND merchant_id = $2 AND enabled`,
+		endpointID, merchantID)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return webhook.ErrEndpointNotFound
+	}
+
+	_, err = tx.Exec(ctx,
+		`UPDATE checkout.webhook_deliveries
+		 SET status = 'DEAD', last_error = 'endpoint disabled', updated_at = now()
+		 WHERE endpoint_id = $1 AND status IN ('PENDING','FAILED')`,
+		endpointID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *PaymentsRepo) GetDelivery(ctx context.Context, merchantID, deliveryID string) (webhook.Delivery, error) {
+	row, err := scanWebhookDelivery(r.pool.QueryRow(ctx,
+		`SELECT `+webhookDeliveryColumns+` FROM checkout.webhook_deliveries
+		 WHERE delivery_id = $1 AND merchant_id = $2`,
+		deliveryID, merchantID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return webhook.Delivery{}, webhook.ErrDeliveryNotFound
+	}
+	if err != nil {
+		return webhook.Delivery{}, err
+	}
+	return WebhookDeliveryRowToDomain(row), nil
+}
+
+func (r *PaymentsRepo) ListDeliveries(ctx context.Context, f webhook.DeliveryFilter) ([]webhook.Delivery, error) {
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, fmt.Sprintf(cond, len(args)))
+	}
+
+	add("merchant_id = $%d", f.MerchantID)
+	if f.EndpointID != "" {
+		add("endpoint_id = $%d", f.EndpointID)
+	}
+	if f.EventID != "" {
+		add("event_id = $%d", f.EventID)
+	}
+	if f.Status != "" {
+		add("status = $%d", string(f.Status))
+	}
+	if f.After != nil {
+		args = append(args, f.After.CreatedAt, f.After.ID)
+		conds = append(conds, fmt.Sprintf("(created_at, delivery_id) < ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	args = append(args, f.Limit)
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM checkout.webhook_deliveries
+		WHERE ` + strings.Join(conds, " AND ") +
+		fmt.Sprintf(` ORDER BY created_at DESC, delivery_id DESC LIMIT $%d`, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	deliveries := make([]webhook.Delivery, 0, f.Limit)
+	for rows.Next() {
+		row, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("cant parse row to webhookDeliveryRow, err:%w", err)
+		}
+		deliveries = append(deliveries, WebhookDeliveryRowToDomain(row))
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error with rows: %w", rows.Err())
+	}
+
+	return deliveries, nil
+}
+
+func (r *PaymentsRepo) ListAttempts(ctx context.Context, deliveryID string) ([]webhook.Attempt, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT delivery_id, attempt, status_code, error, duration_ms, created_at
+		 FROM checkout.webhook_delivery_attempts
+		 WHERE delivery_id = $1 ORDER BY id`,
+		deliveryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []webhook.Attempt
+	for rows.Next() {
+		var a WebhookAttemptRow
+		if err := rows.Scan(&a.DeliveryID, &a.Attempt, &a.StatusCode, &a.Error, &a.DurationMs, &a.CreatedAt); err != nil {
+			return nil, fmt.Errorf("cant parse row to webhookAttemptRow, err:%w", err)
+		}
+		attempts = append(attempts, WebhookAttemptRowToDomain(a))
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error with rows: %w", rows.Err())
+	}
+
+	return attempts, nil
+}
+
+func (r *PaymentsRepo) Redeliver(ctx context.Context, merchantID, deliveryID string) (webhook.Delivery, error) {
+	row, err := scanWebhookDelivery(r.pool.QueryRow(ctx,
+		`UPDATE checkout.webhook_deliveries d
+		 SET status = 'PENDING', attempt_base = d.attempt, next_attempt_at = now(), updated_at = now()
+		 FROM checkout.webhook_endpoints e
+		 WHERE d.delivery_id = $1 AND d.merchant_id = $2 AND d.status <> 'IN_PROGRESS'
+		   AND e.endpoint_id = d.endpoint_id AND e.enabled
+		 RETURNING `+webhookDeliveryReturning,
+		deliveryID, merchantID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		// различаем «нет такой», «endpoint отключён» и «сейчас отправляется»
+		d, err := r.GetDelivery(ctx, merchantID, deliveryID)
+		if err != nil {
+			return webhook.Delivery{}, err
+		}
+		var enabled bool
+		err = r.pool.QueryRow(ctx,
+			`SELECT enabled FROM checkout.webhook_endpoints WHERE endpoint_id = $1`, d.EndpointID).Scan(&enabled)
+		if err != nil {
+			return webhook.Delivery{}, err
+		}
+		if !enabled {
+			return webhook.Delivery{}, webhook.ErrEndpointDisabled
+		}
+		return webhook.Delivery{}, webhook.ErrDeliveryBusy
+	}
+	if err != nil {
+		return webhook.Delivery{}, err
+	}
+	return WebhookDeliveryRowToDomain(row), nil
+}
+
+func (r *PaymentsRepo) PickDeliveries(ctx context.Context, count int) ([]webhook.Job, error) {
+	rows, err := r.pool.Query(ctx, pickDeliveriesSQL, count)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	jobs := make([]webhook.Job, 0, count)
+	for rows.Next() {
+		var j webhook.Job
+		err := rows.Scan(&j.ID, &j.EndpointID, &j.MerchantID, &j.EventID, &j.EventType, &j.Payload,
+			&j.Attempt, &j.AttemptBase, &j.URL, &j.Secret)
+		if err != nil {
+			return nil, fmt.Errorf("cant parse row to webhook job, err:%w", err)
+		}
+		j.Status = webhook.DeliveryInProgress
+		jobs = append(jobs, j)
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error with rows: %w", rows.Err())
+	}
+
+	return jobs, nil
+}
+
+// CompleteDelivery пишет попытку в журнал и переводит доставку в итоговый статус.
+// Итог принимается, только если доставка всё ещё IN_PROGRESS с той же попыткой:
+// иначе её успел вернуть reset и, возможно, забрать другой воркер — ErrDeliveryLost
+func (r *PaymentsRepo) CompleteDelivery(ctx context.Context, res webhook.Result) error {
+	tx, err := begin(ctx, r.pool)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	status := webhook.DeliveryDead
+	switch {
+	case res.Delivered:
+		status = webhook.DeliveryDelivered
+	case res.NextAttemptAt != nil:
+		status = webhook.DeliveryFailed
+	}
+
+	tag, err := tx.Exec(ctx,
+		`UPDATE checkout.webhook_deliveries
+		 SET status = $2,
+		     next_attempt_at = COALESCE($3, next_attempt_at),
+		     last_status_code = $4,
+		     last_error = $5,
+		     delivered_at = CASE WHEN $2 = 'DELIVERED' THEN now() ELSE delivered_at END,
+		     updated_at = now()
+		 WHERE delivery_id = $1 AND status = 'IN_PROGRESS' AND attempt = $6`,
+		res.DeliveryID, string(status), res.NextAttemptAt, res.StatusCode, res.Error, res.Attempt)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return webhook.ErrDeliveryLost
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO checkout.webhook_delivery_attempts (delivery_id, attempt, status_code, error, duration_ms)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		res.DeliveryID, res.Attempt, res.StatusCode, res.Error, res.Duration.Milliseconds())
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func (r *PaymentsRepo) ResetDeliveries(ctx context.Context, olderThan time.Duration) error {
+	if _, err := r.pool.Exec(ctx, resetDeliveriesSQL, olderThan.Seconds()); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ReleaseDeliveries возвращает в очередь доставки, забранные, но не отправленные
+func (r *PaymentsRepo) ReleaseDeliveries(ctx context.Context, ids []string) error {
+	_, err := r.pool.Exec(ctx, releaseDeliveriesSQL, ids)
+	return err
+}
+
+// insertWebhookDeliveries раскладывает уведомление по всем активным endpoint'ам мерчанта
+func insertWebhookDeliveries(ctx context.Context, tx pgx.Tx, n webhook.Notification) error {
+	payload, err := json.Marshal(n)
+	if err != nil {
+		return fmt.Errorf("marshal webhook notification: %w", err)
+	}
+	_, err = tx.Exec(ctx,
+		`INSERT INTO checkout.webhook_deliveries (delivery_id, endpoint_id, merchant_id, event_id, event_type, payload)
+		 SELECT 'whd_' || gen_random_uuid(), endpoint_id, merchant_id, $2, $3, $4
+		 FROM checkout.webhook_endpoints
+		 WHERE merchant_id = $1 AND enabled`,
+		n.MerchantID, n.ID, n.Type, payload)
+	return err
+}
+
+func scanWebhookEndpoint(row pgx.Row) (WebhookEndpointRow, error) {
+	var e WebhookEndpointRow
+	err := row.Scan(
+		&e.ID,
+		&e.MerchantID,
+		&e.URL,
+		&e.Secret,
+		&e.Enabled,
+		&e.CreatedAt,
+	)
+	return e, err
+}
+
+func scanWebhookDelivery(row pgx.Row) (WebhookDeliveryRow, error) {
+	var d WebhookDeliveryRow
+	err := row.Scan(
+		&d.ID,
+		&d.EndpointID,
+		&d.MerchantID,
+		&d.EventID,
+		&d.EventType,
+		&d.Payload,
+		&d.Status,
+		&d.Attempt,
+		&d.NextAttemptAt,
+		&d.LastStatusCode,
+		&d.LastError,
+		&d.DeliveredAt,
+		&d.CreatedAt,
+		&d.UpdatedAt,
+	)
+	return d, err
+}
@@ -0,0 +1,42 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/ratelimit"
+)
+
+// Fallback ходит в общий (Redis) лимитер, а при его недоступности
+// считает лимиты в памяти процесса, чтобы не отказывать всем подряд
+type Fallback struct {
+	primary   ratelimit.Limiter
+	secondary ratelimit.Limiter
+	timeout   time.Duration
+	degraded  atomic.Bool
+}
+
+func NewFallback(primary, secondary ratelimit.Limiter, timeout time.Duration) *Fallback {
+	return &Fallback{primary: primary, secondary: secondary, timeout: timeout}
+}
+
+func (f *Fallback) Allow(ctx context.Context, key string, l ratelimit.Limit) (ratelimit.Decision, error) {
+	pctx, cancel := context.WithTimeout(ctx, f.timeout)
+	d, err := f.primary.Allow(pctx, key, l)
+	cancel()
+
+	if err == nil {
+		if f.degraded.CompareAndSwap(true, false) {
+			log.Println("ratelimit: primary limiter recovered")
+		}
+		return d, nil
+	}
+
+	// логируем только переход в деградацию, а не каждый запрос
+	if f.degraded.CompareAndSwap(false, true) {
+		log.Printf("ratelimit: primary limiter unavailable, using in-process fallback:%v", err)
+	}
+	return f.secondary.Allow(ctx, key, l)
+}
@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/ratelimit"
+)
+
+// после стольких бакетов начинаем удалять простаивающие: они эквивалентны отсутствующим
+const memorySweepSize = 10000
+
+// сколько бакетов проверяет один вызов Allow: очистка идёт понемногу,
+// а не проходом по всей карте под мьютексом
+const memorySweepStep = 20
+
+type bucket struct {
+	tokens float64
+	ts     time.Time
+	full   time.Time // к этому моменту бакет заполнится и станет равен отсутствующему
+}
+
+// Memory — token bucket в памяти процесса, лимит действует на один инстанс
+type Memory struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	now     func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (m *Memory) Allow(ctx context.Context, key string, l ratelimit.Limit) (ratelimit.Decision, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+
+	if len(m.buckets) >= memorySweepSize {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(l.Burst), ts: now}
+		m.buckets[key] = b
+	}
+
+	b.tokens = refill(b.tokens, now.Sub(b.ts), l)
+	b.ts = now
+
+	allowed := b.tokens >= 1
+	if allowed {
+		b.tokens--
+	}
+
+	return ratelimit.NewDecision(l, b.tokens, allowed), nil
+}
+
+// sweep проверяет несколько бакетов: обход карты начинается со случайного места,
+// так что за серию вызовов просматривается вся карта
+func (m *Memory) sweep(now time.Time) {
+	checked := 0
+	for key, b := range m.buckets {
+		// медленный лимит заполняется дольше минуты: удалив бакет раньше,
+		// вернули бы мерчанту полный запас
+		if !now.Before(b.full) {
+			delete(m.buckets, key)
+		}
+		if checked++; checked >= memorySweepStep {
+			return
+		}
+	}
+}
+
+func refill(tokens float64, elapsed time.Duration, l ratelimit.Limit) float64 {
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(float64(l.Burst), tokens+elapsed.Seconds()*l.Rate)
+}
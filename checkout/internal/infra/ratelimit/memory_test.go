@@ -0,0 +1,127 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/ratelimit"
+)
+
+// fakeClock — управляемое время для бакетов
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestMemory() (*Memory, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	m := NewMemory()
+	m.now = clock.now
+	return m, clock
+}
+
+func TestMemoryBurstAndRefill(t *testing.T) {
+	m, clock := newTestMemory()
+	l := ratelimit.Limit{Rate: 2, Burst: 3}
+
+	for i := range 3 {
+		d, _ := m.Allow(context.Background(), "k", l)
+		if !d.Allowed || d.Remaining != 2-i {
+			t.Fatalf("request %d: %+v", i, d)
+		}
+	}
+
+	d, _ := m.Allow(context.Background(), "k", l)
+	if d.Allowed {
+		t.Fatal("expected limit to be exceeded")
+	}
+	if d.RetryAfter != 500*time.Millisecond {
+		t.Fatalf("unexpected retry after %s", d.RetryAfter)
+	}
+
+	// другой ключ — отдельный бакет
+	if d, _ := m.Allow(context.Background(), "other", l); !d.Allowed {
+		t.Fatal("keys share a bucket")
+	}
+
+	clock.t = clock.t.Add(500 * time.Millisecond)
+	if d, _ := m.Allow(context.Background(), "k", l); !d.Allowed {
+		t.Fatal("expected token after refill")
+	}
+}
+
+func TestMemorySweepIsIncremental(t *testing.T) {
+	m, clock := newTestMemory()
+	l := ratelimit.Limit{Rate: 1, Burst: 1}
+
+	for i := range memorySweepSize {
+		m.buckets[fmt.Sprintf("idle-%d", i)] = &bucket{tokens: 1, ts: clock.t, full: clock.t}
+	}
+	clock.t = clock.t.Add(2 * time.Minute)
+
+	// один вызов удаляет не больше memorySweepStep бакетов
+	m.Allow(context.Background(), "fresh", l)
+	if got, want := len(m.buckets), memorySweepSize-memorySweepStep+1; got != want {
+		t.Fatalf("buckets after one call: got %d, want %d", got, want)
+	}
+
+	// пока карта выше порога, каждый вызов продолжает очистку
+	for len(m.buckets) >= memorySweepSize {
+		m.Allow(context.Background(), "fresh", l)
+	}
+	if _, ok := m.buckets["fresh"]; !ok {
+		t.Fatal("active bucket swept")
+	}
+}
+
+func TestMemorySweepKeepsRefillingBucket(t *testing.T) {
+	m, clock := newTestMemory()
+	// 10 запросов в час: бакет заполняется час, а не минуту
+	slow := ratelimit.Limit{Rate: 10.0 / 3600, Burst: 10}
+	for range 10 {
+		m.Allow(context.Background(), "slow", slow)
+	}
+	for i := range memorySweepSize {
+		m.buckets[fmt.Sprintf("idle-%d", i)] = &bucket{tokens: 1, ts: clock.t, full: clock.t}
+	}
+
+	clock.t = clock.t.Add(10 * time.Minute)
+	for len(m.buckets) >= memorySweepSize {
+		m.Allow(context.Background(), "fresh", ratelimit.Limit{Rate: 1, Burst: 1})
+	}
+	if _, ok := m.buckets["slow"]; !ok {
+		t.Fatal("bucket swept before refill")
+	}
+	// за 10 минут накопилось меньше двух токенов, а не полный запас
+	if d, _ := m.Allow(context.Background(), "slow", slow); d.Remaining != 0 {
+		t.Fatalf("limit reset by sweep: %+v", d)
+	}
+}
+
+// failing — недоступный основной лимитер
+type failing struct{ calls int }
+
+func (f *failing) Allow(ctx context.Context, key string, l ratelimit.Limit) (ratelimit.Decision, error) {
+	f.calls++
+	return ratelimit.Decision{}, errors.New("redis down")
+}
+
+func TestFallbackUsesMemoryWhenPrimaryFails(t *testing.T) {
+	primary := &failing{}
+	secondary, _ := newTestMemory()
+	f := NewFallback(primary, secondary, time.Second)
+	l := ratelimit.Limit{Rate: 1, Burst: 1}
+
+	d, err := f.Allow(context.Background(), "k", l)
+	if err != nil || !d.Allowed {
+		t.Fatalf("expected fallback decision, got %+v err=%v", d, err)
+	}
+	if d, _ := f.Allow(context.Background(), "k", l); d.Allowed {
+		t.Fatal("fallback does not enforce limit")
+	}
+	if primary.calls != 2 || !f.degraded.Load() {
+		t.Fatalf("primary calls=%d degraded=%v", primary.calls, f.degraded.Load())
+	}
+}
@@ -0,0 +1,61 @@
+package redisidem
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// token bucket атомарно на стороне Redis; время берём из Redis, чтобы
+// инстансы с разными часами считали одинаково
+var tokenBucketScript = redis.NewScript(`
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local data = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(data[1]) or burst
+local ts = tonumber(data[2]) or now
+
+tokens = math.min(burst, tokens + math.max(0, now - ts) * rate / 1000)
+
+local allowed = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+
+return {allowed, tostring(tokens)}
+`)
+
+// Limiter — распределённый лимитер на том же клиенте Redis, что и идемпотентность
+type Limiter struct {
+	store  *Store
+	prefix string
+}
+
+func NewLimiter(store *Store, prefix string) *Limiter {
+	return &Limiter{store: store, prefix: prefix}
+}
+
+func (l *Limiter) Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Decision, error) {
+	res, err := tokenBucketScript.Run(ctx, l.store.rdb, []string{l.prefix + key}, limit.Rate, limit.Burst).Slice()
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	allowed, _ := res[0].(int64)
+	tokensStr, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return ratelimit.Decision{}, err
+	}
+
+	return ratelimit.NewDecision(limit, tokens, allowed == 1), nil
+}
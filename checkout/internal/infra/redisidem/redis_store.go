@@ -17,22 +17,16 @@ type Store struct {
 	prefix string
 }
 
-func New(cfg config.Redis) (*Store, error) {
+// New не ходит в Redis: клиент подключается при первом запросе.
+// Нужна ли Redis на старте, решает вызывающий через Ping
+func New(cfg config.Redis) *Store {
 	rdb := redis.NewClient(&redis.Options{
 		Addr:     cfg.Addr,
 		Password: cfg.Pass,
 		DB:       cfg.DB,
 	})
 
-	// Проверим соединение
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	// Проверка соединения
-	if err := rdb.Ping(ctx).Err(); err != nil {
-		return nil, fmt.Errorf("redis not responding: %v", err)
-	}
-
-	return &Store{rdb: rdb, prefix: cfg.Prefix}, nil
+	return &Store{rdb: rdb, prefix: cfg.Prefix}
 }
 
 func (s *Store) Ping() error {
@@ -51,23 +45,83 @@ func (s *Store) Close() {
 	log.Println("Redis closed...")
 }
 
-func (s *Store) Reserve(ctx context.Context, merchantID, idemKey, bodyHash string, ttl time.Duration) (bool, error) {
-	rec := idempotency.Record{State: idempotency.StateInProgress, BodyHash: bodyHash, UpdatedAt: time.Now().Unix()}
+// reserveScript занимает ключ, если его нет или его можно перехватить
+// (см. idempotency.Record.CanTakeOver): ARGV — новая запись, body_hash, now ms, ttl ms
+var reserveScript = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if cur then
+  local rec = cjson.decode(cur)
+  if rec.body_hash ~= ARGV[2] then return 0 end
+  local expired = rec.state == 'IN_PROGRESS' and (tonumber(rec.lease_until) or 0) <= tonumber(ARGV[3])
+  local retryable = rec.state == 'ERROR' and rec.retryable == true
+  if not (expired or retryable) then return 0 end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[4])
+return 1
+`)
+
+// completeScript пишет итог, только пока ключ у того же владельца
+// (или уже истёк): ARGV — новая запись, owner, ttl ms
+var completeScript = redis.NewScript(`
+local cur = redis.call('GET', KEYS[1])
+if cur then
+  local rec = cjson.decode(cur)
+  if rec.owner ~= ARGV[2] then return 0 end
+end
+redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[3])
+return 1
+`)
+
+func (s *Store) Reserve(ctx context.Context, merchantID, idemKey, bodyHash, owner string, lease, ttl time.Duration) (bool, error) {
+	now := time.Now()
+	rec := idempotency.Record{
+		State:      idempotency.StateInProgress,
+		BodyHash:   bodyHash,
+		UpdatedAt:  now.Unix(),
+		Owner:      owner,
+		LeaseUntil: now.Add(lease).UnixMilli(),
+	}
 	b, _ := json.Marshal(rec)
-	return s.rdb.SetNX(ctx, s.key(merchantID, idemKey), b, ttl).Result()
+	n, err := reserveScript.Run(ctx, s.rdb, []string{s.key(merchantID, idemKey)},
+		b, bodyHash, now.UnixMilli(), ttl.Milliseconds()).Int()
+	return n == 1, err
 }
 
-func (s *Store) Finalize(ctx context.Context, merchantID, idemKey, bodyHash string, httpCode int, paymentID string, resp map[string]any, ttl time.Duration) error {
-	rec := idempotency.Record{
+func (s *Store) Finalize(ctx context.Context, merchantID, idemKey, owner, bodyHash string, httpCode int, paymentID string,
+	resp map[string]any, ttl time.Duration) error {
+	return s.complete(ctx, merchantID, idemKey, idempotency.Record{
 		State:     idempotency.StateDone,
 		BodyHash:  bodyHash,
 		PaymentID: paymentID,
 		HTTPCode:  httpCode,
 		Response:  resp,
-		UpdatedAt: time.Now().Unix(),
-	}
+		Owner:     owner,
+	}, ttl)
+}
+
+func (s *Store) Fail(ctx context.Context, merchantID, idemKey, owner, bodyHash string, retryable bool, httpCode int,
+	resp map[string]any, ttl time.Duration) error {
+	return s.complete(ctx, merchantID, idemKey, idempotency.Record{
+		State:     idempotency.StateError,
+		BodyHash:  bodyHash,
+		HTTPCode:  httpCode,
+		Response:  resp,
+		Owner:     owner,
+		Retryable: retryable,
+	}, ttl)
+}
+
+func (s *Store) complete(ctx context.Context, merchantID, idemKey string, rec idempotency.Record, ttl time.Duration) error {
+	rec.UpdatedAt = time.Now().Unix()
 	b, _ := json.Marshal(rec)
-	return s.rdb.Set(ctx, s.key(merchantID, idemKey), b, ttl).Err()
+	n, err := completeScript.Run(ctx, s.rdb, []string{s.key(merchantID, idemKey)}, b, rec.Owner, ttl.Milliseconds()).Int()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return idempotency.ErrLeaseLost
+	}
+	return nil
 }
 
 func (s *Store) Load(ctx context.Context, merchantID, idemKey string) (*idempotency.Record, error) {
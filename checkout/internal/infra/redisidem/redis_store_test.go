@@ -0,0 +1,24 @@
+package redisidem
+
+import (
+	"os"
+	"testing"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/idempotency/idemtest"
+)
+
+// нужен живой Redis: TEST_REDIS_ADDR=localhost:6379 go test ./...
+func TestStore(t *testing.T) {
+	addr := os.Getenv("TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("TEST_REDIS_ADDR not set")
+	}
+	store := New(config.Redis{Addr: addr, Prefix: "idemtest:"})
+	if err := store.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(store.Close)
+
+	idemtest.Run(t, store)
+}
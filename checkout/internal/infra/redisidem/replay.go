@@ -0,0 +1,20 @@
+package redisidem
+
+import (
+	"context"
+	"time"
+)
+
+// Replay — общий для инстансов журнал подписей на том же клиенте Redis
+type Replay struct {
+	store  *Store
+	prefix string
+}
+
+func NewReplay(store *Store, prefix string) *Replay {
+	return &Replay{store: store, prefix: prefix}
+}
+
+func (r *Replay) Remember(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return r.store.rdb.SetNX(ctx, r.prefix+key, 1, ttl).Result()
+}
@@ -0,0 +1,42 @@
+package replay
+
+import (
+	"context"
+	"log"
+	"sync/atomic"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/merchant"
+)
+
+// Fallback запоминает подписи в Redis, а при его недоступности — в памяти процесса:
+// защита слабее (только в пределах инстанса), но подписанные запросы не отклоняются
+type Fallback struct {
+	primary   merchant.ReplayGuard
+	secondary merchant.ReplayGuard
+	timeout   time.Duration
+	degraded  atomic.Bool
+}
+
+func NewFallback(primary, secondary merchant.ReplayGuard, timeout time.Duration) *Fallback {
+	return &Fallback{primary: primary, secondary: secondary, timeout: timeout}
+}
+
+func (f *Fallback) Remember(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	pctx, cancel := context.WithTimeout(ctx, f.timeout)
+	fresh, err := f.primary.Remember(pctx, key, ttl)
+	cancel()
+
+	if err == nil {
+		if f.degraded.CompareAndSwap(true, false) {
+			log.Println("replay: primary guard recovered")
+		}
+		return fresh, nil
+	}
+
+	// логируем только переход в деградацию, а не каждый запрос
+	if f.degraded.CompareAndSwap(false, true) {
+		log.Printf("replay: primary guard unavailable, using in-process fallback:%v", err)
+	}
+	return f.secondary.Remember(ctx, key, ttl)
+}
@@ -0,0 +1,48 @@
+package replay
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// сколько записей проверяет один вызов Remember: истёкшие удаляются понемногу
+const memorySweepStep = 20
+
+// Memory помнит подписи в памяти процесса: повтор на другой инстанс не заметит
+type Memory struct {
+	mu      sync.Mutex
+	expires map[string]time.Time
+	now     func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{expires: make(map[string]time.Time), now: time.Now}
+}
+
+func (m *Memory) Remember(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	if exp, ok := m.expires[key]; ok && now.Before(exp) {
+		return false, nil
+	}
+	m.expires[key] = now.Add(ttl)
+	return true, nil
+}
+
+// sweep: обход карты начинается со случайного места, за серию вызовов проверяется вся
+func (m *Memory) sweep(now time.Time) {
+	checked := 0
+	for key, exp := range m.expires {
+		if !now.Before(exp) {
+			delete(m.expires, key)
+		}
+		if checked++; checked >= memorySweepStep {
+			return
+		}
+	}
+}
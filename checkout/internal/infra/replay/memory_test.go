@@ -0,0 +1,49 @@
+package replay
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryRemember(t *testing.T) {
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	if fresh, _ := m.Remember(ctx, "sig", time.Minute); !fresh {
+		t.Fatal("first use reported as replay")
+	}
+	if fresh, _ := m.Remember(ctx, "sig", time.Minute); fresh {
+		t.Fatal("replay not detected")
+	}
+	if fresh, _ := m.Remember(ctx, "other", time.Minute); !fresh {
+		t.Fatal("different key reported as replay")
+	}
+
+	// после ttl подпись всё равно отклонит проверка timestamp, запись можно забыть
+	now = now.Add(time.Minute)
+	m.Remember(ctx, "x", time.Minute)
+	if _, ok := m.expires["sig"]; ok {
+		t.Fatal("expired entry not swept")
+	}
+}
+
+type failing struct{}
+
+func (failing) Remember(ctx context.Context, key string, ttl time.Duration) (bool, error) {
+	return false, errors.New("redis down")
+}
+
+func TestFallbackUsesMemoryWhenPrimaryFails(t *testing.T) {
+	f := NewFallback(failing{}, NewMemory(), time.Second)
+
+	if fresh, err := f.Remember(context.Background(), "sig", time.Minute); err != nil || !fresh {
+		t.Fatalf("expected fallback to accept first use, got %v err=%v", fresh, err)
+	}
+	if fresh, _ := f.Remember(context.Background(), "sig", time.Minute); fresh {
+		t.Fatal("fallback does not detect replay")
+	}
+}
@@ -0,0 +1,241 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/webhook"
+)
+
+type Repository interface {
+	PickDeliveries(ctx context.Context, count int) ([]webhook.Job, error)
+	CompleteDelivery(ctx context.Context, res webhook.Result) error
+	ResetDeliveries(ctx context.Context, olderThan time.Duration) error
+	ReleaseDeliveries(ctx context.Context, ids []string) error
+}
+
+// Worker доставляет уведомления мерчантам: подписывает тело, повторяет
+// неудачные попытки с экспоненциальной паузой до MaxAttempts
+type Worker struct {
+	repo   Repository
+	client *http.Client
+	cfg    config.Webhooks
+}
+
+func New(cfg config.Webhooks, repo Repository) *Worker {
+	return &Worker{
+		cfg:    cfg,
+		repo:   repo,
+		client: newClient(cfg),
+	}
+}
+
+// newClient: редиректы не выполняются (ответ 3xx — неудачная попытка),
+// соединения — только на публичные адреса, если не AllowInsecure.
+// Адрес проверяется после резолва, так что DNS-имя на 127.0.0.1 тоже не пройдёт
+func newClient(cfg config.Webhooks) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	if !cfg.AllowInsecure {
+		transport.Proxy = nil
+		dialer := &net.Dialer{
+			Timeout:   cfg.RequestTimeout,
+			KeepAlive: 30 * time.Second,
+			Control:   publicOnly,
+		}
+		transport.DialContext = dialer.DialContext
+	}
+
+	return &http.Client{
+		Timeout:   cfg.RequestTimeout,
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	ap, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if !webhook.PublicAddr(ap.Addr()) {
+		return webhook.ErrPrivateAddress
+	}
+	return nil
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	tickerPoll := time.NewTicker(w.cfg.PollInterval)
+	tickerReset := time.NewTicker(w.cfg.ResetInterval)
+	defer func() {
+		tickerPoll.Stop()
+		tickerReset.Stop()
+	}()
+
+	for {
+		select {
+		case <-tickerPoll.C:
+			w.PollBatch(ctx)
+		case <-tickerReset.C:
+			if err := w.repo.ResetDeliveries(ctx, w.cfg.ResetAfter); err != nil {
+				log.Printf("webhooks: error while reset deliveries:%v", err)
+			}
+		case <-ctx.Done():
+			log.Println("Webhook worker closed...")
+			return
+		}
+	}
+}
+
+// PollBatch забирает пачку и отправляет её. ctx — время жизни воркера:
+// запросы к БД ограничены PollTimeout каждый, отправка — RequestTimeout
+func (w *Worker) PollBatch(ctx context.Context) {
+	pickCtx, cancel := context.WithTimeout(ctx, w.cfg.PollTimeout)
+	jobs, err := w.repo.PickDeliveries(pickCtx, w.cfg.BatchSize)
+	cancel()
+	if err != nil {
+		log.Printf("webhooks: error pick deliveries:%v", err)
+		return
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		released []string // забраны, но не отправлены из-за остановки
+	)
+	release := func(id string) {
+		mu.Lock()
+		released = append(released, id)
+		mu.Unlock()
+	}
+	semaphore := make(chan struct{}, w.cfg.MaxParallel)
+
+	for _, job := range jobs {
+		wg.Add(1)
+		go func(job webhook.Job) {
+			defer wg.Done()
+
+			select {
+			case semaphore <- struct{}{}:
+			case <-ctx.Done():
+				release(job.ID)
+				return
+			}
+			defer func() { <-semaphore }()
+
+			res := w.deliver(ctx, job)
+			if !res.Delivered && ctx.Err() != nil {
+				// запрос оборвала остановка, а не endpoint: попытку не засчитываем
+				release(job.ID)
+				return
+			}
+
+			// итог записываем и при остановке: запрос уже ушёл мерчанту
+			storeCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), w.cfg.PollTimeout)
+			defer cancel()
+			err := w.repo.CompleteDelivery(storeCtx, res)
+			if errors.Is(err, webhook.ErrDeliveryLost) {
+				log.Printf("webhooks: delivery=%s attempt=%d lost ownership, result dropped", job.ID, job.Attempt)
+				return
+			}
+			if err != nil {
+				log.Printf("webhooks: error complete delivery=%s:%v", job.ID, err)
+				return
+			}
+
+			switch {
+			case res.Delivered:
+				log.Printf("webhooks: delivered delivery=%s attempt=%d", job.ID, job.Attempt)
+			case res.NextAttemptAt == nil:
+				log.Printf("webhooks: delivery=%s dead after %d attempts", job.ID, job.Attempt)
+			default:
+				log.Printf("webhooks: delivery=%s attempt=%d failed, retry at %s", job.ID, job.Attempt,
+					res.NextAttemptAt.Format(time.RFC3339))
+			}
+		}(job)
+	}
+
+	wg.Wait()
+
+	if len(released) == 0 {
+		return
+	}
+	releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), w.cfg.PollTimeout)
+	defer cancel()
+	if err := w.repo.ReleaseDeliveries(releaseCtx, released); err != nil {
+		log.Printf("webhooks: error release %d deliveries:%v", len(released), err)
+	}
+}
+
+func (w *Worker) deliver(ctx context.Context, job webhook.Job) webhook.Result {
+	res := webhook.Result{DeliveryID: job.ID, Attempt: job.Attempt}
+
+	start := time.Now()
+	code, err := w.send(ctx, job)
+	res.Duration = time.Since(start)
+
+	if code != 0 {
+		res.StatusCode = &code
+	}
+	if err == nil && code >= 200 && code < 300 {
+		res.Delivered = true
+		return res
+	}
+
+	msg := fmt.Sprintf("unexpected status %d", code)
+	if err != nil {
+		msg = err.Error()
+	}
+	res.Error = &msg
+
+	// после redeliver паузы и лимит считаются заново, номер попытки — нет
+	if n := job.Attempt - job.AttemptBase; n < w.cfg.MaxAttempts {
+		next := time.Now().Add(w.backoff(n))
+		res.NextAttemptAt = &next
+	}
+	return res
+}
+
+func (w *Worker) send(ctx context.Context, job webhook.Job) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.URL, bytes.NewReader(job.Payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "checkout-webhooks")
+	req.Header.Set("X-Webhook-Id", job.EventID)
+	req.Header.Set("X-Webhook-Delivery", job.ID)
+	req.Header.Set(webhook.SignatureHeader, webhook.Sign(job.Secret, time.Now(), job.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	// тело ответа не нужно, но дочитываем немного, чтобы соединение переиспользовалось
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 4<<10))
+
+	return resp.StatusCode, nil
+}
+
+// backoff: BackoffBase * 2^(attempt-1), не больше BackoffMax
+func (w *Worker) backoff(attempt int) time.Duration {
+	d := w.cfg.BackoffBase
+	for i := 1; i < attempt && d < w.cfg.BackoffMax; i++ {
+		d *= 2
+	}
+	return min(d, w.cfg.BackoffMax)
+}
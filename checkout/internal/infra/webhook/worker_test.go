@@ -0,0 +1,336 @@
+package webhook
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/webhook"
+)
+
+// fakeRepo отдаёт заранее заданные доставки и запоминает результаты
+type fakeRepo struct {
+	mu       sync.Mutex
+	jobs     []webhook.Job
+	results  []webhook.Result
+	released []string
+	storeErr []error // ctx.Err() на момент записи итога
+	lost     bool    // доставку успел забрать reset — CompleteDelivery отказывает
+}
+
+func (r *fakeRepo) PickDeliveries(ctx context.Context, count int) ([]webhook.Job, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	jobs := r.jobs
+	r.jobs = nil
+	return jobs, nil
+}
+
+func (r *fakeRepo) CompleteDelivery(ctx context.Context, res webhook.Result) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.lost {
+		return webhook.ErrDeliveryLost
+	}
+	r.results = append(r.results, res)
+	r.storeErr = append(r.storeErr, ctx.Err())
+	return nil
+}
+
+func (r *fakeRepo) ResetDeliveries(ctx context.Context, olderThan time.Duration) error { return nil }
+
+func (r *fakeRepo) ReleaseDeliveries(ctx context.Context, ids []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.released = append(r.released, ids...)
+	return nil
+}
+
+func testConfig() config.Webhooks {
+	return config.Webhooks{
+		PollTimeout:    time.Second,
+		BatchSize:      10,
+		MaxParallel:    2,
+		RequestTimeout: time.Second,
+		MaxAttempts:    3,
+		BackoffBase:    time.Second,
+		BackoffMax:     time.Minute,
+		AllowInsecure:  true, // httptest слушает 127.0.0.1
+	}
+}
+
+func newJob(url string, attempt int) webhook.Job {
+	return newJobID("whd_1", url, attempt)
+}
+
+func newJobID(id, url string, attempt int) webhook.Job {
+	return webhook.Job{
+		Delivery: webhook.Delivery{
+			ID:        id,
+			EventID:   "evt_1",
+			EventType: "payment.succeeded",
+			Payload:   []byte(`{"id":"evt_1","type":"payment.succeeded"}`),
+			Attempt:   attempt,
+		},
+		URL:    url,
+		Secret: "whsec_test",
+	}
+}
+
+func TestWorkerDeliversSignedPayload(t *testing.T) {
+	var (
+		gotBody      []byte
+		gotSignature string
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotBody, _ = io.ReadAll(r.Body)
+		gotSignature = r.Header.Get(webhook.SignatureHeader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	job := newJob(srv.URL, 1)
+	repo := &fakeRepo{jobs: []webhook.Job{job}}
+	New(testConfig(), repo).PollBatch(context.Background())
+
+	if len(repo.results) != 1 {
+		t.Fatalf("expected 1 result, got %d", len(repo.results))
+	}
+	res := repo.results[0]
+	if !res.Delivered {
+		t.Fatalf("expected delivered, got error %v", res.Error)
+	}
+	if res.StatusCode == nil || *res.StatusCode != http.StatusNoContent {
+		t.Fatalf("unexpected status code %v", res.StatusCode)
+	}
+	if string(gotBody) != string(job.Payload) {
+		t.Fatalf("unexpected body %s", gotBody)
+	}
+	if err := webhook.Verify(job.Secret, gotSignature, gotBody, time.Minute); err != nil {
+		t.Fatalf("signature verification failed: %v", err)
+	}
+	if err := webhook.Verify("whsec_other", gotSignature, gotBody, time.Minute); err == nil {
+		t.Fatal("signature verified with wrong secret")
+	}
+}
+
+func TestWorkerSchedulesRetryWithBackoff(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	repo := &fakeRepo{jobs: []webhook.Job{newJob(srv.URL, 2)}}
+	before := time.Now()
+	New(testConfig(), repo).PollBatch(context.Background())
+
+	res := repo.results[0]
+	if res.Delivered {
+		t.Fatal("expected failure")
+	}
+	if res.StatusCode == nil || *res.StatusCode != http.StatusInternalServerError {
+		t.Fatalf("unexpected status code %v", res.StatusCode)
+	}
+	if res.NextAttemptAt == nil {
+		t.Fatal("expected retry to be scheduled")
+	}
+	// вторая попытка: пауза base*2
+	if d := res.NextAttemptAt.Sub(before); d < 2*time.Second || d > 3*time.Second {
+		t.Fatalf("unexpected backoff %s", d)
+	}
+}
+
+func TestWorkerStopsAfterMaxAttempts(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	repo := &fakeRepo{jobs: []webhook.Job{newJob(srv.URL, 3)}}
+	New(testConfig(), repo).PollBatch(context.Background())
+
+	res := repo.results[0]
+	if res.Delivered || res.NextAttemptAt != nil {
+		t.Fatalf("expected dead delivery, got %+v", res)
+	}
+	if res.Error == nil {
+		t.Fatal("expected last error to be recorded")
+	}
+}
+
+func TestWorkerCountsAttemptsFromRedeliver(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer srv.Close()
+
+	// доставка была DEAD после 3 попыток, redeliver: это первая попытка нового круга
+	job := newJob(srv.URL, 4)
+	job.AttemptBase = 3
+	repo := &fakeRepo{jobs: []webhook.Job{job}}
+	before := time.Now()
+	New(testConfig(), repo).PollBatch(context.Background())
+
+	res := repo.results[0]
+	if res.Attempt != 4 {
+		t.Fatalf("attempt number must keep growing, got %d", res.Attempt)
+	}
+	if res.NextAttemptAt == nil {
+		t.Fatal("expected retry to be scheduled")
+	}
+	if d := res.NextAttemptAt.Sub(before); d < time.Second || d > 2*time.Second {
+		t.Fatalf("expected first backoff step, got %s", d)
+	}
+}
+
+func TestWorkerDropsResultWhenDeliveryLost(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	repo := &fakeRepo{jobs: []webhook.Job{newJob(srv.URL, 1)}, lost: true}
+	New(testConfig(), repo).PollBatch(context.Background())
+
+	// итог не записан и доставка не возвращается в очередь: ею владеет другой
+	if len(repo.results) != 0 || len(repo.released) != 0 {
+		t.Fatalf("expected nothing stored, got results=%+v released=%v", repo.results, repo.released)
+	}
+}
+
+func TestWorkerRecordsResultAfterPollTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(100 * time.Millisecond)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	// PollTimeout ограничивает запросы к БД, а не отправку
+	cfg := testConfig()
+	cfg.PollTimeout = 20 * time.Millisecond
+	repo := &fakeRepo{jobs: []webhook.Job{newJob(srv.URL, 1)}}
+	New(cfg, repo).PollBatch(context.Background())
+
+	if len(repo.results) != 1 || !repo.results[0].Delivered {
+		t.Fatalf("expected delivered result, got %+v", repo.results)
+	}
+	if repo.storeErr[0] != nil {
+		t.Fatalf("result stored with expired context: %v", repo.storeErr[0])
+	}
+}
+
+func TestWorkerReleasesJobsOnShutdown(t *testing.T) {
+	started := make(chan struct{}, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body) // иначе сервер не заметит разрыв соединения
+		started <- struct{}{}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.MaxParallel = 1
+	repo := &fakeRepo{jobs: []webhook.Job{newJobID("whd_1", srv.URL, 1), newJobID("whd_2", srv.URL, 1)}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-started
+		cancel()
+	}()
+	New(cfg, repo).PollBatch(ctx)
+
+	// оборванная отправка и ждавшая семафор не считаются попытками
+	if len(repo.results) != 0 {
+		t.Fatalf("expected no results, got %+v", repo.results)
+	}
+	if len(repo.released) != 2 {
+		t.Fatalf("expected both deliveries released, got %v", repo.released)
+	}
+}
+
+func TestWorkerBlocksPrivateAddress(t *testing.T) {
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits++
+	}))
+	defer srv.Close()
+
+	cfg := testConfig()
+	cfg.AllowInsecure = false
+	repo := &fakeRepo{jobs: []webhook.Job{newJob(srv.URL, 1)}}
+	New(cfg, repo).PollBatch(context.Background())
+
+	if hits != 0 {
+		t.Fatal("request reached loopback endpoint")
+	}
+	res := repo.results[0]
+	if res.Delivered || res.Error == nil || !strings.Contains(*res.Error, webhook.ErrPrivateAddress.Error()) {
+		t.Fatalf("expected private address error, got %+v", res)
+	}
+	if res.NextAttemptAt == nil {
+		t.Fatal("expected retry to be scheduled")
+	}
+}
+
+func TestWorkerDoesNotFollowRedirects(t *testing.T) {
+	redirected := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("/hook", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/internal", http.StatusTemporaryRedirect)
+	})
+	mux.HandleFunc("/internal", func(w http.ResponseWriter, r *http.Request) {
+		redirected = true
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	repo := &fakeRepo{jobs: []webhook.Job{newJob(srv.URL+"/hook", 1)}}
+	New(testConfig(), repo).PollBatch(context.Background())
+
+	if redirected {
+		t.Fatal("redirect followed")
+	}
+	res := repo.results[0]
+	if res.Delivered || res.StatusCode == nil || *res.StatusCode != http.StatusTemporaryRedirect {
+		t.Fatalf("expected undelivered 307, got %+v", res)
+	}
+}
+
+func TestPublicOnly(t *testing.T) {
+	for addr, want := range map[string]error{
+		"93.184.216.34:443":   nil,
+		"127.0.0.1:443":       webhook.ErrPrivateAddress,
+		"10.0.0.5:443":        webhook.ErrPrivateAddress,
+		"169.254.169.254:80":  webhook.ErrPrivateAddress,
+		"100.64.1.1:443":      webhook.ErrPrivateAddress,
+		"[::1]:443":           webhook.ErrPrivateAddress,
+		"[::ffff:10.0.0.1]:1": webhook.ErrPrivateAddress,
+	} {
+		if err := publicOnly("tcp", addr, nil); !errors.Is(err, want) {
+			t.Errorf("%s: got %v, want %v", addr, err, want)
+		}
+	}
+}
+
+func TestBackoffIsCapped(t *testing.T) {
+	w := New(testConfig(), &fakeRepo{})
+	if d := w.backoff(1); d != time.Second {
+		t.Fatalf("attempt 1: got %s", d)
+	}
+	if d := w.backoff(4); d != 8*time.Second {
+		t.Fatalf("attempt 4: got %s", d)
+	}
+	if d := w.backoff(30); d != time.Minute {
+		t.Fatalf("attempt 30: got %s", d)
+	}
+}
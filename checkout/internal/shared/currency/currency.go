@@ -0,0 +1,38 @@
+package currency
+
+import "github.com/shopspring/decimal"
+
+// максимальное число знаков после запятой среди валют — под него колонки numeric в БД
+const MaxExponent = 4
+
+type Currency struct {
+	Code     string
+	Numeric  string
+	Exponent int32
+	Name     string
+}
+
+// Lookup ищет валюту по буквенному коду
+func Lookup(code string) (Currency, bool) {
+	c, ok := iso4217[code]
+	return c, ok
+}
+
+// Valid проверяет, что сумма не точнее минорной единицы валюты.
+// Смотрим на значение, а не на запись: незначащие нули ("100.0" JPY) допустимы
+func (c Currency) Valid(amount decimal.Decimal) bool {
+	return amount.Truncate(c.Exponent).Equal(amount)
+}
+
+// Format печатает сумму с числом знаков валюты: 100 JPY, 10.50 USD, 1.250 KWD
+func (c Currency) Format(amount decimal.Decimal) string {
+	return amount.StringFixed(c.Exponent)
+}
+
+// Format по коду; для неизвестного кода — как раньше, 2 знака
+func Format(amount decimal.Decimal, code string) string {
+	if c, ok := Lookup(code); ok {
+		return c.Format(amount)
+	}
+	return amount.StringFixed(2)
+}
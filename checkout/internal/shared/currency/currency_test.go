@@ -0,0 +1,32 @@
+package currency
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestValid(t *testing.T) {
+	cases := []struct {
+		code, amount string
+		want         bool
+	}{
+		{"JPY", "100", true},
+		{"JPY", "100.0", true}, // незначащий ноль не меняет сумму
+		{"JPY", "100.5", false},
+		{"USD", "10.50", true},
+		{"USD", "10.500", true},
+		{"USD", "10.505", false},
+		{"KWD", "1.250", true},
+		{"KWD", "1.2505", false},
+	}
+	for _, c := range cases {
+		cur, ok := Lookup(c.code)
+		if !ok {
+			t.Fatalf("unknown currency %s", c.code)
+		}
+		if got := cur.Valid(decimal.RequireFromString(c.amount)); got != c.want {
+			t.Errorf("%s %s: got %v, want %v", c.amount, c.code, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package web
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/merchant"
+)
+
+const (
+	apiKeyHeader    = "X-Api-Key"
+	signatureHeader = "X-Signature"
+	timestampHeader = "X-Timestamp"
+	adminHeader     = "X-Admin-Token"
+)
+
+// authenticator определяет мерчанта по API-ключу и проверяет подпись тела
+type authenticator struct {
+	keys    merchant.Repository
+	replay  merchant.ReplayGuard
+	cfg     config.Auth
+	timeout time.Duration
+}
+
+// merchantAuth пропускает запрос дальше только с действующим ключом.
+// Подпись: hex(HMAC-SHA256(api_key, timestamp + "." + method + "." + uri + "." + body)).
+// Проверяется, если пришёл X-Signature или подпись обязательна по конфигу.
+// Каждая подпись принимается один раз: повтор запроса подписывается заново.
+func (a *authenticator) merchantAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		secret := apiKeyFromRequest(r)
+		if secret == "" {
+			writeUnauthorized(w, "api key required")
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), a.timeout)
+		key, err := a.keys.GetActiveAPIKey(ctx, merchant.HashSecret(secret))
+		cancel()
+		if err != nil {
+			if errors.Is(err, merchant.ErrKeyNotFound) {
+				writeUnauthorized(w, "invalid api key")
+				return
+			}
+			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+				writeAuthError(w, http.StatusGatewayTimeout, "request timed out")
+				return
+			}
+			log.Printf("auth error: %v", err)
+			writeAuthError(w, http.StatusInternalServerError, "")
+			return
+		}
+
+		if r.Header.Get(signatureHeader) != "" || a.cfg.RequireSignature {
+			if err := a.verifySignature(r, secret, key.MerchantID); err != nil {
+				writeUnauthorized(w, err.Error())
+				return
+			}
+		}
+
+		next(w, r.WithContext(merchant.WithID(r.Context(), key.MerchantID)))
+	}
+}
+
+func (a *authenticator) verifySignature(r *http.Request, secret, merchantID string) error {
+	ts := r.Header.Get(timestampHeader)
+	unix, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return errors.New("invalid timestamp")
+	}
+
+	// старая подпись не принимается: окно защищает от повтора перехваченного запроса
+	skew := time.Since(time.Unix(unix, 0))
+	if skew > a.cfg.SignatureTolerance || skew < -a.cfg.SignatureTolerance {
+		return errors.New("timestamp outside tolerance")
+	}
+
+	sig, err := hex.DecodeString(r.Header.Get(signatureHeader))
+	if err != nil || len(sig) == 0 {
+		return errors.New("invalid signature")
+	}
+
+	// тело читаем целиком и возвращаем обработчику, размер уже ограничен limitBody
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return errors.New("cant read body")
+	}
+	r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts + "." + r.Method + "." + r.URL.RequestURI() + "."))
+	mac.Write(body)
+
+	if !hmac.Equal(sig, mac.Sum(nil)) {
+		return errors.New("invalid signature")
+	}
+
+	// timestamp допустим в обе стороны от now, подпись живёт два окна
+	ctx, cancel := context.WithTimeout(r.Context(), a.timeout)
+	defer cancel()
+	fresh, err := a.replay.Remember(ctx, merchantID+":"+hex.EncodeToString(sig), 2*a.cfg.SignatureTolerance)
+	if err != nil {
+		log.Printf("auth: replay guard error:%v", err)
+		return errors.New("cant verify signature")
+	}
+	if !fresh {
+		return errors.New("signature already used")
+	}
+	return nil
+}
+
+// adminAuth закрывает служебные ручки; без настроенного токена они недоступны
+func (a *authenticator) adminAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token := r.Header.Get(adminHeader)
+		if a.cfg.AdminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(a.cfg.AdminToken)) != 1 {
+			writeAuthError(w, http.StatusForbidden, "forbidden")
+			return
+		}
+		next(w, r)
+	}
+}
+
+// ключ принимается в X-Api-Key или в Authorization: Bearer
+func apiKeyFromRequest(r *http.Request) string {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return key
+	}
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	return ""
+}
+
+func writeUnauthorized(w http.ResponseWriter, msg string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="checkout"`)
+	writeAuthError(w, http.StatusUnauthorized, msg)
+}
+
+func writeAuthError(w http.ResponseWriter, code int, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+}
@@ -0,0 +1,196 @@
+package web
+
+import (
+	"context"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/merchant"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/ratelimit"
+)
+
+const (
+	defaultOverridesRefresh = 30 * time.Second
+	overridesTimeout        = 2 * time.Second
+)
+
+// rateLimiter ограничивает запросы мерчанта к каждой ручке отдельно
+type rateLimiter struct {
+	limiter   ratelimit.Limiter
+	cfg       config.RateLimit
+	overrides ratelimit.OverrideSource // nil — только лимиты из конфига
+	snapshot  atomic.Pointer[overrideSnapshot]
+	loading   atomic.Bool
+}
+
+// overrideSnapshot — лимиты мерчантов из БД на момент loadedAt
+type overrideSnapshot struct {
+	rules    map[string][]config.RateLimitRule // по merchant_id
+	loadedAt time.Time
+}
+
+// limit ставится после merchantAuth: ключ бакета — мерчант и шаблон маршрута
+func (rl *rateLimiter) limit(next http.HandlerFunc) http.HandlerFunc {
+	if !rl.cfg.Enabled {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		merchantID, _ := merchant.IDFromContext(r.Context())
+		route := r.Pattern
+
+		if rl.allow(w, r, merchantID+":"+route, rl.limitFor(merchantID, route)) {
+			next(w, r)
+		}
+	}
+}
+
+// preAuth ставится перед merchantAuth: ключ бакета — адрес клиента,
+// так перебор и неверные ключи не нагружают БД
+func (rl *rateLimiter) preAuth(next http.HandlerFunc) http.HandlerFunc {
+	if !rl.cfg.Enabled {
+		return next
+	}
+	l := ratelimit.Limit{Rate: rl.cfg.PreAuth.Rate, Burst: rl.cfg.PreAuth.Burst}
+	return func(w http.ResponseWriter, r *http.Request) {
+		if rl.allow(w, r, "ip:"+rl.clientIP(r), l) {
+			next(w, r)
+		}
+	}
+}
+
+// allow списывает токен и пишет заголовки; false — ответ 429 уже отправлен
+func (rl *rateLimiter) allow(w http.ResponseWriter, r *http.Request, key string, l ratelimit.Limit) bool {
+	if l.Rate <= 0 || l.Burst <= 0 {
+		// лимит не задан
+		return true
+	}
+
+	d, err := rl.limiter.Allow(r.Context(), key, l)
+	if err != nil {
+		// лимитер не должен ронять оплату: пропускаем без лимита
+		log.Printf("ratelimit error: %v", err)
+		return true
+	}
+
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(d.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(d.Remaining))
+	h.Set("RateLimit-Reset", ceilSeconds(d.Reset))
+
+	if !d.Allowed {
+		h.Set("Retry-After", ceilSeconds(d.RetryAfter))
+		writeAuthError(w, http.StatusTooManyRequests, "rate limit exceeded")
+		return false
+	}
+	return true
+}
+
+// clientIP: заголовку балансировщика верим, только если он настроен
+func (rl *rateLimiter) clientIP(r *http.Request) string {
+	if rl.cfg.ClientIPHeader != "" {
+		if ip := strings.TrimSpace(r.Header.Get(rl.cfg.ClientIPHeader)); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// limitFor: мерчант+ручка > мерчант > ручка > default.
+// Лимиты мерчанта из БД перекрывают такие же из конфига
+func (rl *rateLimiter) limitFor(merchantID, route string) ratelimit.Limit {
+	rule := rl.cfg.Default
+	matched := 0
+
+	for _, r := range rl.cfg.Routes {
+		if r.Route == route {
+			rule, matched = r, 1
+		}
+	}
+	merchantRules := func(rules []config.RateLimitRule) {
+		for _, r := range rules {
+			if r.MerchantID != merchantID {
+				continue
+			}
+			switch {
+			case r.Route == route:
+				rule, matched = r, 3
+			case r.Route == "" && matched <= 2:
+				rule, matched = r, 2
+			}
+		}
+	}
+	merchantRules(rl.cfg.Merchants)
+	merchantRules(rl.overridesFor(merchantID))
+
+	return ratelimit.Limit{Rate: rule.Rate, Burst: rule.Burst}
+}
+
+// overridesFor берёт лимиты мерчанта из последнего снимка. Первый снимок
+// загружается в запросе, устаревший обновляется в фоне, не задерживая запросы
+func (rl *rateLimiter) overridesFor(merchantID string) []config.RateLimitRule {
+	if rl.overrides == nil {
+		return nil
+	}
+
+	refresh := rl.cfg.OverridesRefresh
+	if refresh <= 0 {
+		refresh = defaultOverridesRefresh
+	}
+
+	s := rl.snapshot.Load()
+	switch {
+	case s == nil:
+		s = rl.loadOverrides()
+	case time.Since(s.loadedAt) > refresh && rl.loading.CompareAndSwap(false, true):
+		go func() {
+			defer rl.loading.Store(false)
+			rl.loadOverrides()
+		}()
+	}
+	return s.rules[merchantID]
+}
+
+// loadOverrides перечитывает лимиты из БД; при ошибке остаётся прежний снимок
+// до следующей попытки через OverridesRefresh
+func (rl *rateLimiter) loadOverrides() *overrideSnapshot {
+	ctx, cancel := context.WithTimeout(context.Background(), overridesTimeout)
+	defer cancel()
+
+	overrides, err := rl.overrides.ListRateLimitOverrides(ctx)
+	if err != nil {
+		log.Printf("ratelimit: error load merchant overrides:%v", err)
+		s := &overrideSnapshot{loadedAt: time.Now()}
+		if prev := rl.snapshot.Load(); prev != nil {
+			s.rules = prev.rules
+		}
+		rl.snapshot.Store(s)
+		return s
+	}
+
+	s := &overrideSnapshot{rules: make(map[string][]config.RateLimitRule), loadedAt: time.Now()}
+	for _, o := range overrides {
+		s.rules[o.MerchantID] = append(s.rules[o.MerchantID], config.RateLimitRule{
+			MerchantID: o.MerchantID,
+			Route:      o.Route,
+			Rate:       o.Rate,
+			Burst:      o.Burst,
+		})
+	}
+	rl.snapshot.Store(s)
+	return s
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
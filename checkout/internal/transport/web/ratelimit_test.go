@@ -0,0 +1,174 @@
+package web
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/merchant"
+	domainratelimit "github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/ratelimit"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/ratelimit"
+)
+
+// fakeKeys считает обращения к БД за ключом; известен только "sk_valid"
+type fakeKeys struct {
+	merchant.Repository
+	lookups int
+}
+
+func (k *fakeKeys) GetActiveAPIKey(ctx context.Context, hash string) (merchant.APIKey, error) {
+	k.lookups++
+	if hash == merchant.HashSecret("sk_valid") {
+		return merchant.APIKey{ID: "key_1", MerchantID: "m_1"}, nil
+	}
+	return merchant.APIKey{}, merchant.ErrKeyNotFound
+}
+
+func newTestProtected(cfg config.RateLimit, keys *fakeKeys) http.HandlerFunc {
+	a := &authenticator{keys: keys, timeout: time.Second}
+	rl := &rateLimiter{limiter: ratelimit.NewMemory(), cfg: cfg}
+	return rl.preAuth(a.merchantAuth(rl.limit(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})))
+}
+
+func doRequest(h http.HandlerFunc, remoteAddr, key string) int {
+	r := httptest.NewRequest(http.MethodGet, "/v1/payments", nil)
+	r.RemoteAddr = remoteAddr
+	r.Header.Set(apiKeyHeader, key)
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w.Code
+}
+
+func TestPreAuthLimitStopsKeyGuessing(t *testing.T) {
+	keys := &fakeKeys{}
+	h := newTestProtected(config.RateLimit{
+		Enabled: true,
+		PreAuth: config.RateLimitRule{Rate: 0.001, Burst: 2},
+	}, keys)
+
+	for i, want := range []int{401, 401, 429, 429} {
+		if got := doRequest(h, "203.0.113.7:5000", "sk_guess"); got != want {
+			t.Fatalf("request %d: got %d, want %d", i, got, want)
+		}
+	}
+	// после лимита запросы не доходят до БД
+	if keys.lookups != 2 {
+		t.Fatalf("expected 2 key lookups, got %d", keys.lookups)
+	}
+
+	// лимит — на адрес: другой клиент проходит
+	if got := doRequest(h, "203.0.113.8:5000", "sk_valid"); got != http.StatusNoContent {
+		t.Fatalf("other client: got %d", got)
+	}
+}
+
+func TestMerchantLimitAfterAuth(t *testing.T) {
+	h := newTestProtected(config.RateLimit{
+		Enabled: true,
+		PreAuth: config.RateLimitRule{Rate: 100, Burst: 100},
+		Default: config.RateLimitRule{Rate: 0.001, Burst: 1},
+	}, &fakeKeys{})
+
+	if got := doRequest(h, "203.0.113.7:5000", "sk_valid"); got != http.StatusNoContent {
+		t.Fatalf("first request: got %d", got)
+	}
+	// лимит мерчанта общий для всех его адресов
+	if got := doRequest(h, "203.0.113.8:5000", "sk_valid"); got != http.StatusTooManyRequests {
+		t.Fatalf("second request: got %d", got)
+	}
+}
+
+func TestLimitFor(t *testing.T) {
+	rl := &rateLimiter{cfg: config.RateLimit{
+		Default: config.RateLimitRule{Rate: 1, Burst: 1},
+		Routes:  []config.RateLimitRule{{Route: "POST /v1/payments", Rate: 2, Burst: 2}},
+		Merchants: []config.RateLimitRule{
+			{MerchantID: "m_1", Rate: 3, Burst: 3},
+			{MerchantID: "m_1", Route: "POST /v1/payments", Rate: 4, Burst: 4},
+		},
+	}}
+
+	cases := []struct {
+		merchant, route string
+		want            int
+	}{
+		{"m_2", "GET /v1/payments", 1},
+		{"m_2", "POST /v1/payments", 2},
+		{"m_1", "GET /v1/payments", 3},
+		{"m_1", "POST /v1/payments", 4},
+	}
+	for _, c := range cases {
+		if got := rl.limitFor(c.merchant, c.route); got.Burst != c.want {
+			t.Errorf("%s %s: got burst %d, want %d", c.merchant, c.route, got.Burst, c.want)
+		}
+	}
+}
+
+// fakeOverrides — таблица merchant_rate_limits
+type fakeOverrides struct {
+	rows  []domainratelimit.Override
+	err   error
+	loads int
+}
+
+func (o *fakeOverrides) ListRateLimitOverrides(ctx context.Context) ([]domainratelimit.Override, error) {
+	o.loads++
+	return o.rows, o.err
+}
+
+func TestLimitForDBOverrides(t *testing.T) {
+	src := &fakeOverrides{rows: []domainratelimit.Override{
+		{MerchantID: "m_1", Limit: domainratelimit.Limit{Rate: 5, Burst: 5}},
+		{MerchantID: "m_2", Route: "POST /v1/payments", Limit: domainratelimit.Limit{Rate: 6, Burst: 6}},
+	}}
+	rl := &rateLimiter{overrides: src, cfg: config.RateLimit{
+		Default:          config.RateLimitRule{Rate: 1, Burst: 1},
+		Merchants:        []config.RateLimitRule{{MerchantID: "m_1", Rate: 3, Burst: 3}},
+		OverridesRefresh: time.Hour,
+	}}
+
+	cases := []struct {
+		merchant, route string
+		want            int
+	}{
+		{"m_1", "GET /v1/payments", 5}, // БД перекрывает конфиг
+		{"m_2", "POST /v1/payments", 6},
+		{"m_2", "GET /v1/payments", 1},
+		{"m_3", "GET /v1/payments", 1},
+	}
+	for _, c := range cases {
+		if got := rl.limitFor(c.merchant, c.route); got.Burst != c.want {
+			t.Errorf("%s %s: got burst %d, want %d", c.merchant, c.route, got.Burst, c.want)
+		}
+	}
+	// снимок свежий — в БД за каждым запросом не ходим
+	if src.loads != 1 {
+		t.Fatalf("expected 1 load, got %d", src.loads)
+	}
+
+	// ошибка чтения оставляет прежние лимиты
+	src.rows, src.err = nil, errors.New("db down")
+	if got := rl.loadOverrides(); len(got.rules["m_1"]) != 1 {
+		t.Fatalf("overrides lost on error: %+v", got.rules)
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:5000"
+	r.Header.Set("X-Real-IP", "203.0.113.7")
+
+	if ip := (&rateLimiter{}).clientIP(r); ip != "10.0.0.1" {
+		t.Fatalf("header trusted without config: %s", ip)
+	}
+	rl := &rateLimiter{cfg: config.RateLimit{ClientIPHeader: "X-Real-IP"}}
+	if ip := rl.clientIP(r); ip != "203.0.113.7" {
+		t.Fatalf("configured header ignored: %s", ip)
+	}
+}
@@ -2,14 +2,17 @@ package web
 
 import (
 	"context"
+	"expvar"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/idempotency"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/merchant"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/ratelimit"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/kafka"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/postgres"
-	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/redisidem"
 	v1 "github.com/EgorLis/MicroserviceExampleGo/checkout/internal/transport/web/v1"
 )
 
@@ -18,12 +21,43 @@ type Server struct {
 	cfg    config.HTTP
 }
 
-func New(cfg config.HTTP, db *postgres.PaymentsRepo, idemStore *redisidem.Store, kafkaProducer *kafka.Producer) *Server {
-	healthHandler := &v1.HealthHandler{Version: config.Version, DBPinger: db, CachePinger: idemStore}
-	paymentsHandler := &v1.PaymentsHandler{Cfg: cfg, IdemStore: idemStore, Repo: db, Publisher: kafkaProducer}
+// Deps — всё, что нужно серверу: конфиги ручек и их хранилища
+type Deps struct {
+	HTTP        config.HTTP
+	Auth        config.Auth
+	RateLimit   config.RateLimit
+	Idempotency config.Idempotency
+	Archive     config.Archive
+	Webhooks    config.Webhooks
+
+	DB        *postgres.PaymentsRepo
+	IdemStore idempotency.Store
+	IdemTx    idempotency.TxRunner
+	Limiter   ratelimit.Limiter
+	Replay    merchant.ReplayGuard
+	Producer  *kafka.Producer
+	Outbox    v1.OutboxStatus
+}
+
+func New(d Deps) *Server {
+	cfg, db := d.HTTP, d.DB
+	healthHandler := &v1.HealthHandler{Version: config.Version, DBPinger: db, IdemPinger: d.IdemStore, Outbox: d.Outbox}
+	lease := d.Idempotency.Lease
+	if lease <= 0 {
+		lease = idempotency.DefaultLease
+	}
+	paymentsHandler := &v1.PaymentsHandler{Cfg: cfg, IdemStore: d.IdemStore, IdemLease: lease, Tx: d.IdemTx, Repo: db,
+		Merchants: db, Publisher: d.Producer}
+	refundsHandler := &v1.RefundsHandler{Cfg: cfg, IdemStore: d.IdemStore, IdemLease: lease, Tx: d.IdemTx, Repo: db,
+		Payments: db}
+	merchantsHandler := &v1.MerchantsHandler{Cfg: cfg, Auth: d.Auth, Repo: db}
+	webhooksHandler := &v1.WebhooksHandler{Cfg: cfg, Webhooks: d.Webhooks, Repo: db}
+	outboxHandler := &v1.OutboxHandler{Cfg: cfg, Archive: d.Archive, Repo: db}
+	auth := &authenticator{keys: db, replay: d.Replay, cfg: d.Auth, timeout: cfg.PaymentTimeout}
+	rl := &rateLimiter{limiter: d.Limiter, cfg: d.RateLimit, overrides: db}
 	srv := &http.Server{
 		Addr:              cfg.Addr,
-		Handler:           newRouter(healthHandler, paymentsHandler),
+		Handler:           newRouter(auth, rl, healthHandler, paymentsHandler, refundsHandler, merchantsHandler, webhooksHandler, outboxHandler),
 		ReadTimeout:       10 * time.Second,
 		WriteTimeout:      10 * time.Second,
 		MaxHeaderBytes:    1 << 20,
@@ -48,17 +82,53 @@ func (ws *Server) Close(ctx context.Context) {
 	log.Println("server exited gracefully")
 }
 
-func newRouter(hh *v1.HealthHandler, ph *v1.PaymentsHandler) http.Handler {
+func newRouter(a *authenticator, rl *rateLimiter, hh *v1.HealthHandler, ph *v1.PaymentsHandler, rh *v1.RefundsHandler,
+	mh *v1.MerchantsHandler, wh *v1.WebhooksHandler, oh *v1.OutboxHandler) http.Handler {
 	mux := http.NewServeMux()
 
+	// мерчантские ручки: лимит по адресу, аутентификация, затем лимит мерчанта
+	protected := func(h http.HandlerFunc) http.HandlerFunc {
+		return rl.preAuth(a.merchantAuth(rl.limit(h)))
+	}
+
 	// health
 	mux.HandleFunc("GET /healthz", hh.Liveness)
 	mux.HandleFunc("GET /readyz", hh.Readiness)
 	mux.HandleFunc("GET /version", hh.VersionInfo)
 
 	// payments
-	mux.HandleFunc("POST /v1/payments", limitBody(16<<10, ph.Create)) // 16 KB
-	mux.HandleFunc("GET /v1/payments/{id}", ph.Get)
+	mux.HandleFunc("POST /v1/payments", limitBody(16<<10, protected(ph.Create))) // 16 KB
+	mux.HandleFunc("GET /v1/payments", protected(ph.List))
+	mux.HandleFunc("GET /v1/payments/{id}", protected(ph.Get))
+	mux.HandleFunc("GET /v1/payments/{id}/events", protected(ph.Events))
+	mux.HandleFunc("POST /v1/payments/{id}/capture", limitBody(1<<10, protected(ph.Capture))) // 1 KB
+	mux.HandleFunc("POST /v1/payments/{id}/void", limitBody(1<<10, protected(ph.Void)))
+	mux.HandleFunc("POST /v1/payments/{id}/confirm", limitBody(1<<10, protected(ph.Confirm)))
+
+	// refunds
+	mux.HandleFunc("POST /v1/payments/{id}/refunds", limitBody(4<<10, protected(rh.Create))) // 4 KB
+	mux.HandleFunc("GET /v1/refunds/{id}", protected(rh.Get))
+
+	// webhooks
+	mux.HandleFunc("POST /v1/webhooks/endpoints", limitBody(4<<10, protected(wh.CreateEndpoint)))
+	mux.HandleFunc("GET /v1/webhooks/endpoints", protected(wh.ListEndpoints))
+	mux.HandleFunc("DELETE /v1/webhooks/endpoints/{id}", protected(wh.DeleteEndpoint))
+	mux.HandleFunc("GET /v1/webhooks/deliveries", protected(wh.ListDeliveries))
+	mux.HandleFunc("GET /v1/webhooks/{delivery_id}", protected(wh.GetDelivery))
+	mux.HandleFunc("POST /v1/webhooks/{delivery_id}/redeliver", limitBody(1<<10, protected(wh.Redeliver)))
+
+	// admin
+	mux.HandleFunc("POST /admin/v1/merchants", limitBody(1<<10, a.adminAuth(mh.Create)))
+	mux.HandleFunc("PUT /admin/v1/merchants/{id}/currencies", limitBody(4<<10, a.adminAuth(mh.SetCurrencies)))
+	mux.HandleFunc("GET /admin/v1/merchants/{id}/keys", a.adminAuth(mh.ListKeys))
+	mux.HandleFunc("POST /admin/v1/merchants/{id}/keys", limitBody(1<<10, a.adminAuth(mh.RotateKey)))
+	mux.HandleFunc("DELETE /admin/v1/merchants/{id}/keys/{key_id}", a.adminAuth(mh.RevokeKey))
+	mux.HandleFunc("GET /admin/v1/outbox/events", a.adminAuth(oh.List))
+	mux.HandleFunc("GET /admin/v1/outbox/events/{id}", a.adminAuth(oh.Get))
+	mux.HandleFunc("POST /admin/v1/outbox/events/{id}/retry", a.adminAuth(oh.Retry))
+	mux.HandleFunc("POST /admin/v1/outbox/retry", limitBody(1<<10, a.adminAuth(oh.RetryAll)))
+	mux.HandleFunc("POST /admin/v1/outbox/purge", limitBody(1<<10, a.adminAuth(oh.Purge)))
+	mux.HandleFunc("GET /admin/v1/metrics", a.adminAuth(expvar.Handler().ServeHTTP)) // счётчики воркеров
 
 	loggedMux := loggingMiddleware(mux)
 
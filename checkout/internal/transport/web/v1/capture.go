@@ -0,0 +1,274 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/events"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/idempotency"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+// Capture списывает авторизованный платёж полностью или частично
+func (ph *PaymentsHandler) Capture(w http.ResponseWriter, r *http.Request) {
+	var req paymentCaptureRequest
+
+	// тело необязательно: пустое — capture на всю сумму
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	defer r.Body.Close()
+
+	if req.Amount != "" && !validateAmount(req.Amount, anyCurrency) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": []string{"invalid amount"}})
+		return
+	}
+
+	ph.operate(w, r, "capture", req, payment.StatusCapturing, func(pay payment.Payment) (event.Envelope, int, error) {
+		if !manualAuthorized(pay) {
+			return event.Envelope{}, http.StatusConflict, errNotManualAuthorized
+		}
+		amount := pay.Amount
+		if req.Amount != "" {
+			if !validateAmount(req.Amount, amountCurrency(pay.Currency)) {
+				return event.Envelope{}, http.StatusBadRequest, errors.New("invalid amount")
+			}
+			amount, _ = decimal.NewFromString(req.Amount)
+		}
+		if amount.GreaterThan(pay.Amount) {
+			return event.Envelope{}, http.StatusUnprocessableEntity, errors.New("amount exceeds authorized amount")
+		}
+		env, err := events.NewPaymentCaptureRequestedEvent(pay, amount)
+		return env, http.StatusInternalServerError, err
+	})
+}
+
+// Void отменяет авторизацию без списания
+func (ph *PaymentsHandler) Void(w http.ResponseWriter, r *http.Request) {
+	ph.operate(w, r, "void", nil, payment.StatusVoiding, func(pay payment.Payment) (event.Envelope, int, error) {
+		if !manualAuthorized(pay) {
+			return event.Envelope{}, http.StatusConflict, errNotManualAuthorized
+		}
+		env, err := events.NewPaymentVoidRequestedEvent(pay, events.VoidReasonMerchant)
+		return env, http.StatusInternalServerError, err
+	})
+}
+
+// Confirm продолжает авторизацию после того, как покупатель прошёл challenge
+func (ph *PaymentsHandler) Confirm(w http.ResponseWriter, r *http.Request) {
+	var req paymentConfirmRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	defer r.Body.Close()
+
+	if req.ChallengeID == "" {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": []string{"challenge_id is required"}})
+		return
+	}
+
+	ph.operate(w, r, "confirm", req, payment.StatusProcessing, func(pay payment.Payment) (event.Envelope, int, error) {
+		if pay.Status != payment.StatusRequiresAction || pay.NextAction == nil {
+			return event.Envelope{}, http.StatusConflict, errors.New("payment does not require action")
+		}
+		if req.ChallengeID != pay.NextAction.ChallengeID {
+			return event.Envelope{}, http.StatusUnprocessableEntity, errors.New("challenge_id does not match")
+		}
+		env, err := events.NewPaymentConfirmRequestedEvent(pay, req.ChallengeID)
+		return env, http.StatusInternalServerError, err
+	})
+}
+
+var errNotManualAuthorized = errors.New("payment is not authorized for manual capture")
+
+func manualAuthorized(pay payment.Payment) bool {
+	return pay.CaptureMethod == payment.CaptureManual && pay.Status == payment.StatusAuthorized
+}
+
+// operate переводит платёж в to и кладёт команду для provider в outbox.
+// newEvent проверяет, что операция допустима в текущем статусе.
+// С Idempotency-Key повтор запроса получает записанный ответ, ключи операций
+// не пересекаются с ключами создания (префикс op)
+func (ph *PaymentsHandler) operate(w http.ResponseWriter, r *http.Request, op string, req any,
+	to payment.PaymentStatus, newEvent func(payment.Payment) (event.Envelope, int, error)) {
+	paymentID := r.PathValue("id")
+
+	if !validatePayID(paymentID) {
+		writeError(w, http.StatusBadRequest, "wrong id")
+		return
+	}
+
+	idemKey := r.Header.Get("Idempotency-Key")
+	if idemKey != "" {
+		if err := validateIdempotencyKey(idemKey); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), ph.Cfg.PaymentTimeout)
+	defer cancel()
+
+	pay, err := ph.Repo.GetPaymentByID(ctx, paymentID)
+	if err == nil && pay.MerchantID != authMerchant(r) {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	if idemKey == "" {
+		updated, code, err := ph.apply(ctx, pay, to, newEvent)
+		switch {
+		case err == nil:
+			writeJSON(w, http.StatusAccepted, ToResponse(updated))
+		case code != 0:
+			writeError(w, code, err.Error())
+		default:
+			writeInternalError(w, "db", err)
+		}
+		return
+	}
+
+	key := op + ":" + idemKey
+	bodyHash, err := canonicalHash(struct {
+		PaymentID string
+		Request   any
+	}{paymentID, req})
+	if err != nil {
+		writeInternalError(w, "idempotency", err)
+		return
+	}
+	owner := idempotencyOwner()
+
+	var (
+		created bool
+		code    int
+		resp    map[string]any
+	)
+	err = ph.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		// запись до Reserve: если она есть, ключ перехватывается у прежней попытки
+		prev, err := ph.IdemStore.Load(ctx, pay.MerchantID, key)
+		if err != nil {
+			return err
+		}
+		created, err = ph.IdemStore.Reserve(ctx, pay.MerchantID, key, bodyHash, owner, ph.IdemLease, idempotency.TTL)
+		if err != nil || !created {
+			return err
+		}
+
+		// прежняя попытка упала после перехода: операция уже применена, а платёж
+		// мог уйти и дальше (provider провёл capture) — отдаём его как успех
+		updated := pay
+		if prev == nil || !pay.Status.Reached(to) {
+			var c int
+			updated, c, err = ph.apply(ctx, pay, to, newEvent)
+			if err != nil && c > 0 && c < http.StatusInternalServerError {
+				// отказ по статусу или сумме: повтор получит тот же ответ
+				code, resp = c, map[string]any{"error": err.Error()}
+				return failIdempotency(ctx, ph.IdemStore, pay.MerchantID, key, owner, bodyHash, false, code, resp)
+			}
+			if err != nil {
+				return err
+			}
+		}
+
+		code = http.StatusAccepted
+		if resp, err = toMap(ToResponse(updated)); err != nil {
+			return err
+		}
+		return ph.IdemStore.Finalize(ctx, pay.MerchantID, key, owner, bodyHash, code, pay.ID, resp, idempotency.TTL)
+	})
+	if err != nil {
+		// аренду перехватили, пока мы работали: итог запишет новый владелец
+		if errors.Is(err, idempotency.ErrLeaseLost) {
+			ph.replayOperation(ctx, w, pay, key, bodyHash)
+			return
+		}
+		failIdempotency(ctx, ph.IdemStore, pay.MerchantID, key, owner, bodyHash, true, 0, nil)
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	if !created {
+		ph.replayOperation(ctx, w, pay, key, bodyHash)
+		return
+	}
+
+	writeJSON(w, code, resp)
+}
+
+// apply проверяет операцию и переводит платёж. code != 0 — отказ с этим статусом,
+// code == 0 с ошибкой — сбой инфраструктуры
+func (ph *PaymentsHandler) apply(ctx context.Context, pay payment.Payment, to payment.PaymentStatus,
+	newEvent func(payment.Payment) (event.Envelope, int, error)) (payment.Payment, int, error) {
+	env, code, err := newEvent(pay)
+	if err != nil {
+		return payment.Payment{}, code, err
+	}
+
+	updated, err := ph.Repo.Transition(ctx, payment.Transition{
+		PaymentID: pay.ID,
+		From:      pay.Status,
+		To:        to,
+		EventType: "http." + string(env.Type),
+		Out:       &env,
+	})
+	if err != nil {
+		if errors.Is(err, payment.ErrStatusConflict) || errors.Is(err, payment.ErrInvalidTransition) {
+			return payment.Payment{}, http.StatusConflict, errors.New("payment status changed")
+		}
+		return payment.Payment{}, 0, err
+	}
+	return updated, 0, nil
+}
+
+// replayOperation отвечает на повтор операции с уже занятым ключом
+func (ph *PaymentsHandler) replayOperation(ctx context.Context, w http.ResponseWriter, pay payment.Payment,
+	key, bodyHash string) {
+	val, err := ph.IdemStore.Load(ctx, pay.MerchantID, key)
+	if err != nil {
+		writeInternalError(w, "idempotency", err)
+		return
+	}
+	if val == nil {
+		// ключ истёк между Reserve и Load
+		writeError(w, http.StatusConflict, "idempotency key expired, retry the request")
+		return
+	}
+	if val.BodyHash != bodyHash {
+		writeError(w, http.StatusUnprocessableEntity, "idempotency key reused with different payload")
+		return
+	}
+
+	switch val.State {
+	case idempotency.StateInProgress:
+		// владелец ещё работает: отдаём платёж как есть
+		writeInProgress(w, val, ToResponse(pay))
+	case idempotency.StateDone:
+		writeJSON(w, val.HTTPCode, val.Response)
+	case idempotency.StateError:
+		if !val.Retryable {
+			writeJSON(w, val.HTTPCode, val.Response)
+			return
+		}
+		// восстановимую ошибку только что перехватил параллельный повтор
+		writeError(w, http.StatusConflict, "previous attempt failed, retry the request")
+	}
+}
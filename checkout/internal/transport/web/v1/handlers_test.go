@@ -0,0 +1,421 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/idempotency"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/merchant"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/refund"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/infra/memidem"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/event"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+const testMerchant = "m_1"
+
+// fakePayments хранит платежи в памяти; insertErr — ошибка следующей вставки
+type fakePayments struct {
+	payment.Repository
+	mu          sync.Mutex
+	byID        map[string]payment.Payment
+	inserts     int
+	insertErr   error
+	transitions int
+}
+
+func newFakePayments() *fakePayments {
+	return &fakePayments{byID: map[string]payment.Payment{}}
+}
+
+func (f *fakePayments) InsertPayment(ctx context.Context, p payment.Payment, out event.Envelope) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if err := f.insertErr; err != nil {
+		f.insertErr = nil
+		return err
+	}
+	f.inserts++
+	f.byID[p.ID] = p
+	return nil
+}
+
+func (f *fakePayments) GetPaymentByID(ctx context.Context, id string) (payment.Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.byID[id]
+	if !ok {
+		return payment.Payment{}, pgx.ErrNoRows
+	}
+	return p, nil
+}
+
+func (f *fakePayments) GetPaymentByUniqKeys(ctx context.Context, merchantID, orderID string) (payment.Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, p := range f.byID {
+		if p.MerchantID == merchantID && p.OrderID == orderID {
+			return p, nil
+		}
+	}
+	return payment.Payment{}, pgx.ErrNoRows
+}
+
+func (f *fakePayments) Transition(ctx context.Context, tr payment.Transition) (payment.Payment, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	p, ok := f.byID[tr.PaymentID]
+	if !ok {
+		return payment.Payment{}, pgx.ErrNoRows
+	}
+	if p.Status != tr.From {
+		return payment.Payment{}, payment.ErrStatusConflict
+	}
+	f.transitions++
+	p.Status = tr.To
+	f.byID[p.ID] = p
+	return p, nil
+}
+
+// fakeRefunds проверяет остаток как InsertRefund под блокировкой платежа
+type fakeRefunds struct {
+	refund.Repository
+	mu       sync.Mutex
+	payments *fakePayments
+	refunds  []refund.Refund
+	inserts  int
+}
+
+func (f *fakeRefunds) InsertRefund(ctx context.Context, ref refund.Refund, out event.Envelope) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	pay, _ := f.payments.GetPaymentByID(ctx, ref.PaymentID)
+	if pay.Status != payment.StatusSucceeded {
+		return refund.ErrPaymentNotRefundable
+	}
+	if ref.Amount.GreaterThan(refund.Remaining(pay.CapturedOrAmount(), f.refunded(ref.PaymentID))) {
+		return refund.ErrExceedsRefundable
+	}
+	f.inserts++
+	f.refunds = append(f.refunds, ref)
+	return nil
+}
+
+func (f *fakeRefunds) GetRefundByIdemKey(ctx context.Context, paymentID, idemKey string) (refund.Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, r := range f.refunds {
+		if r.PaymentID == paymentID && r.IdempotencyKey == idemKey {
+			return r, nil
+		}
+	}
+	return refund.Refund{}, refund.ErrNotFound
+}
+
+func (f *fakeRefunds) GetRefundedAmount(ctx context.Context, paymentID string) (decimal.Decimal, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.refunded(paymentID), nil
+}
+
+func (f *fakeRefunds) refunded(paymentID string) decimal.Decimal {
+	sum := decimal.Zero
+	for _, r := range f.refunds {
+		if r.PaymentID == paymentID {
+			sum = sum.Add(r.Amount)
+		}
+	}
+	return sum
+}
+
+type fakeMerchants struct{ merchant.Repository }
+
+func (fakeMerchants) GetMerchant(ctx context.Context, id string) (merchant.Merchant, error) {
+	if id != testMerchant {
+		return merchant.Merchant{}, merchant.ErrNotFound
+	}
+	return merchant.Merchant{ID: id}, nil
+}
+
+// countingTx — как idempotency.NoTx, но считает вызовы
+type countingTx struct{ calls int }
+
+func (t *countingTx) WithinTx(ctx context.Context, fn func(ctx context.Context) error) error {
+	t.calls++
+	return fn(ctx)
+}
+
+func newRequest(method, target, idemKey, body string) *http.Request {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	r.Header.Set("Idempotency-Key", idemKey)
+	return r.WithContext(merchant.WithID(r.Context(), testMerchant))
+}
+
+func serve(h http.HandlerFunc, r *http.Request) (int, map[string]any) {
+	w := httptest.NewRecorder()
+	h(w, r)
+	var body map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &body)
+	return w.Code, body
+}
+
+func newPaymentsHandler(repo *fakePayments) *PaymentsHandler {
+	return &PaymentsHandler{
+		Repo: repo, Tx: &countingTx{}, Merchants: fakeMerchants{}, IdemStore: memidem.New(),
+		Cfg: config.HTTP{PaymentTimeout: time.Second}, IdemLease: time.Minute,
+	}
+}
+
+const paymentBody = `{"order_id":"o_1","amount":"10.50","currency":"USD","method_token":"tok_visa"}`
+
+func TestCreatePaymentReplaysByKey(t *testing.T) {
+	repo := newFakePayments()
+	ph := newPaymentsHandler(repo)
+
+	code, first := serve(ph.Create, newRequest(http.MethodPost, "/v1/payments", "k1", paymentBody))
+	if code != http.StatusCreated {
+		t.Fatalf("create: got %d %v", code, first)
+	}
+	code, second := serve(ph.Create, newRequest(http.MethodPost, "/v1/payments", "k1", paymentBody))
+	if code != http.StatusCreated || second["payment_id"] != first["payment_id"] {
+		t.Fatalf("replay: got %d %v, want %v", code, second, first["payment_id"])
+	}
+	if repo.inserts != 1 {
+		t.Fatalf("expected single insert, got %d", repo.inserts)
+	}
+
+	other := strings.Replace(paymentBody, "10.50", "11.00", 1)
+	if code, _ := serve(ph.Create, newRequest(http.MethodPost, "/v1/payments", "k1", other)); code != http.StatusUnprocessableEntity {
+		t.Fatalf("key reused with other body: got %d", code)
+	}
+}
+
+func TestCreatePaymentRetriesAfterFailure(t *testing.T) {
+	repo := newFakePayments()
+	repo.insertErr = errors.New("db down")
+	ph := newPaymentsHandler(repo)
+
+	if code, _ := serve(ph.Create, newRequest(http.MethodPost, "/v1/payments", "k1", paymentBody)); code != http.StatusInternalServerError {
+		t.Fatalf("failed insert: got %d", code)
+	}
+	// восстановимая ошибка: повтор с тем же ключом перехватывает его сразу
+	if code, body := serve(ph.Create, newRequest(http.MethodPost, "/v1/payments", "k1", paymentBody)); code != http.StatusCreated {
+		t.Fatalf("retry: got %d %v", code, body)
+	}
+	if repo.inserts != 1 {
+		t.Fatalf("expected single insert, got %d", repo.inserts)
+	}
+}
+
+func newRefundsHandler(payments *fakePayments, amount string) (*RefundsHandler, *fakeRefunds, *countingTx, string) {
+	payID := "pay_" + uuid.NewString()
+	payments.byID[payID] = payment.Payment{
+		ID: payID, MerchantID: testMerchant, OrderID: "o_1", Currency: "USD",
+		Amount: decimal.RequireFromString(amount), Status: payment.StatusSucceeded,
+	}
+	refunds := &fakeRefunds{payments: payments}
+	tx := &countingTx{}
+	rh := &RefundsHandler{
+		Repo: refunds, Payments: payments, IdemStore: memidem.New(), Tx: tx,
+		Cfg: config.HTTP{PaymentTimeout: time.Second}, IdemLease: time.Minute,
+	}
+	return rh, refunds, tx, payID
+}
+
+func refundRequest(payID, idemKey, body string) *http.Request {
+	r := newRequest(http.MethodPost, "/v1/payments/"+payID+"/refunds", idemKey, body)
+	r.SetPathValue("id", payID)
+	return r
+}
+
+func TestCreateRefundReplaysByKey(t *testing.T) {
+	rh, refunds, tx, payID := newRefundsHandler(newFakePayments(), "10.00")
+
+	code, first := serve(rh.Create, refundRequest(payID, "r1", `{"amount":"4.00"}`))
+	if code != http.StatusCreated {
+		t.Fatalf("create: got %d %v", code, first)
+	}
+	code, second := serve(rh.Create, refundRequest(payID, "r1", `{"amount":"4.00"}`))
+	if code != http.StatusCreated || second["refund_id"] != first["refund_id"] {
+		t.Fatalf("replay: got %d %v, want %v", code, second, first["refund_id"])
+	}
+	if refunds.inserts != 1 {
+		t.Fatalf("expected single insert, got %d", refunds.inserts)
+	}
+	// резерв, возврат и финализация — внутри TxRunner
+	if tx.calls != 2 {
+		t.Fatalf("expected every attempt within tx, got %d calls", tx.calls)
+	}
+
+	// пустая сумма — весь остаток
+	code, rest := serve(rh.Create, refundRequest(payID, "r2", `{}`))
+	if code != http.StatusCreated {
+		t.Fatalf("remaining refund: got %d %v", code, rest)
+	}
+	if got := refunds.refunds[1].Amount; !got.Equal(decimal.RequireFromString("6.00")) {
+		t.Fatalf("remaining refund amount: got %s", got)
+	}
+}
+
+func TestCreateRefundRejectionIsStored(t *testing.T) {
+	rh, refunds, _, payID := newRefundsHandler(newFakePayments(), "10.00")
+
+	if code, _ := serve(rh.Create, refundRequest(payID, "r1", `{"amount":"12.00"}`)); code != http.StatusUnprocessableEntity {
+		t.Fatalf("exceeding refund: got %d", code)
+	}
+	// невосстановимый отказ отдаётся из ключа, а не считается заново
+	refunds.payments.byID[payID] = payment.Payment{
+		ID: payID, MerchantID: testMerchant, Currency: "USD",
+		Amount: decimal.RequireFromString("20.00"), Status: payment.StatusSucceeded,
+	}
+	if code, _ := serve(rh.Create, refundRequest(payID, "r1", `{"amount":"12.00"}`)); code != http.StatusUnprocessableEntity {
+		t.Fatalf("replayed rejection: got %d", code)
+	}
+	if refunds.inserts != 0 {
+		t.Fatalf("rejected refund inserted %d times", refunds.inserts)
+	}
+}
+
+func TestCreateRefundNotRefundable(t *testing.T) {
+	payments := newFakePayments()
+	rh, _, _, payID := newRefundsHandler(payments, "10.00")
+	p := payments.byID[payID]
+	p.Status = payment.StatusAuthorized
+	payments.byID[payID] = p
+
+	if code, _ := serve(rh.Create, refundRequest(payID, "r1", `{"amount":"1.00"}`)); code != http.StatusConflict {
+		t.Fatalf("refund of authorized payment: got %d", code)
+	}
+}
+
+type pinger struct{ err error }
+
+func (p pinger) Ping() error { return p.err }
+
+func TestReadinessPingsIdempotencyStore(t *testing.T) {
+	h := &HealthHandler{DBPinger: pinger{}, IdemPinger: memidem.New()}
+	if code, _ := serve(h.Readiness, httptest.NewRequest(http.MethodGet, "/readyz", nil)); code != http.StatusOK {
+		t.Fatalf("memory store: got %d", code)
+	}
+
+	h.IdemPinger = pinger{err: errors.New("redis not responding")}
+	if code, _ := serve(h.Readiness, httptest.NewRequest(http.MethodGet, "/readyz", nil)); code != http.StatusServiceUnavailable {
+		t.Fatalf("unavailable store: got %d", code)
+	}
+}
+
+func newAuthorized(repo *fakePayments) string {
+	payID := "pay_" + uuid.NewString()
+	repo.byID[payID] = payment.Payment{
+		ID: payID, MerchantID: testMerchant, OrderID: "o_1", Currency: "USD",
+		Amount: decimal.RequireFromString("10.00"), Status: payment.StatusAuthorized,
+		CaptureMethod: payment.CaptureManual,
+	}
+	return payID
+}
+
+func operationRequest(payID, op, idemKey, body string) *http.Request {
+	r := newRequest(http.MethodPost, "/v1/payments/"+payID+"/"+op, idemKey, body)
+	r.SetPathValue("id", payID)
+	return r
+}
+
+func TestCaptureReplaysByKey(t *testing.T) {
+	repo := newFakePayments()
+	ph := newPaymentsHandler(repo)
+	payID := newAuthorized(repo)
+
+	code, first := serve(ph.Capture, operationRequest(payID, "capture", "c1", `{"amount":"4.00"}`))
+	if code != http.StatusAccepted || first["status"] != string(payment.StatusCapturing) {
+		t.Fatalf("capture: got %d %v", code, first)
+	}
+	// повтор не упирается в новый статус, а получает тот же ответ
+	code, second := serve(ph.Capture, operationRequest(payID, "capture", "c1", `{"amount":"4.00"}`))
+	if code != http.StatusAccepted || second["status"] != first["status"] {
+		t.Fatalf("replay: got %d %v", code, second)
+	}
+	if repo.transitions != 1 {
+		t.Fatalf("expected single transition, got %d", repo.transitions)
+	}
+
+	if code, _ := serve(ph.Capture, operationRequest(payID, "capture", "c1", `{"amount":"5.00"}`)); code != http.StatusUnprocessableEntity {
+		t.Fatalf("key reused with other amount: got %d", code)
+	}
+	// без ключа — прежнее поведение: статус уже не AUTHORIZED
+	if code, _ := serve(ph.Capture, operationRequest(payID, "capture", "", `{"amount":"4.00"}`)); code != http.StatusConflict {
+		t.Fatalf("capture without key: got %d", code)
+	}
+}
+
+func TestCaptureTakeoverAfterProviderCaptured(t *testing.T) {
+	repo := newFakePayments()
+	ph := newPaymentsHandler(repo)
+	payID := newAuthorized(repo)
+
+	// прежняя попытка перевела платёж и упала до Finalize, provider успел провести capture
+	bodyHash, err := canonicalHash(struct {
+		PaymentID string
+		Request   any
+	}{payID, paymentCaptureRequest{Amount: "4.00"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ph.IdemStore.Reserve(context.Background(), testMerchant, "capture:c1", bodyHash, "crashed",
+		-time.Second, idempotency.TTL); err != nil {
+		t.Fatal(err)
+	}
+	p := repo.byID[payID]
+	p.Status = payment.StatusSucceeded
+	repo.byID[payID] = p
+
+	code, body := serve(ph.Capture, operationRequest(payID, "capture", "c1", `{"amount":"4.00"}`))
+	if code != http.StatusAccepted || body["status"] != string(payment.StatusSucceeded) {
+		t.Fatalf("takeover: got %d %v", code, body)
+	}
+	if repo.transitions != 0 {
+		t.Fatalf("capture applied again: %d transitions", repo.transitions)
+	}
+
+	// новый ключ — обычная проверка статуса
+	if code, _ := serve(ph.Capture, operationRequest(payID, "capture", "c2", `{"amount":"4.00"}`)); code != http.StatusConflict {
+		t.Fatalf("capture of succeeded payment: got %d", code)
+	}
+}
+
+func TestVoidRejectionIsStored(t *testing.T) {
+	repo := newFakePayments()
+	ph := newPaymentsHandler(repo)
+	payID := newAuthorized(repo)
+	p := repo.byID[payID]
+	p.CaptureMethod = payment.CaptureAutomatic
+	repo.byID[payID] = p
+
+	if code, _ := serve(ph.Void, operationRequest(payID, "void", "v1", "")); code != http.StatusConflict {
+		t.Fatalf("void of automatic payment: got %d", code)
+	}
+	// отказ записан в ключ: повтор получает его, даже если платёж изменился
+	p.CaptureMethod = payment.CaptureManual
+	repo.byID[payID] = p
+	if code, _ := serve(ph.Void, operationRequest(payID, "void", "v1", "")); code != http.StatusConflict {
+		t.Fatalf("replayed rejection: got %d", code)
+	}
+	if repo.transitions != 0 {
+		t.Fatalf("rejected void applied %d times", repo.transitions)
+	}
+
+	// ключи capture и void не пересекаются
+	if code, _ := serve(ph.Capture, operationRequest(payID, "capture", "v1", "")); code != http.StatusAccepted {
+		t.Fatalf("capture with void's key: got %d", code)
+	}
+}
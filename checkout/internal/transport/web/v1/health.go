@@ -2,16 +2,25 @@ package v1
 
 import (
 	"net/http"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/outbox"
 )
 
+// OutboxStatus — outbox-воркер инстанса
+type OutboxStatus interface {
+	Status() outbox.WorkerStatus
+}
+
 type HealthHandler struct {
 	Version  string
 	DBPinger interface {
 		Ping() error
 	}
-	CachePinger interface {
+	// хранилище ключей идемпотентности из конфига: Redis, postgres или память
+	IdemPinger interface {
 		Ping() error
 	}
+	Outbox OutboxStatus
 }
 
 func (h *HealthHandler) Liveness(w http.ResponseWriter, r *http.Request) {
@@ -24,12 +33,19 @@ func (h *HealthHandler) Readiness(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusServiceUnavailable, err.Error())
 		return
 	}
-	err = h.CachePinger.Ping()
+	err = h.IdemPinger.Ping()
 	if err != nil {
 		writeError(w, http.StatusServiceUnavailable, err.Error())
 		return
 	}
-	writeJSON(w, http.StatusOK, "ready")
+	// реплика без лидерства outbox всё равно готова принимать запросы,
+	// статус только показывает, какой инстанс сейчас отправляет события
+	resp := readinessResponse{Status: "ready"}
+	if h.Outbox != nil {
+		st := h.Outbox.Status()
+		resp.Outbox = &OutboxWorkerResponse{WorkerID: st.WorkerID, Active: st.Active, LeaderElection: st.LeaderElection}
+	}
+	writeJSON(w, http.StatusOK, resp)
 }
 
 func (h *HealthHandler) VersionInfo(w http.ResponseWriter, r *http.Request) {
@@ -6,8 +6,13 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"log"
 	"net/http"
+	"strconv"
+	"time"
 
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/idempotency"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/merchant"
 	"github.com/google/uuid"
 )
 
@@ -25,6 +30,16 @@ func createPaymentID() string {
 	return "pay_" + uuid.NewString()
 }
 
+func createRefundID() string {
+	return "rf_" + uuid.NewString()
+}
+
+// мерчант, от имени которого пришёл запрос, его кладёт auth-middleware
+func authMerchant(r *http.Request) string {
+	id, _ := merchant.IDFromContext(r.Context())
+	return id
+}
+
 func canonicalHash(v any) (string, error) {
 	// сериализуем в JSON
 	data, err := json.Marshal(v)
@@ -37,6 +52,56 @@ func canonicalHash(v any) (string, error) {
 	return hex.EncodeToString(sum[:]), nil
 }
 
+// toMap — ответ в виде, в котором его хранит ключ идемпотентности
+func toMap(v any) (map[string]any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var m map[string]any
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 func isTimeout(err error) bool {
 	return errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled)
 }
+
+// ответ на ошибку инфраструктуры: timeout -> 504, остальное -> 500
+func writeInternalError(w http.ResponseWriter, scope string, err error) {
+	if isTimeout(err) {
+		writeError(w, http.StatusGatewayTimeout, "request timed out")
+		return
+	}
+	log.Printf("%s error: %v", scope, err)
+	writeError(w, http.StatusInternalServerError, "")
+}
+
+// токен владельца аренды ключа идемпотентности, свой у каждого запроса
+func idempotencyOwner() string {
+	return "req_" + uuid.NewString()
+}
+
+// failIdempotency фиксирует неудачную попытку как StateError. Контекст запроса
+// к этому моменту может быть уже отменён, поэтому пишем с отдельным таймаутом
+func failIdempotency(ctx context.Context, store idempotency.Store, merchantID, key, owner, bodyHash string,
+	retryable bool, code int, resp map[string]any) error {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 2*time.Second)
+	defer cancel()
+
+	err := store.Fail(ctx, merchantID, key, owner, bodyHash, retryable, code, resp, idempotency.TTL)
+	if err != nil && !errors.Is(err, idempotency.ErrLeaseLost) {
+		log.Printf("idempotency: fail record error: %v", err)
+	}
+	return err
+}
+
+// ответ повтору, пока владелец ключа ещё работает: подсказываем, когда истечёт аренда
+func writeInProgress(w http.ResponseWriter, rec *idempotency.Record, v any) {
+	if wait := time.Until(time.UnixMilli(rec.LeaseUntil)); wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+	}
+	writeJSON(w, http.StatusAccepted, v)
+}
@@ -0,0 +1,152 @@
+package v1
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+)
+
+// курсор непрозрачен для клиента: base64url от JSON с позицией последней записи
+type listCursor struct {
+	CreatedAt string `json:"t"`
+	ID        string `json:"id"`
+}
+
+// List ищет платежи по фильтрам с keyset-пагинацией
+func (ph *PaymentsHandler) List(w http.ResponseWriter, r *http.Request) {
+	filter, errs := parseListFilter(r.URL.Query())
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": errs})
+		return
+	}
+
+	// выдача всегда ограничена мерчантом из API-ключа
+	merchantID := authMerchant(r)
+	if filter.MerchantID != "" && filter.MerchantID != merchantID {
+		writeError(w, http.StatusForbidden, "merchant_id does not match api key")
+		return
+	}
+	filter.MerchantID = merchantID
+
+	limit := filter.Limit
+	// берём на одну запись больше, чтобы понять, есть ли следующая страница
+	filter.Limit++
+
+	ctx, cancel := context.WithTimeout(r.Context(), ph.Cfg.PaymentTimeout)
+	defer cancel()
+
+	pays, err := ph.Repo.ListPayments(ctx, filter)
+	if err != nil {
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	resp := PaymentListResponse{Data: make([]PaymentResponse, 0, len(pays))}
+	if len(pays) > limit {
+		pays = pays[:limit]
+		last := pays[len(pays)-1]
+		next := encodeCursor(payment.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		resp.NextCursor = &next
+	}
+	for _, p := range pays {
+		resp.Data = append(resp.Data, ToResponse(p))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+func parseListFilter(q url.Values) (payment.ListFilter, []string) {
+	var (
+		f    = payment.ListFilter{Limit: payment.DefaultListLimit}
+		errs []string
+	)
+
+	if v := q.Get("merchant_id"); v != "" {
+		if !validateString(v) {
+			errs = append(errs, "invalid merchant_id")
+		}
+		f.MerchantID = v
+	}
+	if v := q.Get("order_id"); v != "" {
+		if !validateString(v) {
+			errs = append(errs, "invalid order_id")
+		}
+		f.OrderID = v
+	}
+	if v := q.Get("status"); v != "" {
+		if !validateStatus(v) {
+			errs = append(errs, "invalid status")
+		}
+		f.Status = payment.PaymentStatus(v)
+	}
+	if v := q.Get("currency"); v != "" {
+		if !validateCurrency(v) {
+			errs = append(errs, "invalid currency")
+		}
+		f.Currency = v
+	}
+	if v := q.Get("created_from"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			errs = append(errs, "invalid created_from")
+		}
+		f.CreatedFrom = &t
+	}
+	if v := q.Get("created_to"); v != "" {
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			errs = append(errs, "invalid created_to")
+		}
+		f.CreatedTo = &t
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > payment.MaxListLimit {
+			errs = append(errs, "invalid limit")
+		}
+		f.Limit = n
+	}
+	if v := q.Get("cursor"); v != "" {
+		c, err := decodeCursor(v)
+		if err != nil {
+			errs = append(errs, "invalid cursor")
+		}
+		f.After = &c
+	}
+
+	return f, errs
+}
+
+func encodeCursor(c payment.Cursor) string {
+	data, _ := json.Marshal(listCursor{CreatedAt: toRFC3339Nano(c.CreatedAt), ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(s string) (payment.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return payment.Cursor{}, err
+	}
+
+	var lc listCursor
+	if err := json.Unmarshal(data, &lc); err != nil {
+		return payment.Cursor{}, err
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, lc.CreatedAt)
+	if err != nil {
+		return payment.Cursor{}, err
+	}
+	if !validatePayID(lc.ID) {
+		return payment.Cursor{}, errors.New("wrong id in cursor")
+	}
+
+	return payment.Cursor{CreatedAt: t, ID: lc.ID}, nil
+}
@@ -3,20 +3,158 @@ package v1
 import (
 	"time"
 
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/merchant"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/outbox"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/refund"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/webhook"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/currency"
 )
 
 // domain -> http
 func ToResponse(p payment.Payment) PaymentResponse {
-	return PaymentResponse{
+	resp := PaymentResponse{
 		ID: p.ID, MerchantID: p.MerchantID,
-		OrderID: p.OrderID, Amount: p.Amount.StringFixed(2),
+		OrderID: p.OrderID, Amount: currency.Format(p.Amount, p.Currency),
 		Currency: p.Currency, Status: string(p.Status),
 		PSPRef: p.PSPRef, CreatedAt: toRFC3339(p.CreatedAt),
-		UpdatedAt: toRFC3339(p.UpdatedAt),
+		UpdatedAt: toRFC3339(p.UpdatedAt), CaptureMethod: string(p.CaptureMethod),
 	}
+	if p.AmountCaptured != nil {
+		captured := currency.Format(*p.AmountCaptured, p.Currency)
+		resp.AmountCaptured = &captured
+	}
+	if p.AuthorizationExpiresAt != nil {
+		expiresAt := toRFC3339(*p.AuthorizationExpiresAt)
+		resp.AuthorizationExpiresAt = &expiresAt
+	}
+	resp.NextAction = toNextActionResponse(p.NextAction)
+	return resp
+}
+
+// ToCreateResponse — ответ на создание по уже существующему платежу
+func ToCreateResponse(p payment.Payment) PaymentCreateResponse {
+	return PaymentCreateResponse{PaymentID: p.ID, Status: string(p.Status), NextAction: toNextActionResponse(p.NextAction)}
+}
+
+func toNextActionResponse(a *payment.NextAction) *NextActionResponse {
+	if a == nil {
+		return nil
+	}
+	return &NextActionResponse{Type: a.Type, RedirectURL: a.RedirectURL, ChallengeID: a.ChallengeID}
+}
+
+// domain -> http
+func ToRefundResponse(r refund.Refund) RefundResponse {
+	return RefundResponse{
+		ID: r.ID, PaymentID: r.PaymentID,
+		MerchantID: r.MerchantID, Amount: currency.Format(r.Amount, r.Currency),
+		Currency: r.Currency, Reason: r.Reason,
+		Status: string(r.Status), PSPRef: r.PSPRef,
+		FailureReason: r.FailureReason, CreatedAt: toRFC3339(r.CreatedAt),
+		UpdatedAt: toRFC3339(r.UpdatedAt),
+	}
+}
+
+// domain -> http
+func ToEventsResponse(paymentID string, history []payment.StatusChange) PaymentEventsResponse {
+	resp := PaymentEventsResponse{
+		PaymentID: paymentID,
+		Events:    make([]PaymentEventResponse, 0, len(history)),
+	}
+	for _, c := range history {
+		var from *string
+		if c.From != nil {
+			s := string(*c.From)
+			from = &s
+		}
+		resp.Events = append(resp.Events, PaymentEventResponse{
+			FromStatus: from, ToStatus: string(c.To),
+			Source: c.Source, EventID: c.EventID,
+			ErrorDetails: c.ErrorDetails, OccurredAt: toRFC3339Nano(c.OccurredAt),
+		})
+	}
+	return resp
 }
 
 func toRFC3339(t time.Time) string {
 	return t.Truncate(time.Second).UTC().Format(time.RFC3339)
 }
+
+func toRFC3339Nano(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+func ToMerchantResponse(m merchant.Merchant) MerchantResponse {
+	currencies := m.Currencies
+	if currencies == nil {
+		currencies = []string{}
+	}
+	return MerchantResponse{MerchantID: m.ID, Name: m.Name, Currencies: currencies}
+}
+
+func ToAPIKeyResponse(k merchant.APIKey) APIKeyResponse {
+	resp := APIKeyResponse{KeyID: k.ID, Prefix: k.Prefix, ValidFrom: toRFC3339(k.ValidFrom)}
+	if k.ValidUntil != nil {
+		s := toRFC3339(*k.ValidUntil)
+		resp.ValidUntil = &s
+	}
+	if k.RevokedAt != nil {
+		s := toRFC3339(*k.RevokedAt)
+		resp.RevokedAt = &s
+	}
+	return resp
+}
+
+func ToAPIKeyCreateResponse(k merchant.APIKey, secret string) APIKeyCreateResponse {
+	return APIKeyCreateResponse{APIKeyResponse: ToAPIKeyResponse(k), APIKey: secret}
+}
+
+func ToWebhookEndpointResponse(e webhook.Endpoint) WebhookEndpointResponse {
+	return WebhookEndpointResponse{EndpointID: e.ID, URL: e.URL, CreatedAt: toRFC3339(e.CreatedAt)}
+}
+
+func ToWebhookDeliveryResponse(d webhook.Delivery, attempts []webhook.Attempt) WebhookDeliveryResponse {
+	resp := WebhookDeliveryResponse{
+		DeliveryID: d.ID, EndpointID: d.EndpointID,
+		EventID: d.EventID, EventType: d.EventType,
+		Status: string(d.Status), Attempt: d.Attempt,
+		NextAttemptAt: toRFC3339(d.NextAttemptAt), LastStatusCode: d.LastStatusCode,
+		LastError: d.LastError, CreatedAt: toRFC3339(d.CreatedAt),
+	}
+	if d.DeliveredAt != nil {
+		deliveredAt := toRFC3339(*d.DeliveredAt)
+		resp.DeliveredAt = &deliveredAt
+	}
+	for _, a := range attempts {
+		resp.Attempts = append(resp.Attempts, WebhookAttemptResponse{
+			Attempt: a.Attempt, StatusCode: a.StatusCode,
+			Error: a.Error, DurationMs: a.Duration.Milliseconds(),
+			CreatedAt: toRFC3339Nano(a.CreatedAt),
+		})
+	}
+	return resp
+}
+
+// domain -> http, payload и headers только для карточки события
+func ToOutboxEventResponse(e outbox.Event, full bool) OutboxEventResponse {
+	resp := OutboxEventResponse{
+		ID: e.ID, AggregateType: e.AggregateType,
+		AggregateID: e.AggregateID, EventType: e.EventType,
+		EventVersion: e.EventVersion, Key: e.Key,
+		Status: string(e.Status), Attempt: e.Attempt,
+		NextAttemptAt: toRFC3339(e.NextAttemptAt), LastError: e.LastError,
+		CreatedAt: toRFC3339Nano(e.CreatedAt), UpdatedAt: toRFC3339Nano(e.UpdatedAt),
+	}
+	if e.DecodeErr != nil {
+		resp.DecodeError = e.DecodeErr.Error()
+	}
+	if full {
+		resp.Payload = e.Payload
+		resp.Headers = e.Headers
+		if e.DecodeErr != nil {
+			resp.RawHeaders = string(e.RawHeaders)
+		}
+	}
+	return resp
+}
@@ -0,0 +1,202 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/merchant"
+	"github.com/google/uuid"
+)
+
+// MerchantsHandler — служебные ручки: заведение мерчантов и выпуск/ротация ключей
+type MerchantsHandler struct {
+	Repo merchant.Repository
+	Cfg  config.HTTP
+	Auth config.Auth
+}
+
+// Create заводит мерчанта и сразу выпускает ему первый ключ
+func (mh *MerchantsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	var req merchantCreateRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	defer r.Body.Close()
+
+	var errs []string
+	if !validateString(req.MerchantID) {
+		errs = append(errs, "invalid merchant_id")
+	}
+	if !validateCurrencies(req.Currencies) {
+		errs = append(errs, "invalid currencies")
+	}
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": errs})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), mh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	key, secret, err := newKey(req.MerchantID)
+	if err != nil {
+		writeInternalError(w, "merchant", err)
+		return
+	}
+
+	m, key, err := mh.Repo.InsertMerchant(ctx, merchant.Merchant{ID: req.MerchantID, Name: req.Name, Currencies: req.Currencies}, key)
+	if err != nil {
+		if errors.Is(err, merchant.ErrExists) {
+			writeError(w, http.StatusConflict, "merchant already exists")
+			return
+		}
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, MerchantCreateResponse{
+		MerchantResponse: ToMerchantResponse(m),
+		Key:              ToAPIKeyCreateResponse(key, secret),
+	})
+}
+
+// SetCurrencies заменяет список разрешённых валют, пустой список снимает ограничение
+func (mh *MerchantsHandler) SetCurrencies(w http.ResponseWriter, r *http.Request) {
+	var req merchantCurrenciesRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	defer r.Body.Close()
+
+	if !validateCurrencies(req.Currencies) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": []string{"invalid currencies"}})
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), mh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	m, err := mh.Repo.SetCurrencies(ctx, r.PathValue("id"), req.Currencies)
+	if err != nil {
+		if errors.Is(err, merchant.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ToMerchantResponse(m))
+}
+
+// RotateKey выпускает новый ключ; действующие ключи работают ещё overlap
+func (mh *MerchantsHandler) RotateKey(w http.ResponseWriter, r *http.Request) {
+	merchantID := r.PathValue("id")
+
+	var req keyRotateRequest
+
+	// тело необязательно: пустое — overlap из конфига
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	defer r.Body.Close()
+
+	overlap := mh.Auth.RotationOverlap
+	if req.Overlap != "" {
+		d, err := time.ParseDuration(req.Overlap)
+		if err != nil || d < 0 {
+			writeJSON(w, http.StatusBadRequest, map[string]any{"errors": []string{"invalid overlap"}})
+			return
+		}
+		overlap = d
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), mh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	key, secret, err := mh.issueKey(ctx, merchantID, overlap)
+	if err != nil {
+		if errors.Is(err, merchant.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, ToAPIKeyCreateResponse(key, secret))
+}
+
+func (mh *MerchantsHandler) ListKeys(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), mh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	keys, err := mh.Repo.ListAPIKeys(ctx, r.PathValue("id"))
+	if err != nil {
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	resp := make([]APIKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		resp = append(resp, ToAPIKeyResponse(k))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"keys": resp})
+}
+
+// RevokeKey отзывает ключ немедленно, без периода перекрытия
+func (mh *MerchantsHandler) RevokeKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), mh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	if err := mh.Repo.RevokeAPIKey(ctx, r.PathValue("id"), r.PathValue("key_id")); err != nil {
+		if errors.Is(err, merchant.ErrKeyNotFound) {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (mh *MerchantsHandler) issueKey(ctx context.Context, merchantID string, overlap time.Duration) (merchant.APIKey, string, error) {
+	key, secret, err := newKey(merchantID)
+	if err != nil {
+		return merchant.APIKey{}, "", err
+	}
+
+	key, err = mh.Repo.RotateAPIKey(ctx, key, overlap)
+
+	return key, secret, err
+}
+
+// newKey генерирует ключ; в БД попадает только хэш, secret отдаётся мерчанту
+func newKey(merchantID string) (merchant.APIKey, string, error) {
+	secret, err := merchant.NewSecret()
+	if err != nil {
+		return merchant.APIKey{}, "", err
+	}
+
+	return merchant.APIKey{
+		ID:         "key_" + uuid.NewString(),
+		MerchantID: merchantID,
+		Prefix:     merchant.DisplayPrefix(secret),
+		Hash:       merchant.HashSecret(secret),
+	}, secret, nil
+}
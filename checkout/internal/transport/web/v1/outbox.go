@@ -0,0 +1,246 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/outbox"
+)
+
+// OutboxHandler — служебные ручки для разбора outbox без psql
+type OutboxHandler struct {
+	Repo    outbox.Repository
+	Cfg     config.HTTP
+	Archive config.Archive
+}
+
+// List ищет события по статусу, агрегату и возрасту, от новых к старым
+func (oh *OutboxHandler) List(w http.ResponseWriter, r *http.Request) {
+	filter, errs := parseOutboxFilter(r.URL.Query())
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": errs})
+		return
+	}
+
+	limit := filter.Limit
+	// берём на одну запись больше, чтобы понять, есть ли следующая страница
+	filter.Limit++
+
+	ctx, cancel := context.WithTimeout(r.Context(), oh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	evts, err := oh.Repo.ListEvents(ctx, filter)
+	if err != nil {
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	resp := OutboxEventListResponse{Data: make([]OutboxEventResponse, 0, len(evts))}
+	if len(evts) > limit {
+		evts = evts[:limit]
+		next := strconv.FormatInt(evts[len(evts)-1].ID, 10)
+		resp.NextCursor = &next
+	}
+	for _, e := range evts {
+		resp.Data = append(resp.Data, ToOutboxEventResponse(e, false))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// Get отдаёт событие целиком, с payload и headers
+func (oh *OutboxHandler) Get(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseOutboxID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), oh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	evt, err := oh.Repo.GetEvent(ctx, id)
+	if err != nil {
+		if errors.Is(err, outbox.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ToOutboxEventResponse(evt, true))
+}
+
+// Retry возвращает FAILED/DEAD событие в очередь с новым бюджетом попыток
+func (oh *OutboxHandler) Retry(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseOutboxID(w, r)
+	if !ok {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), oh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	evt, err := oh.Repo.RetryEvent(ctx, id)
+	if err != nil {
+		switch {
+		case errors.Is(err, outbox.ErrNotFound):
+			writeError(w, http.StatusNotFound, "not found")
+		case errors.Is(err, outbox.ErrNotRetryable):
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeInternalError(w, "db", err)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ToOutboxEventResponse(evt, false))
+}
+
+// RetryAll возвращает в очередь все события статуса FAILED или DEAD
+func (oh *OutboxHandler) RetryAll(w http.ResponseWriter, r *http.Request) {
+	var req outboxRetryRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	defer r.Body.Close()
+
+	status := outbox.Status(req.Status)
+	if status != outbox.StatusFailed && status != outbox.StatusDead {
+		writeError(w, http.StatusBadRequest, "status must be FAILED or DEAD")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), oh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	n, err := oh.Repo.RetryEvents(ctx, status)
+	if err != nil {
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, OutboxBatchResponse{Processed: n})
+}
+
+// Purge разово архивирует (или удаляет) SENT-события старше older_than_days.
+// Обычно это делает фоновый архиватор, ручка — для срочной чистки
+func (oh *OutboxHandler) Purge(w http.ResponseWriter, r *http.Request) {
+	var req outboxPurgeRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	defer r.Body.Close()
+
+	if req.OlderThanDays < 1 {
+		writeError(w, http.StatusBadRequest, "older_than_days must be positive")
+		return
+	}
+	archive := true
+	if req.Archive != nil {
+		archive = *req.Archive
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), oh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	olderThan := time.Duration(req.OlderThanDays) * 24 * time.Hour
+	batch := max(oh.Archive.BatchSize, 1)
+
+	// пачками, как архиватор; по таймауту отдаём сколько успели
+	var total int64
+	for {
+		n, err := oh.Repo.ArchiveSent(ctx, olderThan, batch, archive)
+		if err != nil {
+			if isTimeout(err) && total > 0 {
+				break
+			}
+			writeInternalError(w, "db", err)
+			return
+		}
+		total += n
+		if n < int64(batch) {
+			break
+		}
+	}
+
+	writeJSON(w, http.StatusOK, OutboxBatchResponse{Processed: total})
+}
+
+func parseOutboxID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil || id < 1 {
+		writeError(w, http.StatusBadRequest, "wrong id")
+		return 0, false
+	}
+	return id, true
+}
+
+func parseOutboxFilter(q url.Values) (outbox.ListFilter, []string) {
+	var (
+		f    = outbox.ListFilter{Limit: outbox.DefaultListLimit}
+		errs []string
+	)
+
+	if v := q.Get("status"); v != "" {
+		if !validateOutboxStatus(v) {
+			errs = append(errs, "invalid status")
+		}
+		f.Status = outbox.Status(v)
+	}
+	if v := q.Get("aggregate_type"); v != "" {
+		if !validateString(v) {
+			errs = append(errs, "invalid aggregate_type")
+		}
+		f.AggregateType = v
+	}
+	if v := q.Get("aggregate_id"); v != "" {
+		if !validateString(v) {
+			errs = append(errs, "invalid aggregate_id")
+		}
+		f.AggregateID = v
+	}
+	// возраст в формате Go duration: 30m, 24h
+	if v := q.Get("older_than"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			errs = append(errs, "invalid older_than")
+		}
+		f.OlderThan = d
+	}
+	if v := q.Get("newer_than"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			errs = append(errs, "invalid newer_than")
+		}
+		f.NewerThan = d
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > outbox.MaxListLimit {
+			errs = append(errs, "invalid limit")
+		}
+		f.Limit = n
+	}
+	if v := q.Get("cursor"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil || id < 1 {
+			errs = append(errs, "invalid cursor")
+		}
+		f.BeforeID = id
+	}
+
+	return f, errs
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/events"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/idempotency"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/merchant"
 	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -21,9 +22,12 @@ import (
 
 type PaymentsHandler struct {
 	Repo      payment.Repository
+	Tx        idempotency.TxRunner
+	Merchants merchant.Repository
 	IdemStore idempotency.Store
 	Publisher events.Publisher
 	Cfg       config.HTTP
+	IdemLease time.Duration
 }
 
 func (ph *PaymentsHandler) Create(w http.ResponseWriter, r *http.Request) {
@@ -50,115 +54,59 @@ func (ph *PaymentsHandler) Create(w http.ResponseWriter, r *http.Request) {
 
 	defer r.Body.Close()
 
+	// мерчант определяется API-ключом, merchant_id в теле только сверяется с ним
+	merchantID := authMerchant(r)
+	if req.MerchantID == "" {
+		req.MerchantID = merchantID
+	}
+	if req.MerchantID != merchantID {
+		writeError(w, http.StatusForbidden, "merchant_id does not match api key")
+		return
+	}
+
 	if errs := validatePayment(req); len(errs) > 0 {
 		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": errs})
 		return
 	}
 
-	bodyHash, err := canonicalHash(req)
+	m, err := ph.Merchants.GetMerchant(ctx, merchantID)
 	if err != nil {
-		log.Printf("idempotency error: %v", err)
-		writeError(w, http.StatusInternalServerError, "")
+		// ключ есть, а мерчанта нет — удалён в обход API
+		if errors.Is(err, merchant.ErrNotFound) {
+			writeError(w, http.StatusForbidden, "merchant not found")
+			return
+		}
+		writeInternalError(w, "db", err)
+		return
+	}
+	if !m.AcceptsCurrency(req.Currency) {
+		writeError(w, http.StatusUnprocessableEntity, "currency is not enabled for merchant")
 		return
 	}
 
-	// 1) пробуем создать «резервацию» (SETNX)
-	created, err := ph.IdemStore.Reserve(ctx, req.MerchantID, idemKey, bodyHash, idempotency.TTL)
+	bodyHash, err := canonicalHash(req)
 	if err != nil {
-		// Проверка на timeout / отмену контекста
-		if isTimeout(err) {
-			writeError(w, http.StatusGatewayTimeout, "request timed out")
-			return
-		}
-		// Прочие ошибки
 		log.Printf("idempotency error: %v", err)
 		writeError(w, http.StatusInternalServerError, "")
 		return
 	}
 
-	if !created {
-		// ключ уже был
-		val, err := ph.IdemStore.Load(ctx, req.MerchantID, idemKey)
-		if err != nil {
-			// Проверка на timeout / отмену контекста
-			if isTimeout(err) {
-				writeError(w, http.StatusGatewayTimeout, "request timed out")
-				return
-			}
-			// Прочие ошибки
-			log.Printf("idempotency error: %v", err)
-			writeError(w, http.StatusInternalServerError, "")
-			return
-		}
-		if val.BodyHash != bodyHash {
-			writeError(w, http.StatusUnprocessableEntity, "idempotency key reused with different payload")
-			return
-		}
-
-		switch val.State {
-		case idempotency.StateInProgress:
-			existPayment, err := ph.Repo.GetPaymentByUniqKeys(ctx, req.MerchantID, req.OrderID)
-			var resp PaymentCreateResponse
-			if err != nil {
-				// Проверка на timeout / отмену контекста
-				if isTimeout(err) {
-					writeError(w, http.StatusGatewayTimeout, "request timed out")
-					return
-				}
-				// Прочие ошибки
-				log.Println(err)
-				if errors.Is(err, pgx.ErrNoRows) {
-					resp.Status = string(payment.StatusProcessing)
-					writeJSON(w, http.StatusAccepted, resp)
-					return
-				}
-				log.Printf("db error: %v", err)
-				writeError(w, http.StatusInternalServerError, "")
-				return
-			}
-			resp.PaymentID = existPayment.ID
-			resp.Status = string(existPayment.Status)
-			code := http.StatusCreated
-			err = ph.IdemStore.Finalize(ctx, req.MerchantID, idemKey, bodyHash, code, existPayment.ID,
-				map[string]any{"payment_id": resp.PaymentID, "status": resp.Status}, idempotency.TTL)
-			if err != nil {
-				// Проверка на timeout / отмену контекста
-				if isTimeout(err) {
-					writeError(w, http.StatusGatewayTimeout, "request timed out")
-					return
-				}
-				// Прочие ошибки
-				writeError(w, http.StatusInternalServerError, "")
-				return
-			}
-
-			log.Printf("idempotency: value finalized")
-
-			writeJSON(w, code, resp)
-			return
-		case idempotency.StateDone:
-			writeJSON(w, val.HTTPCode, val.Response)
-			return
-		case idempotency.StateError:
-			writeError(w, http.StatusInternalServerError, "previous attempt failed")
-			return
-		}
-
-	}
-
-	log.Printf("idempotency: value reserved")
-
 	payID := createPaymentID()
 
 	amount, _ := decimal.NewFromString(req.Amount)
+	captureMethod := payment.CaptureMethod(req.CaptureMethod)
+	if captureMethod == "" {
+		captureMethod = payment.CaptureAutomatic
+	}
 	pay := payment.Payment{
-		ID:          payID,
-		MerchantID:  req.MerchantID,
-		OrderID:     req.OrderID,
-		Amount:      amount,
-		Currency:    req.Currency,
-		MethodToken: req.MethodToken,
-		Status:      payment.StatusPending,
+		ID:            payID,
+		MerchantID:    req.MerchantID,
+		OrderID:       req.OrderID,
+		Amount:        amount,
+		Currency:      req.Currency,
+		MethodToken:   req.MethodToken,
+		Status:        payment.StatusPending,
+		CaptureMethod: captureMethod,
 	}
 
 	event, err := events.NewPaymentCreatedEvent(pay)
@@ -174,51 +122,162 @@ func (ph *PaymentsHandler) Create(w http.ResponseWriter, r *http.Request) {
 	event.Headers["x-idempotency-key"] = idemKey
 	event.Headers["x-trace-id"] = uuid.NewString()
 
-	// db logic
-	if err := ph.Repo.InsertPayment(ctx, pay, event); err != nil {
-		// 1. Проверка на timeout / отмену контекста
-		if isTimeout(err) {
-			writeError(w, http.StatusGatewayTimeout, "request timed out")
+	resp := PaymentCreateResponse{Status: string(pay.Status), PaymentID: payID}
+	code := http.StatusCreated
+	owner := idempotencyOwner()
+
+	// с postgres-хранилищем резерв ключа, платёж и финализация коммитятся вместе:
+	// сбой посередине не оставляет ключ навсегда IN_PROGRESS
+	var created bool
+	err = ph.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		// 1) пробуем занять ключ (или перехватить брошенный)
+		var err error
+		created, err = ph.IdemStore.Reserve(ctx, req.MerchantID, idemKey, bodyHash, owner, ph.IdemLease, idempotency.TTL)
+		if err != nil || !created {
+			return err
+		}
+
+		log.Printf("idempotency: value reserved")
+
+		// 2) платёж и событие в outbox
+		if err := ph.Repo.InsertPayment(ctx, pay, event); err != nil {
+			return err
+		}
+
+		log.Println("db: row added")
+
+		// 3) записать финализацию и обновить TTL
+		return ph.IdemStore.Finalize(ctx, req.MerchantID, idemKey, owner, bodyHash, code, payID,
+			map[string]any{"payment_id": resp.PaymentID, "status": resp.Status}, idempotency.TTL)
+	})
+	if err != nil {
+		// 1. Аренду перехватили, пока мы работали: итог запишет новый владелец
+		if errors.Is(err, idempotency.ErrLeaseLost) {
+			ph.replay(ctx, w, req, idemKey, bodyHash)
 			return
 		}
 
 		// 2. Проверка на уникальность
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgErr.Code == "23505" {
-			writeError(w, http.StatusConflict, "payment already exists")
+			ph.conflict(ctx, w, req, pay, idemKey, owner, bodyHash)
 			return
 		}
 
-		// 3. Всё остальное → 500
-		log.Printf("db error: %v", err)
+		// 3. timeout и прочие сбои — восстановимая ошибка, повтор перехватит ключ сразу
+		failIdempotency(ctx, ph.IdemStore, req.MerchantID, idemKey, owner, bodyHash, true, 0, nil)
+		if isTimeout(err) {
+			writeError(w, http.StatusGatewayTimeout, "request timed out")
+			return
+		}
+
+		log.Printf("create payment error: %v", err)
 		writeError(w, http.StatusInternalServerError, "")
 		return
 	}
 
-	log.Println("db: row added")
+	if !created {
+		ph.replay(ctx, w, req, idemKey, bodyHash)
+		return
+	}
 
-	resp := PaymentCreateResponse{Status: string(pay.Status), PaymentID: payID}
-	code := http.StatusCreated
-	// 3) записать финализацию в Redis и обновить TTL
-	err = ph.IdemStore.Finalize(ctx, req.MerchantID, idemKey, bodyHash, code, payID,
-		map[string]any{"payment_id": resp.PaymentID, "status": resp.Status}, idempotency.TTL)
+	log.Printf("idempotency: value finalized")
+
+	writeJSON(w, code, resp)
+}
+
+// conflict разбирает нарушение уникальности (merchant_id, order_id). Если платёж
+// совпадает с запросом, это наша же попытка, упавшая до Finalize: ключ перехвачен
+// после аренды, и платёж отдаётся как созданный. Иначе заказ уже оплачивается другим запросом
+func (ph *PaymentsHandler) conflict(ctx context.Context, w http.ResponseWriter, req paymentCreateRequest,
+	pay payment.Payment, idemKey, owner, bodyHash string) {
+	existPayment, err := ph.Repo.GetPaymentByUniqKeys(ctx, req.MerchantID, req.OrderID)
 	if err != nil {
-		// Проверка на timeout / отмену контекста
-		if isTimeout(err) {
-			writeError(w, http.StatusGatewayTimeout, "request timed out")
+		failIdempotency(ctx, ph.IdemStore, req.MerchantID, idemKey, owner, bodyHash, true, 0, nil)
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	if !samePayment(existPayment, pay) {
+		resp := map[string]any{"error": "payment already exists"}
+		if err := failIdempotency(ctx, ph.IdemStore, req.MerchantID, idemKey, owner, bodyHash, false,
+			http.StatusConflict, resp); errors.Is(err, idempotency.ErrLeaseLost) {
+			ph.replay(ctx, w, req, idemKey, bodyHash)
 			return
 		}
-		// Прочие ошибки
-		log.Printf("idempotency error: %v", err)
-		writeError(w, http.StatusInternalServerError, "")
+		writeJSON(w, http.StatusConflict, resp)
 		return
 	}
 
-	log.Printf("idempotency: value finalized")
+	resp := ToCreateResponse(existPayment)
+	code := http.StatusCreated
+	err = ph.IdemStore.Finalize(ctx, req.MerchantID, idemKey, owner, bodyHash, code, existPayment.ID,
+		map[string]any{"payment_id": resp.PaymentID, "status": resp.Status}, idempotency.TTL)
+	if errors.Is(err, idempotency.ErrLeaseLost) {
+		ph.replay(ctx, w, req, idemKey, bodyHash)
+		return
+	}
+	if err != nil {
+		writeInternalError(w, "idempotency", err)
+		return
+	}
+
+	log.Printf("idempotency: value recovered")
 
 	writeJSON(w, code, resp)
 }
 
+// samePayment — существующий платёж создан тем же запросом
+func samePayment(exist, pay payment.Payment) bool {
+	return exist.Amount.Equal(pay.Amount) && exist.Currency == pay.Currency &&
+		exist.MethodToken == pay.MethodToken && exist.CaptureMethod == pay.CaptureMethod
+}
+
+// replay отвечает на повтор запроса с уже занятым ключом
+func (ph *PaymentsHandler) replay(ctx context.Context, w http.ResponseWriter, req paymentCreateRequest, idemKey, bodyHash string) {
+	val, err := ph.IdemStore.Load(ctx, req.MerchantID, idemKey)
+	if err != nil {
+		writeInternalError(w, "idempotency", err)
+		return
+	}
+	if val == nil {
+		// ключ истёк между Reserve и Load
+		writeError(w, http.StatusConflict, "idempotency key expired, retry the request")
+		return
+	}
+	if val.BodyHash != bodyHash {
+		writeError(w, http.StatusUnprocessableEntity, "idempotency key reused with different payload")
+		return
+	}
+
+	switch val.State {
+	case idempotency.StateInProgress:
+		// владелец ещё работает: ключ не трогаем, итог запишет он
+		existPayment, err := ph.Repo.GetPaymentByUniqKeys(ctx, req.MerchantID, req.OrderID)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				writeInProgress(w, val, PaymentCreateResponse{Status: string(payment.StatusProcessing)})
+				return
+			}
+			writeInternalError(w, "db", err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, ToCreateResponse(existPayment))
+		return
+	case idempotency.StateDone:
+		writeJSON(w, val.HTTPCode, val.Response)
+		return
+	case idempotency.StateError:
+		if !val.Retryable {
+			writeJSON(w, val.HTTPCode, val.Response)
+			return
+		}
+		// восстановимую ошибку только что перехватил параллельный повтор
+		writeError(w, http.StatusConflict, "previous attempt failed, retry the request")
+		return
+	}
+}
+
 func (ph *PaymentsHandler) Get(w http.ResponseWriter, r *http.Request) {
 	parts := strings.Split(r.URL.Path, "/")
 	if len(parts) < 4 {
@@ -237,6 +296,9 @@ func (ph *PaymentsHandler) Get(w http.ResponseWriter, r *http.Request) {
 	defer cancel()
 
 	payment, err := ph.Repo.GetPaymentByID(ctx, paymentID)
+	if err == nil && payment.MerchantID != authMerchant(r) {
+		err = pgx.ErrNoRows // чужой платёж не отличаем от несуществующего
+	}
 	if err != nil {
 		// Проверка на timeout / отмену контекста
 		if isTimeout(err) {
@@ -256,3 +318,48 @@ func (ph *PaymentsHandler) Get(w http.ResponseWriter, r *http.Request) {
 
 	writeJSON(w, http.StatusOK, resp)
 }
+
+// Events отдаёт историю смены статусов платежа
+func (ph *PaymentsHandler) Events(w http.ResponseWriter, r *http.Request) {
+	paymentID := r.PathValue("id")
+
+	if !validatePayID(paymentID) {
+		writeError(w, http.StatusBadRequest, "wrong id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), ph.Cfg.PaymentTimeout)
+	defer cancel()
+
+	pay, err := ph.Repo.GetPaymentByID(ctx, paymentID)
+	if err == nil && pay.MerchantID != authMerchant(r) {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		// Проверка на timeout / отмену контекста
+		if isTimeout(err) {
+			writeError(w, http.StatusGatewayTimeout, "request timed out")
+			return
+		}
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		log.Println(err)
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	history, err := ph.Repo.GetStatusHistory(ctx, paymentID)
+	if err != nil {
+		if isTimeout(err) {
+			writeError(w, http.StatusGatewayTimeout, "request timed out")
+			return
+		}
+		log.Println(err)
+		writeError(w, http.StatusInternalServerError, "")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ToEventsResponse(paymentID, history))
+}
@@ -0,0 +1,274 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/events"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/idempotency"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/refund"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/shopspring/decimal"
+)
+
+// ключи идемпотентности возвратов не пересекаются с ключами создания платежей
+const refundIdemPrefix = "refund:"
+
+type RefundsHandler struct {
+	Repo      refund.Repository
+	Payments  payment.Repository
+	IdemStore idempotency.Store
+	Tx        idempotency.TxRunner
+	Cfg       config.HTTP
+	IdemLease time.Duration
+}
+
+func (rh *RefundsHandler) Create(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10000*time.Millisecond)
+	defer cancel()
+
+	paymentID := r.PathValue("id")
+	if !validatePayID(paymentID) {
+		writeError(w, http.StatusBadRequest, "wrong id")
+		return
+	}
+
+	idemKey := r.Header.Get("Idempotency-Key")
+	if idemKey == "" {
+		writeError(w, http.StatusBadRequest, "idempotency key required")
+		return
+	}
+
+	if err := validateIdempotencyKey(idemKey); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var req refundCreateRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	defer r.Body.Close()
+
+	if errs := validateRefund(req); len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": errs})
+		return
+	}
+
+	pay, err := rh.Payments.GetPaymentByID(ctx, paymentID)
+	if err == nil && pay.MerchantID != authMerchant(r) {
+		err = pgx.ErrNoRows
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	if req.Amount != "" && !validateAmount(req.Amount, amountCurrency(pay.Currency)) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": []string{"invalid amount"}})
+		return
+	}
+
+	// хэш включает платёж: тот же ключ для другого платежа — конфликт
+	bodyHash, err := canonicalHash(struct {
+		PaymentID string
+		Request   refundCreateRequest
+	}{paymentID, req})
+	if err != nil {
+		writeInternalError(w, "idempotency", err)
+		return
+	}
+
+	key := refundIdemPrefix + idemKey
+	owner := idempotencyOwner()
+
+	var (
+		created bool
+		ref     refund.Refund  // созданный или найденный возврат
+		code    int            // бизнес-отказ, записанный в ключ
+		resp    map[string]any // его тело
+	)
+
+	// с postgres-хранилищем резерв ключа, возврат и финализация коммитятся вместе,
+	// как при создании платежа
+	err = rh.Tx.WithinTx(ctx, func(ctx context.Context) error {
+		var err error
+		created, err = rh.IdemStore.Reserve(ctx, pay.MerchantID, key, bodyHash, owner, rh.IdemLease, idempotency.TTL)
+		if err != nil || !created {
+			return err
+		}
+
+		log.Printf("idempotency: refund key reserved")
+
+		// ключ мог быть перехвачен у упавшей попытки, которая успела создать возврат
+		ref, err = rh.Repo.GetRefundByIdemKey(ctx, paymentID, idemKey)
+		if err == nil {
+			return rh.finalize(ctx, pay.MerchantID, key, owner, bodyHash, ref)
+		}
+		if !errors.Is(err, refund.ErrNotFound) {
+			return err
+		}
+
+		amount, _ := decimal.NewFromString(req.Amount)
+		if req.Amount == "" {
+			refunded, err := rh.Repo.GetRefundedAmount(ctx, paymentID)
+			if err != nil {
+				return err
+			}
+			amount = refund.Remaining(pay.CapturedOrAmount(), refunded)
+		}
+
+		ref = refund.Refund{
+			ID:             createRefundID(),
+			PaymentID:      pay.ID,
+			MerchantID:     pay.MerchantID,
+			Amount:         amount,
+			Currency:       pay.Currency,
+			Reason:         req.Reason,
+			Status:         refund.StatusPending,
+			IdempotencyKey: idemKey,
+		}
+
+		event, err := events.NewRefundCreatedEvent(ref, pay)
+		if err != nil {
+			return err
+		}
+
+		event.Headers["x-idempotency-key"] = idemKey
+		event.Headers["x-trace-id"] = uuid.NewString()
+
+		// весь платёж уже возвращён
+		err = refund.ErrExceedsRefundable
+		if amount.IsPositive() {
+			err = rh.Repo.InsertRefund(ctx, ref, event)
+		}
+
+		// бизнес-отказы фиксируем как невосстановимую ошибку: повтор получит тот же ответ
+		switch {
+		case err == nil:
+			log.Println("db: refund added")
+			return rh.finalize(ctx, pay.MerchantID, key, owner, bodyHash, ref)
+		case errors.Is(err, refund.ErrPaymentNotRefundable):
+			code = http.StatusConflict
+		case errors.Is(err, refund.ErrExceedsRefundable):
+			code = http.StatusUnprocessableEntity
+		default:
+			return err
+		}
+		resp = map[string]any{"error": err.Error()}
+		return failIdempotency(ctx, rh.IdemStore, pay.MerchantID, key, owner, bodyHash, false, code, resp)
+	})
+	if err != nil {
+		// аренду перехватили, пока мы работали: итог запишет новый владелец
+		if errors.Is(err, idempotency.ErrLeaseLost) {
+			rh.replay(ctx, w, pay.MerchantID, paymentID, idemKey, bodyHash)
+			return
+		}
+		// восстановимая ошибка, повтор перехватит ключ сразу
+		failIdempotency(ctx, rh.IdemStore, pay.MerchantID, key, owner, bodyHash, true, 0, nil)
+		writeInternalError(w, "refund", err)
+		return
+	}
+
+	if !created {
+		rh.replay(ctx, w, pay.MerchantID, paymentID, idemKey, bodyHash)
+		return
+	}
+	if code != 0 {
+		writeJSON(w, code, resp)
+		return
+	}
+
+	log.Printf("idempotency: refund value finalized")
+
+	writeJSON(w, http.StatusCreated, RefundCreateResponse{RefundID: ref.ID, Status: string(ref.Status)})
+}
+
+// replay отвечает на повтор запроса с уже занятым ключом
+func (rh *RefundsHandler) replay(ctx context.Context, w http.ResponseWriter, merchantID, paymentID, idemKey, bodyHash string) {
+	val, err := rh.IdemStore.Load(ctx, merchantID, refundIdemPrefix+idemKey)
+	if err != nil {
+		writeInternalError(w, "idempotency", err)
+		return
+	}
+	if val == nil {
+		// ключ истёк между Reserve и Load
+		writeError(w, http.StatusConflict, "idempotency key expired, retry the request")
+		return
+	}
+	if val.BodyHash != bodyHash {
+		writeError(w, http.StatusUnprocessableEntity, "idempotency key reused with different payload")
+		return
+	}
+
+	switch val.State {
+	case idempotency.StateInProgress:
+		// владелец ещё работает: ключ не трогаем, итог запишет он
+		existRefund, err := rh.Repo.GetRefundByIdemKey(ctx, paymentID, idemKey)
+		if err != nil {
+			if errors.Is(err, refund.ErrNotFound) {
+				writeInProgress(w, val, RefundCreateResponse{Status: string(refund.StatusPending)})
+				return
+			}
+			writeInternalError(w, "db", err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, RefundCreateResponse{RefundID: existRefund.ID, Status: string(existRefund.Status)})
+	case idempotency.StateDone:
+		writeJSON(w, val.HTTPCode, val.Response)
+	case idempotency.StateError:
+		if !val.Retryable {
+			writeJSON(w, val.HTTPCode, val.Response)
+			return
+		}
+		// восстановимую ошибку только что перехватил параллельный повтор
+		writeError(w, http.StatusConflict, "previous attempt failed, retry the request")
+	}
+}
+
+// finalize записывает в ключ ответ о созданном возврате
+func (rh *RefundsHandler) finalize(ctx context.Context, merchantID, key, owner, bodyHash string, ref refund.Refund) error {
+	return rh.IdemStore.Finalize(ctx, merchantID, key, owner, bodyHash, http.StatusCreated, ref.ID,
+		map[string]any{"refund_id": ref.ID, "status": string(ref.Status)}, idempotency.TTL)
+}
+
+func (rh *RefundsHandler) Get(w http.ResponseWriter, r *http.Request) {
+	refundID := r.PathValue("id")
+
+	if !validateRefundID(refundID) {
+		writeError(w, http.StatusBadRequest, "wrong id")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), rh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	ref, err := rh.Repo.GetRefundByID(ctx, refundID)
+	if err == nil && ref.MerchantID != authMerchant(r) {
+		err = refund.ErrNotFound
+	}
+	if err != nil {
+		if errors.Is(err, refund.ErrNotFound) {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ToRefundResponse(ref))
+}
@@ -6,4 +6,46 @@ type paymentCreateRequest struct {
 	Amount      string `json:"amount"`
 	Currency    string `json:"currency"`
 	MethodToken string `json:"method_token"`
+	// automatic (по умолчанию) | manual — списание отдельным capture
+	CaptureMethod string `json:"capture_method,omitempty"`
+}
+
+type paymentCaptureRequest struct {
+	Amount string `json:"amount,omitempty"` // пусто — вся авторизованная сумма
+}
+
+type paymentConfirmRequest struct {
+	ChallengeID string `json:"challenge_id"` // из next_action
+}
+
+type refundCreateRequest struct {
+	Amount string `json:"amount,omitempty"` // пусто — весь остаток
+	Reason string `json:"reason,omitempty"`
+}
+
+type merchantCreateRequest struct {
+	MerchantID string   `json:"merchant_id"`
+	Name       string   `json:"name,omitempty"`
+	Currencies []string `json:"currencies,omitempty"` // пусто — все валюты
+}
+
+type merchantCurrenciesRequest struct {
+	Currencies []string `json:"currencies"`
+}
+
+type keyRotateRequest struct {
+	Overlap string `json:"overlap,omitempty"` // Go duration, пусто — из конфига
+}
+
+type webhookEndpointCreateRequest struct {
+	URL string `json:"url"`
+}
+
+type outboxRetryRequest struct {
+	Status string `json:"status"` // FAILED | DEAD — вернуть в очередь все события статуса
+}
+
+type outboxPurgeRequest struct {
+	OlderThanDays int   `json:"older_than_days"`
+	Archive       *bool `json:"archive,omitempty"` // по умолчанию true, false — удалить без архива
 }
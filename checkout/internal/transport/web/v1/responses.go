@@ -1,8 +1,11 @@
 package v1
 
+import "encoding/json"
+
 type PaymentCreateResponse struct {
-	PaymentID string `json:"payment_id,omitempty"`
-	Status    string `json:"status"`
+	PaymentID  string              `json:"payment_id,omitempty"`
+	Status     string              `json:"status"`
+	NextAction *NextActionResponse `json:"next_action,omitempty"`
 }
 
 type PaymentResponse struct {
@@ -15,6 +18,58 @@ type PaymentResponse struct {
 	PSPRef     *string `json:"psp_reference"`
 	CreatedAt  string  `json:"created_at"`
 	UpdatedAt  string  `json:"updated_at"`
+
+	CaptureMethod          string  `json:"capture_method"`
+	AmountCaptured         *string `json:"amount_captured,omitempty"`
+	AuthorizationExpiresAt *string `json:"authorization_expires_at,omitempty"`
+
+	NextAction *NextActionResponse `json:"next_action,omitempty"` // только в REQUIRES_ACTION
+}
+
+// действие покупателя: пройти challenge по redirect_url, затем confirm с challenge_id
+type NextActionResponse struct {
+	Type        string `json:"type"`
+	RedirectURL string `json:"redirect_url"`
+	ChallengeID string `json:"challenge_id"`
+}
+
+// конверт выдачи списка: next_cursor == null — страниц больше нет
+type PaymentListResponse struct {
+	Data       []PaymentResponse `json:"data"`
+	NextCursor *string           `json:"next_cursor"`
+}
+
+type PaymentEventsResponse struct {
+	PaymentID string                 `json:"payment_id"`
+	Events    []PaymentEventResponse `json:"events"`
+}
+
+type PaymentEventResponse struct {
+	FromStatus   *string `json:"from_status"`
+	ToStatus     string  `json:"to_status"`
+	Source       string  `json:"source"`
+	EventID      *string `json:"event_id,omitempty"`
+	ErrorDetails *string `json:"error_details,omitempty"`
+	OccurredAt   string  `json:"occurred_at"`
+}
+
+type RefundCreateResponse struct {
+	RefundID string `json:"refund_id,omitempty"`
+	Status   string `json:"status"`
+}
+
+type RefundResponse struct {
+	ID            string  `json:"refund_id"`
+	PaymentID     string  `json:"payment_id"`
+	MerchantID    string  `json:"merchant_id"`
+	Amount        string  `json:"amount"`
+	Currency      string  `json:"currency"`
+	Reason        string  `json:"reason,omitempty"`
+	Status        string  `json:"status"`
+	PSPRef        *string `json:"psp_reference"`
+	FailureReason *string `json:"failure_reason,omitempty"`
+	CreatedAt     string  `json:"created_at"`
+	UpdatedAt     string  `json:"updated_at"`
 }
 
 type healthResponse struct {
@@ -23,3 +78,102 @@ type healthResponse struct {
 type versionResponse struct {
 	Version string `json:"version"`
 }
+
+type readinessResponse struct {
+	Status string                `json:"status"`
+	Outbox *OutboxWorkerResponse `json:"outbox,omitempty"`
+}
+
+type OutboxWorkerResponse struct {
+	WorkerID       string `json:"worker_id"`
+	Active         bool   `json:"active"`
+	LeaderElection bool   `json:"leader_election"`
+}
+
+type MerchantResponse struct {
+	MerchantID string   `json:"merchant_id"`
+	Name       string   `json:"name"`
+	Currencies []string `json:"currencies"`
+}
+
+type MerchantCreateResponse struct {
+	MerchantResponse
+	Key APIKeyCreateResponse `json:"key"`
+}
+
+// APIKey отдаётся только в ответе на выпуск ключа
+type APIKeyCreateResponse struct {
+	APIKeyResponse
+	APIKey string `json:"api_key"`
+}
+
+type APIKeyResponse struct {
+	KeyID      string  `json:"key_id"`
+	Prefix     string  `json:"prefix"`
+	ValidFrom  string  `json:"valid_from"`
+	ValidUntil *string `json:"valid_until"`
+	RevokedAt  *string `json:"revoked_at,omitempty"`
+}
+
+type WebhookEndpointResponse struct {
+	EndpointID string `json:"endpoint_id"`
+	URL        string `json:"url"`
+	Secret     string `json:"secret,omitempty"` // только при создании
+	CreatedAt  string `json:"created_at"`
+}
+
+type WebhookDeliveryResponse struct {
+	DeliveryID     string                   `json:"delivery_id"`
+	EndpointID     string                   `json:"endpoint_id"`
+	EventID        string                   `json:"event_id"`
+	EventType      string                   `json:"event_type"`
+	Status         string                   `json:"status"`
+	Attempt        int                      `json:"attempt"`
+	NextAttemptAt  string                   `json:"next_attempt_at"`
+	LastStatusCode *int                     `json:"last_status_code,omitempty"`
+	LastError      *string                  `json:"last_error,omitempty"`
+	DeliveredAt    *string                  `json:"delivered_at,omitempty"`
+	CreatedAt      string                   `json:"created_at"`
+	Attempts       []WebhookAttemptResponse `json:"attempts,omitempty"`
+}
+
+type WebhookDeliveryListResponse struct {
+	Data       []WebhookDeliveryResponse `json:"data"`
+	NextCursor *string                   `json:"next_cursor"`
+}
+
+type WebhookAttemptResponse struct {
+	Attempt    int     `json:"attempt"`
+	StatusCode *int    `json:"status_code,omitempty"`
+	Error      *string `json:"error,omitempty"`
+	DurationMs int64   `json:"duration_ms"`
+	CreatedAt  string  `json:"created_at"`
+}
+
+type OutboxEventResponse struct {
+	ID            int64             `json:"id"`
+	AggregateType string            `json:"aggregate_type"`
+	AggregateID   string            `json:"aggregate_id"`
+	EventType     string            `json:"event_type"`
+	EventVersion  int               `json:"event_version"`
+	Key           string            `json:"key"`
+	Status        string            `json:"status"`
+	Attempt       int               `json:"attempt"`
+	NextAttemptAt string            `json:"next_attempt_at"`
+	LastError     *string           `json:"last_error,omitempty"`
+	CreatedAt     string            `json:"created_at"`
+	UpdatedAt     string            `json:"updated_at"`
+	Payload       json.RawMessage   `json:"payload,omitempty"` // только в карточке события
+	Headers       map[string]string `json:"headers,omitempty"`
+	RawHeaders    string            `json:"raw_headers,omitempty"`  // если headers не разобрались
+	DecodeError   string            `json:"decode_error,omitempty"` // строка повреждена
+}
+
+type OutboxEventListResponse struct {
+	Data       []OutboxEventResponse `json:"data"`
+	NextCursor *string               `json:"next_cursor"`
+}
+
+type OutboxBatchResponse struct {
+	Processed int64 `json:"processed"`
+}
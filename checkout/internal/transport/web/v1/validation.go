@@ -2,22 +2,19 @@ package v1
 
 import (
 	"errors"
-	"regexp"
+	"net/netip"
+	"net/url"
 	"strings"
 	"unicode/utf8"
 
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/outbox"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/webhook"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/shared/currency"
 	"github.com/google/uuid"
 	"github.com/shopspring/decimal"
 )
 
-var currencyRe = regexp.MustCompile(`^[A-Z]{3}$`)
-
-var iso4217 = map[string]struct{}{
-	"USD": {},
-	"EUR": {},
-	"RUB": {},
-}
-
 func validatePayment(req paymentCreateRequest) []string {
 	var errs []string
 
@@ -30,16 +27,98 @@ func validatePayment(req paymentCreateRequest) []string {
 	if !validateString(req.MerchantID) {
 		errs = append(errs, "invalid merchant_id")
 	}
-	if !validateDecimal(req.Amount) {
-		errs = append(errs, "invalid amount")
-	}
 	if !validateCurrency(req.Currency) {
 		errs = append(errs, "invalid currency")
+	} else if !validateAmount(req.Amount, amountCurrency(req.Currency)) {
+		errs = append(errs, "invalid amount")
+	}
+	if !validateCaptureMethod(req.CaptureMethod) {
+		errs = append(errs, "invalid capture_method")
 	}
 
 	return errs
 }
 
+func validateCaptureMethod(m string) bool {
+	switch payment.CaptureMethod(m) {
+	case "", payment.CaptureAutomatic, payment.CaptureManual:
+		return true
+	default:
+		return false
+	}
+}
+
+func validateStatus(s string) bool {
+	switch payment.PaymentStatus(s) {
+	case payment.StatusPending, payment.StatusProcessing, payment.StatusSucceeded, payment.StatusFailed,
+		payment.StatusAuthorized, payment.StatusCapturing, payment.StatusVoiding, payment.StatusVoided,
+		payment.StatusRequiresAction:
+		return true
+	default:
+		return false
+	}
+}
+
+func validateOutboxStatus(s string) bool {
+	switch outbox.Status(s) {
+	case outbox.StatusNew, outbox.StatusInProgress, outbox.StatusSent, outbox.StatusFailed, outbox.StatusDead:
+		return true
+	default:
+		return false
+	}
+}
+
+func validateRefund(req refundCreateRequest) []string {
+	var errs []string
+
+	// точность по валюте платежа проверяется, когда платёж загружен
+	if req.Amount != "" && !validateAmount(req.Amount, anyCurrency) {
+		errs = append(errs, "invalid amount")
+	}
+	if utf8.RuneCountInString(req.Reason) > 256 {
+		errs = append(errs, "invalid reason")
+	}
+
+	return errs
+}
+
+// validateWebhookURL: только https и только публичные адреса, чтобы мерчант
+// не мог направить уведомления во внутреннюю сеть. Имена проверяет ещё и воркер
+// после резолва (см. infra/webhook). allowInsecure — для локального запуска
+func validateWebhookURL(s string, allowInsecure bool) bool {
+	if len(s) > 2048 {
+		return false
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.Host == "" || u.User != nil {
+		return false
+	}
+	if allowInsecure {
+		return u.Scheme == "https" || u.Scheme == "http"
+	}
+	if u.Scheme != "https" {
+		return false
+	}
+
+	host := strings.ToLower(strings.TrimSuffix(u.Hostname(), "."))
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !webhook.PublicAddr(ip) {
+		return false
+	}
+	return true
+}
+
+func validateDeliveryStatus(s string) bool {
+	switch webhook.DeliveryStatus(s) {
+	case webhook.DeliveryPending, webhook.DeliveryInProgress, webhook.DeliveryDelivered,
+		webhook.DeliveryFailed, webhook.DeliveryDead:
+		return true
+	}
+	return false
+}
+
 func validateIdempotencyKey(key string) error {
 	key = strings.TrimSpace(key)
 	l := utf8.RuneCountInString(key)
@@ -50,20 +129,38 @@ func validateIdempotencyKey(key string) error {
 }
 
 func validateCurrency(code string) bool {
-	if !currencyRe.MatchString(code) {
-		return false
-	}
-	_, ok := iso4217[code]
+	_, ok := currency.Lookup(code)
 	return ok
 }
 
+func validateCurrencies(codes []string) bool {
+	for _, code := range codes {
+		if !validateCurrency(code) {
+			return false
+		}
+	}
+	return true
+}
+
+// пока валюта неизвестна (платёж не загружен), проверяем по самой точной
+var anyCurrency = currency.Currency{Exponent: currency.MaxExponent}
+
+// валюта для проверки суммы; неизвестную отсеет validateCurrency
+func amountCurrency(code string) currency.Currency {
+	if c, ok := currency.Lookup(code); ok {
+		return c
+	}
+	return anyCurrency
+}
+
 func validateString(s string) bool {
 	s = strings.TrimSpace(s)
 	l := utf8.RuneCountInString(s)
 	return l > 0 && l <= 128
 }
 
-func validateDecimal(dec string) bool {
+// положительное число, не точнее минорной единицы валюты: "100.0" JPY допустимо, "100.5" — нет
+func validateAmount(dec string, c currency.Currency) bool {
 	d, err := decimal.NewFromString(dec)
 	if err != nil {
 		return false
@@ -72,11 +169,7 @@ func validateDecimal(dec string) bool {
 	if d.Cmp(decimal.Zero) <= 0 {
 		return false
 	}
-	// не больше 2 знаков после запятой
-	if d.Exponent() < -2 {
-		return false
-	}
-	return true
+	return c.Valid(d)
 }
 
 func validatePayID(s string) bool {
@@ -88,3 +181,13 @@ func validatePayID(s string) bool {
 	_, err := uuid.Parse(idPart)
 	return err == nil
 }
+
+func validateRefundID(s string) bool {
+	if !strings.HasPrefix(s, "rf_") {
+		return false
+	}
+	idPart := strings.TrimPrefix(s, "rf_")
+
+	_, err := uuid.Parse(idPart)
+	return err == nil
+}
@@ -0,0 +1,249 @@
+package v1
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/checkout/internal/domain/webhook"
+	"github.com/google/uuid"
+)
+
+type WebhooksHandler struct {
+	Repo     webhook.Repository
+	Cfg      config.HTTP
+	Webhooks config.Webhooks
+}
+
+// CreateEndpoint регистрирует адрес; секрет подписи отдаётся только в этом ответе
+func (wh *WebhooksHandler) CreateEndpoint(w http.ResponseWriter, r *http.Request) {
+	var req webhookEndpointCreateRequest
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+
+	defer r.Body.Close()
+
+	if !validateWebhookURL(req.URL, wh.Webhooks.AllowInsecure) {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": []string{"invalid url"}})
+		return
+	}
+
+	secret, err := webhook.NewSecret()
+	if err != nil {
+		writeInternalError(w, "webhook", err)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), wh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	e, err := wh.Repo.InsertEndpoint(ctx, webhook.Endpoint{
+		ID:         "we_" + uuid.NewString(),
+		MerchantID: authMerchant(r),
+		URL:        req.URL,
+		Secret:     secret,
+	})
+	if err != nil {
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	resp := ToWebhookEndpointResponse(e)
+	resp.Secret = e.Secret
+	writeJSON(w, http.StatusCreated, resp)
+}
+
+func (wh *WebhooksHandler) ListEndpoints(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), wh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	endpoints, err := wh.Repo.ListEndpoints(ctx, authMerchant(r))
+	if err != nil {
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	resp := make([]WebhookEndpointResponse, 0, len(endpoints))
+	for _, e := range endpoints {
+		resp = append(resp, ToWebhookEndpointResponse(e))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{"endpoints": resp})
+}
+
+func (wh *WebhooksHandler) DeleteEndpoint(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), wh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	if err := wh.Repo.DisableEndpoint(ctx, authMerchant(r), r.PathValue("id")); err != nil {
+		if errors.Is(err, webhook.ErrEndpointNotFound) {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeliveries — журнал доставок мерчанта от новых к старым, с keyset-пагинацией как у платежей
+func (wh *WebhooksHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	filter, errs := parseDeliveryFilter(r.URL.Query())
+	if len(errs) > 0 {
+		writeJSON(w, http.StatusBadRequest, map[string]any{"errors": errs})
+		return
+	}
+	filter.MerchantID = authMerchant(r)
+
+	limit := filter.Limit
+	filter.Limit++
+
+	ctx, cancel := context.WithTimeout(r.Context(), wh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	deliveries, err := wh.Repo.ListDeliveries(ctx, filter)
+	if err != nil {
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	resp := WebhookDeliveryListResponse{Data: make([]WebhookDeliveryResponse, 0, len(deliveries))}
+	if len(deliveries) > limit {
+		deliveries = deliveries[:limit]
+		last := deliveries[len(deliveries)-1]
+		next := encodeDeliveryCursor(webhook.Cursor{CreatedAt: last.CreatedAt, ID: last.ID})
+		resp.NextCursor = &next
+	}
+	for _, d := range deliveries {
+		resp.Data = append(resp.Data, ToWebhookDeliveryResponse(d, nil))
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// GetDelivery отдаёт доставку вместе с журналом попыток
+func (wh *WebhooksHandler) GetDelivery(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), wh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	d, err := wh.Repo.GetDelivery(ctx, authMerchant(r), r.PathValue("delivery_id"))
+	if err != nil {
+		if errors.Is(err, webhook.ErrDeliveryNotFound) {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	attempts, err := wh.Repo.ListAttempts(ctx, d.ID)
+	if err != nil {
+		writeInternalError(w, "db", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, ToWebhookDeliveryResponse(d, attempts))
+}
+
+// Redeliver ставит доставку в очередь заново, в том числе после DEAD
+func (wh *WebhooksHandler) Redeliver(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), wh.Cfg.PaymentTimeout)
+	defer cancel()
+
+	d, err := wh.Repo.Redeliver(ctx, authMerchant(r), r.PathValue("delivery_id"))
+	if err != nil {
+		switch {
+		case errors.Is(err, webhook.ErrDeliveryNotFound):
+			writeError(w, http.StatusNotFound, "not found")
+		case errors.Is(err, webhook.ErrDeliveryBusy):
+			writeError(w, http.StatusConflict, "delivery in progress")
+		case errors.Is(err, webhook.ErrEndpointDisabled):
+			writeError(w, http.StatusConflict, "endpoint disabled")
+		default:
+			writeInternalError(w, "db", err)
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, ToWebhookDeliveryResponse(d, nil))
+}
+
+func parseDeliveryFilter(q url.Values) (webhook.DeliveryFilter, []string) {
+	var (
+		f    = webhook.DeliveryFilter{Limit: webhook.DefaultListLimit}
+		errs []string
+	)
+
+	if v := q.Get("endpoint_id"); v != "" {
+		if !validateString(v) {
+			errs = append(errs, "invalid endpoint_id")
+		}
+		f.EndpointID = v
+	}
+	if v := q.Get("event_id"); v != "" {
+		if !validateString(v) {
+			errs = append(errs, "invalid event_id")
+		}
+		f.EventID = v
+	}
+	if v := q.Get("status"); v != "" {
+		if !validateDeliveryStatus(v) {
+			errs = append(errs, "invalid status")
+		}
+		f.Status = webhook.DeliveryStatus(v)
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > webhook.MaxListLimit {
+			errs = append(errs, "invalid limit")
+		}
+		f.Limit = n
+	}
+	if v := q.Get("cursor"); v != "" {
+		c, err := decodeDeliveryCursor(v)
+		if err != nil {
+			errs = append(errs, "invalid cursor")
+		}
+		f.After = &c
+	}
+
+	return f, errs
+}
+
+func encodeDeliveryCursor(c webhook.Cursor) string {
+	data, _ := json.Marshal(listCursor{CreatedAt: toRFC3339Nano(c.CreatedAt), ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeDeliveryCursor(s string) (webhook.Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return webhook.Cursor{}, err
+	}
+
+	var lc listCursor
+	if err := json.Unmarshal(data, &lc); err != nil {
+		return webhook.Cursor{}, err
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, lc.CreatedAt)
+	if err != nil {
+		return webhook.Cursor{}, err
+	}
+	if !strings.HasPrefix(lc.ID, "whd_") || !validateString(lc.ID) {
+		return webhook.Cursor{}, errors.New("wrong id in cursor")
+	}
+
+	return webhook.Cursor{CreatedAt: t, ID: lc.ID}, nil
+}
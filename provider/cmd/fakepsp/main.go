@@ -0,0 +1,42 @@
+// fakepsp — локальный эквайер для provider: HTTP API authorize/capture/refund/void
+// и запрос статуса, исходы и сетевые сбои задают сценарии симулятора
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/infra/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/transport/web"
+)
+
+func main() {
+	cfg, err := config.LoadFakePSPConfig()
+	if err != nil {
+		log.Fatalf("failed load config: %v", err)
+	}
+
+	sim, err := psp.New(cfg.Simulator)
+	if err != nil {
+		log.Fatalf("failed init simulator: %v", err)
+	}
+
+	server := web.NewFakePSP(*cfg, sim)
+
+	ctx, stop := signal.NotifyContext(context.Background(),
+		os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go server.Run()
+
+	<-ctx.Done()
+	stopCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	server.Close(stopCtx)
+}
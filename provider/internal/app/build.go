@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	domainpsp "github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
 	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/infra/kafka"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/infra/outbox"
 	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/infra/postgres"
 	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/infra/provider"
 	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/infra/psp"
@@ -15,12 +17,13 @@ import (
 )
 
 type App struct {
-	config   *config.Config
-	postgres *postgres.PaymentsRepo
-	pspSim   *psp.Simulator
-	kafka    *kafka.Client
-	provider *provider.Client
-	server   *web.Server
+	config    *config.Config
+	postgres  *postgres.PaymentsRepo
+	pspRouter *psp.Router
+	kafka     *kafka.Client
+	provider  *provider.Client
+	outbox    *outbox.Worker
+	server    *web.Server
 }
 
 func Build() (*App, error) {
@@ -35,7 +38,25 @@ func Build() (*App, error) {
 		return nil, fmt.Errorf("failed init postgres: %w", err)
 	}
 
-	pspSimulator := psp.New(&cfg.PSP)
+	pspAdapters := make([]domainpsp.Adapter, 0, len(cfg.PSP.Simulators)+1)
+	for _, simCfg := range append([]config.Simulator{cfg.PSP.Simulator}, cfg.PSP.Simulators...) {
+		sim, err := psp.New(simCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed init psp simulator: %w", err)
+		}
+		pspAdapters = append(pspAdapters, sim)
+	}
+	for _, httpCfg := range cfg.PSP.HTTP {
+		adapter, err := psp.NewHTTP(httpCfg)
+		if err != nil {
+			return nil, fmt.Errorf("failed init http psp: %w", err)
+		}
+		pspAdapters = append(pspAdapters, adapter)
+	}
+	pspRouter, err := psp.NewRouter(cfg.PSP.Routing, pspAdapters...)
+	if err != nil {
+		return nil, fmt.Errorf("failed init psp router: %w", err)
+	}
 
 	kafka := kafka.NewClient(cfg.Kafka)
 
@@ -45,17 +66,22 @@ func Build() (*App, error) {
 		adapters = append(adapters, con)
 	}
 
-	provider := provider.New(pspSimulator, kafka.GetProducer(), postgres, adapters)
+	provider, err := provider.New(pspRouter, postgres, adapters, cfg.PSP.Pending, cfg.Retry)
+	if err != nil {
+		return nil, fmt.Errorf("failed init provider: %w", err)
+	}
+	relay := outbox.New(cfg.Outbox, kafka.GetProducer(), postgres)
 
-	server := web.New(cfg.HTTP, postgres)
+	server := web.New(cfg.HTTP, postgres, cfg.PSP.Webhooks, provider)
 
 	return &App{
-		config:   cfg,
-		postgres: postgres,
-		pspSim:   pspSimulator,
-		kafka:    kafka,
-		provider: provider,
-		server:   server,
+		config:    cfg,
+		postgres:  postgres,
+		pspRouter: pspRouter,
+		kafka:     kafka,
+		provider:  provider,
+		outbox:    relay,
+		server:    server,
 	}, nil
 }
 
@@ -67,6 +93,7 @@ func (a *App) Run(ctx context.Context) error {
 	}
 
 	go a.provider.Run(ctx)
+	go a.outbox.Run(ctx)
 	go a.kafka.Run(ctx)
 	go a.server.Run()
 
@@ -14,10 +14,12 @@ import (
 var Version = "unknown"
 
 type Config struct {
-	HTTP  HTTP     `mapstructure:"http"`
-	DB    Database `mapstructure:"database"`
-	Kafka Kafka    `mapstructure:"kafka"`
-	PSP   PSP      `mapstructure:"psp"`
+	HTTP   HTTP     `mapstructure:"http"`
+	DB     Database `mapstructure:"database"`
+	Kafka  Kafka    `mapstructure:"kafka"`
+	PSP    PSP      `mapstructure:"psp"`
+	Outbox Outbox   `mapstructure:"outbox"`
+	Retry  Retry    `mapstructure:"retry"`
 }
 
 type HTTP struct {
@@ -45,17 +47,184 @@ type KafkaProducer struct {
 	BatchTimeout           time.Duration `mapstructure:"batch_timeout"`
 	PaymentsProcessedTopic string        `mapstructure:"payments_processed_topic"`
 	PaymentsFailedTopic    string        `mapstructure:"payments_failed_topic"`
+	RefundsProcessedTopic  string        `mapstructure:"refunds_processed_topic"`
+	RefundsFailedTopic     string        `mapstructure:"refunds_failed_topic"`
 }
 
 type KafkaConsumer struct {
 	Partitions             int    `mapstructure:"partitions"`
 	GroupID                string `mapstructure:"group_id"`
 	PaymentsInitiatedTopic string `mapstructure:"payments_initiated_topic"`
+	RefundsInitiatedTopic  string `mapstructure:"refunds_initiated_topic"`
 }
 
 type PSP struct {
-	Chance float64 `mapstructure:"chance"`
-	Prefix string  `mapstructure:"prefix"`
+	Simulator  `mapstructure:",squash"` // основной симулятор, по умолчанию name: simulator
+	Simulators []Simulator              `mapstructure:"simulators"` // дополнительные симуляторы для маршрутизации
+	HTTP       []HTTPPSP                `mapstructure:"http"`       // внешние PSP по HTTP (cmd/fakepsp)
+	Routing    Routing                  `mapstructure:"routing"`
+	Pending    Pending                  `mapstructure:"pending"`
+	Webhooks   Webhooks                 `mapstructure:"webhooks"`
+}
+
+// Pending — авторизации, на которые PSP ответил PENDING (итог пришлёт webhook'ом)
+// или REQUIRES_ACTION (итог после confirm покупателя)
+type Pending struct {
+	Timeout       time.Duration `mapstructure:"timeout"`        // сколько ждать итог, потом payments.failed
+	SweepInterval time.Duration `mapstructure:"sweep_interval"` // как часто искать просроченные
+	SweepBatch    int           `mapstructure:"sweep_batch"`
+}
+
+// Webhooks — входящие webhook'и PSP: POST /v1/webhooks/psp/{psp},
+// подпись HMAC-SHA256 секретом этого PSP
+type Webhooks struct {
+	Tolerance time.Duration `mapstructure:"tolerance"` // допустимое расхождение времени подписи
+	PSPs      []WebhookPSP  `mapstructure:"psps"`
+}
+
+type WebhookPSP struct {
+	Name      string `mapstructure:"name"`
+	Secret    string `mapstructure:"secret"`
+	SecretEnv string `mapstructure:"secret_env"` // переменная окружения с секретом, в yaml его не хранят
+}
+
+type Simulator struct {
+	Name              string  `mapstructure:"name"`
+	Chance            float64 `mapstructure:"chance"`
+	RefundChance      float64 `mapstructure:"refund_chance"`
+	CaptureChance     float64 `mapstructure:"capture_chance"`
+	UnavailableChance float64 `mapstructure:"unavailable_chance"` // доля запросов, на которые PSP недоступен
+	Prefix            string  `mapstructure:"prefix"`
+	// страница challenge для исхода challenge, к ней добавляется ?challenge_id=
+	ChallengeURL string `mapstructure:"challenge_url"`
+	// Seed != 0 — исходы детерминированы: решение, задержка и недоступность
+	// зависят только от seed, операции, ключа идемпотентности и номера повтора
+	Seed uint64 `mapstructure:"seed"`
+	// доля одобрений авторизации по merchant_id вместо chance. viper приводит
+	// ключи к нижнему регистру, сравнение тоже без учёта регистра
+	Merchants map[string]float64 `mapstructure:"merchants"`
+	Latency   Latency            `mapstructure:"latency"`   // задержка ответа по умолчанию
+	Scenarios []Scenario         `mapstructure:"scenarios"` // применяется первый подходящий
+}
+
+// Scenario — заданный исход по "магическим" суммам и токенам, как тестовые карты.
+// Пустое условие не проверяется, пустой Outcome — обычное случайное решение
+type Scenario struct {
+	Name         string   `mapstructure:"name"`
+	Operations   []string `mapstructure:"operations"` // authorize | capture | refund | void | confirm, пусто — все
+	MethodToken  string   `mapstructure:"method_token"`
+	Merchant     string   `mapstructure:"merchant"`
+	Amount       string   `mapstructure:"amount"`        // точная сумма
+	AmountSuffix string   `mapstructure:"amount_suffix"` // окончание суммы со знаками валюты: ".13" для USD, "13" для JPY
+	Outcome      string   `mapstructure:"outcome"`       // approve | hard_decline | soft_decline | timeout | unavailable | server_error | connection_reset | pending | challenge
+	// итог pending- или challenge-авторизации: approve | hard_decline | soft_decline, пусто — по chance
+	Final   string  `mapstructure:"final"`
+	Code    string  `mapstructure:"code"`    // код отказа PSP
+	Latency Latency `mapstructure:"latency"` // вместо задержки по умолчанию
+}
+
+// Latency — распределение задержки: fixed (mean), uniform (min..max),
+// normal (mean, stddev), exponential (mean). Max > 0 ограничивает сверху
+type Latency struct {
+	Distribution string        `mapstructure:"distribution"` // пусто — без задержки
+	Min          time.Duration `mapstructure:"min"`
+	Max          time.Duration `mapstructure:"max"`
+	Mean         time.Duration `mapstructure:"mean"`
+	StdDev       time.Duration `mapstructure:"stddev"`
+}
+
+// HTTPPSP — адаптер к эквайеру по HTTP. Повторы безопасны: запрос несёт Idempotency-Key
+type HTTPPSP struct {
+	Name        string        `mapstructure:"name"`
+	BaseURL     string        `mapstructure:"base_url"`
+	BaseURLEnv  string        `mapstructure:"base_url_env"` // переменная окружения, переопределяющая base_url
+	Timeout     time.Duration `mapstructure:"timeout"`      // на одну попытку
+	MaxAttempts int           `mapstructure:"max_attempts"`
+	Backoff     time.Duration `mapstructure:"backoff"` // пауза перед n-й повторной попыткой — backoff*n
+}
+
+// FakePSP — конфиг cmd/fakepsp: HTTP-эквайер поверх симулятора
+type FakePSP struct {
+	Addr string `mapstructure:"addr"`
+	// сколько держать запрос со сценарием timeout, если клиент не отвалился раньше
+	HangTimeout time.Duration `mapstructure:"hang_timeout"`
+	Simulator   Simulator     `mapstructure:"simulator"`
+	Webhook     FakeWebhook   `mapstructure:"webhook"`
+}
+
+// FakeWebhook — куда и с какой подписью fakepsp шлёт итог pending-авторизаций
+type FakeWebhook struct {
+	URL       string        `mapstructure:"url"` // пусто — webhook'и не шлются
+	URLEnv    string        `mapstructure:"url_env"`
+	Secret    string        `mapstructure:"secret"`
+	SecretEnv string        `mapstructure:"secret_env"`
+	Delay     time.Duration `mapstructure:"delay"` // через сколько после ответа PENDING
+}
+
+// Routing — выбор PSP для авторизации: первое подходящее правило, иначе Default
+type Routing struct {
+	Default []RouteTarget `mapstructure:"default"` // пусто — основной симулятор
+	Rules   []RouteRule   `mapstructure:"rules"`
+}
+
+// RouteRule: пустой список или граница — без ограничения
+type RouteRule struct {
+	Name       string        `mapstructure:"name"`
+	Merchants  []string      `mapstructure:"merchants"`
+	Currencies []string      `mapstructure:"currencies"`
+	MinAmount  string        `mapstructure:"min_amount"` // включительно
+	MaxAmount  string        `mapstructure:"max_amount"` // не включительно
+	Targets    []RouteTarget `mapstructure:"targets"`
+}
+
+// RouteTarget: основной PSP выбирается по весам от хеша payment_id, остальные —
+// резерв при недоступности в порядке списка. Weight 0 — только резерв
+type RouteTarget struct {
+	PSP    string `mapstructure:"psp"`
+	Weight int    `mapstructure:"weight"`
+}
+
+// Outbox — relay результатов PSP из provider.outbox_events в Kafka
+type Outbox struct {
+	PollInterval        time.Duration `mapstructure:"poll_interval"`
+	PollTimeout         time.Duration `mapstructure:"poll_timeout"`
+	BatchSize           int           `mapstructure:"batch_size"`
+	ResetEventsInterval time.Duration `mapstructure:"reset_events_interval"`
+	ResetEventsTimeout  time.Duration `mapstructure:"reset_events_timeout"`
+	MaxParallel         int           `mapstructure:"max_parallel"`
+	MaxAttempts         int           `mapstructure:"max_attempts"` // 0 — повторять бесконечно
+	BackoffBase         time.Duration `mapstructure:"backoff_base"`
+	BackoffMax          time.Duration `mapstructure:"backoff_max"`
+	BackoffJitter       float64       `mapstructure:"backoff_jitter"` // доля паузы, на которую она случайно сокращается, 0..1
+	WorkerID            string        `mapstructure:"worker_id"`      // пусто — hostname и случайный суффикс
+	HeartbeatInterval   time.Duration `mapstructure:"heartbeat_interval"`
+	OwnerTTL            time.Duration `mapstructure:"owner_ttl"` // без heartbeat дольше — строки воркера сбрасываются
+	// собственные IN_PROGRESS-строки старше — отправлены, но не закрыты, сбрасываются
+	ReclaimAfter time.Duration `mapstructure:"reclaim_after"`
+	// строки outbox_workers без heartbeat дольше удаляются, 0 — не удалять
+	WorkerRetention time.Duration `mapstructure:"worker_retention"`
+}
+
+// Retry — повторы обработки команд из Kafka. Сбой БД сначала повторяется на месте
+// (InlineAttempts). Если обработка всё равно упала с ошибкой из Retryable, команда
+// уходит в provider.retry_events и партиция идёт дальше: воркер повторяет её через
+// backoff, после MaxAttempts попыток — *.failed. Исход таймаута PSP неизвестен:
+// такая команда остаётся DEAD без *.failed, платёж ждёт ручного разбора
+type Retry struct {
+	InlineAttempts int           `mapstructure:"inline_attempts"` // 1 — без повторов на месте
+	InlineBackoff  time.Duration `mapstructure:"inline_backoff"`  // пауза перед n-й повторной попыткой — inline_backoff*2^(n-1)
+	MaxAttempts    int           `mapstructure:"max_attempts"`    // всего попыток, 1 — без очереди повторов
+	BackoffBase    time.Duration `mapstructure:"backoff_base"`
+	BackoffMax     time.Duration `mapstructure:"backoff_max"`    // предел и для пауз на месте
+	BackoffJitter  float64       `mapstructure:"backoff_jitter"` // доля паузы, на которую она случайно сокращается, 0..1
+	Retryable      []string      `mapstructure:"retryable"`      // database | psp_timeout | psp_unavailable
+	PollInterval   time.Duration `mapstructure:"poll_interval"`
+	BatchSize      int           `mapstructure:"batch_size"`
+	// IN_PROGRESS дольше — воркер упал посреди обработки, команду берут снова.
+	// Должно быть больше времени обработки одной команды
+	ReclaimAfter  time.Duration `mapstructure:"reclaim_after"`
+	RetainDone    time.Duration `mapstructure:"retain_done"` // сколько хранить обработанные (DONE)
+	PruneInterval time.Duration `mapstructure:"prune_interval"`
 }
 
 func LoadConfig() (*Config, error) {
@@ -99,6 +268,48 @@ func LoadConfig() (*Config, error) {
 		cfg.DB.Host = postgresHost
 	}
 
+	for i, h := range cfg.PSP.HTTP {
+		if url := os.Getenv(h.BaseURLEnv); h.BaseURLEnv != "" && url != "" {
+			cfg.PSP.HTTP[i].BaseURL = url
+		}
+	}
+
+	for i, wh := range cfg.PSP.Webhooks.PSPs {
+		if secret := os.Getenv(wh.SecretEnv); wh.SecretEnv != "" && secret != "" {
+			cfg.PSP.Webhooks.PSPs[i].Secret = secret
+		}
+		// без секрета подпись webhook'а подделает любой
+		if cfg.PSP.Webhooks.PSPs[i].Secret == "" {
+			return nil, fmt.Errorf("psp webhooks %q: secret is required, set %s", wh.Name, wh.SecretEnv)
+		}
+	}
+
+	return cfg, nil
+}
+
+func LoadFakePSPConfig() (*FakePSP, error) {
+	v := viper.New()
+	v.SetConfigFile(os.Getenv("CONFIG_PATH"))
+
+	if err := v.ReadInConfig(); err != nil {
+		return nil, err
+	}
+
+	cfg := &FakePSP{}
+	if err := v.Unmarshal(&cfg); err != nil {
+		return nil, err
+	}
+
+	if url := os.Getenv(cfg.Webhook.URLEnv); cfg.Webhook.URLEnv != "" && url != "" {
+		cfg.Webhook.URL = url
+	}
+	if secret := os.Getenv(cfg.Webhook.SecretEnv); cfg.Webhook.SecretEnv != "" && secret != "" {
+		cfg.Webhook.Secret = secret
+	}
+	if cfg.Webhook.URL != "" && cfg.Webhook.Secret == "" {
+		return nil, fmt.Errorf("fakepsp webhook: secret is required, set %s", cfg.Webhook.SecretEnv)
+	}
+
 	return cfg, nil
 }
 
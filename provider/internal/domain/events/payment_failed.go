@@ -6,9 +6,11 @@ import (
 	"time"
 
 	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+	"github.com/google/uuid"
 )
 
 type PaymentFailed struct {
+	EventID      string `json:"event_id"`
 	EventType    string `json:"event_type"`
 	EventVersion int    `json:"event_version"`
 	PaymentID    string `json:"payment_id"`
@@ -29,6 +31,7 @@ func NewPaymentFailedEvent(evn event.Envelope, errDetails error) (event.Envelope
 	}
 
 	payload.EventType = string(event.PaymentFailedEvent)
+	payload.EventID = uuid.NewString() // ключ дедупликации у потребителей
 	payload.OccurredAt = time.Now().UTC().Format(time.RFC3339Nano)
 	payload.ErrorDetails = errDetails.Error()
 
@@ -0,0 +1,128 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+	"github.com/google/uuid"
+)
+
+// Операции над авторизованным платежом
+const (
+	OperationCapture = "capture"
+	OperationVoid    = "void"
+)
+
+// Результат capture/void, отправляемый в checkout
+type PaymentOperationResult struct {
+	EventID      string  `json:"event_id"`
+	EventType    string  `json:"event_type"`
+	EventVersion int     `json:"event_version"`
+	PaymentID    string  `json:"payment_id"`
+	MerchantID   string  `json:"merchant_id"`
+	OrderID      string  `json:"order_id"`
+	Amount       string  `json:"amount"`
+	Currency     string  `json:"currency"`
+	Status       string  `json:"status"`
+	PSPRef       *string `json:"psp_reference"`
+	OccurredAt   string  `json:"occurred_at"`
+	ErrorDetails string  `json:"error_details,omitempty"`
+}
+
+// Команда отмены авторизации, которую provider ставит себе сам
+type PaymentVoidRequested struct {
+	EventID      string  `json:"event_id"`
+	EventType    string  `json:"event_type"`
+	EventVersion int     `json:"event_version"`
+	PaymentID    string  `json:"payment_id"`
+	MerchantID   string  `json:"merchant_id"`
+	OrderID      string  `json:"order_id"`
+	Amount       string  `json:"amount"`
+	Currency     string  `json:"currency"`
+	PSPRef       *string `json:"psp_reference"`
+	OccurredAt   string  `json:"occurred_at"`
+}
+
+// Операция, которую запрашивает команда из checkout
+func OperationOf(t event.EnvelopeType) string {
+	if t == event.PaymentVoidRequestedEvent {
+		return OperationVoid
+	}
+	return OperationCapture
+}
+
+// Конструктор результата из команды capture/void.
+// errDetails != nil — операция не удалась, событие *_failed. eventID пустой — новый
+func NewPaymentOperationResultEvent(evn event.Envelope, status string, pspRef *string, errDetails error, eventID string) (event.Envelope, error) {
+	var payload PaymentOperationResult
+
+	if err := json.Unmarshal(evn.Payload, &payload); err != nil {
+		return event.Envelope{}, fmt.Errorf("invalid JSON err:%v", err)
+	}
+
+	success := errDetails == nil
+	var evnType event.EnvelopeType
+	switch {
+	case OperationOf(evn.Type) == OperationVoid && success:
+		evnType = event.PaymentVoidedEvent
+	case OperationOf(evn.Type) == OperationVoid:
+		evnType = event.PaymentVoidFailedEvent
+	case success:
+		evnType = event.PaymentCapturedEvent
+	default:
+		evnType = event.PaymentCaptureFailedEvent
+	}
+
+	payload.EventType = string(evnType)
+	payload.EventID = eventID // ключ дедупликации у потребителей
+	if eventID == "" {
+		payload.EventID = uuid.NewString()
+	}
+	payload.Status = status
+	payload.PSPRef = pspRef
+	payload.OccurredAt = time.Now().UTC().Format(time.RFC3339Nano)
+	if !success {
+		payload.ErrorDetails = errDetails.Error()
+	}
+
+	value, err := json.Marshal(payload)
+	if err != nil {
+		return event.Envelope{}, err
+	}
+
+	return event.Envelope{
+		Type:    evnType,
+		Key:     payload.PaymentID, // партиционирование по payment_id
+		Payload: value,
+		Headers: evn.Headers,
+	}, nil
+}
+
+// Конструктор команды отмены из исходной команды payment.created: PSP одобрил
+// авторизацию, когда платёж уже провален. eventID — ключ идемпотентности у PSP
+func NewPaymentVoidRequestedEvent(evn event.Envelope, pspRef *string, eventID string) (event.Envelope, error) {
+	var payload PaymentVoidRequested
+
+	if err := json.Unmarshal(evn.Payload, &payload); err != nil {
+		return event.Envelope{}, fmt.Errorf("invalid JSON err:%v", err)
+	}
+
+	payload.EventType = string(event.PaymentVoidRequestedEvent)
+	payload.EventID = eventID
+	payload.PSPRef = pspRef
+	payload.OccurredAt = time.Now().UTC().Format(time.RFC3339Nano)
+
+	value, err := json.Marshal(payload)
+	if err != nil {
+		return event.Envelope{}, err
+	}
+
+	return event.Envelope{
+		Type:    event.PaymentVoidRequestedEvent,
+		Key:     payload.PaymentID,
+		Payload: value,
+		Headers: evn.Headers,
+	}, nil
+}
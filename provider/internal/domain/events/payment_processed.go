@@ -6,23 +6,50 @@ import (
 	"time"
 
 	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+	"github.com/google/uuid"
 )
 
 type PaymentProcessed struct {
-	EventType    string  `json:"event_type"`
-	EventVersion int     `json:"event_version"`
-	PaymentID    string  `json:"payment_id"`
-	MerchantID   string  `json:"merchant_id"`
-	OrderID      string  `json:"order_id"`
-	Amount       string  `json:"amount"`
-	Currency     string  `json:"currency"`
-	Status       string  `json:"status"`
-	PSPRef       *string `json:"psp_reference"`
-	OccurredAt   string  `json:"occurred_at"`
+	EventID       string  `json:"event_id"`
+	EventType     string  `json:"event_type"`
+	EventVersion  int     `json:"event_version"`
+	PaymentID     string  `json:"payment_id"`
+	MerchantID    string  `json:"merchant_id"`
+	OrderID       string  `json:"order_id"`
+	Amount        string  `json:"amount"`
+	Currency      string  `json:"currency"`
+	Status        string  `json:"status"`
+	PSPRef        *string `json:"psp_reference"`
+	CaptureMethod string  `json:"capture_method,omitempty"`
+	OccurredAt    string  `json:"occurred_at"`
+
+	NextAction *NextAction `json:"next_action,omitempty"` // для REQUIRES_ACTION
+}
+
+// статус события, когда покупатель должен пройти challenge
+const StatusRequiresAction = "REQUIRES_ACTION"
+
+const NextActionRedirect = "redirect"
+
+type NextAction struct {
+	Type        string `json:"type"`
+	RedirectURL string `json:"redirect_url"`
+	ChallengeID string `json:"challenge_id"`
 }
 
-// Конструктор события из доменного объекта
-func NewPaymentProcessedEvent(evn event.Envelope, status string, pspRef *string) (event.Envelope, error) {
+// Конструктор события из доменного объекта.
+// eventID пустой — новое решение; при повторной отправке сохранённого — прежний id
+func NewPaymentProcessedEvent(evn event.Envelope, status string, pspRef *string, eventID string) (event.Envelope, error) {
+	return newPaymentProcessed(evn, status, pspRef, eventID, nil)
+}
+
+// Авторизация ждёт challenge: checkout переводит платёж в REQUIRES_ACTION
+func NewPaymentActionRequiredEvent(evn event.Envelope, pspRef *string, redirectURL, challengeID string) (event.Envelope, error) {
+	return newPaymentProcessed(evn, StatusRequiresAction, pspRef, "",
+		&NextAction{Type: NextActionRedirect, RedirectURL: redirectURL, ChallengeID: challengeID})
+}
+
+func newPaymentProcessed(evn event.Envelope, status string, pspRef *string, eventID string, next *NextAction) (event.Envelope, error) {
 	var payload PaymentProcessed
 
 	if err := json.Unmarshal(evn.Payload, &payload); err != nil {
@@ -32,6 +59,11 @@ func NewPaymentProcessedEvent(evn event.Envelope, status string, pspRef *string)
 	payload.EventType = string(event.PaymentProcessedEvent)
 	payload.Status = status
 	payload.PSPRef = pspRef
+	payload.NextAction = next
+	payload.EventID = eventID // ключ дедупликации у потребителей
+	if eventID == "" {
+		payload.EventID = uuid.NewString()
+	}
 	payload.OccurredAt = time.Now().UTC().Format(time.RFC3339Nano)
 
 	value, err := json.Marshal(payload)
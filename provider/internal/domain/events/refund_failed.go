@@ -0,0 +1,49 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+	"github.com/google/uuid"
+)
+
+type RefundFailed struct {
+	EventID      string `json:"event_id"`
+	EventType    string `json:"event_type"`
+	EventVersion int    `json:"event_version"`
+	RefundID     string `json:"refund_id"`
+	PaymentID    string `json:"payment_id"`
+	MerchantID   string `json:"merchant_id"`
+	Amount       string `json:"amount"`
+	Currency     string `json:"currency"`
+	OccurredAt   string `json:"occurred_at"`
+	ErrorDetails string `json:"error_details"`
+}
+
+// Конструктор события из refund.created
+func NewRefundFailedEvent(evn event.Envelope, errDetails error) (event.Envelope, error) {
+	var payload RefundFailed
+
+	if err := json.Unmarshal(evn.Payload, &payload); err != nil {
+		return event.Envelope{}, fmt.Errorf("invalid JSON err:%v", err)
+	}
+
+	payload.EventType = string(event.RefundFailedEvent)
+	payload.EventID = uuid.NewString() // ключ дедупликации у потребителей
+	payload.OccurredAt = time.Now().UTC().Format(time.RFC3339Nano)
+	payload.ErrorDetails = errDetails.Error()
+
+	value, err := json.Marshal(payload)
+	if err != nil {
+		return event.Envelope{}, err
+	}
+
+	return event.Envelope{
+		Type:    event.RefundFailedEvent,
+		Key:     payload.PaymentID, // партиционирование по payment_id
+		Payload: value,
+		Headers: evn.Headers,
+	}, nil
+}
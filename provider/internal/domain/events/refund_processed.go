@@ -0,0 +1,54 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+	"github.com/google/uuid"
+)
+
+type RefundProcessed struct {
+	EventID      string  `json:"event_id"`
+	EventType    string  `json:"event_type"`
+	EventVersion int     `json:"event_version"`
+	RefundID     string  `json:"refund_id"`
+	PaymentID    string  `json:"payment_id"`
+	MerchantID   string  `json:"merchant_id"`
+	Amount       string  `json:"amount"`
+	Currency     string  `json:"currency"`
+	Status       string  `json:"status"`
+	PSPRef       *string `json:"psp_reference"`
+	OccurredAt   string  `json:"occurred_at"`
+}
+
+// Конструктор события из refund.created, eventID пустой — новый
+func NewRefundProcessedEvent(evn event.Envelope, status string, pspRef *string, eventID string) (event.Envelope, error) {
+	var payload RefundProcessed
+
+	if err := json.Unmarshal(evn.Payload, &payload); err != nil {
+		return event.Envelope{}, fmt.Errorf("invalid JSON err:%v", err)
+	}
+
+	payload.EventType = string(event.RefundProcessedEvent)
+	payload.EventID = eventID // ключ дедупликации у потребителей
+	if eventID == "" {
+		payload.EventID = uuid.NewString()
+	}
+	payload.Status = status
+	payload.PSPRef = pspRef
+	payload.OccurredAt = time.Now().UTC().Format(time.RFC3339Nano)
+
+	value, err := json.Marshal(payload)
+	if err != nil {
+		return event.Envelope{}, err
+	}
+
+	return event.Envelope{
+		Type:    event.RefundProcessedEvent,
+		Key:     payload.PaymentID, // партиционирование по payment_id
+		Payload: value,
+		Headers: evn.Headers,
+	}, nil
+}
@@ -0,0 +1,34 @@
+package outbox
+
+import (
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+)
+
+type Status string
+
+const (
+	StatusNew        Status = "NEW"
+	StatusInProgress Status = "IN_PROGRESS"
+	StatusSent       Status = "SENT"
+	StatusFailed     Status = "FAILED" // ждёт следующей попытки
+	StatusDead       Status = "DEAD"   // попытки исчерпаны, воркер его больше не берёт
+)
+
+// Message — событие, взятое воркером в отправку
+type Message struct {
+	ID       int64
+	Attempt  int // сколько попыток уже было до этой
+	Envelope event.Envelope
+	// строку не удалось разобрать в Envelope: повтор не поможет, сразу DEAD
+	DecodeErr error
+}
+
+// Failure — итог неудачной отправки. NextAttemptAt == nil — событие уходит в DEAD
+type Failure struct {
+	ID            int64
+	Attempt       int
+	Error         string
+	NextAttemptAt *time.Time
+}
@@ -0,0 +1,33 @@
+package payment
+
+import (
+	"errors"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+)
+
+// Состояния отложенной авторизации
+const (
+	PendingWaiting   = "PENDING"   // ждём webhook от PSP
+	PendingCompleted = "COMPLETED" // итог пришёл, payments.processed в outbox
+	PendingExpired   = "EXPIRED"   // webhook не пришёл до Deadline, payments.failed в outbox
+)
+
+var (
+	ErrPendingNotFound = errors.New("pending payment not found")
+	// итог уже зафиксирован: повторный или опоздавший webhook
+	ErrPendingResolved = errors.New("pending payment already resolved")
+	ErrInvalidCallback = errors.New("invalid psp callback")
+)
+
+// PendingAuthorization — авторизация, на которую PSP ответил PENDING.
+// Command — исходная команда payment.created: из неё строится событие-итог
+type PendingAuthorization struct {
+	PaymentID string
+	PSP       string
+	PSPRef    *string
+	Status    string
+	Command   event.Envelope
+	Deadline  time.Time
+}
@@ -0,0 +1,20 @@
+package psp
+
+// Сетевые сбои, которые эквайер отыгрывает на уровне HTTP, не вызывая операцию
+const (
+	FaultTimeout     = "timeout"          // запрос висит до таймаута клиента
+	FaultServerError = "server_error"     // ответ 500
+	FaultReset       = "connection_reset" // соединение рвётся без ответа
+)
+
+// Acquirer — адаптер, за которым стоит эквайер с решениями по ключу
+// идемпотентности: он отвечает на HTTP API fakepsp
+type Acquirer interface {
+	Adapter
+	// Fault — сбой, заданный для запроса, пусто — без сбоя
+	Fault(operation string, req Request) string
+	// Lookup — запомненное решение, ok=false — запроса с таким ключом не было
+	Lookup(operation, idemKey string) (Result, bool, error)
+	// Settle — итог PENDING-операции, ok=false — такой операции нет
+	Settle(operation, idemKey string) (Result, bool, error)
+}
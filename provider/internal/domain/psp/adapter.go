@@ -0,0 +1,63 @@
+package psp
+
+import (
+	"context"
+
+	"github.com/shopspring/decimal"
+)
+
+// Статусы успешных операций PSP. Отказ приходит ошибкой (см. errors.go)
+const (
+	StatusAuthorized = "AUTHORIZED"
+	StatusCaptured   = "CAPTURED"
+	StatusRefunded   = "REFUNDED"
+	StatusVoided     = "VOIDED"
+	// StatusPending — PSP принял авторизацию, итог пришлёт webhook'ом (3DS,
+	// банковский перевод). Поддерживается только для авторизации
+	StatusPending = "PENDING"
+	// StatusRequiresAction — банк требует challenge покупателя (3DS): итог
+	// авторизации даёт Confirm после его прохождения
+	StatusRequiresAction = "REQUIRES_ACTION"
+)
+
+// Request — операция над платежом. IdempotencyKey: payment_id, для capture/void —
+// event_id команды, для возврата — refund_id; повтор с тем же ключом не должен
+// проводить деньги второй раз
+type Request struct {
+	IdempotencyKey string
+	PaymentID      string
+	RefundID       string
+	MerchantID     string
+	Amount         decimal.Decimal
+	Currency       string
+	MethodToken    string  // только для авторизации
+	PSPRef         *string // ссылка авторизации для capture/void/refund
+	// PSP, авторизовавший платёж: capture/void/refund/confirm идут только к нему.
+	// Для авторизации пусто — выбирает маршрутизатор
+	PSP         string
+	ChallengeID string // только для Confirm
+}
+
+type Result struct {
+	Status     string
+	PSPRef     *string
+	PSP        string      // имя адаптера, проведшего операцию
+	NextAction *NextAction // для StatusRequiresAction
+}
+
+// NextAction — challenge, который покупатель проходит по RedirectURL
+type NextAction struct {
+	RedirectURL string
+	ChallengeID string
+}
+
+// Adapter — интеграция с одним PSP
+type Adapter interface {
+	Name() string
+	Authorize(ctx context.Context, req Request) (Result, error)
+	Capture(ctx context.Context, req Request) (Result, error)
+	Refund(ctx context.Context, req Request) (Result, error)
+	Void(ctx context.Context, req Request) (Result, error)
+	// Confirm завершает авторизацию, ответившую StatusRequiresAction
+	Confirm(ctx context.Context, req Request) (Result, error)
+}
@@ -0,0 +1,46 @@
+package psp
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Виды ошибок PSP, проверяются через errors.Is
+var (
+	ErrHardDecline = errors.New("hard decline") // окончательный отказ, повтор не поможет
+	ErrSoftDecline = errors.New("soft decline") // отказ, повтор позже может пройти
+	ErrTimeout     = errors.New("psp timeout")  // запрос ушёл, исход неизвестен
+	ErrUnavailable = errors.New("psp unavailable")
+)
+
+// Error — ошибка адаптера: Kind — один из видов выше, Code — код PSP, если есть
+type Error struct {
+	Kind   error
+	PSP    string
+	Code   string
+	Reason string
+}
+
+func NewError(kind error, psp, code, reason string) *Error {
+	return &Error{Kind: kind, PSP: psp, Code: code, Reason: reason}
+}
+
+func (e *Error) Error() string {
+	msg := fmt.Sprintf("%s: %v", e.PSP, e.Kind)
+	if e.Code != "" {
+		msg += " code=" + e.Code
+	}
+	if e.Reason != "" {
+		msg += ": " + e.Reason
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Kind
+}
+
+// IsDecline — PSP ответил отказом, это исход операции, а не сбой
+func IsDecline(err error) bool {
+	return errors.Is(err, ErrHardDecline) || errors.Is(err, ErrSoftDecline)
+}
@@ -0,0 +1,21 @@
+package retry
+
+import "github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+
+type Status string
+
+const (
+	StatusReady      Status = "READY" // ждёт next_attempt_at
+	StatusInProgress Status = "IN_PROGRESS"
+	StatusDone       Status = "DONE"
+	StatusDead       Status = "DEAD" // попытки исчерпаны или ошибка не повторяемая, *.failed в outbox, если исход известен
+)
+
+// Command — команда из Kafka, взятая воркером повторов
+type Command struct {
+	ID       int64
+	Attempt  int // сколько попыток уже было до этой
+	Envelope event.Envelope
+	// строку не удалось разобрать в Envelope: повтор не поможет, сразу DEAD
+	DecodeErr error
+}
@@ -14,6 +14,7 @@ import (
 
 type consumer struct {
 	logPrefix     string
+	cfg           config.KafkaConsumer
 	cons          *kafka.Reader
 	readMsgChan   chan kafka.Message
 	commitMsgChan chan kafka.Message
@@ -22,10 +23,14 @@ type consumer struct {
 func newConsumer(cfg config.Kafka, logPrefix string) *consumer {
 	return &consumer{
 		logPrefix: logPrefix,
+		cfg:       cfg.Consumer,
 		cons: kafka.NewReader(kafka.ReaderConfig{
 			Brokers: cfg.Brokers,
 			GroupID: cfg.Consumer.GroupID,
-			Topic:   cfg.Consumer.PaymentsInitiatedTopic,
+			GroupTopics: []string{
+				cfg.Consumer.PaymentsInitiatedTopic,
+				cfg.Consumer.RefundsInitiatedTopic,
+			},
 		}),
 		readMsgChan:   make(chan kafka.Message, 1),
 		commitMsgChan: make(chan kafka.Message, 1),
@@ -7,6 +7,7 @@ import (
 
 func (p *Producer) toKafkaMessage(evt event.Envelope) kafka.Message {
 	evt.Headers["client-id"] = p.cfg.ClientID
+	evt.Headers[event.TypeHeader] = string(evt.Type)
 	headers := make([]kafka.Header, 0, len(evt.Headers))
 	for k, v := range evt.Headers {
 		headers = append(headers, kafka.Header{Key: k, Value: []byte(v)})
@@ -14,10 +15,14 @@ func (p *Producer) toKafkaMessage(evt event.Envelope) kafka.Message {
 
 	var topic string
 	switch evt.Type {
-	case event.PaymentProcessedEvent:
+	case event.PaymentProcessedEvent, event.PaymentCapturedEvent, event.PaymentVoidedEvent:
 		topic = p.cfg.PaymentsProcessedTopic
-	case event.PaymentFailedEvent:
+	case event.PaymentFailedEvent, event.PaymentCaptureFailedEvent, event.PaymentVoidFailedEvent:
 		topic = p.cfg.PaymentsFailedTopic
+	case event.RefundProcessedEvent:
+		topic = p.cfg.RefundsProcessedTopic
+	case event.RefundFailedEvent:
+		topic = p.cfg.RefundsFailedTopic
 	}
 
 	return kafka.Message{
@@ -35,8 +40,19 @@ func (c *consumer) toEvent(msg kafka.Message) event.Envelope {
 		headers[msgHeader.Key] = string(msgHeader.Value)
 	}
 
+	var evnType event.EnvelopeType
+	switch msg.Topic {
+	case c.cfg.PaymentsInitiatedTopic:
+		evnType = event.PaymentCreatedEvent
+	case c.cfg.RefundsInitiatedTopic:
+		evnType = event.RefundCreatedEvent
+	}
+	if t, err := event.StringToType(headers[event.TypeHeader]); err == nil {
+		evnType = t
+	}
+
 	return event.Envelope{
-		Type:    event.PaymentCreatedEvent,
+		Type:    evnType,
 		Payload: msg.Value,
 		Headers: headers,
 		Key:     string(msg.Key),
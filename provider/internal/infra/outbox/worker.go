@@ -0,0 +1,292 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"log"
+	"math/rand/v2"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/events"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/outbox"
+	"github.com/google/uuid"
+)
+
+type Repository interface {
+	// PickBatch отдаёт готовые к отправке события, не больше одного на key.
+	// Взятые события помечаются workerID
+	PickBatch(ctx context.Context, count int, workerID string) ([]outbox.Message, error)
+	MarkSent(ctx context.Context, ids []int64) error
+	MarkFailed(ctx context.Context, failures []outbox.Failure) error
+	// ResetEvents забирает IN_PROGRESS-события воркеров без heartbeat дольше ownerTTL
+	// и собственные, не закрытые дольше reclaimAfter
+	ResetEvents(ctx context.Context, workerID string, ownerTTL, reclaimAfter time.Duration) ([]outbox.Message, error)
+	Heartbeat(ctx context.Context, workerID string) error
+	PruneWorkers(ctx context.Context, olderThan time.Duration) (int64, error)
+	Deregister(ctx context.Context, workerID string) error
+}
+
+// Worker — relay: отправляет в Kafka события, записанные в outbox вместе с решением PSP.
+// Работает на всех инстансах, их разводит SKIP LOCKED
+type Worker struct {
+	id   string
+	repo Repository
+	pub  events.Publisher
+	cfg  config.Outbox
+}
+
+func New(cfg config.Outbox, pub events.Publisher, repo Repository) *Worker {
+	id := cfg.WorkerID
+	if id == "" {
+		id = defaultWorkerID()
+	}
+	return &Worker{
+		id:   id,
+		cfg:  cfg,
+		pub:  pub,
+		repo: repo,
+	}
+}
+
+func (w *Worker) Run(ctx context.Context) {
+	// heartbeat до первой выборки: иначе соседи сочтут наши строки брошенными
+	w.heartbeat(ctx)
+
+	// heartbeat — своей горутиной: пока poll разбирает длинную очередь,
+	// соседи не должны счесть воркер упавшим и забрать его строки
+	heartbeatDone := make(chan struct{})
+	go func() {
+		defer close(heartbeatDone)
+		w.runHeartbeat(ctx)
+	}()
+
+	tickerPoll := time.NewTicker(w.cfg.PollInterval)
+	tickerReset := time.NewTicker(w.cfg.ResetEventsInterval)
+	defer func() {
+		tickerPoll.Stop()
+		tickerReset.Stop()
+	}()
+
+	wake := make(chan struct{}, 1)
+
+	for {
+		select {
+		case <-tickerPoll.C:
+			w.poll(ctx, wake)
+		case <-wake:
+			w.poll(ctx, wake)
+		case <-tickerReset.C:
+			ctxReset, cancel := context.WithTimeout(ctx, w.cfg.ResetEventsTimeout)
+
+			w.resetStuck(ctxReset)
+
+			cancel()
+		case <-ctx.Done():
+			// после последнего heartbeat, иначе он вернёт запись о воркере
+			<-heartbeatDone
+			w.stop()
+			log.Println("Outbox worker closed...")
+			return
+		}
+	}
+}
+
+func (w *Worker) runHeartbeat(ctx context.Context) {
+	ticker := time.NewTicker(w.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			w.heartbeat(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// heartbeat отмечает воркер живым и удаляет записи давно упавших соседей
+func (w *Worker) heartbeat(ctx context.Context) {
+	ctx, cancel := context.WithTimeout(ctx, w.cfg.HeartbeatInterval)
+	defer cancel()
+
+	if err := w.repo.Heartbeat(ctx, w.id); err != nil {
+		log.Printf("outbox: heartbeat error:%v", err)
+	}
+
+	if w.cfg.WorkerRetention <= 0 {
+		return
+	}
+	n, err := w.repo.PruneWorkers(ctx, w.cfg.WorkerRetention)
+	if err != nil {
+		log.Printf("outbox: prune workers error:%v", err)
+		return
+	}
+	if n > 0 {
+		log.Printf("outbox: pruned %d stale workers", n)
+	}
+}
+
+func (w *Worker) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	if err := w.repo.Deregister(ctx, w.id); err != nil {
+		log.Printf("outbox: deregister error:%v", err)
+	}
+}
+
+func defaultWorkerID() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "provider"
+	}
+	return host + "-" + uuid.NewString()[:8]
+}
+
+// poll выбирает очередь, пока она не опустеет: следующее событие key
+// становится доступно только после отправки текущего. Не дольше PollInterval:
+// остаток разберёт следующий проход через wake, а Run успеет к сбросу и остановке
+func (w *Worker) poll(ctx context.Context, wake chan struct{}) {
+	deadline := time.Now().Add(w.cfg.PollInterval)
+	for ctx.Err() == nil {
+		pollCtx, cancel := context.WithTimeout(ctx, w.cfg.PollTimeout)
+		n := w.PollBatch(pollCtx)
+		cancel()
+
+		if n == 0 {
+			return
+		}
+		if time.Now().After(deadline) {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+			return
+		}
+	}
+}
+
+// PollBatch отправляет одну пачку, возвращает сколько событий взято
+func (w *Worker) PollBatch(ctx context.Context) int {
+	msgs, err := w.repo.PickBatch(ctx, w.cfg.BatchSize, w.id)
+	if err != nil {
+		log.Printf("outbox: error pick batch:%v", err)
+		return 0
+	}
+
+	if len(msgs) == 0 {
+		return 0
+	}
+
+	var (
+		mu     sync.Mutex
+		sent   = make([]int64, 0, len(msgs))
+		failed = make([]outbox.Failure, 0)
+		wg     sync.WaitGroup
+	)
+
+	semaphore := make(chan struct{}, w.cfg.MaxParallel)
+
+	for _, msg := range msgs {
+		wg.Add(1)
+		go func(msg outbox.Message) {
+			defer wg.Done()
+
+			select {
+			case semaphore <- struct{}{}:
+				// заняли
+			case <-ctx.Done():
+				return
+			}
+			defer func() { <-semaphore }() // освободить
+
+			err := msg.DecodeErr
+			if err == nil {
+				err = w.pub.Publish(ctx, msg.Envelope)
+			}
+			if err != nil {
+				log.Printf("outbox: kafka: publish failed key=%s, event_id=%d attempt=%d error:%v",
+					msg.Envelope.Key, msg.ID, msg.Attempt+1, err)
+				mu.Lock()
+				failed = append(failed, w.failure(msg, err))
+				mu.Unlock()
+				return
+			}
+			mu.Lock()
+			sent = append(sent, msg.ID)
+			mu.Unlock()
+			log.Printf("outbox: kafka: published %s key=%s, event_id=%d", msg.Envelope.Type, msg.Envelope.Key, msg.ID)
+		}(msg)
+	}
+
+	wg.Wait()
+
+	if len(sent) > 0 {
+		if err := w.repo.MarkSent(ctx, sent); err != nil {
+			log.Printf("outbox: error update sent:%v", err)
+		}
+	}
+
+	w.markFailed(ctx, failed)
+
+	return len(msgs)
+}
+
+// resetStuck засчитывает зависшим в IN_PROGRESS событиям неудачную попытку
+func (w *Worker) resetStuck(ctx context.Context) {
+	msgs, err := w.repo.ResetEvents(ctx, w.id, w.cfg.OwnerTTL, w.cfg.ReclaimAfter)
+	if err != nil {
+		log.Printf("outbox: error while reset events:%v", err)
+		return
+	}
+
+	failed := make([]outbox.Failure, 0, len(msgs))
+	for _, msg := range msgs {
+		failed = append(failed, w.failure(msg, errors.New("publish result lost: stuck in progress")))
+	}
+	w.markFailed(ctx, failed)
+}
+
+func (w *Worker) markFailed(ctx context.Context, failed []outbox.Failure) {
+	if len(failed) == 0 {
+		return
+	}
+
+	if err := w.repo.MarkFailed(ctx, failed); err != nil {
+		log.Printf("outbox: error update failed:%v", err)
+		return
+	}
+
+	for _, f := range failed {
+		if f.NextAttemptAt == nil {
+			log.Printf("outbox: event_id=%d dead after %d attempts, last error:%s", f.ID, f.Attempt, f.Error)
+		}
+	}
+}
+
+// failure: без DecodeErr и пока не исчерпан MaxAttempts — повтор через backoff, иначе DEAD
+func (w *Worker) failure(msg outbox.Message, err error) outbox.Failure {
+	f := outbox.Failure{ID: msg.ID, Attempt: msg.Attempt + 1, Error: err.Error()}
+	if msg.DecodeErr == nil && (w.cfg.MaxAttempts <= 0 || f.Attempt < w.cfg.MaxAttempts) {
+		next := time.Now().Add(w.backoff(f.Attempt))
+		f.NextAttemptAt = &next
+	}
+	return f
+}
+
+// backoff: BackoffBase * 2^(attempt-1), не больше BackoffMax, минус случайная доля BackoffJitter
+func (w *Worker) backoff(attempt int) time.Duration {
+	d := w.cfg.BackoffBase
+	for i := 1; i < attempt && d < w.cfg.BackoffMax; i++ {
+		d *= 2
+	}
+	d = min(d, w.cfg.BackoffMax)
+	if w.cfg.BackoffJitter > 0 {
+		d -= time.Duration(rand.Float64() * min(w.cfg.BackoffJitter, 1) * float64(d))
+	}
+	return d
+}
@@ -0,0 +1,242 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/outbox"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+)
+
+// fakeRepo отдаёт заранее заданные события и запоминает вызовы
+type fakeRepo struct {
+	mu sync.Mutex
+	// endless — PickBatch всегда отдаёт событие: очередь не кончается
+	endless    bool
+	batches    [][]outbox.Message
+	stuck      []outbox.Message
+	sent       []int64
+	failed     []outbox.Failure
+	pickedBy   []string
+	resetArgs  []any
+	heartbeats int
+	pruned     int
+	calls      []string
+}
+
+func (r *fakeRepo) PickBatch(ctx context.Context, count int, workerID string) ([]outbox.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pickedBy = append(r.pickedBy, workerID)
+	if r.endless {
+		return []outbox.Message{newMessage(int64(len(r.sent)+1), "pay_1", 0)}, nil
+	}
+	if len(r.batches) == 0 {
+		return nil, nil
+	}
+	batch := r.batches[0]
+	r.batches = r.batches[1:]
+	return batch, nil
+}
+
+func (r *fakeRepo) MarkSent(ctx context.Context, ids []int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sent = append(r.sent, ids...)
+	return nil
+}
+
+func (r *fakeRepo) MarkFailed(ctx context.Context, failures []outbox.Failure) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failed = append(r.failed, failures...)
+	return nil
+}
+
+func (r *fakeRepo) ResetEvents(ctx context.Context, workerID string, ownerTTL, reclaimAfter time.Duration) ([]outbox.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.resetArgs = []any{workerID, ownerTTL, reclaimAfter}
+	stuck := r.stuck
+	r.stuck = nil
+	return stuck, nil
+}
+
+func (r *fakeRepo) Heartbeat(ctx context.Context, workerID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.heartbeats++
+	r.calls = append(r.calls, "heartbeat")
+	return nil
+}
+
+func (r *fakeRepo) PruneWorkers(ctx context.Context, olderThan time.Duration) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pruned++
+	return 0, nil
+}
+
+func (r *fakeRepo) Deregister(ctx context.Context, workerID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, "deregister")
+	return nil
+}
+
+func (r *fakeRepo) heartbeatCount() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.heartbeats
+}
+
+// fakePublisher падает на событиях с key из fail
+type fakePublisher struct {
+	mu   sync.Mutex
+	fail map[string]bool
+}
+
+func (p *fakePublisher) Publish(ctx context.Context, evn event.Envelope) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.fail[evn.Key] {
+		return errors.New("broker unavailable")
+	}
+	return nil
+}
+
+func newMessage(id int64, key string, attempt int) outbox.Message {
+	return outbox.Message{ID: id, Attempt: attempt, Envelope: event.Envelope{Key: key, Payload: []byte(`{}`)}}
+}
+
+func testConfig() config.Outbox {
+	return config.Outbox{
+		PollInterval:        10 * time.Millisecond,
+		PollTimeout:         time.Second,
+		BatchSize:           10,
+		ResetEventsInterval: time.Hour,
+		ResetEventsTimeout:  time.Second,
+		MaxParallel:         2,
+		MaxAttempts:         3,
+		BackoffBase:         time.Second,
+		BackoffMax:          time.Minute,
+		WorkerID:            "w_test",
+		HeartbeatInterval:   5 * time.Millisecond,
+		OwnerTTL:            30 * time.Second,
+		ReclaimAfter:        5 * time.Minute,
+		WorkerRetention:     time.Hour,
+	}
+}
+
+func TestPollBatchMarksSentAndFailed(t *testing.T) {
+	repo := &fakeRepo{batches: [][]outbox.Message{{
+		newMessage(1, "pay_1", 0),
+		newMessage(2, "pay_2", 0),
+		newMessage(3, "pay_3", 2), // третья попытка из трёх
+	}}}
+	pub := &fakePublisher{fail: map[string]bool{"pay_2": true, "pay_3": true}}
+	w := New(testConfig(), pub, repo)
+
+	if n := w.PollBatch(context.Background()); n != 3 {
+		t.Fatalf("PollBatch = %d, want 3", n)
+	}
+
+	if repo.pickedBy[0] != "w_test" {
+		t.Fatalf("batch picked by %q", repo.pickedBy[0])
+	}
+	if len(repo.sent) != 1 || repo.sent[0] != 1 {
+		t.Fatalf("sent = %v", repo.sent)
+	}
+	failed := map[int64]outbox.Failure{}
+	for _, f := range repo.failed {
+		failed[f.ID] = f
+	}
+	if f := failed[2]; f.Attempt != 1 || f.NextAttemptAt == nil {
+		t.Fatalf("failed event not rescheduled: %+v", f)
+	}
+	if f := failed[3]; f.Attempt != 3 || f.NextAttemptAt != nil {
+		t.Fatalf("event with exhausted attempts not dead: %+v", f)
+	}
+}
+
+// Длинная очередь не задерживает heartbeat: иначе соседи сочтут воркер
+// упавшим и заберут его строки
+func TestHeartbeatNotStarvedByPoll(t *testing.T) {
+	repo := &fakeRepo{endless: true}
+	w := New(testConfig(), &fakePublisher{}, repo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.Run(ctx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("worker did not stop while draining the queue")
+	}
+
+	if n := repo.heartbeatCount(); n < 5 {
+		t.Fatalf("only %d heartbeats while draining", n)
+	}
+	if repo.pruned == 0 {
+		t.Fatal("stale workers never pruned")
+	}
+	if calls := repo.calls; calls[len(calls)-1] != "deregister" {
+		t.Fatalf("heartbeat after deregister: %v", calls[len(calls)-3:])
+	}
+}
+
+func TestPollBoundedByInterval(t *testing.T) {
+	repo := &fakeRepo{endless: true}
+	w := New(testConfig(), &fakePublisher{}, repo)
+
+	wake := make(chan struct{}, 1)
+	start := time.Now()
+	w.poll(context.Background(), wake)
+
+	if time.Since(start) > time.Second {
+		t.Fatal("poll drained endless queue without a bound")
+	}
+	select {
+	case <-wake:
+	default:
+		t.Fatal("rest of the queue not scheduled")
+	}
+}
+
+func TestResetStuckCountsAttempt(t *testing.T) {
+	repo := &fakeRepo{stuck: []outbox.Message{
+		newMessage(1, "pay_1", 0),
+		newMessage(2, "pay_2", 2),
+		{ID: 3, DecodeErr: errors.New("bad headers")},
+	}}
+	cfg := testConfig()
+	w := New(cfg, &fakePublisher{}, repo)
+
+	w.resetStuck(context.Background())
+
+	if repo.resetArgs[0] != cfg.WorkerID || repo.resetArgs[1] != cfg.OwnerTTL || repo.resetArgs[2] != cfg.ReclaimAfter {
+		t.Fatalf("reset called with %v", repo.resetArgs)
+	}
+	if len(repo.failed) != 3 {
+		t.Fatalf("expected 3 failures, got %d", len(repo.failed))
+	}
+	if f := repo.failed[0]; f.Attempt != 1 || f.NextAttemptAt == nil {
+		t.Fatalf("stuck event not rescheduled: %+v", f)
+	}
+	if f := repo.failed[1]; f.Attempt != 3 || f.NextAttemptAt != nil {
+		t.Fatalf("stuck event with exhausted attempts not dead: %+v", f)
+	}
+	if f := repo.failed[2]; f.NextAttemptAt != nil {
+		t.Fatalf("undecodable event not dead: %+v", f)
+	}
+}
@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS provider.processed_refunds (
+  refund_id     TEXT PRIMARY KEY,
+  payment_id    TEXT NOT NULL,
+  processed_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  status        TEXT NOT NULL,                  -- REFUNDED | DECLINED
+  psp_reference TEXT NULL
+);
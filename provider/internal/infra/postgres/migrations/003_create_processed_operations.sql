@@ -0,0 +1,10 @@
+-- результаты capture/void по авторизованным платежам
+CREATE TABLE IF NOT EXISTS provider.processed_operations (
+  payment_id    TEXT NOT NULL,
+  operation     TEXT NOT NULL,                  -- capture | void
+  processed_at  TIMESTAMPTZ NOT NULL DEFAULT now(),
+  status        TEXT NOT NULL,                  -- CAPTURED | VOIDED | DECLINED
+  amount        TEXT NOT NULL,
+  psp_reference TEXT NULL,
+  PRIMARY KEY (payment_id, operation)
+);
@@ -0,0 +1,28 @@
+-- transactional outbox: результат решения PSP пишется в одной транзакции
+-- с processed-строкой, в Kafka его отправляет relay-воркер
+CREATE TABLE IF NOT EXISTS provider.outbox_events (
+    id              BIGSERIAL PRIMARY KEY,
+    event_type      TEXT        NOT NULL,                 -- "payments.processed"
+    key             TEXT        NOT NULL,                 -- партиционирование (payment_id)
+    payload         JSONB       NOT NULL,
+    headers         JSONB       NOT NULL DEFAULT '{}'::jsonb,
+    status          TEXT        NOT NULL DEFAULT 'NEW',   -- NEW|IN_PROGRESS|SENT|FAILED|DEAD
+    attempt         INT         NOT NULL DEFAULT 0,
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error      TEXT        NULL,
+    locked_by       TEXT        NULL,                     -- воркер, взявший IN_PROGRESS-событие
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS outbox_status_idx ON provider.outbox_events (status, next_attempt_at);
+CREATE INDEX IF NOT EXISTS outbox_key_pending_idx ON provider.outbox_events (key, id) WHERE status <> 'SENT';
+CREATE INDEX IF NOT EXISTS outbox_in_progress_idx ON provider.outbox_events (locked_by) WHERE status = 'IN_PROGRESS';
+
+-- heartbeat воркеров: сбрасываются только IN_PROGRESS-строки воркеров,
+-- переставших отмечаться
+CREATE TABLE IF NOT EXISTS provider.outbox_workers (
+    worker_id    TEXT        PRIMARY KEY,
+    started_at   TIMESTAMPTZ NOT NULL DEFAULT now(),
+    heartbeat_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,21 @@
+-- id отправленного события-результата: при повторной доставке команды
+-- сохранённое решение уходит с тем же event_id и дедуплицируется у потребителей
+ALTER TABLE provider.processed_events ADD COLUMN IF NOT EXISTS event_id TEXT NULL;
+ALTER TABLE provider.processed_refunds ADD COLUMN IF NOT EXISTS event_id TEXT NULL;
+ALTER TABLE provider.processed_operations ADD COLUMN IF NOT EXISTS event_id TEXT NULL;
+
+-- результат capture/void хранится по event_id команды: capture после отказа —
+-- новая команда и новая операция у PSP, а не повтор сохранённого отказа
+ALTER TABLE provider.processed_operations ADD COLUMN IF NOT EXISTS command_id TEXT NULL;
+
+-- у старых строк event_id команды не сохранялся
+UPDATE provider.processed_operations
+SET command_id = payment_id || ':' || operation
+WHERE command_id IS NULL;
+
+ALTER TABLE provider.processed_operations ALTER COLUMN command_id SET NOT NULL;
+ALTER TABLE provider.processed_operations DROP CONSTRAINT IF EXISTS processed_operations_pkey;
+ALTER TABLE provider.processed_operations ADD PRIMARY KEY (command_id);
+
+CREATE INDEX IF NOT EXISTS processed_operations_payment_idx
+  ON provider.processed_operations (payment_id, operation);
@@ -0,0 +1,2 @@
+-- PSP, авторизовавший платёж: capture/void/refund маршрутизируются к нему
+ALTER TABLE provider.processed_events ADD COLUMN IF NOT EXISTS psp TEXT NULL;
@@ -0,0 +1,19 @@
+-- авторизации, на которые PSP ответил PENDING: итог придёт webhook'ом,
+-- не пришёл до deadline — платёж проваливается
+CREATE TABLE IF NOT EXISTS provider.pending_payments (
+  payment_id    TEXT PRIMARY KEY,
+  psp           TEXT NOT NULL,
+  psp_reference TEXT NULL,
+  status        TEXT NOT NULL DEFAULT 'PENDING', -- PENDING | COMPLETED | EXPIRED
+  event_type    TEXT NOT NULL,                   -- исходная команда
+  key           TEXT NOT NULL,
+  payload       JSONB NOT NULL,
+  headers       JSONB NOT NULL DEFAULT '{}'::jsonb,
+  deadline      TIMESTAMPTZ NOT NULL,
+  created_at    TIMESTAMPTZ NOT NULL DEFAULT now(),
+  updated_at    TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS pending_payments_deadline_idx
+  ON provider.pending_payments (deadline)
+  WHERE status = 'PENDING';
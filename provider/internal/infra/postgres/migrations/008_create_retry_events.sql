@@ -0,0 +1,26 @@
+-- очередь повторов: команда из Kafka, обработка которой упала с повторяемой
+-- ошибкой, ждёт здесь, а партиция обрабатывается дальше
+CREATE TABLE IF NOT EXISTS provider.retry_events (
+    id              BIGSERIAL PRIMARY KEY,
+    event_type      TEXT        NOT NULL,                 -- исходная команда
+    key             TEXT        NOT NULL,                 -- payment_id: порядок команд одного платежа
+    payload         JSONB       NOT NULL,
+    headers         JSONB       NOT NULL DEFAULT '{}'::jsonb,
+    status          TEXT        NOT NULL DEFAULT 'READY', -- READY|IN_PROGRESS|DONE|DEAD
+    attempt         INT         NOT NULL DEFAULT 0,       -- сколько попыток уже было
+    next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_error      TEXT        NULL,
+    created_at      TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at      TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS retry_events_due_idx
+  ON provider.retry_events (next_attempt_at)
+  WHERE status IN ('READY','IN_PROGRESS');
+CREATE INDEX IF NOT EXISTS retry_events_key_idx
+  ON provider.retry_events (key, id)
+  WHERE status IN ('READY','IN_PROGRESS');
+-- обработанные команды удаляются по retry.retain_done
+CREATE INDEX IF NOT EXISTS retry_events_done_idx
+  ON provider.retry_events (updated_at)
+  WHERE status = 'DONE';
@@ -0,0 +1,217 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/outbox"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// PickBatch: статус NEW/FAILED, время пришло, отметим IN_PROGRESS за воркером $2
+// и вернём. Берётся только голова каждого key, чтобы результаты одного платежа
+// уходили в Kafka по порядку. DEAD держит очередь key, пока его не вернут вручную
+const pickSQL = `
+WITH cte AS (
+  SELECT o.id
+  FROM provider.outbox_events o
+  WHERE o.status IN ('NEW','FAILED') AND o.next_attempt_at <= now()
+    AND NOT EXISTS (
+      SELECT 1 FROM provider.outbox_events p
+      WHERE p.key = o.key AND p.id < o.id AND p.status <> 'SENT'
+    )
+  ORDER BY o.id
+  FOR UPDATE SKIP LOCKED
+  LIMIT $1
+)
+UPDATE provider.outbox_events o
+SET status='IN_PROGRESS', locked_by=$2, updated_at=now()
+FROM cte
+WHERE o.id = cte.id
+RETURNING o.id, o.attempt, o.event_type, o.key, o.payload, o.headers;
+`
+
+// resetSQL забирает себе ($1) события, зависшие в IN_PROGRESS: их владелец
+// перестал слать heartbeat дольше $2 секунд (упал посреди отправки), либо это
+// собственные строки старше $3 секунд, которые не удалось закрыть после отправки.
+// Воркер засчитает им неудачную попытку. Строки живых чужих воркеров не трогаются
+const resetSQL = `
+UPDATE provider.outbox_events o
+SET locked_by=$1, updated_at=now()
+WHERE o.status = 'IN_PROGRESS' AND (
+	NOT EXISTS (
+	  SELECT 1 FROM provider.outbox_workers w
+	  WHERE w.worker_id = o.locked_by AND w.heartbeat_at > now() - make_interval(secs => $2)
+	)
+	OR (o.locked_by = $1 AND o.updated_at < now() - make_interval(secs => $3))
+)
+RETURNING o.id, o.attempt, o.event_type, o.key, o.payload, o.headers;
+`
+
+type outboxEventRow struct {
+	ID        int64
+	Attempt   int
+	EventType string
+	Key       string
+	Payload   []byte
+	Headers   []byte
+}
+
+// EnqueueEvent кладёт событие в outbox вне решения PSP (например, *.failed)
+func (r *PaymentsRepo) EnqueueEvent(ctx context.Context, env event.Envelope) error {
+	return insertOutboxEvent(ctx, r.pool, env)
+}
+
+func (r *PaymentsRepo) PickBatch(ctx context.Context, count int, workerID string) ([]outbox.Message, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	msgs, err := queryOutboxMessages(ctx, tx, pickSQL, count, workerID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	return msgs, nil
+}
+
+func (r *PaymentsRepo) MarkSent(ctx context.Context, ids []int64) error {
+	_, err := r.pool.Exec(ctx, `
+        UPDATE provider.outbox_events
+        SET status='SENT', last_error = NULL, locked_by = NULL, updated_at=now()
+        WHERE id = ANY($1)
+    `, ids)
+	return err
+}
+
+// MarkFailed: NextAttemptAt == nil переводит событие в DEAD
+func (r *PaymentsRepo) MarkFailed(ctx context.Context, failures []outbox.Failure) error {
+	var (
+		ids      = make([]int64, len(failures))
+		attempts = make([]int32, len(failures))
+		errs     = make([]string, len(failures))
+		next     = make([]*time.Time, len(failures))
+	)
+	for i, f := range failures {
+		ids[i], attempts[i], errs[i], next[i] = f.ID, int32(f.Attempt), f.Error, f.NextAttemptAt
+	}
+
+	_, err := r.pool.Exec(ctx, `
+        UPDATE provider.outbox_events o
+        SET status = CASE WHEN f.next_at IS NULL THEN 'DEAD' ELSE 'FAILED' END,
+            attempt = f.attempt,
+            last_error = f.err,
+            next_attempt_at = COALESCE(f.next_at, o.next_attempt_at),
+            locked_by = NULL,
+            updated_at = now()
+        FROM unnest($1::bigint[], $2::int[], $3::text[], $4::timestamptz[]) AS f(id, attempt, err, next_at)
+        WHERE o.id = f.id
+    `, ids, attempts, errs, next)
+	return err
+}
+
+func (r *PaymentsRepo) ResetEvents(ctx context.Context, workerID string, ownerTTL, reclaimAfter time.Duration) ([]outbox.Message, error) {
+	return queryOutboxMessages(ctx, r.pool, resetSQL, workerID, ownerTTL.Seconds(), reclaimAfter.Seconds())
+}
+
+// Heartbeat отмечает, что воркер жив; его IN_PROGRESS-строки не сбрасываются
+func (r *PaymentsRepo) Heartbeat(ctx context.Context, workerID string) error {
+	_, err := r.pool.Exec(ctx,
+		`INSERT INTO provider.outbox_workers (worker_id) VALUES ($1)
+		 ON CONFLICT (worker_id) DO UPDATE SET heartbeat_at = now()`,
+		workerID)
+	return err
+}
+
+// PruneWorkers удаляет воркеров без heartbeat дольше olderThan: упавшие
+// не успели Deregister. Их строки resetSQL забирает и без записи о воркере
+func (r *PaymentsRepo) PruneWorkers(ctx context.Context, olderThan time.Duration) (int64, error) {
+	res, err := r.pool.Exec(ctx,
+		`DELETE FROM provider.outbox_workers WHERE heartbeat_at < now() - make_interval(secs => $1)`,
+		olderThan.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
+
+// Deregister при остановке: строки воркера сразу можно забирать
+func (r *PaymentsRepo) Deregister(ctx context.Context, workerID string) error {
+	_, err := r.pool.Exec(ctx, `DELETE FROM provider.outbox_workers WHERE worker_id = $1`, workerID)
+	return err
+}
+
+// querier — пул или транзакция
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func insertOutboxEvent(ctx context.Context, q querier, env event.Envelope) error {
+	headers, err := json.Marshal(env.Headers)
+	if err != nil {
+		return fmt.Errorf("invalid event headers, err:%w", err)
+	}
+	_, err = q.Exec(ctx,
+		`INSERT INTO provider.outbox_events (event_type, key, payload, headers)
+		 VALUES ($1,$2,$3,$4)`,
+		string(env.Type), env.Key, env.Payload, headers)
+	return err
+}
+
+func queryOutboxMessages(ctx context.Context, q querier, sql string, args ...any) ([]outbox.Message, error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []outbox.Message
+	for rows.Next() {
+		var row outboxEventRow
+		if err := rows.Scan(&row.ID, &row.Attempt, &row.EventType, &row.Key, &row.Payload, &row.Headers); err != nil {
+			return nil, fmt.Errorf("cant parse row to outboxEventRow, err:%w", err)
+		}
+		// битая строка не должна блокировать остальную пачку
+		env, err := outboxRowToEnvelope(row)
+		if err != nil {
+			err = fmt.Errorf("cant parse outboxEventRow to envelope, err:%w", err)
+		}
+		msgs = append(msgs, outbox.Message{ID: row.ID, Attempt: row.Attempt, Envelope: env, DecodeErr: err})
+	}
+
+	if rows.Err() != nil {
+		return nil, fmt.Errorf("error with rows: %w", rows.Err())
+	}
+
+	return msgs, nil
+}
+
+func outboxRowToEnvelope(row outboxEventRow) (event.Envelope, error) {
+	headers := map[string]string{}
+	if err := json.Unmarshal(row.Headers, &headers); err != nil {
+		return event.Envelope{}, fmt.Errorf("invalid headers, err:%v", err)
+	}
+
+	eventType, err := event.StringToType(row.EventType)
+	if err != nil {
+		return event.Envelope{}, fmt.Errorf("invalid event type, err:%v", err)
+	}
+
+	return event.Envelope{
+		Type:    eventType,
+		Key:     row.Key,
+		Payload: row.Payload,
+		Headers: headers,
+	}, nil
+}
@@ -0,0 +1,142 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/events"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+	"github.com/jackc/pgx/v5"
+)
+
+const pendingColumns = `payment_id, psp, psp_reference, status, event_type, key, payload, headers, deadline`
+
+// InsertPendingPayment запоминает авторизацию, ждущую webhook или confirm, и
+// out (если задан) одной транзакцией. Повторная доставка команды строку не меняет
+func (r *PaymentsRepo) InsertPendingPayment(ctx context.Context, p payment.PendingAuthorization, out *event.Envelope) error {
+	headers, err := json.Marshal(p.Command.Headers)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	res, err := tx.Exec(ctx, `
+		INSERT INTO provider.pending_payments (payment_id, psp, psp_reference, event_type, key, payload, headers, deadline)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8)
+		ON CONFLICT (payment_id) DO NOTHING`,
+		p.PaymentID, p.PSP, p.PSPRef, string(p.Command.Type), p.Command.Key, p.Command.Payload, headers, p.Deadline)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		log.Printf("postgres: duplicate pending payment, payment_id: %s", p.PaymentID)
+		return nil
+	}
+
+	if out != nil {
+		if err := insertOutboxEvent(ctx, tx, *out); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetPendingPayment — отложенная авторизация в любом состоянии, pgx.ErrNoRows — её нет
+func (r *PaymentsRepo) GetPendingPayment(ctx context.Context, paymentID string) (payment.PendingAuthorization, error) {
+	rows, err := r.pool.Query(ctx,
+		`SELECT `+pendingColumns+` FROM provider.pending_payments WHERE payment_id = $1`, paymentID)
+	if err != nil {
+		return payment.PendingAuthorization{}, err
+	}
+	return pgx.CollectExactlyOneRow(rows, scanPending)
+}
+
+// ListExpiredPendingPayments — ждущие webhook дольше deadline, старые первыми
+func (r *PaymentsRepo) ListExpiredPendingPayments(ctx context.Context, limit int) ([]payment.PendingAuthorization, error) {
+	rows, err := r.pool.Query(ctx, `
+		SELECT `+pendingColumns+` FROM provider.pending_payments
+		WHERE status = 'PENDING' AND deadline <= now()
+		ORDER BY deadline
+		LIMIT $1`, limit)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, scanPending)
+}
+
+// CompletePendingPayment фиксирует итог из webhook: решение PSP и payments.processed
+// одной транзакцией. payment.ErrPendingResolved — итог уже зафиксирован
+func (r *PaymentsRepo) CompletePendingPayment(ctx context.Context, processed events.PaymentProcessed, pspName string, out event.Envelope) error {
+	return r.resolvePending(ctx, processed.PaymentID, payment.PendingCompleted, out, `
+		INSERT INTO provider.processed_events (payment_id, status, psp_reference, event_id, psp)
+		VALUES ($1,$2,$3,$4,NULLIF($5, ''))
+		ON CONFLICT (payment_id) DO NOTHING`,
+		processed.PaymentID, processed.Status, processed.PSPRef, processed.EventID, pspName)
+}
+
+// ExpirePendingPayment проваливает авторизацию без webhook: payments.failed в outbox.
+// payment.ErrPendingResolved — итог успел прийти
+func (r *PaymentsRepo) ExpirePendingPayment(ctx context.Context, paymentID string, out event.Envelope) error {
+	return r.resolvePending(ctx, paymentID, payment.PendingExpired, out, "")
+}
+
+// resolvePending: переход из PENDING — захват строки, поэтому webhook и
+// sweeper (в том числе с разных инстансов) не зафиксируют итог дважды
+func (r *PaymentsRepo) resolvePending(ctx context.Context, paymentID, status string, out event.Envelope, sql string, args ...any) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	res, err := tx.Exec(ctx, `
+		UPDATE provider.pending_payments SET status = $2, updated_at = now()
+		WHERE payment_id = $1 AND status = 'PENDING'`,
+		paymentID, status)
+	if err != nil {
+		return err
+	}
+	if res.RowsAffected() == 0 {
+		return payment.ErrPendingResolved
+	}
+
+	if sql != "" {
+		if _, err := tx.Exec(ctx, sql, args...); err != nil {
+			return err
+		}
+	}
+
+	if err := insertOutboxEvent(ctx, tx, out); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func scanPending(row pgx.CollectableRow) (payment.PendingAuthorization, error) {
+	var (
+		p   payment.PendingAuthorization
+		cmd outboxEventRow
+	)
+	if err := row.Scan(&p.PaymentID, &p.PSP, &p.PSPRef, &p.Status,
+		&cmd.EventType, &cmd.Key, &cmd.Payload, &cmd.Headers, &p.Deadline); err != nil {
+		return payment.PendingAuthorization{}, fmt.Errorf("cant parse pending payment row, err:%w", err)
+	}
+
+	env, err := outboxRowToEnvelope(cmd)
+	if err != nil {
+		return payment.PendingAuthorization{}, fmt.Errorf("cant parse pending payment command, err:%w", err)
+	}
+	p.Command = env
+
+	return p, nil
+}
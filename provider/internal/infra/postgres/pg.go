@@ -11,6 +11,7 @@ import (
 	"time"
 
 	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/events"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -140,23 +141,99 @@ func newPostgresPool(dsn string) (*pgxpool.Pool, error) {
 	return pool, nil
 }
 
-func (r *PaymentsRepo) InsertProcessedEvent(ctx context.Context, payment events.PaymentProcessed) error {
-	res, err := r.pool.Exec(ctx, `
-    	INSERT INTO provider.processed_events (payment_id, status, psp_reference)
-    	VALUES ($1,$2,$3)
+// GetProcessedEvent — сохранённое решение PSP по платежу, pgx.ErrNoRows — решения нет
+func (r *PaymentsRepo) GetProcessedEvent(ctx context.Context, paymentID string) (events.PaymentProcessed, error) {
+	p := events.PaymentProcessed{PaymentID: paymentID}
+	err := r.pool.QueryRow(ctx,
+		`SELECT status, psp_reference, coalesce(event_id, '') FROM provider.processed_events WHERE payment_id = $1`,
+		paymentID).Scan(&p.Status, &p.PSPRef, &p.EventID)
+	return p, err
+}
+
+// InsertProcessedEvent пишет решение PSP и событие-результат одной транзакцией.
+// Если решение уже есть (дубль), событие не пишется — оно ушло в outbox с первым решением
+func (r *PaymentsRepo) InsertProcessedEvent(ctx context.Context, payment events.PaymentProcessed, pspName string, out event.Envelope) error {
+	return r.insertProcessed(ctx, out, "processed event, payment_id: "+payment.PaymentID, `
+    	INSERT INTO provider.processed_events (payment_id, status, psp_reference, event_id, psp)
+    	VALUES ($1,$2,$3,$4,NULLIF($5, ''))
     	ON CONFLICT (payment_id) DO NOTHING`,
-		payment.PaymentID, payment.Status, payment.PSPRef)
+		payment.PaymentID, payment.Status, payment.PSPRef, payment.EventID, pspName)
+}
+
+// GetPaymentPSP — PSP авторизации, пусто — платёж обработан до маршрутизации,
+// capture/void/refund по нему маршрутизатор отклонит. У отложенной авторизации,
+// истёкшей без итога, решения нет — PSP берётся из pending_payments
+func (r *PaymentsRepo) GetPaymentPSP(ctx context.Context, paymentID string) (string, error) {
+	var name string
+	err := r.pool.QueryRow(ctx, `
+		SELECT coalesce(psp, '') FROM provider.processed_events WHERE payment_id = $1
+		UNION ALL
+		SELECT psp FROM provider.pending_payments WHERE payment_id = $1
+		LIMIT 1`,
+		paymentID).Scan(&name)
+	return name, err
+}
+
+// GetProcessedRefund — сохранённое решение PSP по возврату, pgx.ErrNoRows — решения нет
+func (r *PaymentsRepo) GetProcessedRefund(ctx context.Context, refundID string) (events.RefundProcessed, error) {
+	p := events.RefundProcessed{RefundID: refundID}
+	err := r.pool.QueryRow(ctx,
+		`SELECT payment_id, status, psp_reference, coalesce(event_id, '') FROM provider.processed_refunds WHERE refund_id = $1`,
+		refundID).Scan(&p.PaymentID, &p.Status, &p.PSPRef, &p.EventID)
+	return p, err
+}
+
+func (r *PaymentsRepo) InsertProcessedRefund(ctx context.Context, refund events.RefundProcessed, out event.Envelope) error {
+	return r.insertProcessed(ctx, out, "processed refund, refund_id: "+refund.RefundID, `
+    	INSERT INTO provider.processed_refunds (refund_id, payment_id, status, psp_reference, event_id)
+    	VALUES ($1,$2,$3,$4,$5)
+    	ON CONFLICT (refund_id) DO NOTHING`,
+		refund.RefundID, refund.PaymentID, refund.Status, refund.PSPRef, refund.EventID)
+}
+
+// GetProcessedOperation — сохранённый результат команды capture/void по её
+// event_id, pgx.ErrNoRows — результата нет
+func (r *PaymentsRepo) GetProcessedOperation(ctx context.Context, commandID string) (events.PaymentOperationResult, error) {
+	var p events.PaymentOperationResult
+	err := r.pool.QueryRow(ctx,
+		`SELECT payment_id, status, amount, psp_reference, coalesce(event_id, '') FROM provider.processed_operations
+		 WHERE command_id = $1`,
+		commandID).Scan(&p.PaymentID, &p.Status, &p.Amount, &p.PSPRef, &p.EventID)
+	return p, err
+}
+
+func (r *PaymentsRepo) InsertProcessedOperation(ctx context.Context, commandID, operation string, res events.PaymentOperationResult, out event.Envelope) error {
+	return r.insertProcessed(ctx, out, "processed "+operation+", command_id: "+commandID, `
+    	INSERT INTO provider.processed_operations (command_id, payment_id, operation, status, amount, psp_reference, event_id)
+    	VALUES ($1,$2,$3,$4,$5,$6,$7)
+    	ON CONFLICT (command_id) DO NOTHING`,
+		commandID, res.PaymentID, operation, res.Status, res.Amount, res.PSPRef, res.EventID)
+}
 
+// insertProcessed: processed-строка и outbox-событие в одной транзакции
+func (r *PaymentsRepo) insertProcessed(ctx context.Context, out event.Envelope, what, sql string, args ...any) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	res, err := tx.Exec(ctx, sql, args...)
 	if err != nil {
 		return err
 	}
 
 	if res.RowsAffected() == 0 {
-		// значит, запись с таким payment_id уже есть
-		log.Printf("postgres: duplicate processed event, payment_id: %s", payment.PaymentID)
+		// значит, решение уже записано вместе со своим событием
+		log.Printf("postgres: duplicate %s", what)
+		return nil
 	}
 
-	return nil
+	if err := insertOutboxEvent(ctx, tx, out); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
 
 func (r *PaymentsRepo) Statistic(ctx context.Context) (events.Statistic, error) {
@@ -0,0 +1,151 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/retry"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+)
+
+// pickRetrySQL: READY, время пришло, отметим IN_PROGRESS и вернём. Берётся только
+// голова каждого key — команды одного платежа повторяются по порядку. Зависшие
+// в IN_PROGRESS дольше $2 секунд (воркер упал посреди обработки) берутся снова
+const pickRetrySQL = `
+WITH cte AS (
+  SELECT r.id
+  FROM provider.retry_events r
+  WHERE ((r.status = 'READY' AND r.next_attempt_at <= now())
+      OR (r.status = 'IN_PROGRESS' AND r.updated_at < now() - make_interval(secs => $2)))
+    AND NOT EXISTS (
+      SELECT 1 FROM provider.retry_events p
+      WHERE p.key = r.key AND p.id < r.id AND p.status IN ('READY','IN_PROGRESS')
+    )
+  ORDER BY r.next_attempt_at
+  FOR UPDATE SKIP LOCKED
+  LIMIT $1
+)
+UPDATE provider.retry_events r
+SET status='IN_PROGRESS', updated_at=now()
+FROM cte
+WHERE r.id = cte.id
+RETURNING r.id, r.attempt, r.event_type, r.key, r.payload, r.headers;
+`
+
+// HasRetryCommands — у key есть команды в очереди повторов: новая должна встать за ними
+func (r *PaymentsRepo) HasRetryCommands(ctx context.Context, key string) (bool, error) {
+	var exists bool
+	err := r.pool.QueryRow(ctx, `
+		SELECT EXISTS (
+			SELECT 1 FROM provider.retry_events WHERE key = $1 AND status IN ('READY','IN_PROGRESS')
+		)`, key).Scan(&exists)
+	return exists, err
+}
+
+// InsertRetryCommand откладывает команду: attempt попыток уже было, следующая — в nextAt
+func (r *PaymentsRepo) InsertRetryCommand(ctx context.Context, cmd event.Envelope, attempt int, nextAt time.Time, lastErr string) error {
+	headers, err := json.Marshal(cmd.Headers)
+	if err != nil {
+		return fmt.Errorf("invalid event headers, err:%w", err)
+	}
+	_, err = r.pool.Exec(ctx, `
+		INSERT INTO provider.retry_events (event_type, key, payload, headers, attempt, next_attempt_at, last_error)
+		VALUES ($1,$2,$3,$4,$5,$6,NULLIF($7, ''))`,
+		string(cmd.Type), cmd.Key, cmd.Payload, headers, attempt, nextAt, lastErr)
+	return err
+}
+
+// InsertDeadCommand сохраняет команду сразу DEAD: исход у PSP неизвестен,
+// повторы не настроены, команда ждёт ручного разбора
+func (r *PaymentsRepo) InsertDeadCommand(ctx context.Context, cmd event.Envelope, attempt int, lastErr string) error {
+	headers, err := json.Marshal(cmd.Headers)
+	if err != nil {
+		return fmt.Errorf("invalid event headers, err:%w", err)
+	}
+	_, err = r.pool.Exec(ctx, `
+		INSERT INTO provider.retry_events (event_type, key, payload, headers, status, attempt, next_attempt_at, last_error)
+		VALUES ($1,$2,$3,$4,'DEAD',$5,now(),$6)`,
+		string(cmd.Type), cmd.Key, cmd.Payload, headers, attempt, lastErr)
+	return err
+}
+
+func (r *PaymentsRepo) PickRetryCommands(ctx context.Context, count int, reclaimAfter time.Duration) ([]retry.Command, error) {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	msgs, err := queryOutboxMessages(ctx, tx, pickRetrySQL, count, reclaimAfter.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+
+	cmds := make([]retry.Command, 0, len(msgs))
+	for _, m := range msgs {
+		cmds = append(cmds, retry.Command{ID: m.ID, Attempt: m.Attempt, Envelope: m.Envelope, DecodeErr: m.DecodeErr})
+	}
+	return cmds, nil
+}
+
+// CompleteRetryCommand — команда обработана, её результат уже в outbox
+func (r *PaymentsRepo) CompleteRetryCommand(ctx context.Context, id int64, attempt int) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE provider.retry_events
+		SET status='DONE', attempt=$2, last_error=NULL, updated_at=now()
+		WHERE id = $1`, id, attempt)
+	return err
+}
+
+func (r *PaymentsRepo) RescheduleRetryCommand(ctx context.Context, id int64, attempt int, nextAt time.Time, lastErr string) error {
+	_, err := r.pool.Exec(ctx, `
+		UPDATE provider.retry_events
+		SET status='READY', attempt=$2, next_attempt_at=$3, last_error=$4, updated_at=now()
+		WHERE id = $1`, id, attempt, nextAt, lastErr)
+	return err
+}
+
+// FailRetryCommand переводит команду в DEAD и кладёт out (*.failed) в outbox
+// одной транзакцией. out == nil — событие не строится: команду не разобрать
+// или исход у PSP неизвестен
+func (r *PaymentsRepo) FailRetryCommand(ctx context.Context, id int64, attempt int, lastErr string, out *event.Envelope) error {
+	tx, err := r.pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx) // безопасно: если уже коммитнули — no-op
+
+	if _, err := tx.Exec(ctx, `
+		UPDATE provider.retry_events
+		SET status='DEAD', attempt=$2, last_error=$3, updated_at=now()
+		WHERE id = $1`, id, attempt, lastErr); err != nil {
+		return err
+	}
+
+	if out != nil {
+		if err := insertOutboxEvent(ctx, tx, *out); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// PruneRetryCommands удаляет обработанные (DONE) команды старше olderThan.
+// DEAD остаются для разбора
+func (r *PaymentsRepo) PruneRetryCommands(ctx context.Context, olderThan time.Duration) (int64, error) {
+	res, err := r.pool.Exec(ctx, `
+		DELETE FROM provider.retry_events
+		WHERE status = 'DONE' AND updated_at < now() - make_interval(secs => $1)`,
+		olderThan.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected(), nil
+}
@@ -5,22 +5,35 @@ import (
 	"fmt"
 	"log"
 
-	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/events"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
 )
 
 type Client struct {
 	handlers []*handler
+	retrier  *handler // обрабатывает команды из очереди повторов
+	db       Database
+	pending  config.Pending
+	retry    config.Retry
 }
 
-func New(psp PSP, pub events.Publisher, db Database, cons []Consumer) *Client {
+func New(adapter psp.Adapter, db Database, cons []Consumer, pending config.Pending, retry config.Retry) (*Client, error) {
+	if err := validateRetry(retry); err != nil {
+		return nil, err
+	}
+
 	handlers := make([]*handler, 0, len(cons))
 	for idx, con := range cons {
-		handlers = append(handlers, newHandler(con, pub, db, psp, fmt.Sprintf("provider: handler[%d]", idx)))
+		handlers = append(handlers, newHandler(con, db, adapter, pending.Timeout, retry, fmt.Sprintf("provider: handler[%d]", idx)))
 	}
 
 	return &Client{
 		handlers: handlers,
-	}
+		retrier:  newHandler(nil, db, adapter, pending.Timeout, retry, "provider: retry"),
+		db:       db,
+		pending:  pending,
+		retry:    retry,
+	}, nil
 }
 
 func (c *Client) Run(ctx context.Context) {
@@ -30,6 +43,8 @@ func (c *Client) Run(ctx context.Context) {
 	for _, h := range c.handlers {
 		go h.run(ctx)
 	}
+	go c.sweepPending(ctx)
+	go c.retryCommands(ctx)
 
 	<-ctx.Done()
 
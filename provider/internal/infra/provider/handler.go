@@ -2,47 +2,102 @@ package provider
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"time"
 
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
 	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/events"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/retry"
 	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
 	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/helpers"
+	"github.com/jackc/pgx/v5"
 )
 
+// Database: решение PSP и событие-результат пишутся одной транзакцией (outbox),
+// в Kafka их отправляет relay-воркер. Get* возвращают сохранённое решение или
+// pgx.ErrNoRows — при повторной доставке PSP не спрашивается второй раз
 type Database interface {
-	InsertProcessedEvent(ctx context.Context, payment events.PaymentProcessed) error
-}
+	GetProcessedEvent(ctx context.Context, paymentID string) (events.PaymentProcessed, error)
+	InsertProcessedEvent(ctx context.Context, payment events.PaymentProcessed, pspName string, out event.Envelope) error
+	// GetPaymentPSP — PSP, авторизовавший платёж: к нему идут capture/void/refund
+	GetPaymentPSP(ctx context.Context, paymentID string) (string, error)
+	GetProcessedRefund(ctx context.Context, refundID string) (events.RefundProcessed, error)
+	InsertProcessedRefund(ctx context.Context, refund events.RefundProcessed, out event.Envelope) error
+	// capture/void хранятся по event_id команды: повтор после отказа — новая команда
+	GetProcessedOperation(ctx context.Context, commandID string) (events.PaymentOperationResult, error)
+	InsertProcessedOperation(ctx context.Context, commandID, operation string, res events.PaymentOperationResult, out event.Envelope) error
+	// EnqueueEvent — событие без решения PSP (*.failed)
+	EnqueueEvent(ctx context.Context, out event.Envelope) error
+
+	// очередь повторов: команды, обработка которых упала с повторяемой ошибкой
+	HasRetryCommands(ctx context.Context, key string) (bool, error)
+	InsertRetryCommand(ctx context.Context, cmd event.Envelope, attempt int, nextAt time.Time, lastErr string) error
+	// PickRetryCommands также забирает IN_PROGRESS, брошенные дольше reclaimAfter
+	PickRetryCommands(ctx context.Context, count int, reclaimAfter time.Duration) ([]retry.Command, error)
+	CompleteRetryCommand(ctx context.Context, id int64, attempt int) error
+	RescheduleRetryCommand(ctx context.Context, id int64, attempt int, nextAt time.Time, lastErr string) error
+	// InsertDeadCommand сохраняет команду сразу DEAD: повторять её нельзя, а *.failed не отправить
+	InsertDeadCommand(ctx context.Context, cmd event.Envelope, attempt int, lastErr string) error
+	// FailRetryCommand: DEAD и *.failed (если out задан) одной транзакцией
+	FailRetryCommand(ctx context.Context, id int64, attempt int, lastErr string, out *event.Envelope) error
+	PruneRetryCommands(ctx context.Context, olderThan time.Duration) (int64, error)
 
-type PSP interface {
-	DecidePayment() (status string, pspRef *string)
+	// авторизации, на которые PSP ответил PENDING (итог придёт webhook'ом) или
+	// REQUIRES_ACTION (итог даст confirm); out — событие, уходящее сразу
+	InsertPendingPayment(ctx context.Context, p payment.PendingAuthorization, out *event.Envelope) error
+	GetPendingPayment(ctx context.Context, paymentID string) (payment.PendingAuthorization, error)
+	ListExpiredPendingPayments(ctx context.Context, limit int) ([]payment.PendingAuthorization, error)
+	// Complete/Expire фиксируют итог и событие одной транзакцией,
+	// payment.ErrPendingResolved — итог уже зафиксирован
+	CompletePendingPayment(ctx context.Context, processed events.PaymentProcessed, pspName string, out event.Envelope) error
+	ExpirePendingPayment(ctx context.Context, paymentID string, out event.Envelope) error
 }
 
+// статус отказа, общий для всех решений PSP
+const pspDeclined = "DECLINED"
+
+var errPendingUnsupported = errors.New("psp answered PENDING or REQUIRES_ACTION: async result is supported for authorization only")
+
 type Consumer interface {
 	ConsumeEvent(ctx context.Context) (evn event.Envelope, err error)
 	FinalizeEvent(ctx context.Context) error
 }
 
 type handler struct {
-	logPrefix string
-	consumer  Consumer
-	pub       events.Publisher
-	db        Database
-	psp       PSP
+	logPrefix      string
+	consumer       Consumer
+	db             Database
+	psp            psp.Adapter
+	pendingTimeout time.Duration // сколько ждать webhook по PENDING-авторизации
+	retryCfg       config.Retry
+	retryable      map[string]bool // классы ошибок, с которыми команда уходит в очередь повторов
 
 	evnChan chan event.Envelope
 }
 
-func newHandler(con Consumer, pub events.Publisher, db Database, psp PSP, logPrefix string) *handler {
+func newHandler(con Consumer, db Database, adapter psp.Adapter, pendingTimeout time.Duration,
+	retryCfg config.Retry, logPrefix string) *handler {
 	evnChan := make(chan event.Envelope, 1)
 
+	retryable := make(map[string]bool, len(retryCfg.Retryable))
+	for _, class := range retryCfg.Retryable {
+		retryable[class] = true
+	}
+
 	return &handler{
-		logPrefix: logPrefix,
-		consumer:  con,
-		pub:       pub,
-		db:        db,
-		psp:       psp,
-		evnChan:   evnChan,
+		logPrefix:      logPrefix,
+		consumer:       con,
+		db:             db,
+		psp:            adapter,
+		pendingTimeout: pendingTimeout,
+		retryCfg:       retryCfg,
+		retryable:      retryable,
+		evnChan:        evnChan,
 	}
 }
 
@@ -62,21 +117,8 @@ func (h *handler) startProcessEvents(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		case evn := <-h.evnChan:
-			// пытаемся провести платеж
-			if err := h.providePayment(ctx, evn); err != nil {
-				if helpers.IsTimeout(err) {
-					return
-				}
-				// если неудачно, то пишем в топик брокера
-				if paymentFailedEvn, err := events.NewPaymentFailedEvent(evn, err); err != nil {
-					log.Printf("%s: error while create new payment failed event:%v", h.logPrefix, err)
-				} else {
-					if err = h.pub.Publish(ctx, paymentFailedEvn); err != nil {
-						log.Printf("%s: publisher error:%v", h.logPrefix, err)
-						continue
-					}
-					log.Printf("%s: published payment.failed payment_id=%s", h.logPrefix, paymentFailedEvn.Key)
-				}
+			if err := h.processUntilDone(ctx, evn); err != nil {
+				return
 			}
 
 			if err := h.consumer.FinalizeEvent(ctx); err != nil {
@@ -89,6 +131,24 @@ func (h *handler) startProcessEvents(ctx context.Context) {
 	}
 }
 
+// processUntilDone повторяет process для той же команды, пока она не будет
+// обработана или отложена: без FinalizeEvent consumer дальше не читает.
+// Ошибка — только отмена ctx
+func (h *handler) processUntilDone(ctx context.Context, evn event.Envelope) error {
+	for attempt := 1; ; attempt++ {
+		err := h.process(ctx, evn)
+		if err == nil || ctx.Err() != nil {
+			return ctx.Err()
+		}
+		pause := backoff(h.retryCfg.InlineBackoff, h.retryCfg.BackoffMax, h.retryCfg.BackoffJitter, attempt)
+		log.Printf("%s: attempt=%d can't process %s key=%s, next in %s:%v",
+			h.logPrefix, attempt, evn.Type, evn.Key, pause, err)
+		if err := sleep(ctx, pause); err != nil {
+			return err
+		}
+	}
+}
+
 func (h *handler) startReadEvents(ctx context.Context) {
 	log.Printf("%s: read events started", h.logPrefix)
 	defer func() { log.Printf("%s: read events closed", h.logPrefix) }()
@@ -107,21 +167,233 @@ func (h *handler) startReadEvents(ctx context.Context) {
 	}
 }
 
-func (h *handler) providePayment(ctx context.Context, event event.Envelope) error {
-	log.Printf("%s: consumed payment_id=%s", h.logPrefix, event.Key)
-	status, pspRef := h.psp.DecidePayment()
-	newEvent, err := events.NewPaymentProcessedEvent(event, string(status), pspRef)
+func (h *handler) provide(ctx context.Context, evn event.Envelope) error {
+	switch evn.Type {
+	case event.PaymentCreatedEvent:
+		return h.providePayment(ctx, evn)
+	case event.RefundCreatedEvent:
+		return h.provideRefund(ctx, evn)
+	case event.PaymentCaptureRequestedEvent, event.PaymentVoidRequestedEvent:
+		return h.provideOperation(ctx, evn)
+	case event.PaymentConfirmRequestedEvent:
+		return h.provideConfirm(ctx, evn)
+	default:
+		return fmt.Errorf("unsupported event type %q", evn.Type)
+	}
+}
+
+func newFailedEvent(evn event.Envelope, errDetails error) (event.Envelope, error) {
+	switch evn.Type {
+	case event.RefundCreatedEvent:
+		return events.NewRefundFailedEvent(evn, errDetails)
+	case event.PaymentCaptureRequestedEvent, event.PaymentVoidRequestedEvent:
+		return events.NewPaymentOperationResultEvent(evn, "", nil, errDetails, "")
+	default:
+		return events.NewPaymentFailedEvent(evn, errDetails)
+	}
+}
+
+func (h *handler) providePayment(ctx context.Context, evn event.Envelope) error {
+	log.Printf("%s: consumed payment_id=%s", h.logPrefix, evn.Key)
+
+	var stored events.PaymentProcessed
+	found, err := h.stored(ctx, func() (err error) {
+		stored, err = h.db.GetProcessedEvent(ctx, evn.Key)
+		return err
+	})
+	if err != nil {
+		log.Printf("%s: database error:%v", h.logPrefix, err)
+		return err
+	}
+	if found {
+		// повторная доставка: PSP второй раз не спрашиваем, повторяем сохранённый исход
+		return h.reemit(ctx, evn.Key, stored.Status, func() (event.Envelope, error) {
+			return events.NewPaymentProcessedEvent(evn, stored.Status, stored.PSPRef, stored.EventID)
+		})
+	}
+
+	var pending payment.PendingAuthorization
+	found, err = h.stored(ctx, func() (err error) {
+		pending, err = h.db.GetPendingPayment(ctx, evn.Key)
+		return err
+	})
+	if err != nil {
+		log.Printf("%s: database error:%v", h.logPrefix, err)
+		return err
+	}
+	if found {
+		// PSP уже ответил PENDING или REQUIRES_ACTION: итог придёт webhook'ом
+		// или confirm'ом, иначе его зафиксирует sweeper
+		log.Printf("%s: redelivered payment_id=%s, pending authorization status=%s", h.logPrefix, evn.Key, pending.Status)
+		return nil
+	}
+
+	req, err := newPSPRequest(evn)
+	if err != nil {
+		return err
+	}
+
+	res, err := h.psp.Authorize(ctx, req)
+	status, pspRef, err := h.decision(ctx, req, res, err)
+	if err != nil {
+		return err
+	}
+
+	switch status {
+	case psp.StatusPending:
+		return h.awaitCallback(ctx, evn, res.PSP, pspRef, nil)
+	case psp.StatusRequiresAction:
+		return h.awaitAction(ctx, evn, res, pspRef)
+	}
+
+	newEvent, err := events.NewPaymentProcessedEvent(evn, status, pspRef, "")
 	if err != nil {
 		log.Printf("%s: can't create processed event, error:%v", h.logPrefix, err)
 		return err
 	}
 
-	attempt, err := h.retray(0, func() error {
-		return h.db.InsertProcessedEvent(ctx, events.PaymentProcessed{
-			PaymentID: newEvent.Key,
-			Status:    string(status),
-			PSPRef:    pspRef,
+	var processed events.PaymentProcessed
+	if err := json.Unmarshal(newEvent.Payload, &processed); err != nil {
+		return err
+	}
+
+	err = h.retry(ctx, func() error {
+		return h.db.InsertProcessedEvent(ctx, processed, res.PSP, newEvent)
+	})
+
+	if err != nil {
+		log.Printf("%s: database error:%v", h.logPrefix, err)
+		return err
+	}
+
+	log.Printf("%s: enqueued payment.processed payment_id=%s status=%s", h.logPrefix, newEvent.Key, status)
+
+	return nil
+}
+
+func (h *handler) provideRefund(ctx context.Context, evn event.Envelope) error {
+	log.Printf("%s: consumed refund for payment_id=%s", h.logPrefix, evn.Key)
+
+	var created events.RefundProcessed
+	if err := json.Unmarshal(evn.Payload, &created); err != nil {
+		return fmt.Errorf("invalid JSON err:%v", err)
+	}
+
+	var stored events.RefundProcessed
+	found, err := h.stored(ctx, func() (err error) {
+		stored, err = h.db.GetProcessedRefund(ctx, created.RefundID)
+		return err
+	})
+	if err != nil {
+		log.Printf("%s: database error:%v", h.logPrefix, err)
+		return err
+	}
+	if found {
+		return h.reemit(ctx, created.RefundID, stored.Status, func() (event.Envelope, error) {
+			return events.NewRefundProcessedEvent(evn, stored.Status, stored.PSPRef, stored.EventID)
+		})
+	}
+
+	req, err := newPSPRequest(evn)
+	if err != nil {
+		return err
+	}
+	if req.PSP, err = h.paymentPSP(ctx, req.PaymentID); err != nil {
+		return err
+	}
+
+	res, err := h.psp.Refund(ctx, req)
+	status, pspRef, err := h.decision(ctx, req, res, err)
+	if err != nil {
+		return err
+	}
+	if status == psp.StatusPending || status == psp.StatusRequiresAction {
+		return errPendingUnsupported
+	}
+
+	newEvent, err := events.NewRefundProcessedEvent(evn, status, pspRef, "")
+	if err != nil {
+		log.Printf("%s: can't create refund processed event, error:%v", h.logPrefix, err)
+		return err
+	}
+
+	var processed events.RefundProcessed
+	if err := json.Unmarshal(newEvent.Payload, &processed); err != nil {
+		return err
+	}
+
+	err = h.retry(ctx, func() error {
+		return h.db.InsertProcessedRefund(ctx, processed, newEvent)
+	})
+
+	if err != nil {
+		log.Printf("%s: database error:%v", h.logPrefix, err)
+		return err
+	}
+
+	log.Printf("%s: enqueued refund.processed refund_id=%s status=%s", h.logPrefix, processed.RefundID, status)
+
+	return nil
+}
+
+// capture/void авторизованного платежа
+func (h *handler) provideOperation(ctx context.Context, evn event.Envelope) error {
+	operation := events.OperationOf(evn.Type)
+	log.Printf("%s: consumed %s payment_id=%s", h.logPrefix, operation, evn.Key)
+
+	// ключ идемпотентности операции у PSP — event_id команды: повторная
+	// доставка той же команды не проводит её второй раз, новая — проводит
+	req, err := newPSPRequest(evn)
+	if err != nil {
+		return err
+	}
+
+	var stored events.PaymentOperationResult
+	found, err := h.stored(ctx, func() (err error) {
+		stored, err = h.db.GetProcessedOperation(ctx, req.IdempotencyKey)
+		return err
+	})
+	if err != nil {
+		log.Printf("%s: database error:%v", h.logPrefix, err)
+		return err
+	}
+	if found {
+		return h.reemit(ctx, evn.Key, stored.Status, func() (event.Envelope, error) {
+			return newOperationResultEvent(evn, stored.Status, stored.PSPRef, stored.EventID)
 		})
+	}
+
+	if req.PSP, err = h.paymentPSP(ctx, req.PaymentID); err != nil {
+		return err
+	}
+
+	var pspRes psp.Result
+	if operation == events.OperationVoid {
+		pspRes, err = h.psp.Void(ctx, req)
+	} else {
+		pspRes, err = h.psp.Capture(ctx, req)
+	}
+	status, pspRef, err := h.decision(ctx, req, pspRes, err)
+	if err != nil {
+		return err
+	}
+	if status == psp.StatusPending || status == psp.StatusRequiresAction {
+		return errPendingUnsupported
+	}
+
+	newEvent, err := newOperationResultEvent(evn, status, pspRef, "")
+	if err != nil {
+		log.Printf("%s: can't create %s result event, error:%v", h.logPrefix, operation, err)
+		return err
+	}
+
+	var res events.PaymentOperationResult
+	if err := json.Unmarshal(newEvent.Payload, &res); err != nil {
+		return err
+	}
+
+	err = h.retry(ctx, func() error {
+		return h.db.InsertProcessedOperation(ctx, req.IdempotencyKey, operation, res, newEvent)
 	})
 
 	if err != nil {
@@ -129,32 +401,129 @@ func (h *handler) providePayment(ctx context.Context, event event.Envelope) erro
 		return err
 	}
 
-	_, err = h.retray(attempt, func() error {
-		return h.pub.Publish(ctx, newEvent)
+	log.Printf("%s: enqueued %s payment_id=%s status=%s", h.logPrefix, newEvent.Type, res.PaymentID, status)
+
+	return nil
+}
+
+func newOperationResultEvent(evn event.Envelope, status string, pspRef *string, eventID string) (event.Envelope, error) {
+	var declined error
+	if status == pspDeclined {
+		declined = fmt.Errorf("%s declined by psp", events.OperationOf(evn.Type))
+	}
+	return events.NewPaymentOperationResultEvent(evn, status, pspRef, declined, eventID)
+}
+
+// awaitCallback запоминает PENDING-авторизацию: payments.processed уйдёт,
+// когда PSP пришлёт итог webhook'ом, или payments.failed — по истечении pendingTimeout.
+// out, если задан, уходит в outbox вместе с ней
+func (h *handler) awaitCallback(ctx context.Context, evn event.Envelope, pspName string, pspRef *string, out *event.Envelope) error {
+	pending := payment.PendingAuthorization{
+		PaymentID: evn.Key,
+		PSP:       pspName,
+		PSPRef:    pspRef,
+		Status:    payment.PendingWaiting,
+		Command:   evn,
+		Deadline:  time.Now().Add(h.pendingTimeout),
+	}
+
+	err := h.retry(ctx, func() error {
+		return h.db.InsertPendingPayment(ctx, pending, out)
 	})
+	if err != nil {
+		log.Printf("%s: database error:%v", h.logPrefix, err)
+		return err
+	}
+
+	log.Printf("%s: psp %s pending payment_id=%s, awaiting callback until %s",
+		h.logPrefix, pspName, evn.Key, pending.Deadline.Format(time.RFC3339))
+	return nil
+}
+
+// awaitAction: PSP требует challenge. checkout получает REQUIRES_ACTION с
+// next_action, итог авторизации даст payment.confirm_requested
+func (h *handler) awaitAction(ctx context.Context, evn event.Envelope, res psp.Result, pspRef *string) error {
+	if res.NextAction == nil {
+		return fmt.Errorf("psp %s answered %s without next action", res.PSP, res.Status)
+	}
+
+	out, err := events.NewPaymentActionRequiredEvent(evn, pspRef, res.NextAction.RedirectURL, res.NextAction.ChallengeID)
+	if err != nil {
+		log.Printf("%s: can't create action required event, error:%v", h.logPrefix, err)
+		return err
+	}
+
+	return h.awaitCallback(ctx, evn, res.PSP, pspRef, &out)
+}
 
+// reemit кладёт в outbox сохранённый исход повторно: с прежним event_id
+// потребители отбросят его как дубль, а если первое событие потерялось — получат
+func (h *handler) reemit(ctx context.Context, id, status string, build func() (event.Envelope, error)) error {
+	out, err := build()
 	if err != nil {
-		log.Printf("%s: publisher error:%v", h.logPrefix, err)
+		log.Printf("%s: can't rebuild stored result id=%s, error:%v", h.logPrefix, id, err)
 		return err
 	}
 
-	log.Printf("%s: published payment.processed payment_id=%s status=%s", h.logPrefix, newEvent.Key, status)
+	err = h.retry(ctx, func() error {
+		return h.db.EnqueueEvent(ctx, out)
+	})
+	if err != nil {
+		log.Printf("%s: database error:%v", h.logPrefix, err)
+		return err
+	}
 
+	log.Printf("%s: redelivered id=%s, re-enqueued stored %s status=%s", h.logPrefix, id, out.Type, status)
 	return nil
 }
 
-func (h *handler) retray(attempt int, fn func() error) (int, error) {
-	var lastErr error
+// paymentPSP — PSP авторизации, пусто — неизвестен (платёж до маршрутизации):
+// маршрутизатор такую операцию отклонит
+func (h *handler) paymentPSP(ctx context.Context, paymentID string) (string, error) {
+	var name string
+	err := h.retry(ctx, func() (err error) {
+		name, err = h.db.GetPaymentPSP(ctx, paymentID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		log.Printf("%s: database error:%v", h.logPrefix, err)
+	}
+	return name, err
+}
+
+// stored ищет сохранённое решение через get: false — решения ещё нет
+func (h *handler) stored(ctx context.Context, get func() error) (bool, error) {
+	found := true
+	err := h.retry(ctx, func() error {
+		err := get()
+		if errors.Is(err, pgx.ErrNoRows) {
+			found = false
+			return nil
+		}
+		return err
+	})
+	return found && err == nil, err
+}
 
-	for curAttempt := attempt; curAttempt < 4; curAttempt++ {
-		time.Sleep(5 * time.Second * time.Duration(curAttempt))
+// retry повторяет операцию с БД на месте до InlineAttempts раз, пока жив ctx.
+// Попытки исчерпаны — errDatabase: команда уйдёт в очередь повторов
+func (h *handler) retry(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
 		err := fn()
-		if err == nil {
-			return attempt, err
+		if err == nil || helpers.IsTimeout(err) {
+			return err
 		}
-		log.Printf("%s attempt=%d error while provide a payment:%v", h.logPrefix, curAttempt+1, err)
-		lastErr = err
-	}
+		log.Printf("%s: attempt=%d database error:%v", h.logPrefix, attempt, err)
 
-	return -1, lastErr
+		if attempt >= h.retryCfg.InlineAttempts {
+			return errDatabase{err}
+		}
+		pause := backoff(h.retryCfg.InlineBackoff, h.retryCfg.BackoffMax, h.retryCfg.BackoffJitter, attempt)
+		if err := sleep(ctx, pause); err != nil {
+			return err
+		}
+	}
 }
@@ -0,0 +1,332 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/events"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+	"github.com/jackc/pgx/v5"
+)
+
+// fakeDB хранит решения, outbox и очередь повторов в памяти
+type fakeDB struct {
+	mu         sync.Mutex
+	processed  map[string]events.PaymentProcessed
+	refunds    map[string]events.RefundProcessed
+	operations map[string]events.PaymentOperationResult
+	pending    map[string]payment.PendingAuthorization
+	pspOf      map[string]string
+	outbox     []event.Envelope
+	retries    []*fakeRetry
+	nextID     int64
+	// failWrites — сколько ближайших записей (решение, outbox) упадут
+	failWrites int
+}
+
+func newFakeDB() *fakeDB {
+	return &fakeDB{
+		processed:  map[string]events.PaymentProcessed{},
+		refunds:    map[string]events.RefundProcessed{},
+		operations: map[string]events.PaymentOperationResult{},
+		pending:    map[string]payment.PendingAuthorization{},
+		pspOf:      map[string]string{},
+	}
+}
+
+var errFakeDB = errors.New("connection refused")
+
+func (db *fakeDB) write() error {
+	if db.failWrites > 0 {
+		db.failWrites--
+		return errFakeDB
+	}
+	return nil
+}
+
+func (db *fakeDB) GetProcessedEvent(ctx context.Context, paymentID string) (events.PaymentProcessed, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	p, ok := db.processed[paymentID]
+	if !ok {
+		return p, pgx.ErrNoRows
+	}
+	return p, nil
+}
+
+func (db *fakeDB) InsertProcessedEvent(ctx context.Context, p events.PaymentProcessed, pspName string, out event.Envelope) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.write(); err != nil {
+		return err
+	}
+	db.processed[p.PaymentID] = p
+	db.pspOf[p.PaymentID] = pspName
+	db.outbox = append(db.outbox, out)
+	return nil
+}
+
+func (db *fakeDB) GetPaymentPSP(ctx context.Context, paymentID string) (string, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if name, ok := db.pspOf[paymentID]; ok {
+		return name, nil
+	}
+	// как в SQL: истёкшая отложенная авторизация — PSP из pending_payments
+	if p, ok := db.pending[paymentID]; ok {
+		return p.PSP, nil
+	}
+	return "", pgx.ErrNoRows
+}
+
+func (db *fakeDB) GetProcessedRefund(ctx context.Context, refundID string) (events.RefundProcessed, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	r, ok := db.refunds[refundID]
+	if !ok {
+		return r, pgx.ErrNoRows
+	}
+	return r, nil
+}
+
+func (db *fakeDB) InsertProcessedRefund(ctx context.Context, r events.RefundProcessed, out event.Envelope) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.write(); err != nil {
+		return err
+	}
+	db.refunds[r.RefundID] = r
+	db.outbox = append(db.outbox, out)
+	return nil
+}
+
+func (db *fakeDB) GetProcessedOperation(ctx context.Context, commandID string) (events.PaymentOperationResult, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	res, ok := db.operations[commandID]
+	if !ok {
+		return res, pgx.ErrNoRows
+	}
+	return res, nil
+}
+
+func (db *fakeDB) InsertProcessedOperation(ctx context.Context, commandID, operation string, res events.PaymentOperationResult, out event.Envelope) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.write(); err != nil {
+		return err
+	}
+	db.operations[commandID] = res
+	db.outbox = append(db.outbox, out)
+	return nil
+}
+
+func (db *fakeDB) EnqueueEvent(ctx context.Context, out event.Envelope) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if err := db.write(); err != nil {
+		return err
+	}
+	db.outbox = append(db.outbox, out)
+	return nil
+}
+
+func (db *fakeDB) outboxTypes() []event.EnvelopeType {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	types := make([]event.EnvelopeType, 0, len(db.outbox))
+	for _, out := range db.outbox {
+		types = append(types, out.Type)
+	}
+	return types
+}
+
+// fakePSP отвечает через fn и считает вызовы
+type fakePSP struct {
+	mu    sync.Mutex
+	fn    func(op string, req psp.Request) (psp.Result, error)
+	calls []string // op:ключ идемпотентности
+}
+
+func (p *fakePSP) call(op string, req psp.Request) (psp.Result, error) {
+	p.mu.Lock()
+	p.calls = append(p.calls, op+":"+req.IdempotencyKey)
+	p.mu.Unlock()
+	if p.fn == nil {
+		ref := "ref_" + req.IdempotencyKey
+		return psp.Result{PSP: "fake", Status: "APPROVED", PSPRef: &ref}, nil
+	}
+	return p.fn(op, req)
+}
+
+func (p *fakePSP) Name() string { return "fake" }
+func (p *fakePSP) Authorize(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return p.call("authorize", req)
+}
+func (p *fakePSP) Capture(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return p.call("capture", req)
+}
+func (p *fakePSP) Refund(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return p.call("refund", req)
+}
+func (p *fakePSP) Void(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return p.call("void", req)
+}
+func (p *fakePSP) Confirm(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return p.call("confirm", req)
+}
+
+func pspErr(kind error) error {
+	return psp.NewError(kind, "fake", "", "")
+}
+
+func paymentCreated(paymentID string) event.Envelope {
+	payload, _ := json.Marshal(map[string]string{
+		"event_id":     "evt_" + paymentID,
+		"payment_id":   paymentID,
+		"merchant_id":  "m_1",
+		"amount":       "10.00",
+		"currency":     "USD",
+		"method_token": "tok_visa",
+	})
+	return event.Envelope{Type: event.PaymentCreatedEvent, Key: paymentID, Payload: payload}
+}
+
+func refundCreated(paymentID, refundID string) event.Envelope {
+	payload, _ := json.Marshal(map[string]string{
+		"event_id":   "evt_" + refundID,
+		"refund_id":  refundID,
+		"payment_id": paymentID,
+		"amount":     "5.00",
+		"currency":   "USD",
+	})
+	return event.Envelope{Type: event.RefundCreatedEvent, Key: paymentID, Payload: payload}
+}
+
+func operationRequested(t event.EnvelopeType, paymentID, eventID string) event.Envelope {
+	ref := "ref_" + paymentID
+	payload, _ := json.Marshal(map[string]any{
+		"event_id":      eventID,
+		"payment_id":    paymentID,
+		"merchant_id":   "m_1",
+		"amount":        "10.00",
+		"currency":      "USD",
+		"psp_reference": ref,
+	})
+	return event.Envelope{Type: t, Key: paymentID, Payload: payload}
+}
+
+func resultOf(t *testing.T, out event.Envelope) events.PaymentOperationResult {
+	t.Helper()
+	var res events.PaymentOperationResult
+	if err := json.Unmarshal(out.Payload, &res); err != nil {
+		t.Fatalf("invalid result payload: %v", err)
+	}
+	return res
+}
+
+func eventIDOf(t *testing.T, out event.Envelope) string {
+	t.Helper()
+	var payload struct {
+		EventID string `json:"event_id"`
+	}
+	if err := json.Unmarshal(out.Payload, &payload); err != nil {
+		t.Fatalf("invalid payload: %v", err)
+	}
+	return payload.EventID
+}
+
+// Повторная доставка команды не спрашивает PSP второй раз, а повторяет
+// сохранённый исход с прежним event_id: потребители отбросят дубль
+func TestRedeliveryReemitsDecision(t *testing.T) {
+	db := newFakeDB()
+	adapter := &fakePSP{}
+	h := newTestHandler(db, adapter, testRetryConfig())
+	ctx := context.Background()
+
+	for _, evn := range []event.Envelope{
+		paymentCreated("pay_1"), paymentCreated("pay_1"),
+		refundCreated("pay_1", "ref_1"), refundCreated("pay_1", "ref_1"),
+	} {
+		if err := h.process(ctx, evn); err != nil {
+			t.Fatalf("process %s: %v", evn.Type, err)
+		}
+	}
+
+	if len(adapter.calls) != 2 || adapter.calls[0] != "authorize:pay_1" || adapter.calls[1] != "refund:ref_1" {
+		t.Fatalf("psp calls = %v, want one per command keyed by payment_id/refund_id", adapter.calls)
+	}
+	if len(db.outbox) != 4 {
+		t.Fatalf("outbox = %v", db.outbox)
+	}
+	for i := 0; i < 4; i += 2 {
+		if first, again := eventIDOf(t, db.outbox[i]), eventIDOf(t, db.outbox[i+1]); first == "" || first != again {
+			t.Fatalf("%s re-emitted with event_id %q, want %q", db.outbox[i].Type, again, first)
+		}
+	}
+}
+
+// Capture после отказа — новая команда: PSP спрашивается снова по новому
+// ключу, результат уходит с новым event_id и не отбрасывается checkout'ом
+func TestOperationRetriedAfterDecline(t *testing.T) {
+	for _, tt := range []struct {
+		cmd  event.EnvelopeType
+		op   string
+		want event.EnvelopeType
+	}{
+		{event.PaymentCaptureRequestedEvent, "capture", event.PaymentCapturedEvent},
+		{event.PaymentVoidRequestedEvent, "void", event.PaymentVoidedEvent},
+	} {
+		t.Run(tt.op, func(t *testing.T) {
+			db := newFakeDB()
+			db.pspOf["pay_1"] = "fake"
+			var keys []string
+			adapter := &fakePSP{fn: func(op string, req psp.Request) (psp.Result, error) {
+				keys = append(keys, req.IdempotencyKey)
+				if len(keys) == 1 {
+					return psp.Result{}, pspErr(psp.ErrHardDecline)
+				}
+				return psp.Result{PSP: "fake", Status: "APPROVED"}, nil
+			}}
+			h := newTestHandler(db, adapter, testRetryConfig())
+			ctx := context.Background()
+
+			first := operationRequested(tt.cmd, "pay_1", "evt_cmd_1")
+			second := operationRequested(tt.cmd, "pay_1", "evt_cmd_2")
+			for _, evn := range []event.Envelope{first, first, second} {
+				if err := h.process(ctx, evn); err != nil {
+					t.Fatalf("process: %v", err)
+				}
+			}
+
+			// повторная доставка первой команды PSP не спрашивает
+			if len(keys) != 2 || keys[0] != "evt_cmd_1" || keys[1] != "evt_cmd_2" {
+				t.Fatalf("psp idempotency keys = %v", keys)
+			}
+			if len(db.outbox) != 3 {
+				t.Fatalf("outbox = %v", db.outboxTypes())
+			}
+			declined, redelivered, succeeded := resultOf(t, db.outbox[0]), resultOf(t, db.outbox[1]), resultOf(t, db.outbox[2])
+			if declined.EventID != redelivered.EventID {
+				t.Fatalf("redelivered result has new event_id %s, want %s", redelivered.EventID, declined.EventID)
+			}
+			if succeeded.EventID == declined.EventID {
+				t.Fatal("new command reused event_id of the declined one")
+			}
+			if db.outbox[2].Type != tt.want {
+				t.Fatalf("second command result = %s, want %s", db.outbox[2].Type, tt.want)
+			}
+		})
+	}
+}
+
+func TestOperationWithoutEventID(t *testing.T) {
+	if _, err := newPSPRequest(operationRequested(event.PaymentCaptureRequestedEvent, "pay_1", "")); err == nil {
+		t.Fatal("capture without event_id accepted")
+	}
+}
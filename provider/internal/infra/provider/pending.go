@@ -0,0 +1,242 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/events"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// CompletePayment фиксирует итог PENDING-авторизации, присланный PSP webhook'ом:
+// res — одобрение, pspErr — отказ (psp.IsDecline). Ошибки:
+// payment.ErrPendingNotFound — такой авторизации у этого PSP нет;
+// payment.ErrPendingResolved — итог уже зафиксирован (повтор webhook'а или он опоздал:
+// опоздавшее одобрение ставит отмену авторизации в очередь повторов);
+// payment.ErrInvalidCallback — итог не одобрение и не отказ
+func (c *Client) CompletePayment(ctx context.Context, pspName, paymentID string, res psp.Result, pspErr error) error {
+	pending, err := c.db.GetPendingPayment(ctx, paymentID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return payment.ErrPendingNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if pending.PSP != pspName {
+		return payment.ErrPendingNotFound
+	}
+
+	status, pspRef := res.Status, res.PSPRef
+	switch {
+	case pspErr != nil && psp.IsDecline(pspErr):
+		status, pspRef = pspDeclined, nil
+	case pspErr != nil:
+		return fmt.Errorf("%w: %v", payment.ErrInvalidCallback, pspErr)
+	case status != psp.StatusAuthorized:
+		return fmt.Errorf("%w: status %q", payment.ErrInvalidCallback, status)
+	case pspRef == nil:
+		pspRef = pending.PSPRef
+	case pending.PSPRef != nil && *pspRef != *pending.PSPRef:
+		return fmt.Errorf("%w: psp_reference mismatch", payment.ErrInvalidCallback)
+	}
+
+	if err := completePending(ctx, c.db, pending, status, pspRef); err != nil {
+		return err
+	}
+
+	log.Printf("provider: psp %s callback, enqueued payment.processed payment_id=%s status=%s", pspName, paymentID, status)
+	return nil
+}
+
+// provideConfirm: покупатель прошёл challenge — PSP, потребовавший его,
+// завершает авторизацию. Таймаут и недоступность PSP — повторяемые ошибки,
+// confirm уйдёт в очередь повторов, прочие сбои проваливают платёж
+func (h *handler) provideConfirm(ctx context.Context, evn event.Envelope) error {
+	log.Printf("%s: consumed confirm payment_id=%s", h.logPrefix, evn.Key)
+
+	var pending payment.PendingAuthorization
+	found, err := h.stored(ctx, func() (err error) {
+		pending, err = h.db.GetPendingPayment(ctx, evn.Key)
+		return err
+	})
+	if err != nil {
+		log.Printf("%s: database error:%v", h.logPrefix, err)
+		return err
+	}
+	if !found {
+		// авторизации с challenge нет: confirm не к чему применять
+		log.Printf("%s: confirm payment_id=%s without authorization awaiting confirmation, skipped", h.logPrefix, evn.Key)
+		return nil
+	}
+	if pending.Status != payment.PendingWaiting {
+		// повторная доставка или ожидание истекло: итог уже в outbox
+		log.Printf("%s: redelivered confirm payment_id=%s, authorization status=%s", h.logPrefix, evn.Key, pending.Status)
+		return nil
+	}
+
+	req, err := newPSPRequest(evn)
+	if err != nil {
+		return err
+	}
+	req.PSP, req.PSPRef = pending.PSP, pending.PSPRef
+
+	res, err := h.psp.Confirm(ctx, req)
+	status, pspRef, err := h.decision(ctx, req, res, err)
+	switch {
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case errorClass(err) != "":
+		// исход неизвестен или PSP не ответил: challenge ещё в силе
+		return err
+	case err == nil && status != psp.StatusAuthorized && status != pspDeclined:
+		err = fmt.Errorf("psp %s answered %s on confirm", pending.PSP, status)
+	}
+	if pspRef == nil {
+		pspRef = pending.PSPRef
+	}
+
+	alreadyResolved := false
+	dbErr := h.retry(ctx, func() error {
+		var resErr error
+		if err != nil {
+			resErr = failPending(ctx, h.db, pending, err)
+		} else {
+			resErr = completePending(ctx, h.db, pending, status, pspRef)
+		}
+		if errors.Is(resErr, payment.ErrPendingResolved) {
+			alreadyResolved = true // webhook или sweeper успели, повторять нечего
+			return nil
+		}
+		return resErr
+	})
+	if dbErr != nil {
+		log.Printf("%s: database error:%v", h.logPrefix, dbErr)
+		return dbErr
+	}
+	if alreadyResolved {
+		log.Printf("%s: confirm payment_id=%s, authorization already resolved", h.logPrefix, evn.Key)
+		return nil
+	}
+
+	if err != nil {
+		log.Printf("%s: confirm failed payment_id=%s, enqueued payments.failed:%v", h.logPrefix, evn.Key, err)
+		return nil
+	}
+	log.Printf("%s: enqueued payment.processed payment_id=%s status=%s", h.logPrefix, evn.Key, status)
+	return nil
+}
+
+// completePending фиксирует итог отложенной авторизации: payments.processed
+// строится из исходной команды payment.created
+func completePending(ctx context.Context, db Database, pending payment.PendingAuthorization, status string, pspRef *string) error {
+	newEvent, err := events.NewPaymentProcessedEvent(pending.Command, status, pspRef, "")
+	if err != nil {
+		return err
+	}
+
+	var processed events.PaymentProcessed
+	if err := json.Unmarshal(newEvent.Payload, &processed); err != nil {
+		return err
+	}
+
+	err = db.CompletePendingPayment(ctx, processed, pending.PSP, newEvent)
+	if errors.Is(err, payment.ErrPendingResolved) && status == psp.StatusAuthorized {
+		return resolved(ctx, db, pending, pspRef)
+	}
+	return err
+}
+
+// failPending проваливает отложенную авторизацию: payments.failed с причиной
+func failPending(ctx context.Context, db Database, pending payment.PendingAuthorization, reason error) error {
+	out, err := events.NewPaymentFailedEvent(pending.Command, reason)
+	if err != nil {
+		return err
+	}
+	return db.ExpirePendingPayment(ctx, pending.PaymentID, out)
+}
+
+// resolved: одобрение пришло, когда итог уже зафиксирован. Повтор webhook'а
+// безвреден, а после истечения ожидания деньги заблокированы у PSP при
+// проваленном платеже: отмена авторизации уходит в очередь повторов.
+// Ошибка постановки возвращается — PSP повторит webhook
+func resolved(ctx context.Context, db Database, pending payment.PendingAuthorization, pspRef *string) error {
+	cur, err := db.GetPendingPayment(ctx, pending.PaymentID)
+	if err != nil {
+		return err
+	}
+	if cur.Status != payment.PendingExpired {
+		return payment.ErrPendingResolved
+	}
+
+	cmd, err := events.NewPaymentVoidRequestedEvent(pending.Command, pspRef, expiredVoidID(pending.PaymentID))
+	if err != nil {
+		return err
+	}
+	if err := db.InsertRetryCommand(ctx, cmd, 0, time.Now(), "authorized after pending timeout"); err != nil {
+		return err
+	}
+
+	log.Printf("provider: psp %s authorized expired payment_id=%s psp_reference=%v, enqueued void",
+		pending.PSP, pending.PaymentID, deref(pspRef))
+	return payment.ErrPendingResolved
+}
+
+// expiredVoidID — event_id отмены по истёкшему ожиданию: один на платёж,
+// поэтому повторы webhook'а не проводят отмену у PSP второй раз
+func expiredVoidID(paymentID string) string {
+	return uuid.NewSHA1(uuid.NameSpaceURL, []byte("provider:expired-void:"+paymentID)).String()
+}
+
+// sweepPending проваливает отложенные авторизации без итога к сроку: webhook
+// не пришёл или покупатель не прошёл challenge.
+// Захват строки в ExpirePendingPayment позволяет запускать его на всех инстансах
+func (c *Client) sweepPending(ctx context.Context) {
+	ticker := time.NewTicker(c.pending.SweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.expirePending(ctx)
+		}
+	}
+}
+
+func (c *Client) expirePending(ctx context.Context) {
+	expired, err := c.db.ListExpiredPendingPayments(ctx, c.pending.SweepBatch)
+	if err != nil {
+		log.Printf("provider: pending sweeper: database error:%v", err)
+		return
+	}
+
+	for _, p := range expired {
+		err := failPending(ctx, c.db, p,
+			fmt.Errorf("psp %s: no result for pending authorization within %s", p.PSP, c.pending.Timeout))
+		if errors.Is(err, payment.ErrPendingResolved) {
+			continue // webhook успел
+		}
+		if err != nil {
+			log.Printf("provider: pending sweeper: database error:%v", err)
+			return
+		}
+
+		log.Printf("provider: pending sweeper: expired payment_id=%s psp=%s, enqueued payments.failed", p.PaymentID, p.PSP)
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
@@ -0,0 +1,278 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/events"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/retry"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+	"github.com/jackc/pgx/v5"
+)
+
+func (db *fakeDB) InsertPendingPayment(ctx context.Context, p payment.PendingAuthorization, out *event.Envelope) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.pending[p.PaymentID] = p
+	if out != nil {
+		db.outbox = append(db.outbox, *out)
+	}
+	return nil
+}
+
+func (db *fakeDB) GetPendingPayment(ctx context.Context, paymentID string) (payment.PendingAuthorization, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	p, ok := db.pending[paymentID]
+	if !ok {
+		return p, pgx.ErrNoRows
+	}
+	return p, nil
+}
+
+func (db *fakeDB) ListExpiredPendingPayments(ctx context.Context, limit int) ([]payment.PendingAuthorization, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	var expired []payment.PendingAuthorization
+	for _, p := range db.pending {
+		if p.Status == payment.PendingWaiting && p.Deadline.Before(time.Now()) && len(expired) < limit {
+			expired = append(expired, p)
+		}
+	}
+	return expired, nil
+}
+
+func (db *fakeDB) CompletePendingPayment(ctx context.Context, processed events.PaymentProcessed, pspName string, out event.Envelope) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	p, ok := db.pending[processed.PaymentID]
+	if !ok || p.Status != payment.PendingWaiting {
+		return payment.ErrPendingResolved
+	}
+	p.Status = payment.PendingCompleted
+	db.pending[processed.PaymentID] = p
+	db.processed[processed.PaymentID] = processed
+	db.pspOf[processed.PaymentID] = pspName
+	db.outbox = append(db.outbox, out)
+	return nil
+}
+
+func (db *fakeDB) ExpirePendingPayment(ctx context.Context, paymentID string, out event.Envelope) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	p, ok := db.pending[paymentID]
+	if !ok || p.Status != payment.PendingWaiting {
+		return payment.ErrPendingResolved
+	}
+	p.Status = payment.PendingExpired
+	db.pending[paymentID] = p
+	db.outbox = append(db.outbox, out)
+	return nil
+}
+
+func pendingAuthorization(paymentID, status string) payment.PendingAuthorization {
+	ref := "ref_" + paymentID
+	return payment.PendingAuthorization{
+		PaymentID: paymentID,
+		PSP:       "fake",
+		PSPRef:    &ref,
+		Status:    status,
+		Command:   paymentCreated(paymentID),
+		Deadline:  time.Now().Add(time.Minute),
+	}
+}
+
+func TestConfirm(t *testing.T) {
+	tests := []struct {
+		name        string
+		pending     string // статус отложенной авторизации, пусто — её нет
+		pspErr      error
+		wantPSP     int
+		wantOut     []event.EnvelopeType
+		wantPending string
+		wantRetry   bool
+	}{
+		{"authorized", payment.PendingWaiting, nil, 1, []event.EnvelopeType{event.PaymentProcessedEvent}, payment.PendingCompleted, false},
+		{"declined", payment.PendingWaiting, psp.ErrHardDecline, 1, []event.EnvelopeType{event.PaymentProcessedEvent}, payment.PendingCompleted, false},
+		// challenge ещё в силе: confirm повторяется, платёж не проваливается
+		{"psp unavailable", payment.PendingWaiting, psp.ErrUnavailable, 1, nil, payment.PendingWaiting, true},
+		{"psp timeout", payment.PendingWaiting, psp.ErrTimeout, 1, nil, payment.PendingWaiting, true},
+		{"already resolved", payment.PendingExpired, nil, 0, nil, payment.PendingExpired, false},
+		{"no authorization", "", nil, 0, nil, "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDB()
+			if tt.pending != "" {
+				db.pending["pay_1"] = pendingAuthorization("pay_1", tt.pending)
+			}
+			adapter := &fakePSP{fn: func(op string, req psp.Request) (psp.Result, error) {
+				if op != "confirm" || req.PSP != "fake" {
+					t.Errorf("unexpected psp call %s to %q", op, req.PSP)
+				}
+				if tt.pspErr != nil {
+					return psp.Result{}, pspErr(tt.pspErr)
+				}
+				return psp.Result{PSP: "fake", Status: psp.StatusAuthorized}, nil
+			}}
+			h := newTestHandler(db, adapter, testRetryConfig(RetryPSPUnavailable, RetryPSPTimeout))
+
+			confirm := operationRequested(event.PaymentConfirmRequestedEvent, "pay_1", "evt_confirm")
+			if err := h.process(context.Background(), confirm); err != nil {
+				t.Fatalf("process: %v", err)
+			}
+
+			if len(adapter.calls) != tt.wantPSP {
+				t.Fatalf("psp calls = %v, want %d", adapter.calls, tt.wantPSP)
+			}
+			if got := db.outboxTypes(); fmt.Sprint(got) != fmt.Sprint(tt.wantOut) {
+				t.Fatalf("outbox = %v, want %v", got, tt.wantOut)
+			}
+			if got := db.pending["pay_1"].Status; got != tt.wantPending {
+				t.Fatalf("pending status = %q, want %q", got, tt.wantPending)
+			}
+			if (len(db.retries) == 1) != tt.wantRetry {
+				t.Fatalf("retry queue = %d commands, want requeued=%v", len(db.retries), tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestCompletePayment(t *testing.T) {
+	ref := "ref_pay_1"
+	other := "ref_other"
+
+	tests := []struct {
+		name        string
+		pending     string // статус отложенной авторизации, пусто — её нет
+		pspName     string
+		res         psp.Result
+		pspErr      error
+		wantErr     error
+		wantOut     []event.EnvelopeType
+		wantPending string
+		wantVoid    bool
+	}{
+		{"approved", payment.PendingWaiting, "fake", psp.Result{Status: psp.StatusAuthorized}, nil,
+			nil, []event.EnvelopeType{event.PaymentProcessedEvent}, payment.PendingCompleted, false},
+		{"declined", payment.PendingWaiting, "fake", psp.Result{}, pspErr(psp.ErrHardDecline),
+			nil, []event.EnvelopeType{event.PaymentProcessedEvent}, payment.PendingCompleted, false},
+		{"unknown payment", "", "fake", psp.Result{Status: psp.StatusAuthorized}, nil,
+			payment.ErrPendingNotFound, nil, "", false},
+		{"other psp", payment.PendingWaiting, "other", psp.Result{Status: psp.StatusAuthorized}, nil,
+			payment.ErrPendingNotFound, nil, payment.PendingWaiting, false},
+		{"not a decision", payment.PendingWaiting, "fake", psp.Result{}, pspErr(psp.ErrTimeout),
+			payment.ErrInvalidCallback, nil, payment.PendingWaiting, false},
+		{"unexpected status", payment.PendingWaiting, "fake", psp.Result{Status: psp.StatusCaptured}, nil,
+			payment.ErrInvalidCallback, nil, payment.PendingWaiting, false},
+		{"reference mismatch", payment.PendingWaiting, "fake", psp.Result{Status: psp.StatusAuthorized, PSPRef: &other}, nil,
+			payment.ErrInvalidCallback, nil, payment.PendingWaiting, false},
+		{"repeated webhook", payment.PendingCompleted, "fake", psp.Result{Status: psp.StatusAuthorized, PSPRef: &ref}, nil,
+			payment.ErrPendingResolved, nil, payment.PendingCompleted, false},
+		// деньги заблокированы у PSP, а платёж провален — авторизацию нужно отменить
+		{"approved after expiry", payment.PendingExpired, "fake", psp.Result{Status: psp.StatusAuthorized}, nil,
+			payment.ErrPendingResolved, nil, payment.PendingExpired, true},
+		{"declined after expiry", payment.PendingExpired, "fake", psp.Result{}, pspErr(psp.ErrHardDecline),
+			payment.ErrPendingResolved, nil, payment.PendingExpired, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDB()
+			if tt.pending != "" {
+				db.pending["pay_1"] = pendingAuthorization("pay_1", tt.pending)
+			}
+			c := &Client{db: db}
+
+			err := c.CompletePayment(context.Background(), tt.pspName, "pay_1", tt.res, tt.pspErr)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got := db.outboxTypes(); fmt.Sprint(got) != fmt.Sprint(tt.wantOut) {
+				t.Fatalf("outbox = %v, want %v", got, tt.wantOut)
+			}
+			if got := db.pending["pay_1"].Status; got != tt.wantPending {
+				t.Fatalf("pending status = %q, want %q", got, tt.wantPending)
+			}
+			if (len(db.retries) == 1) != tt.wantVoid {
+				t.Fatalf("retry queue = %d commands, want void=%v", len(db.retries), tt.wantVoid)
+			}
+			if tt.wantVoid && db.retries[0].cmd.Type != event.PaymentVoidRequestedEvent {
+				t.Fatalf("enqueued %s, want void", db.retries[0].cmd.Type)
+			}
+		})
+	}
+}
+
+// Отмена по опоздавшему одобрению проходит через очередь повторов к PSP
+// авторизации, повтор webhook'а не проводит её второй раз
+func TestLateApprovalVoided(t *testing.T) {
+	db := newFakeDB()
+	db.pending["pay_1"] = pendingAuthorization("pay_1", payment.PendingExpired)
+	var voids []psp.Request
+	adapter := &fakePSP{fn: func(op string, req psp.Request) (psp.Result, error) {
+		voids = append(voids, req)
+		return psp.Result{PSP: "fake", Status: psp.StatusVoided}, nil
+	}}
+	c := &Client{db: db, retrier: newTestHandler(db, adapter, testRetryConfig()), retry: testRetryConfig()}
+	ctx := context.Background()
+
+	for range 2 {
+		if err := c.CompletePayment(ctx, "fake", "pay_1", psp.Result{Status: psp.StatusAuthorized}, nil); !errors.Is(err, payment.ErrPendingResolved) {
+			t.Fatalf("err = %v", err)
+		}
+	}
+	c.redeliverBatch(ctx)
+	c.redeliverBatch(ctx)
+
+	if len(voids) != 1 {
+		t.Fatalf("psp voids = %d, want 1", len(voids))
+	}
+	req := voids[0]
+	if req.PSP != "fake" || req.PSPRef == nil || *req.PSPRef != "ref_pay_1" || req.IdempotencyKey != expiredVoidID("pay_1") {
+		t.Fatalf("unexpected void request %+v", req)
+	}
+	for _, r := range db.retries {
+		if r.status != retry.StatusDone {
+			t.Fatalf("void command %d left %s", r.id, r.status)
+		}
+	}
+	// повтор отмены переотправляет сохранённый результат
+	if got := db.outboxTypes(); fmt.Sprint(got) != fmt.Sprint([]event.EnvelopeType{event.PaymentVoidedEvent, event.PaymentVoidedEvent}) {
+		t.Fatalf("outbox = %v", got)
+	}
+}
+
+func TestExpirePending(t *testing.T) {
+	db := newFakeDB()
+	overdue := pendingAuthorization("pay_overdue", payment.PendingWaiting)
+	overdue.Deadline = time.Now().Add(-time.Second)
+	db.pending["pay_overdue"] = overdue
+	db.pending["pay_waiting"] = pendingAuthorization("pay_waiting", payment.PendingWaiting)
+	done := pendingAuthorization("pay_done", payment.PendingCompleted)
+	done.Deadline = time.Now().Add(-time.Second)
+	db.pending["pay_done"] = done
+
+	c := &Client{db: db, pending: config.Pending{Timeout: time.Minute, SweepBatch: 10}}
+	c.expirePending(context.Background())
+	c.expirePending(context.Background())
+
+	want := map[string]string{
+		"pay_overdue": payment.PendingExpired,
+		"pay_waiting": payment.PendingWaiting,
+		"pay_done":    payment.PendingCompleted,
+	}
+	for id, status := range want {
+		if got := db.pending[id].Status; got != status {
+			t.Fatalf("%s status = %q, want %q", id, got, status)
+		}
+	}
+	if len(db.outbox) != 1 || db.outbox[0].Type != event.PaymentFailedEvent || db.outbox[0].Key != "pay_overdue" {
+		t.Fatalf("outbox = %v", db.outboxTypes())
+	}
+}
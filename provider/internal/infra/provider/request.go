@@ -0,0 +1,82 @@
+package provider
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+	"github.com/shopspring/decimal"
+)
+
+// поля команд из checkout, нужные PSP
+type command struct {
+	EventID       string  `json:"event_id"`
+	PaymentID     string  `json:"payment_id"`
+	RefundID      string  `json:"refund_id"`
+	MerchantID    string  `json:"merchant_id"`
+	Amount        string  `json:"amount"`
+	Currency      string  `json:"currency"`
+	MethodToken   string  `json:"method_token"`
+	PSPRef        *string `json:"psp_reference"`         // capture/void
+	PaymentPSPRef *string `json:"payment_psp_reference"` // refund
+	ChallengeID   string  `json:"challenge_id"`          // confirm
+}
+
+// newPSPRequest: ключ идемпотентности — refund_id для возврата, event_id команды
+// для capture/void (повтор после отказа — новая операция), иначе payment_id
+func newPSPRequest(evn event.Envelope) (psp.Request, error) {
+	var cmd command
+	if err := json.Unmarshal(evn.Payload, &cmd); err != nil {
+		return psp.Request{}, fmt.Errorf("invalid JSON err:%v", err)
+	}
+
+	amount, err := decimal.NewFromString(cmd.Amount)
+	if err != nil {
+		return psp.Request{}, fmt.Errorf("invalid amount %q", cmd.Amount)
+	}
+
+	req := psp.Request{
+		IdempotencyKey: cmd.PaymentID,
+		PaymentID:      cmd.PaymentID,
+		RefundID:       cmd.RefundID,
+		MerchantID:     cmd.MerchantID,
+		Amount:         amount,
+		Currency:       cmd.Currency,
+		MethodToken:    cmd.MethodToken,
+		PSPRef:         cmd.PSPRef,
+		ChallengeID:    cmd.ChallengeID,
+	}
+	switch {
+	case cmd.RefundID != "":
+		req.IdempotencyKey = cmd.RefundID
+		req.PSPRef = cmd.PaymentPSPRef
+	case evn.Type == event.PaymentCaptureRequestedEvent || evn.Type == event.PaymentVoidRequestedEvent:
+		if cmd.EventID == "" {
+			return psp.Request{}, errors.New("operation command without event_id")
+		}
+		req.IdempotencyKey = cmd.EventID
+	}
+	return req, nil
+}
+
+// decision переводит ответ PSP в статус события: отказ — DECLINED,
+// таймаут, недоступность и прочие сбои — ошибка обработки. Таймаут остаётся
+// psp.ErrTimeout: исход неизвестен, и process не отправит по нему *.failed
+func (h *handler) decision(ctx context.Context, req psp.Request, res psp.Result, err error) (string, *string, error) {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return "", nil, ctxErr
+	}
+	if err == nil {
+		return res.Status, res.PSPRef, nil
+	}
+	if psp.IsDecline(err) {
+		log.Printf("%s: declined payment_id=%s:%v", h.logPrefix, req.PaymentID, err)
+		return pspDeclined, nil, nil
+	}
+	log.Printf("%s: psp error payment_id=%s:%v", h.logPrefix, req.PaymentID, err)
+	return "", nil, err
+}
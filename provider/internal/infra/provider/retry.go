@@ -0,0 +1,275 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/retry"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/helpers"
+)
+
+// Классы повторяемых ошибок для config.Retry.Retryable
+const (
+	RetryDatabase       = "database"        // операция с БД не удалась и после повторов на месте
+	RetryPSPTimeout     = "psp_timeout"     // исход у PSP неизвестен, повтор безопасен по ключу идемпотентности
+	RetryPSPUnavailable = "psp_unavailable" // до PSP не достучались
+)
+
+// errDatabase — повторы операции с БД на месте исчерпаны
+type errDatabase struct{ err error }
+
+func (e errDatabase) Error() string { return e.err.Error() }
+func (e errDatabase) Unwrap() error { return e.err }
+
+func validateRetry(cfg config.Retry) error {
+	if cfg.PollInterval <= 0 || cfg.BatchSize <= 0 {
+		return errors.New("retry: poll_interval and batch_size must be positive")
+	}
+	if cfg.ReclaimAfter <= 0 || cfg.RetainDone <= 0 || cfg.PruneInterval <= 0 {
+		return errors.New("retry: reclaim_after, retain_done and prune_interval must be positive")
+	}
+	for _, class := range cfg.Retryable {
+		switch class {
+		case RetryDatabase, RetryPSPTimeout, RetryPSPUnavailable:
+		default:
+			return fmt.Errorf("retry: unknown retryable error class %q", class)
+		}
+	}
+	return nil
+}
+
+// errorClass — класс ошибки обработки, пусто — не повторяемая
+func errorClass(err error) string {
+	var dbErr errDatabase
+	switch {
+	case errors.As(err, &dbErr):
+		return RetryDatabase
+	case errors.Is(err, psp.ErrTimeout):
+		return RetryPSPTimeout
+	case errors.Is(err, psp.ErrUnavailable):
+		return RetryPSPUnavailable
+	}
+	return ""
+}
+
+// shouldRetry: ошибка из Retryable и попытки attempt не исчерпали MaxAttempts
+func (h *handler) shouldRetry(err error, attempt int) bool {
+	return h.retryable[errorClass(err)] && attempt < h.retryCfg.MaxAttempts
+}
+
+// process обрабатывает команду из Kafka, не задерживая партицию: повторяемый
+// сбой откладывает команду в очередь повторов, таймаут PSP без повторов
+// оставляет её DEAD без события (исход неизвестен), остальные — *.failed. Команда
+// за key, уже ждущим в очереди, встаёт за ним, чтобы не обогнать его.
+// Ошибка — команду не удалось ни обработать, ни отложить
+func (h *handler) process(ctx context.Context, evn event.Envelope) error {
+	var parked bool
+	err := h.retry(ctx, func() (err error) {
+		parked, err = h.db.HasRetryCommands(ctx, evn.Key)
+		return err
+	})
+	if err != nil {
+		log.Printf("%s: database error:%v", h.logPrefix, err)
+		return err
+	}
+	if parked {
+		return h.requeue(ctx, evn, 0, time.Now(), "queued behind earlier command")
+	}
+
+	err = h.provide(ctx, evn)
+	switch {
+	case err == nil:
+		return nil
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case h.shouldRetry(err, 1):
+		return h.requeue(ctx, evn, 1, time.Now().Add(h.backoff(1)), err.Error())
+	case errorClass(err) == RetryPSPTimeout:
+		return h.park(ctx, evn, err)
+	}
+
+	return h.fail(ctx, evn, err)
+}
+
+// park: исход у PSP неизвестен, *.failed мог бы разойтись с уже проведённой
+// операцией. Команда остаётся DEAD для ручного разбора, платёж — в ожидании
+func (h *handler) park(ctx context.Context, evn event.Envelope, cause error) error {
+	err := h.retry(ctx, func() error {
+		return h.db.InsertDeadCommand(ctx, evn, 1, cause.Error())
+	})
+	if err != nil {
+		log.Printf("%s: retry queue error:%v", h.logPrefix, err)
+		return err
+	}
+
+	log.Printf("%s: %s key=%s psp outcome unknown, payment left pending, command parked dead:%v",
+		h.logPrefix, evn.Type, evn.Key, cause)
+	return nil
+}
+
+// requeue откладывает команду: attempt попыток уже было
+func (h *handler) requeue(ctx context.Context, evn event.Envelope, attempt int, nextAt time.Time, reason string) error {
+	err := h.retry(ctx, func() error {
+		return h.db.InsertRetryCommand(ctx, evn, attempt, nextAt, reason)
+	})
+	if err != nil {
+		log.Printf("%s: retry queue error:%v", h.logPrefix, err)
+		return err
+	}
+
+	log.Printf("%s: requeued %s key=%s attempt=%d until %s: %s",
+		h.logPrefix, evn.Type, evn.Key, attempt, nextAt.Format(time.RFC3339), reason)
+	return nil
+}
+
+// fail кладёт *.failed в outbox
+func (h *handler) fail(ctx context.Context, evn event.Envelope, cause error) error {
+	failedEvn, err := newFailedEvent(evn, cause)
+	if err != nil {
+		log.Printf("%s: error while create new failed event:%v", h.logPrefix, err)
+		return nil
+	}
+
+	if err = h.db.EnqueueEvent(ctx, failedEvn); err != nil {
+		log.Printf("%s: outbox error:%v", h.logPrefix, err)
+		return err
+	}
+
+	log.Printf("%s: enqueued %s payment_id=%s", h.logPrefix, failedEvn.Type, failedEvn.Key)
+	return nil
+}
+
+// redeliver — очередная попытка отложенной команды
+func (h *handler) redeliver(ctx context.Context, cmd retry.Command) error {
+	attempt := cmd.Attempt + 1
+
+	if cmd.DecodeErr != nil {
+		log.Printf("%s: retry id=%d dead, can't decode command:%v", h.logPrefix, cmd.ID, cmd.DecodeErr)
+		return h.db.FailRetryCommand(ctx, cmd.ID, attempt, cmd.DecodeErr.Error(), nil)
+	}
+
+	err := h.provide(ctx, cmd.Envelope)
+	switch {
+	case err == nil:
+		return h.db.CompleteRetryCommand(ctx, cmd.ID, attempt)
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case h.shouldRetry(err, attempt):
+		next := time.Now().Add(h.backoff(attempt))
+		log.Printf("%s: retry id=%d key=%s attempt=%d failed, next at %s:%v",
+			h.logPrefix, cmd.ID, cmd.Envelope.Key, attempt, next.Format(time.RFC3339), err)
+		return h.db.RescheduleRetryCommand(ctx, cmd.ID, attempt, next, err.Error())
+	}
+
+	if errorClass(err) == RetryPSPTimeout {
+		// исход у PSP неизвестен: *.failed мог бы разойтись с уже списанными
+		// деньгами, платёж остаётся в ожидании до ручного разбора
+		if err := h.db.FailRetryCommand(ctx, cmd.ID, attempt, err.Error(), nil); err != nil {
+			return err
+		}
+		log.Printf("%s: retry id=%d key=%s dead after %d attempts, psp outcome unknown, payment left pending:%v",
+			h.logPrefix, cmd.ID, cmd.Envelope.Key, attempt, err)
+		return nil
+	}
+
+	var out *event.Envelope
+	if failedEvn, buildErr := newFailedEvent(cmd.Envelope, err); buildErr != nil {
+		log.Printf("%s: error while create new failed event:%v", h.logPrefix, buildErr)
+	} else {
+		out = &failedEvn
+	}
+	if err := h.db.FailRetryCommand(ctx, cmd.ID, attempt, err.Error(), out); err != nil {
+		return err
+	}
+
+	log.Printf("%s: retry id=%d key=%s dead after %d attempts, enqueued *.failed:%v",
+		h.logPrefix, cmd.ID, cmd.Envelope.Key, attempt, err)
+	return nil
+}
+
+// backoff перед попыткой attempt+1 из очереди повторов
+func (h *handler) backoff(attempt int) time.Duration {
+	return backoff(h.retryCfg.BackoffBase, h.retryCfg.BackoffMax, h.retryCfg.BackoffJitter, attempt)
+}
+
+// retryCommands повторяет отложенные команды. Захват строк в PickRetryCommands
+// позволяет запускать его на всех инстансах. Раз в PruneInterval удаляет
+// выполненные команды старше RetainDone
+func (c *Client) retryCommands(ctx context.Context) {
+	ticker := time.NewTicker(c.retry.PollInterval)
+	defer ticker.Stop()
+	prune := time.NewTicker(c.retry.PruneInterval)
+	defer prune.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.redeliverBatch(ctx)
+		case <-prune.C:
+			n, err := c.db.PruneRetryCommands(ctx, c.retry.RetainDone)
+			if err != nil {
+				log.Printf("provider: retry: prune error:%v", err)
+				continue
+			}
+			if n > 0 {
+				log.Printf("provider: retry: pruned %d done commands", n)
+			}
+		}
+	}
+}
+
+func (c *Client) redeliverBatch(ctx context.Context) {
+	cmds, err := c.db.PickRetryCommands(ctx, c.retry.BatchSize, c.retry.ReclaimAfter)
+	if err != nil {
+		log.Printf("provider: retry: database error:%v", err)
+		return
+	}
+
+	for _, cmd := range cmds {
+		if err := c.retrier.redeliver(ctx, cmd); err != nil {
+			// строка останется IN_PROGRESS и вернётся в очередь после таймаута захвата
+			log.Printf("provider: retry id=%d error:%v", cmd.ID, err)
+			if helpers.IsTimeout(err) {
+				return
+			}
+		}
+	}
+}
+
+// backoff: base * 2^(attempt-1), не больше max, минус случайная доля jitter
+func backoff(base, maxDelay time.Duration, jitter float64, attempt int) time.Duration {
+	d := base
+	for i := 1; i < attempt && (maxDelay <= 0 || d < maxDelay); i++ {
+		d *= 2
+	}
+	if maxDelay > 0 {
+		d = min(d, maxDelay)
+	}
+	if jitter > 0 {
+		d -= time.Duration(rand.Float64() * min(jitter, 1) * float64(d))
+	}
+	return d
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
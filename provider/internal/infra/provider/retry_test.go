@@ -0,0 +1,444 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/retry"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/event"
+)
+
+// fakeRetry — строка provider.retry_events
+type fakeRetry struct {
+	id      int64
+	cmd     event.Envelope
+	attempt int
+	status  retry.Status
+	nextAt  time.Time
+	lastErr string
+}
+
+func (db *fakeDB) HasRetryCommands(ctx context.Context, key string) (bool, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	for _, r := range db.retries {
+		if r.cmd.Key == key && (r.status == retry.StatusReady || r.status == retry.StatusInProgress) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (db *fakeDB) InsertRetryCommand(ctx context.Context, cmd event.Envelope, attempt int, nextAt time.Time, lastErr string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.nextID++
+	db.retries = append(db.retries, &fakeRetry{
+		id: db.nextID, cmd: cmd, attempt: attempt, status: retry.StatusReady, nextAt: nextAt, lastErr: lastErr,
+	})
+	return nil
+}
+
+func (db *fakeDB) InsertDeadCommand(ctx context.Context, cmd event.Envelope, attempt int, lastErr string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.nextID++
+	db.retries = append(db.retries, &fakeRetry{
+		id: db.nextID, cmd: cmd, attempt: attempt, status: retry.StatusDead, nextAt: time.Now(), lastErr: lastErr,
+	})
+	return nil
+}
+
+// PickRetryCommands: как pickRetrySQL — только голова каждого key, время пришло
+func (db *fakeDB) PickRetryCommands(ctx context.Context, count int, reclaimAfter time.Duration) ([]retry.Command, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	head := map[string]bool{}
+	var due []*fakeRetry
+	for _, r := range db.retries {
+		if r.status != retry.StatusReady && r.status != retry.StatusInProgress {
+			continue
+		}
+		if head[r.cmd.Key] {
+			continue
+		}
+		head[r.cmd.Key] = true
+		if r.status == retry.StatusReady && !r.nextAt.After(time.Now()) {
+			due = append(due, r)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool { return due[i].nextAt.Before(due[j].nextAt) })
+
+	var cmds []retry.Command
+	for _, r := range due {
+		if len(cmds) == count {
+			break
+		}
+		r.status = retry.StatusInProgress
+		cmds = append(cmds, retry.Command{ID: r.id, Attempt: r.attempt, Envelope: r.cmd})
+	}
+	return cmds, nil
+}
+
+func (db *fakeDB) find(id int64) *fakeRetry {
+	for _, r := range db.retries {
+		if r.id == id {
+			return r
+		}
+	}
+	return nil
+}
+
+func (db *fakeDB) CompleteRetryCommand(ctx context.Context, id int64, attempt int) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	r := db.find(id)
+	r.status, r.attempt, r.lastErr = retry.StatusDone, attempt, ""
+	return nil
+}
+
+func (db *fakeDB) RescheduleRetryCommand(ctx context.Context, id int64, attempt int, nextAt time.Time, lastErr string) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	r := db.find(id)
+	r.status, r.attempt, r.nextAt, r.lastErr = retry.StatusReady, attempt, nextAt, lastErr
+	return nil
+}
+
+func (db *fakeDB) FailRetryCommand(ctx context.Context, id int64, attempt int, lastErr string, out *event.Envelope) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	r := db.find(id)
+	r.status, r.attempt, r.lastErr = retry.StatusDead, attempt, lastErr
+	if out != nil {
+		db.outbox = append(db.outbox, *out)
+	}
+	return nil
+}
+
+func (db *fakeDB) PruneRetryCommands(ctx context.Context, olderThan time.Duration) (int64, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	kept := db.retries[:0]
+	var n int64
+	for _, r := range db.retries {
+		if r.status == retry.StatusDone {
+			n++
+			continue
+		}
+		kept = append(kept, r)
+	}
+	db.retries = kept
+	return n, nil
+}
+
+func testRetryConfig(retryable ...string) config.Retry {
+	return config.Retry{
+		InlineAttempts: 1,
+		InlineBackoff:  time.Millisecond,
+		MaxAttempts:    3,
+		BackoffBase:    time.Second,
+		BackoffMax:     time.Minute,
+		Retryable:      retryable,
+		PollInterval:   time.Second,
+		BatchSize:      10,
+		ReclaimAfter:   time.Minute,
+		RetainDone:     time.Hour,
+		PruneInterval:  time.Hour,
+	}
+}
+
+func newTestHandler(db Database, adapter psp.Adapter, cfg config.Retry) *handler {
+	return newHandler(nil, db, adapter, time.Minute, cfg, "provider: test")
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		attempt int
+		max     time.Duration
+		want    time.Duration
+	}{
+		{"first", 1, time.Minute, time.Second},
+		{"doubles", 3, time.Minute, 4 * time.Second},
+		{"capped", 10, time.Minute, time.Minute},
+		{"large attempt capped", 1000, time.Minute, time.Minute},
+		{"no max", 4, 0, 8 * time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := backoff(time.Second, tt.max, 0, tt.attempt); got != tt.want {
+				t.Fatalf("backoff = %s, want %s", got, tt.want)
+			}
+		})
+	}
+
+	// jitter только уменьшает паузу и не больше чем на свою долю
+	for range 100 {
+		got := backoff(time.Second, time.Minute, 0.5, 2)
+		if got > 2*time.Second || got < time.Second {
+			t.Fatalf("jittered backoff %s out of [1s, 2s]", got)
+		}
+	}
+}
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"database", errDatabase{errFakeDB}, RetryDatabase},
+		{"wrapped database", fmt.Errorf("insert: %w", errDatabase{errFakeDB}), RetryDatabase},
+		{"psp timeout", pspErr(psp.ErrTimeout), RetryPSPTimeout},
+		{"psp unavailable", pspErr(psp.ErrUnavailable), RetryPSPUnavailable},
+		{"decline", pspErr(psp.ErrHardDecline), ""},
+		{"plain", errors.New("invalid JSON"), ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorClass(tt.err); got != tt.want {
+				t.Fatalf("errorClass = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShouldRetry(t *testing.T) {
+	h := newTestHandler(newFakeDB(), &fakePSP{}, testRetryConfig(RetryDatabase, RetryPSPUnavailable))
+
+	tests := []struct {
+		name    string
+		err     error
+		attempt int
+		want    bool
+	}{
+		{"retryable class", errDatabase{errFakeDB}, 1, true},
+		{"last attempt left", pspErr(psp.ErrUnavailable), 2, true},
+		{"attempts exhausted", errDatabase{errFakeDB}, 3, false},
+		{"class not configured", pspErr(psp.ErrTimeout), 1, false},
+		{"not retryable", errors.New("invalid JSON"), 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := h.shouldRetry(tt.err, tt.attempt); got != tt.want {
+				t.Fatalf("shouldRetry = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateRetry(t *testing.T) {
+	if err := validateRetry(testRetryConfig(RetryDatabase)); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+	if err := validateRetry(testRetryConfig("disk")); err == nil {
+		t.Fatal("unknown class accepted")
+	}
+	cfg := testRetryConfig()
+	cfg.ReclaimAfter = 0
+	if err := validateRetry(cfg); err == nil {
+		t.Fatal("zero reclaim_after accepted")
+	}
+}
+
+func TestProcess(t *testing.T) {
+	tests := []struct {
+		name      string
+		retryable []string
+		parked    bool // у key уже есть команда в очереди
+		pspErr    error
+		failWrite int
+		wantPSP   int
+		wantOut   []event.EnvelopeType
+		wantRetry int // attempt отложенной команды, -1 — не отложена
+	}{
+		{"processed", nil, false, nil, 0, 1, []event.EnvelopeType{event.PaymentProcessedEvent}, -1},
+		{"parked behind earlier command", nil, true, nil, 0, 0, nil, 0},
+		{"requeued on retryable psp error", []string{RetryPSPUnavailable}, false, psp.ErrUnavailable, 0, 1, nil, 1},
+		{"requeued on database error", []string{RetryDatabase}, false, nil, 1, 1, nil, 1},
+		{"failed on non retryable error", nil, false, psp.ErrUnavailable, 0, 1, []event.EnvelopeType{event.PaymentFailedEvent}, -1},
+		{"decline is a result", nil, false, psp.ErrHardDecline, 0, 1, []event.EnvelopeType{event.PaymentProcessedEvent}, -1},
+		// исход неизвестен: без *.failed, команда остаётся DEAD для разбора
+		{"psp timeout without retries parked", nil, false, psp.ErrTimeout, 0, 1, nil, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDB()
+			db.failWrites = tt.failWrite
+			if tt.parked {
+				_ = db.InsertRetryCommand(context.Background(), paymentCreated("pay_1"), 1, time.Now().Add(time.Hour), "earlier")
+			}
+			adapter := &fakePSP{fn: func(op string, req psp.Request) (psp.Result, error) {
+				if tt.pspErr != nil {
+					return psp.Result{}, pspErr(tt.pspErr)
+				}
+				return psp.Result{PSP: "fake", Status: "APPROVED"}, nil
+			}}
+			h := newTestHandler(db, adapter, testRetryConfig(tt.retryable...))
+
+			if err := h.process(context.Background(), paymentCreated("pay_1")); err != nil {
+				t.Fatalf("process: %v", err)
+			}
+
+			if len(adapter.calls) != tt.wantPSP {
+				t.Fatalf("psp calls = %v, want %d", adapter.calls, tt.wantPSP)
+			}
+			if got := db.outboxTypes(); fmt.Sprint(got) != fmt.Sprint(tt.wantOut) {
+				t.Fatalf("outbox = %v, want %v", got, tt.wantOut)
+			}
+			queued := db.retries
+			if tt.parked {
+				queued = queued[1:]
+			}
+			switch {
+			case tt.wantRetry < 0 && len(queued) != 0:
+				t.Fatalf("unexpected retry command %+v", queued[0])
+			case tt.wantRetry >= 0 && len(queued) != 1:
+				t.Fatalf("expected 1 retry command, got %d", len(queued))
+			case tt.wantRetry >= 0 && queued[0].attempt != tt.wantRetry:
+				t.Fatalf("retry attempt = %d, want %d", queued[0].attempt, tt.wantRetry)
+			case tt.wantRetry >= 0 && (queued[0].status == retry.StatusDead) != errors.Is(tt.pspErr, psp.ErrTimeout):
+				t.Fatalf("retry status = %s", queued[0].status)
+			}
+		})
+	}
+}
+
+func TestRedeliver(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempt    int // попыток до этой
+		pspErr     error
+		decodeErr  error
+		wantStatus retry.Status
+		wantOut    []event.EnvelopeType
+	}{
+		{"done", 1, nil, nil, retry.StatusDone, []event.EnvelopeType{event.PaymentProcessedEvent}},
+		{"rescheduled", 1, psp.ErrUnavailable, nil, retry.StatusReady, nil},
+		{"exhausted", 2, psp.ErrUnavailable, nil, retry.StatusDead, []event.EnvelopeType{event.PaymentFailedEvent}},
+		// исход неизвестен: payments.failed не уходит, платёж остаётся в ожидании
+		{"exhausted psp timeout", 2, psp.ErrTimeout, nil, retry.StatusDead, nil},
+		{"undecodable", 0, nil, errors.New("bad headers"), retry.StatusDead, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newFakeDB()
+			_ = db.InsertRetryCommand(context.Background(), paymentCreated("pay_1"), tt.attempt, time.Now(), "")
+			adapter := &fakePSP{fn: func(op string, req psp.Request) (psp.Result, error) {
+				if tt.pspErr != nil {
+					return psp.Result{}, pspErr(tt.pspErr)
+				}
+				return psp.Result{PSP: "fake", Status: "APPROVED"}, nil
+			}}
+			h := newTestHandler(db, adapter, testRetryConfig(RetryPSPUnavailable, RetryPSPTimeout))
+
+			cmd := retry.Command{ID: 1, Attempt: tt.attempt, Envelope: paymentCreated("pay_1"), DecodeErr: tt.decodeErr}
+			if err := h.redeliver(context.Background(), cmd); err != nil {
+				t.Fatalf("redeliver: %v", err)
+			}
+
+			r := db.retries[0]
+			if r.status != tt.wantStatus {
+				t.Fatalf("status = %s, want %s", r.status, tt.wantStatus)
+			}
+			if r.attempt != tt.attempt+1 {
+				t.Fatalf("attempt = %d, want %d", r.attempt, tt.attempt+1)
+			}
+			if tt.wantStatus == retry.StatusReady && !r.nextAt.After(time.Now()) {
+				t.Fatal("rescheduled without backoff")
+			}
+			if got := db.outboxTypes(); fmt.Sprint(got) != fmt.Sprint(tt.wantOut) {
+				t.Fatalf("outbox = %v, want %v", got, tt.wantOut)
+			}
+		})
+	}
+}
+
+// Команда за отложенной командой того же платежа встаёт за ней, другие
+// платежи идут дальше; воркер повторов отдаёт их по порядку
+func TestHeadOfLineParking(t *testing.T) {
+	db := newFakeDB()
+	unavailable := true
+	adapter := &fakePSP{fn: func(op string, req psp.Request) (psp.Result, error) {
+		if unavailable && req.PaymentID == "pay_1" {
+			return psp.Result{}, pspErr(psp.ErrUnavailable)
+		}
+		return psp.Result{PSP: "fake", Status: "APPROVED"}, nil
+	}}
+	cfg := testRetryConfig(RetryPSPUnavailable)
+	cfg.BackoffBase = time.Nanosecond
+	h := newTestHandler(db, adapter, cfg)
+	ctx := context.Background()
+
+	capture := paymentCreated("pay_1")
+	capture.Type = event.PaymentCaptureRequestedEvent
+	for _, evn := range []event.Envelope{paymentCreated("pay_1"), capture, paymentCreated("pay_2")} {
+		if err := h.process(ctx, evn); err != nil {
+			t.Fatalf("process %s: %v", evn.Type, err)
+		}
+	}
+
+	if got := fmt.Sprint(adapter.calls); got != "[authorize:pay_1 authorize:pay_2]" {
+		t.Fatalf("capture overtook parked authorization: psp calls %s", got)
+	}
+	if len(db.retries) != 2 || db.retries[1].cmd.Type != event.PaymentCaptureRequestedEvent || db.retries[1].attempt != 0 {
+		t.Fatalf("capture not parked behind authorization: %+v", db.retries)
+	}
+
+	unavailable = false
+	c := &Client{db: db, retrier: h, retry: cfg}
+	time.Sleep(time.Millisecond)
+
+	// в каждом проходе берётся только голова key
+	c.redeliverBatch(ctx)
+	if db.retries[0].status != retry.StatusDone || db.retries[1].status != retry.StatusReady {
+		t.Fatalf("unexpected statuses after first pass: %s, %s", db.retries[0].status, db.retries[1].status)
+	}
+	c.redeliverBatch(ctx)
+	if db.retries[1].status != retry.StatusDone {
+		t.Fatalf("capture not redelivered: %s", db.retries[1].status)
+	}
+	want := "[authorize:pay_1 authorize:pay_2 authorize:pay_1 capture:evt_pay_1]"
+	if got := fmt.Sprint(adapter.calls); got != want {
+		t.Fatalf("psp calls %s, want %s", got, want)
+	}
+
+	if n, _ := db.PruneRetryCommands(ctx, cfg.RetainDone); n != 2 {
+		t.Fatalf("pruned %d, want 2", n)
+	}
+}
+
+// Команду, которую не удалось ни обработать, ни отложить, processUntilDone
+// повторяет, а не бросает: без FinalizeEvent consumer встал бы
+func TestProcessUntilDoneKeepsCommand(t *testing.T) {
+	db := newFakeDB()
+	db.failWrites = 1 // первая запись payments.failed в outbox упадёт
+	adapter := &fakePSP{fn: func(op string, req psp.Request) (psp.Result, error) {
+		return psp.Result{}, pspErr(psp.ErrUnavailable)
+	}}
+	h := newTestHandler(db, adapter, testRetryConfig())
+
+	if err := h.processUntilDone(context.Background(), paymentCreated("pay_1")); err != nil {
+		t.Fatalf("processUntilDone: %v", err)
+	}
+	if len(adapter.calls) != 2 {
+		t.Fatalf("psp calls = %v, want 2", adapter.calls)
+	}
+	if got := fmt.Sprint(db.outboxTypes()); got != "[payments.failed]" {
+		t.Fatalf("outbox = %s", got)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := h.processUntilDone(ctx, paymentCreated("pay_2")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+}
@@ -0,0 +1,192 @@
+package psp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/acquirer"
+)
+
+// HTTPAdapter — PSP по HTTP-контракту acquirer (cmd/fakepsp). Каждая попытка
+// ограничена Timeout; сбои повторяются до MaxAttempts с тем же Idempotency-Key,
+// поэтому повтор не проводит деньги второй раз. Если хоть одна попытка
+// закончилась таймаутом, исход узнаётся запросом статуса, иначе — ErrTimeout
+type HTTPAdapter struct {
+	name   string
+	cfg    config.HTTPPSP
+	client *http.Client
+}
+
+func NewHTTP(cfg config.HTTPPSP) (*HTTPAdapter, error) {
+	if cfg.Name == "" || cfg.BaseURL == "" {
+		return nil, errors.New("http psp: name and base_url are required")
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	cfg.BaseURL = strings.TrimRight(cfg.BaseURL, "/")
+
+	return &HTTPAdapter{
+		name:   cfg.Name,
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}, nil
+}
+
+func (a *HTTPAdapter) Name() string {
+	return a.name
+}
+
+func (a *HTTPAdapter) Authorize(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return a.do(ctx, acquirer.OpAuthorize, req)
+}
+
+func (a *HTTPAdapter) Capture(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return a.do(ctx, acquirer.OpCapture, req)
+}
+
+func (a *HTTPAdapter) Refund(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return a.do(ctx, acquirer.OpRefund, req)
+}
+
+func (a *HTTPAdapter) Void(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return a.do(ctx, acquirer.OpVoid, req)
+}
+
+func (a *HTTPAdapter) Confirm(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return a.do(ctx, acquirer.OpConfirm, req)
+}
+
+// errRetryable — ответ, который стоит повторить
+type errRetryable struct{ err error }
+
+func (e errRetryable) Error() string { return e.err.Error() }
+func (e errRetryable) Unwrap() error { return e.err }
+
+func (a *HTTPAdapter) do(ctx context.Context, operation string, req psp.Request) (psp.Result, error) {
+	body, err := json.Marshal(acquirer.OperationRequest{
+		PaymentID:   req.PaymentID,
+		RefundID:    req.RefundID,
+		MerchantID:  req.MerchantID,
+		Amount:      req.Amount.String(),
+		Currency:    req.Currency,
+		MethodToken: req.MethodToken,
+		PSPRef:      req.PSPRef,
+		ChallengeID: req.ChallengeID,
+	})
+	if err != nil {
+		return psp.Result{}, err
+	}
+
+	var lastErr, timeoutErr error
+	for attempt := range a.cfg.MaxAttempts {
+		if attempt > 0 {
+			t := time.NewTimer(a.cfg.Backoff * time.Duration(attempt))
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return psp.Result{}, psp.NewError(psp.ErrTimeout, a.name, "", ctx.Err().Error())
+			case <-t.C:
+			}
+		}
+
+		res, err := a.attempt(ctx, operation, req.IdempotencyKey, body)
+		var retry errRetryable
+		if !errors.As(err, &retry) {
+			return res, err
+		}
+		lastErr = retry.err
+		if errors.Is(lastErr, psp.ErrTimeout) {
+			timeoutErr = lastErr
+		}
+	}
+	if timeoutErr == nil {
+		return psp.Result{}, lastErr
+	}
+
+	// запрос мог дойти до эквайера: недоступность последней попытки не даёт
+	// права уйти на другой PSP, пока эквайер не скажет, было ли решение
+	if res, ok, err := a.status(ctx, operation, req.IdempotencyKey); ok {
+		return res, err
+	}
+	return psp.Result{}, timeoutErr
+}
+
+// status — решение эквайера по ключу идемпотентности, ok=false — его не узнать
+func (a *HTTPAdapter) status(ctx context.Context, operation, idemKey string) (psp.Result, bool, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet,
+		a.cfg.BaseURL+"/v1/operations/"+url.PathEscape(operation)+"/"+url.PathEscape(idemKey), nil)
+	if err != nil {
+		return psp.Result{}, false, nil
+	}
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		return psp.Result{}, false, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return psp.Result{}, false, nil
+	}
+
+	var out acquirer.OperationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return psp.Result{}, false, nil
+	}
+	res, err := out.Result(a.name)
+	return res, true, err
+}
+
+// attempt классифицирует ответ: до эквайера не достучались или он ответил 503 —
+// ErrUnavailable (можно на другой PSP); таймаут, обрыв, 5xx — ErrTimeout
+// (запрос мог быть проведён, исход неизвестен)
+func (a *HTTPAdapter) attempt(ctx context.Context, operation, idemKey string, body []byte) (psp.Result, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, a.cfg.BaseURL+"/v1/"+operation, bytes.NewReader(body))
+	if err != nil {
+		return psp.Result{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set(acquirer.IdempotencyHeader, idemKey)
+
+	resp, err := a.client.Do(httpReq)
+	if err != nil {
+		if ctx.Err() != nil {
+			return psp.Result{}, psp.NewError(psp.ErrTimeout, a.name, "", err.Error())
+		}
+		kind := psp.ErrTimeout
+		if opErr := (*net.OpError)(nil); errors.As(err, &opErr) && opErr.Op == "dial" {
+			kind = psp.ErrUnavailable
+		}
+		return psp.Result{}, errRetryable{psp.NewError(kind, a.name, "", err.Error())}
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+	case resp.StatusCode == http.StatusServiceUnavailable:
+		return psp.Result{}, errRetryable{psp.NewError(psp.ErrUnavailable, a.name, "", resp.Status)}
+	case resp.StatusCode >= 500:
+		return psp.Result{}, errRetryable{psp.NewError(psp.ErrTimeout, a.name, "", resp.Status)}
+	default:
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<10))
+		return psp.Result{}, fmt.Errorf("%s: %s %s: %s", a.name, operation, resp.Status, bytes.TrimSpace(msg))
+	}
+
+	var out acquirer.OperationResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return psp.Result{}, errRetryable{psp.NewError(psp.ErrTimeout, a.name, "", "invalid response: "+err.Error())}
+	}
+
+	return out.Result(a.name)
+}
@@ -0,0 +1,202 @@
+package psp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/acquirer"
+	"github.com/shopspring/decimal"
+)
+
+// acquirerStub отвечает на операции по очереди ответами replies, последний — на все
+// остальные запросы, и запоминает ключи идемпотентности. Запрос статуса
+// отвечает lookup, nil — 404
+type acquirerStub struct {
+	mu      sync.Mutex
+	replies []func(w http.ResponseWriter, r *http.Request)
+	lookup  func(w http.ResponseWriter, r *http.Request)
+	keys    []string
+	lookups []string // пути запросов статуса
+}
+
+func (s *acquirerStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	if r.Method == http.MethodGet {
+		s.lookups = append(s.lookups, r.URL.Path)
+		s.mu.Unlock()
+		if s.lookup == nil {
+			http.NotFound(w, r)
+			return
+		}
+		s.lookup(w, r)
+		return
+	}
+	s.keys = append(s.keys, r.Header.Get(acquirer.IdempotencyHeader))
+	reply := s.replies[min(len(s.keys), len(s.replies))-1]
+	s.mu.Unlock()
+	reply(w, r)
+}
+
+func (s *acquirerStub) calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.keys)
+}
+
+func status(code int) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(code) }
+}
+
+func respond(out acquirer.OperationResponse) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(out)
+	}
+}
+
+// hangUp держит запрос дольше таймаута попытки
+func hangUp(w http.ResponseWriter, r *http.Request) {
+	select {
+	case <-r.Context().Done():
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+// reset рвёт соединение без ответа
+func reset(w http.ResponseWriter, r *http.Request) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err == nil {
+		_ = conn.Close()
+	}
+}
+
+func TestHTTPAdapter(t *testing.T) {
+	ref := "psp_ref_1"
+	authorized := respond(acquirer.OperationResponse{Operation: acquirer.OpAuthorize, Status: psp.StatusAuthorized, PSPRef: &ref})
+
+	tests := []struct {
+		name      string
+		replies   []func(http.ResponseWriter, *http.Request)
+		lookup    func(http.ResponseWriter, *http.Request)
+		wantErr   error
+		wantCalls int
+	}{
+		{"approved", []func(http.ResponseWriter, *http.Request){authorized}, nil, nil, 1},
+		{"retry after unavailable", []func(http.ResponseWriter, *http.Request){status(http.StatusServiceUnavailable), authorized}, nil, nil, 2},
+		{"retry after reset", []func(http.ResponseWriter, *http.Request){reset, authorized}, nil, nil, 2},
+		{"unavailable exhausted", []func(http.ResponseWriter, *http.Request){status(http.StatusServiceUnavailable)}, nil, psp.ErrUnavailable, 3},
+		// исход 5xx, обрыва и таймаута неизвестен: не ErrUnavailable, иначе роутер уйдёт на другой PSP
+		{"server error", []func(http.ResponseWriter, *http.Request){status(http.StatusInternalServerError)}, nil, psp.ErrTimeout, 3},
+		{"connection reset", []func(http.ResponseWriter, *http.Request){reset}, nil, psp.ErrTimeout, 3},
+		{"attempt timeout", []func(http.ResponseWriter, *http.Request){hangUp}, nil, psp.ErrTimeout, 3},
+		// таймаут любой попытки делает исход неизвестным, даже если последняя — 503
+		{"timeout then unavailable", []func(http.ResponseWriter, *http.Request){hangUp, status(http.StatusServiceUnavailable)},
+			nil, psp.ErrTimeout, 3},
+		// исход после таймаута берётся из запроса статуса
+		{"status after timeout", []func(http.ResponseWriter, *http.Request){hangUp, status(http.StatusServiceUnavailable)},
+			authorized, nil, 3},
+		{"invalid response", []func(http.ResponseWriter, *http.Request){func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("<html>"))
+		}}, nil, psp.ErrTimeout, 3},
+		{"decline not retried", []func(http.ResponseWriter, *http.Request){respond(acquirer.OperationResponse{
+			Status: acquirer.StatusDeclined, DeclineType: acquirer.DeclineSoft, DeclineCode: "insufficient_funds",
+		})}, nil, psp.ErrSoftDecline, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stub := &acquirerStub{replies: tt.replies, lookup: tt.lookup}
+			srv := httptest.NewServer(stub)
+			defer srv.Close()
+
+			a, err := NewHTTP(config.HTTPPSP{Name: "acq", BaseURL: srv.URL + "/", Timeout: 50 * time.Millisecond,
+				MaxAttempts: 3, Backoff: time.Millisecond})
+			if err != nil {
+				t.Fatalf("NewHTTP: %v", err)
+			}
+
+			res, err := a.Authorize(context.Background(), psp.Request{IdempotencyKey: "pay_1", PaymentID: "pay_1",
+				Amount: decimal.NewFromInt(10), Currency: "USD"})
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == nil && (res.PSP != "acq" || res.PSPRef == nil || *res.PSPRef != ref) {
+				t.Fatalf("unexpected result %+v", res)
+			}
+			if n := stub.calls(); n != tt.wantCalls {
+				t.Fatalf("calls = %d, want %d", n, tt.wantCalls)
+			}
+			// повтор несёт тот же ключ: эквайер не проведёт деньги второй раз
+			for _, key := range stub.keys {
+				if key != "pay_1" {
+					t.Fatalf("attempt with idempotency key %q", key)
+				}
+			}
+			for _, path := range stub.lookups {
+				if path != "/v1/operations/authorize/pay_1" {
+					t.Fatalf("status lookup %s", path)
+				}
+			}
+		})
+	}
+}
+
+func TestHTTPAdapterRejectedRequest(t *testing.T) {
+	stub := &acquirerStub{replies: []func(http.ResponseWriter, *http.Request){status(http.StatusBadRequest)}}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	a, _ := NewHTTP(config.HTTPPSP{Name: "acq", BaseURL: srv.URL, Timeout: time.Second, MaxAttempts: 3})
+	_, err := a.Capture(context.Background(), psp.Request{IdempotencyKey: "evt_1"})
+	if err == nil || errorKind(err) != nil {
+		t.Fatalf("expected plain error, got %v", err)
+	}
+	if stub.calls() != 1 {
+		t.Fatalf("rejected request retried %d times", stub.calls())
+	}
+}
+
+func TestHTTPAdapterUnreachable(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	url := srv.URL
+	srv.Close()
+
+	a, _ := NewHTTP(config.HTTPPSP{Name: "acq", BaseURL: url, Timeout: time.Second, MaxAttempts: 2})
+	// соединение не установлено — запрос не ушёл, можно на другой PSP
+	if _, err := a.Authorize(context.Background(), psp.Request{IdempotencyKey: "pay_1"}); !errors.Is(err, psp.ErrUnavailable) {
+		t.Fatalf("expected unavailable, got %v", err)
+	}
+}
+
+func TestHTTPAdapterContextDuringBackoff(t *testing.T) {
+	stub := &acquirerStub{replies: []func(http.ResponseWriter, *http.Request){status(http.StatusServiceUnavailable)}}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	a, _ := NewHTTP(config.HTTPPSP{Name: "acq", BaseURL: srv.URL, Timeout: time.Second, MaxAttempts: 3, Backoff: time.Hour})
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := a.Authorize(ctx, psp.Request{IdempotencyKey: "pay_1"}); !errors.Is(err, psp.ErrTimeout) {
+		t.Fatalf("expected timeout, got %v", err)
+	}
+	if stub.calls() != 1 {
+		t.Fatalf("calls = %d, want 1", stub.calls())
+	}
+}
+
+// errorKind — вид ошибки PSP, nil — не ошибка PSP
+func errorKind(err error) error {
+	for _, kind := range []error{psp.ErrHardDecline, psp.ErrSoftDecline, psp.ErrTimeout, psp.ErrUnavailable} {
+		if errors.Is(err, kind) {
+			return kind
+		}
+	}
+	return nil
+}
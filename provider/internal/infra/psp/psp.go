@@ -1,37 +1,320 @@
 package psp
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
 	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync"
 
 	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/acquirer"
 	"github.com/google/uuid"
 )
 
-type PSPStatus string
+// имя основного симулятора, если в конфиге не задано
+const DefaultSimulatorName = "simulator"
 
-const (
-	Authorized PSPStatus = "AUTHORIZED"
-	Declined   PSPStatus = "DECLINED"
-)
+// сколько последних решений симулятор помнит для повторов по ключу идемпотентности
+const rememberDecisions = 100_000
+
+type decision struct {
+	res   psp.Result
+	err   error
+	final *decision // итог PENDING или REQUIRES_ACTION до Settle/Confirm
+}
 
+// Simulator — адаптер PSP без реального эквайера: исход задают сценарии
+// (магические суммы и токены), остальное решает случай, при Seed — воспроизводимый
 type Simulator struct {
-	cfg config.PSP
+	name      string
+	cfg       config.Simulator
+	scenarios []scenario
+	merchants map[string]float64
+
+	mu        sync.Mutex
+	decisions map[string]decision // операция:ключ идемпотентности -> решение
+	tries     map[string]int      // операция:ключ идемпотентности -> число запросов
+	order     []string            // порядок вытеснения старых ключей
 }
 
-func New(cfg *config.PSP) *Simulator {
+func New(cfg config.Simulator) (*Simulator, error) {
+	name := cfg.Name
+	if name == "" {
+		name = DefaultSimulatorName
+	}
+
+	scenarios, err := newScenarios(cfg.Scenarios)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+	if err := validateLatency(cfg.Latency); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	merchants := make(map[string]float64, len(cfg.Merchants))
+	for id, chance := range cfg.Merchants {
+		merchants[strings.ToLower(id)] = chance
+	}
+
 	return &Simulator{
-		cfg: *cfg,
+		name:      name,
+		cfg:       cfg,
+		scenarios: scenarios,
+		merchants: merchants,
+		decisions: make(map[string]decision),
+		tries:     make(map[string]int),
+	}, nil
+}
+
+func (s *Simulator) Name() string {
+	return s.name
+}
+
+func (s *Simulator) Authorize(ctx context.Context, req psp.Request) (psp.Result, error) {
+	chance := s.cfg.Chance
+	if c, ok := s.merchants[strings.ToLower(req.MerchantID)]; ok {
+		chance = c
+	}
+	return s.decide(ctx, acquirer.OpAuthorize, req, chance, psp.StatusAuthorized, "")
+}
+
+func (s *Simulator) Refund(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return s.decide(ctx, acquirer.OpRefund, req, s.cfg.RefundChance, psp.StatusRefunded, "rf_")
+}
+
+func (s *Simulator) Capture(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return s.decide(ctx, acquirer.OpCapture, req, s.cfg.CaptureChance, psp.StatusCaptured, "cp_")
+}
+
+// Отмена авторизации в симуляторе проходит, если сценарий не сказал иначе
+func (s *Simulator) Void(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return s.decide(ctx, acquirer.OpVoid, req, 1, psp.StatusVoided, "")
+}
+
+// decide: сценарий и задержка, затем решение. Одобрения и отказы запоминаются
+// по ключу идемпотентности: повтор получает прежнее решение. Таймаут и
+// недоступность не запоминаются — до решения PSP такой запрос не дошёл
+func (s *Simulator) decide(ctx context.Context, operation string, req psp.Request,
+	chance float64, status, refPrefix string) (psp.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return psp.Result{}, psp.NewError(psp.ErrTimeout, s.name, "", err.Error())
+	}
+
+	sc := s.match(operation, req)
+
+	lat := s.cfg.Latency
+	if sc != nil && sc.Latency.Distribution != "" {
+		lat = sc.Latency
+	}
+	// у каждого повтора своя задержка и недоступность, но при Seed
+	// последовательность для ключа та же при любом порядке обработки
+	net := rand.New(s.source(operation+"#"+strconv.Itoa(s.try(operation, req.IdempotencyKey)), req.IdempotencyKey))
+	d := latency(lat, net.Float64, net.NormFloat64)
+	unavailable := net.Float64() < s.cfg.UnavailableChance
+
+	if err := sleep(ctx, s.name, d); err != nil {
+		return psp.Result{}, err
+	}
+
+	if sc != nil {
+		approve, err := sc.outcome(s.name)
+		if err != nil {
+			return psp.Result{}, err
+		}
+		if approve {
+			chance = 1
+		}
+	}
+
+	if unavailable {
+		return psp.Result{}, psp.NewError(psp.ErrUnavailable, s.name, "", "simulated outage")
+	}
+
+	roll := func() decision {
+		src := s.source(operation, req.IdempotencyKey)
+		if sc != nil && (sc.Outcome == OutcomePending || sc.Outcome == OutcomeChallenge) {
+			return s.pending(sc, src, chance, status)
+		}
+		if rand.New(src).Float64() < chance {
+			if status == psp.StatusVoided {
+				// отмена новой ссылки не создаёт, остаётся ссылка авторизации
+				return decision{res: psp.Result{Status: status}}
+			}
+			ref := s.cfg.Prefix + refPrefix + uuid.Must(uuid.NewRandomFromReader(src)).String()
+			return decision{res: psp.Result{Status: status, PSPRef: &ref}}
+		}
+		return decision{err: psp.NewError(psp.ErrHardDecline, s.name, "do_not_honor", "declined by simulator")}
+	}
+
+	if req.IdempotencyKey == "" {
+		d := roll()
+		return d.res, d.err
+	}
+
+	key := operation + ":" + req.IdempotencyKey
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if d, ok := s.decisions[key]; ok {
+		return d.res, d.err
 	}
+
+	dec := roll()
+	if _, ok := s.tries[key]; !ok {
+		s.remember(key)
+	}
+	s.decisions[key] = dec
+
+	return dec.res, dec.err
 }
 
-func (s *Simulator) DecidePayment() (status string, pspRef *string) {
-	if isAuthorized(s.cfg.Chance) {
-		ref := s.cfg.Prefix + uuid.NewString() // генерируйте как угодно
-		return string(Authorized), &ref
+// try — номер запроса операции с этим ключом идемпотентности, с нуля
+func (s *Simulator) try(operation, idemKey string) int {
+	if idemKey == "" {
+		return 0
+	}
+	key := operation + ":" + idemKey
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	n, ok := s.tries[key]
+	if !ok {
+		if _, ok := s.decisions[key]; !ok {
+			s.remember(key)
+		}
 	}
-	return string(Declined), nil
+	s.tries[key] = n + 1
+	return n
 }
 
-func isAuthorized(chance float64) bool {
-	return rand.Float64() < chance // true ~80% случаев
+// remember ставит ключ в очередь вытеснения, самый старый ключ забывается
+// вместе с решением и счётчиком запросов. Вызывается под mu
+func (s *Simulator) remember(key string) {
+	if len(s.order) >= rememberDecisions {
+		delete(s.decisions, s.order[0])
+		delete(s.tries, s.order[0])
+		s.order = s.order[1:]
+	}
+	s.order = append(s.order, key)
+}
+
+// pending: ответ PENDING (или REQUIRES_ACTION с challenge) со ссылкой
+// авторизации, итог по Final сценария (пусто — по chance) ждёт Settle или Confirm
+func (s *Simulator) pending(sc *scenario, src *rand.ChaCha8, chance float64, status string) decision {
+	ref := s.cfg.Prefix + uuid.Must(uuid.NewRandomFromReader(src)).String()
+
+	res := psp.Result{Status: psp.StatusPending, PSPRef: &ref}
+	if sc.Outcome == OutcomeChallenge {
+		id := "ch_" + uuid.Must(uuid.NewRandomFromReader(src)).String()
+		res.Status = psp.StatusRequiresAction
+		res.NextAction = &psp.NextAction{ChallengeID: id, RedirectURL: s.cfg.ChallengeURL + "?challenge_id=" + id}
+	}
+
+	final := decision{res: psp.Result{Status: status, PSPRef: &ref}}
+	approve, err := sc.final(s.name)
+	switch {
+	case err != nil:
+		final = decision{err: err}
+	case !approve && rand.New(src).Float64() >= chance:
+		final = decision{err: psp.NewError(psp.ErrHardDecline, s.name, "do_not_honor", "declined by simulator")}
+	}
+
+	return decision{res: res, final: &final}
+}
+
+// Settle завершает PENDING-операцию: запомненное решение заменяется итогом,
+// повторы и запрос статуса дальше видят его. ok=false — такой операции нет
+func (s *Simulator) Settle(operation, idemKey string) (psp.Result, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := operation + ":" + idemKey
+	d, ok := s.decisions[key]
+	if !ok || d.final == nil || d.res.Status != psp.StatusPending {
+		return psp.Result{}, false, nil
+	}
+	s.decisions[key] = *d.final
+	return d.final.res, true, d.final.err
+}
+
+// Confirm: покупатель прошёл challenge, авторизация получает итог. Повтор
+// после итога возвращает его же, confirm без challenge — отказ
+func (s *Simulator) Confirm(ctx context.Context, req psp.Request) (psp.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return psp.Result{}, psp.NewError(psp.ErrTimeout, s.name, "", err.Error())
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := acquirer.OpAuthorize + ":" + req.IdempotencyKey
+	d, ok := s.decisions[key]
+	if !ok {
+		return psp.Result{}, psp.NewError(psp.ErrHardDecline, s.name, "unknown_authorization", "confirm without authorization")
+	}
+	if d.final == nil {
+		return d.res, d.err
+	}
+	if d.res.Status != psp.StatusRequiresAction {
+		return psp.Result{}, psp.NewError(psp.ErrHardDecline, s.name, "no_challenge", "authorization does not require action")
+	}
+	if req.ChallengeID != d.res.NextAction.ChallengeID {
+		return psp.Result{}, psp.NewError(psp.ErrHardDecline, s.name, "challenge_mismatch", "unknown challenge_id")
+	}
+
+	s.decisions[key] = *d.final
+	return d.final.res, d.final.err
+}
+
+// Fault — сетевой сбой, заданный сценарием (timeout, server_error,
+// connection_reset). fakepsp отыгрывает его на уровне HTTP, не вызывая операцию
+func (s *Simulator) Fault(operation string, req psp.Request) string {
+	sc := s.match(operation, req)
+	if sc == nil {
+		return ""
+	}
+	switch sc.Outcome {
+	case OutcomeTimeout, OutcomeServerError, OutcomeReset:
+		return sc.Outcome
+	}
+	return ""
+}
+
+// Lookup — запомненное решение по ключу идемпотентности, для запроса статуса
+func (s *Simulator) Lookup(operation, idemKey string) (psp.Result, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.decisions[operation+":"+idemKey]
+	return d.res, ok, d.err
+}
+
+func (s *Simulator) match(operation string, req psp.Request) *scenario {
+	for i := range s.scenarios {
+		if s.scenarios[i].matches(operation, req) {
+			return &s.scenarios[i]
+		}
+	}
+	return nil
+}
+
+// source — генератор решения и сбоев: при Seed зависит только от seed, операции и ключа,
+// поэтому исход платежа не меняется от порядка и параллельности обработки
+func (s *Simulator) source(operation, idemKey string) *rand.ChaCha8 {
+	var seed [32]byte
+	if s.cfg.Seed == 0 || idemKey == "" {
+		for i := 0; i < len(seed); i += 8 {
+			binary.LittleEndian.PutUint64(seed[i:], rand.Uint64())
+		}
+	} else {
+		seed = sha256.Sum256(fmt.Appendf(nil, "%d:%s:%s:%s", s.cfg.Seed, s.name, operation, idemKey))
+	}
+	return rand.NewChaCha8(seed)
 }
@@ -0,0 +1,140 @@
+package psp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/shopspring/decimal"
+)
+
+func newTestSimulator(t *testing.T, cfg config.Simulator) *Simulator {
+	t.Helper()
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return s
+}
+
+func authRequest(key, amount string) psp.Request {
+	return psp.Request{IdempotencyKey: key, PaymentID: key, MerchantID: "m_1",
+		Amount: decimal.RequireFromString(amount), Currency: "USD", MethodToken: "tok_visa"}
+}
+
+func TestSimulatorScenarios(t *testing.T) {
+	s := newTestSimulator(t, config.Simulator{Chance: 1, Scenarios: []config.Scenario{
+		{Name: "decline", MethodToken: "tok_decline", Outcome: OutcomeHardDecline, Code: "stolen_card"},
+		{Name: "soft", Amount: "51.00", Outcome: OutcomeSoftDecline},
+		{Name: "timeout", AmountSuffix: ".13", Outcome: OutcomeTimeout},
+		{Name: "outage", Amount: "666", Outcome: OutcomeUnavailable},
+		{Name: "pending", Amount: "70", Operations: []string{"authorize"}, Outcome: OutcomePending, Final: OutcomeHardDecline},
+	}})
+
+	tests := []struct {
+		name       string
+		token      string
+		amount     string
+		wantErr    error
+		wantCode   string
+		wantStatus string
+	}{
+		{"approve by chance", "tok_visa", "10", nil, "", psp.StatusAuthorized},
+		{"magic token", "tok_decline", "10", psp.ErrHardDecline, "stolen_card", ""},
+		{"default soft code", "tok_visa", "51", psp.ErrSoftDecline, "try_again_later", ""},
+		{"amount suffix", "tok_visa", "7.13", psp.ErrTimeout, "", ""},
+		{"outage", "tok_visa", "666.00", psp.ErrUnavailable, "", ""},
+		{"pending", "tok_visa", "70", nil, "", psp.StatusPending},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := authRequest(fmt.Sprint("pay_", i), tt.amount)
+			req.MethodToken = tt.token
+			res, err := s.Authorize(context.Background(), req)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			var pe *psp.Error
+			if tt.wantCode != "" && (!errors.As(err, &pe) || pe.Code != tt.wantCode) {
+				t.Fatalf("decline code: %v", err)
+			}
+			if res.Status != tt.wantStatus {
+				t.Fatalf("status = %q, want %q", res.Status, tt.wantStatus)
+			}
+		})
+	}
+
+	// итог pending-авторизации — по Final сценария
+	if _, ok, err := s.Settle("authorize", "pay_5"); !ok || !errors.Is(err, psp.ErrHardDecline) {
+		t.Fatalf("settle = %v, %v", err, ok)
+	}
+}
+
+func TestSimulatorRemembersDecision(t *testing.T) {
+	s := newTestSimulator(t, config.Simulator{Chance: 0.5})
+	ctx := context.Background()
+
+	for i := range 20 {
+		req := authRequest(fmt.Sprint("pay_", i), "10")
+		res1, err1 := s.Authorize(ctx, req)
+		res2, err2 := s.Authorize(ctx, req)
+		if (err1 == nil) != (err2 == nil) || (res1.PSPRef != nil && *res1.PSPRef != *res2.PSPRef) {
+			t.Fatalf("retry of %s got another decision", req.IdempotencyKey)
+		}
+	}
+}
+
+// outcomes — исходы запросов по ключам: отказ, недоступность или ссылка
+func outcomes(s *Simulator, keys []string, tries int) map[string][]string {
+	res := make(map[string][]string)
+	for _, key := range keys {
+		for range tries {
+			r, err := s.Authorize(context.Background(), authRequest(key, "10"))
+			switch {
+			case errors.Is(err, psp.ErrUnavailable):
+				res[key] = append(res[key], "unavailable")
+			case err != nil:
+				res[key] = append(res[key], "declined")
+			default:
+				res[key] = append(res[key], *r.PSPRef)
+			}
+		}
+	}
+	return res
+}
+
+func TestSimulatorSeed(t *testing.T) {
+	cfg := config.Simulator{Chance: 0.5, UnavailableChance: 0.5, Seed: 42}
+	keys := make([]string, 50)
+	reversed := make([]string, len(keys))
+	for i := range keys {
+		keys[i] = fmt.Sprint("pay_", i)
+		reversed[len(keys)-1-i] = keys[i]
+	}
+
+	// порядок и соседние платежи на исход не влияют: у каждого ключа свой генератор
+	a := outcomes(newTestSimulator(t, cfg), keys, 4)
+	b := outcomes(newTestSimulator(t, cfg), reversed, 4)
+	if fmt.Sprint(a) != fmt.Sprint(b) {
+		t.Fatal("seeded outcomes depend on processing order")
+	}
+
+	// недоступность не запоминается: повтор того же ключа может пройти
+	recovered := 0
+	for _, key := range keys {
+		if got := a[key]; got[0] == "unavailable" && got[3] != "unavailable" {
+			recovered++
+		}
+	}
+	if recovered == 0 {
+		t.Fatal("retries of unavailable requests never reached the psp")
+	}
+
+	cfg.Seed = 43
+	if c := outcomes(newTestSimulator(t, cfg), keys, 4); fmt.Sprint(a) == fmt.Sprint(c) {
+		t.Fatal("other seed gave the same outcomes")
+	}
+}
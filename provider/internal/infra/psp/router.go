@@ -0,0 +1,231 @@
+package psp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"slices"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/shopspring/decimal"
+)
+
+type target struct {
+	adapter psp.Adapter
+	weight  int
+}
+
+type route struct {
+	name       string
+	merchants  []string
+	currencies []string
+	min, max   *decimal.Decimal
+	targets    []target
+	total      int // сумма весов
+}
+
+// Router — адаптер над несколькими PSP. Авторизация идёт по первому подходящему
+// правилу (merchant, валюта, сумма) с весовым разделением и резервом при
+// psp.ErrUnavailable. Основной PSP выбирается по ключу идемпотентности, поэтому
+// повтор авторизации идёт к тому же PSP. Capture/void/refund — к PSP,
+// авторизовавшему платёж
+type Router struct {
+	adapters map[string]psp.Adapter
+	rules    []route
+	def      route
+}
+
+func NewRouter(cfg config.Routing, adapters ...psp.Adapter) (*Router, error) {
+	if len(adapters) == 0 {
+		return nil, errors.New("psp router: no adapters")
+	}
+
+	r := &Router{adapters: make(map[string]psp.Adapter, len(adapters))}
+	for _, a := range adapters {
+		if _, ok := r.adapters[a.Name()]; ok {
+			return nil, fmt.Errorf("psp router: duplicate psp %q", a.Name())
+		}
+		r.adapters[a.Name()] = a
+	}
+
+	defTargets := cfg.Default
+	if len(defTargets) == 0 {
+		defTargets = []config.RouteTarget{{PSP: adapters[0].Name(), Weight: 1}}
+	}
+	def, err := r.newRoute(config.RouteRule{Name: "default", Targets: defTargets})
+	if err != nil {
+		return nil, err
+	}
+	r.def = def
+
+	for _, rule := range cfg.Rules {
+		rt, err := r.newRoute(rule)
+		if err != nil {
+			return nil, err
+		}
+		r.rules = append(r.rules, rt)
+	}
+
+	return r, nil
+}
+
+func (r *Router) newRoute(rule config.RouteRule) (route, error) {
+	rt := route{name: rule.Name, merchants: rule.Merchants, currencies: rule.Currencies}
+
+	for _, bound := range []struct {
+		s   string
+		dst **decimal.Decimal
+	}{{rule.MinAmount, &rt.min}, {rule.MaxAmount, &rt.max}} {
+		if bound.s == "" {
+			continue
+		}
+		d, err := decimal.NewFromString(bound.s)
+		if err != nil {
+			return route{}, fmt.Errorf("psp router: rule %q: invalid amount %q", rule.Name, bound.s)
+		}
+		*bound.dst = &d
+	}
+
+	if len(rule.Targets) == 0 {
+		return route{}, fmt.Errorf("psp router: rule %q has no targets", rule.Name)
+	}
+	for _, t := range rule.Targets {
+		a, ok := r.adapters[t.PSP]
+		if !ok {
+			return route{}, fmt.Errorf("psp router: rule %q: unknown psp %q", rule.Name, t.PSP)
+		}
+		if t.Weight < 0 {
+			return route{}, fmt.Errorf("psp router: rule %q: negative weight for %q", rule.Name, t.PSP)
+		}
+		rt.targets = append(rt.targets, target{adapter: a, weight: t.Weight})
+		rt.total += t.Weight
+	}
+
+	return rt, nil
+}
+
+func (r *Router) Name() string {
+	return "router"
+}
+
+func (r *Router) Authorize(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return r.do(ctx, "authorize", r.match(req).order(req.IdempotencyKey), req, psp.Adapter.Authorize)
+}
+
+func (r *Router) Capture(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return r.toOwner(ctx, "capture", req, psp.Adapter.Capture)
+}
+
+func (r *Router) Refund(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return r.toOwner(ctx, "refund", req, psp.Adapter.Refund)
+}
+
+func (r *Router) Void(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return r.toOwner(ctx, "void", req, psp.Adapter.Void)
+}
+
+func (r *Router) Confirm(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return r.toOwner(ctx, "confirm", req, psp.Adapter.Confirm)
+}
+
+// do пробует кандидатов по порядку, к следующему переходит только при
+// недоступности: отказ или таймаут другой PSP не исправит, а может задвоить списание
+func (r *Router) do(ctx context.Context, operation string, candidates []psp.Adapter, req psp.Request,
+	call func(psp.Adapter, context.Context, psp.Request) (psp.Result, error)) (psp.Result, error) {
+	var lastErr error
+	for i, a := range candidates {
+		res, err := call(a, ctx, req)
+		if err == nil {
+			res.PSP = a.Name()
+			return res, nil
+		}
+		if !errors.Is(err, psp.ErrUnavailable) || ctx.Err() != nil {
+			return psp.Result{}, err
+		}
+		lastErr = err
+		if i+1 < len(candidates) {
+			log.Printf("psp router: %s %s unavailable, failover to %s:%v",
+				operation, a.Name(), candidates[i+1].Name(), err)
+		}
+	}
+	return psp.Result{}, lastErr
+}
+
+// toOwner — операция над авторизованным платежом: только к его PSP, без резерва
+func (r *Router) toOwner(ctx context.Context, operation string, req psp.Request,
+	call func(psp.Adapter, context.Context, psp.Request) (psp.Result, error)) (psp.Result, error) {
+	a, err := r.owner(req)
+	if err != nil {
+		return psp.Result{}, fmt.Errorf("psp router: %s payment_id=%s: %w", operation, req.PaymentID, err)
+	}
+	return r.do(ctx, operation, []psp.Adapter{a}, req, call)
+}
+
+// owner — PSP, авторизовавший платёж. Неизвестный PSP — ошибка: другой PSP
+// этой авторизации не знает, а выбор по правилам мог бы провести операцию не там
+func (r *Router) owner(req psp.Request) (psp.Adapter, error) {
+	if req.PSP == "" {
+		return nil, errors.New("authorizing psp unknown")
+	}
+	a, ok := r.adapters[req.PSP]
+	if !ok {
+		return nil, fmt.Errorf("authorizing psp %q not configured", req.PSP)
+	}
+	return a, nil
+}
+
+func (r *Router) match(req psp.Request) route {
+	for _, rt := range r.rules {
+		if rt.matches(req) {
+			return rt
+		}
+	}
+	return r.def
+}
+
+func (rt route) matches(req psp.Request) bool {
+	if len(rt.merchants) > 0 && !slices.Contains(rt.merchants, req.MerchantID) {
+		return false
+	}
+	if len(rt.currencies) > 0 && !slices.Contains(rt.currencies, req.Currency) {
+		return false
+	}
+	if rt.min != nil && req.Amount.LessThan(*rt.min) {
+		return false
+	}
+	if rt.max != nil && !req.Amount.LessThan(*rt.max) {
+		return false
+	}
+	return true
+}
+
+// order: основной PSP по весам, за ним остальные в порядке конфига. Выбор
+// детерминирован по ключу: случайный выбор на повторе после таймаута мог бы
+// провести авторизацию у второго PSP
+func (rt route) order(idemKey string) []psp.Adapter {
+	primary := 0
+	if rt.total > 0 {
+		h := fnv.New64a()
+		h.Write([]byte(idemKey))
+		n := int(h.Sum64() % uint64(rt.total))
+		for i, t := range rt.targets {
+			if n < t.weight {
+				primary = i
+				break
+			}
+			n -= t.weight
+		}
+	}
+
+	res := make([]psp.Adapter, 0, len(rt.targets))
+	res = append(res, rt.targets[primary].adapter)
+	for i, t := range rt.targets {
+		if i != primary {
+			res = append(res, t.adapter)
+		}
+	}
+	return res
+}
@@ -0,0 +1,231 @@
+package psp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/shopspring/decimal"
+)
+
+// stubAdapter отвечает err (nil — одобрение) и считает вызовы
+type stubAdapter struct {
+	name  string
+	err   error
+	calls int
+}
+
+func (a *stubAdapter) call() (psp.Result, error) {
+	a.calls++
+	if a.err != nil {
+		return psp.Result{}, a.err
+	}
+	return psp.Result{Status: psp.StatusAuthorized}, nil
+}
+
+func (a *stubAdapter) Name() string { return a.name }
+func (a *stubAdapter) Authorize(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return a.call()
+}
+func (a *stubAdapter) Capture(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return a.call()
+}
+func (a *stubAdapter) Refund(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return a.call()
+}
+func (a *stubAdapter) Void(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return a.call()
+}
+func (a *stubAdapter) Confirm(ctx context.Context, req psp.Request) (psp.Result, error) {
+	return a.call()
+}
+
+func stubs(names ...string) []psp.Adapter {
+	res := make([]psp.Adapter, 0, len(names))
+	for _, n := range names {
+		res = append(res, &stubAdapter{name: n})
+	}
+	return res
+}
+
+func names(adapters []psp.Adapter) string {
+	var s []string
+	for _, a := range adapters {
+		s = append(s, a.Name())
+	}
+	return fmt.Sprint(s)
+}
+
+func TestRouterRuleMatching(t *testing.T) {
+	r, err := NewRouter(config.Routing{
+		Default: []config.RouteTarget{{PSP: "a", Weight: 1}},
+		Rules: []config.RouteRule{
+			{Name: "vip", Merchants: []string{"m_vip"}, Targets: []config.RouteTarget{{PSP: "b", Weight: 1}}},
+			{Name: "eur-small", Currencies: []string{"EUR"}, MinAmount: "1", MaxAmount: "100",
+				Targets: []config.RouteTarget{{PSP: "c", Weight: 1}}},
+		},
+	}, stubs("a", "b", "c")...)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		merchant string
+		currency string
+		amount   string
+		want     string
+	}{
+		{"merchant rule", "m_vip", "EUR", "50", "vip"},
+		{"first matching rule wins", "m_vip", "USD", "50", "vip"},
+		{"currency and amount", "m_1", "EUR", "50", "eur-small"},
+		{"min inclusive", "m_1", "EUR", "1", "eur-small"},
+		{"max exclusive", "m_1", "EUR", "100", "default"},
+		{"below min", "m_1", "EUR", "0.99", "default"},
+		{"other currency", "m_1", "USD", "50", "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := psp.Request{MerchantID: tt.merchant, Currency: tt.currency, Amount: decimal.RequireFromString(tt.amount)}
+			if got := r.match(req).name; got != tt.want {
+				t.Fatalf("matched rule %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRouterWeights(t *testing.T) {
+	r, err := NewRouter(config.Routing{
+		Default: []config.RouteTarget{{PSP: "a", Weight: 3}, {PSP: "b", Weight: 1}, {PSP: "c", Weight: 0}},
+	}, stubs("a", "b", "c")...)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+
+	primary := map[string]int{}
+	const n = 4000
+	for i := range n {
+		key := fmt.Sprint("pay_", i)
+		order := r.def.order(key)
+		if len(order) != 3 {
+			t.Fatalf("order %s lost a fallback", names(order))
+		}
+		// повтор с тем же ключом — к тому же PSP
+		if again := r.def.order(key); again[0] != order[0] {
+			t.Fatalf("retry of %s routed to %s, first to %s", key, again[0].Name(), order[0].Name())
+		}
+		primary[order[0].Name()]++
+	}
+
+	// weight 0 — только резерв
+	if primary["c"] != 0 {
+		t.Fatalf("zero weight psp chosen as primary %d times", primary["c"])
+	}
+	if share := float64(primary["a"]) / n; share < 0.7 || share > 0.8 {
+		t.Fatalf("psp a primary share %.2f, want ~0.75", share)
+	}
+}
+
+func TestRouterRejectsInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.Routing
+	}{
+		{"unknown psp", config.Routing{Default: []config.RouteTarget{{PSP: "x", Weight: 1}}}},
+		{"negative weight", config.Routing{Default: []config.RouteTarget{{PSP: "a", Weight: -1}}}},
+		{"no targets", config.Routing{Rules: []config.RouteRule{{Name: "empty"}}}},
+		{"invalid amount", config.Routing{Rules: []config.RouteRule{{Name: "bad", MinAmount: "ten",
+			Targets: []config.RouteTarget{{PSP: "a", Weight: 1}}}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewRouter(tt.cfg, stubs("a")...); err == nil {
+				t.Fatal("invalid routing accepted")
+			}
+		})
+	}
+}
+
+func TestRouterFailover(t *testing.T) {
+	unavailable := psp.NewError(psp.ErrUnavailable, "a", "", "")
+
+	tests := []struct {
+		name      string
+		primary   error
+		wantPSP   string
+		wantErr   error
+		wantCalls int // вызовов резервного
+	}{
+		{"primary approves", nil, "a", nil, 0},
+		{"failover on unavailable", unavailable, "b", nil, 1},
+		// отказ или таймаут резерв не исправит, а таймаут может задвоить списание
+		{"no failover on decline", psp.NewError(psp.ErrHardDecline, "a", "", ""), "", psp.ErrHardDecline, 0},
+		{"no failover on timeout", psp.NewError(psp.ErrTimeout, "a", "", ""), "", psp.ErrTimeout, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, b := &stubAdapter{name: "a", err: tt.primary}, &stubAdapter{name: "b"}
+			r, err := NewRouter(config.Routing{
+				Default: []config.RouteTarget{{PSP: "a", Weight: 1}, {PSP: "b", Weight: 0}},
+			}, a, b)
+			if err != nil {
+				t.Fatalf("NewRouter: %v", err)
+			}
+
+			res, err := r.Authorize(context.Background(), psp.Request{PaymentID: "pay_1"})
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if res.PSP != tt.wantPSP {
+				t.Fatalf("psp = %q, want %q", res.PSP, tt.wantPSP)
+			}
+			if b.calls != tt.wantCalls {
+				t.Fatalf("fallback calls = %d, want %d", b.calls, tt.wantCalls)
+			}
+		})
+	}
+
+	// все недоступны — последняя ошибка недоступности
+	r, _ := NewRouter(config.Routing{Default: []config.RouteTarget{{PSP: "a", Weight: 1}, {PSP: "b", Weight: 1}}},
+		&stubAdapter{name: "a", err: unavailable}, &stubAdapter{name: "b", err: unavailable})
+	if _, err := r.Authorize(context.Background(), psp.Request{}); !errors.Is(err, psp.ErrUnavailable) {
+		t.Fatalf("expected unavailable, got %v", err)
+	}
+}
+
+// Операции над авторизованным платежом идут только к его PSP
+func TestRouterOwner(t *testing.T) {
+	a, b := &stubAdapter{name: "a", err: psp.NewError(psp.ErrUnavailable, "a", "", "")}, &stubAdapter{name: "b"}
+	r, err := NewRouter(config.Routing{
+		Default: []config.RouteTarget{{PSP: "a", Weight: 1}, {PSP: "b", Weight: 1}},
+	}, a, b)
+	if err != nil {
+		t.Fatalf("NewRouter: %v", err)
+	}
+	ctx := context.Background()
+
+	res, err := r.Capture(ctx, psp.Request{PaymentID: "pay_1", PSP: "b"})
+	if err != nil || res.PSP != "b" {
+		t.Fatalf("capture routed to %q, err %v", res.PSP, err)
+	}
+
+	// владелец недоступен — резерв не пробуется: авторизация есть только у него
+	if _, err := r.Void(ctx, psp.Request{PaymentID: "pay_1", PSP: "a"}); !errors.Is(err, psp.ErrUnavailable) {
+		t.Fatalf("expected unavailable, got %v", err)
+	}
+	if b.calls != 1 {
+		t.Fatalf("void failed over to b")
+	}
+
+	for _, name := range []string{"", "gone"} {
+		if _, err := r.Refund(ctx, psp.Request{PaymentID: "pay_1", PSP: name}); err == nil {
+			t.Fatalf("refund with psp %q routed", name)
+		}
+	}
+	if a.calls != 1 || b.calls != 1 {
+		t.Fatalf("unknown owner reached psp: a=%d b=%d", a.calls, b.calls)
+	}
+}
@@ -0,0 +1,183 @@
+package psp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/acquirer"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/currency"
+	"github.com/shopspring/decimal"
+)
+
+// Исходы сценария
+const (
+	OutcomeApprove     = "approve"
+	OutcomeHardDecline = "hard_decline"
+	OutcomeSoftDecline = "soft_decline"
+	OutcomeTimeout     = psp.FaultTimeout
+	OutcomeUnavailable = "unavailable"
+	// сетевые сбои: fakepsp отвечает 500 или рвёт соединение,
+	// в процессе — таймаут, исход неизвестен
+	OutcomeServerError = psp.FaultServerError
+	OutcomeReset       = psp.FaultReset
+	// PENDING с итогом по Final позже: fakepsp шлёт его webhook'ом
+	OutcomePending = "pending"
+	// REQUIRES_ACTION с challenge, итог по Final после Confirm
+	OutcomeChallenge = "challenge"
+)
+
+// Распределения задержки
+const (
+	LatencyFixed       = "fixed"
+	LatencyUniform     = "uniform"
+	LatencyNormal      = "normal"
+	LatencyExponential = "exponential"
+)
+
+type scenario struct {
+	config.Scenario
+	amount *decimal.Decimal
+}
+
+func newScenarios(cfg []config.Scenario) ([]scenario, error) {
+	res := make([]scenario, 0, len(cfg))
+	for _, sc := range cfg {
+		switch sc.Outcome {
+		case "", OutcomeApprove, OutcomeHardDecline, OutcomeSoftDecline, OutcomeTimeout, OutcomeUnavailable,
+			OutcomeServerError, OutcomeReset:
+		case OutcomePending, OutcomeChallenge:
+			if len(sc.Operations) != 1 || sc.Operations[0] != acquirer.OpAuthorize {
+				return nil, fmt.Errorf("psp scenario %q: %s outcome needs operations: [%s]", sc.Name, sc.Outcome, acquirer.OpAuthorize)
+			}
+		default:
+			return nil, fmt.Errorf("psp scenario %q: unknown outcome %q", sc.Name, sc.Outcome)
+		}
+		switch sc.Final {
+		case "", OutcomeApprove, OutcomeHardDecline, OutcomeSoftDecline:
+		default:
+			return nil, fmt.Errorf("psp scenario %q: unknown final outcome %q", sc.Name, sc.Final)
+		}
+		for _, op := range sc.Operations {
+			if !slices.Contains([]string{acquirer.OpAuthorize, acquirer.OpCapture, acquirer.OpRefund, acquirer.OpVoid,
+				acquirer.OpConfirm}, op) {
+				return nil, fmt.Errorf("psp scenario %q: unknown operation %q", sc.Name, op)
+			}
+		}
+		if err := validateLatency(sc.Latency); err != nil {
+			return nil, fmt.Errorf("psp scenario %q: %w", sc.Name, err)
+		}
+
+		s := scenario{Scenario: sc}
+		if sc.Amount != "" {
+			d, err := decimal.NewFromString(sc.Amount)
+			if err != nil {
+				return nil, fmt.Errorf("psp scenario %q: invalid amount %q", sc.Name, sc.Amount)
+			}
+			s.amount = &d
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+func validateLatency(l config.Latency) error {
+	switch l.Distribution {
+	case "", LatencyFixed, LatencyUniform, LatencyNormal, LatencyExponential:
+		return nil
+	default:
+		return fmt.Errorf("unknown latency distribution %q", l.Distribution)
+	}
+}
+
+func (sc scenario) matches(operation string, req psp.Request) bool {
+	if len(sc.Operations) > 0 && !slices.Contains(sc.Operations, operation) {
+		return false
+	}
+	if sc.MethodToken != "" && sc.MethodToken != req.MethodToken {
+		return false
+	}
+	if sc.Merchant != "" && sc.Merchant != req.MerchantID {
+		return false
+	}
+	if sc.amount != nil && !sc.amount.Equal(req.Amount) {
+		return false
+	}
+	if sc.AmountSuffix != "" && !strings.HasSuffix(currency.Format(req.Amount, req.Currency), sc.AmountSuffix) {
+		return false
+	}
+	return true
+}
+
+// outcome — заданный сценарием исход. approve=false и err=nil — решает случай
+func (sc scenario) outcome(name string) (approve bool, err error) {
+	return sc.decide(name, sc.Outcome)
+}
+
+// final — итог pending- или challenge-авторизации
+func (sc scenario) final(name string) (approve bool, err error) {
+	return sc.decide(name, sc.Final)
+}
+
+func (sc scenario) decide(name, outcome string) (approve bool, err error) {
+	code := sc.Code
+	switch outcome {
+	case OutcomeApprove:
+		return true, nil
+	case OutcomeHardDecline:
+		if code == "" {
+			code = "do_not_honor"
+		}
+		return false, psp.NewError(psp.ErrHardDecline, name, code, "scenario "+sc.Name)
+	case OutcomeSoftDecline:
+		if code == "" {
+			code = "try_again_later"
+		}
+		return false, psp.NewError(psp.ErrSoftDecline, name, code, "scenario "+sc.Name)
+	case OutcomeTimeout, OutcomeServerError, OutcomeReset:
+		return false, psp.NewError(psp.ErrTimeout, name, code, "scenario "+sc.Name)
+	case OutcomeUnavailable:
+		return false, psp.NewError(psp.ErrUnavailable, name, code, "scenario "+sc.Name)
+	}
+	return false, nil
+}
+
+// latency выбирает задержку по распределению; float — источник [0,1), norm — N(0,1)
+func latency(l config.Latency, float func() float64, norm func() float64) time.Duration {
+	var d time.Duration
+	switch l.Distribution {
+	case LatencyFixed:
+		d = l.Mean
+	case LatencyUniform:
+		d = l.Min + time.Duration(float()*float64(l.Max-l.Min))
+	case LatencyNormal:
+		d = l.Mean + time.Duration(norm()*float64(l.StdDev))
+	case LatencyExponential:
+		d = time.Duration(-math.Log(1-float()) * float64(l.Mean))
+	}
+	d = max(d, l.Min, 0)
+	if l.Max > 0 {
+		d = min(d, l.Max)
+	}
+	return d
+}
+
+// sleep: ответ PSP не дождались — таймаут, исход неизвестен
+func sleep(ctx context.Context, name string, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return psp.NewError(psp.ErrTimeout, name, "", ctx.Err().Error())
+	}
+}
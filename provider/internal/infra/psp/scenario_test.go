@@ -0,0 +1,97 @@
+package psp
+
+import (
+	"testing"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/acquirer"
+	"github.com/shopspring/decimal"
+)
+
+func TestNewScenariosRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		sc   config.Scenario
+	}{
+		{"unknown outcome", config.Scenario{Outcome: "maybe"}},
+		{"unknown final", config.Scenario{Final: "timeout"}},
+		{"unknown operation", config.Scenario{Operations: []string{"settle"}}},
+		{"pending not on authorize", config.Scenario{Outcome: OutcomePending, Operations: []string{acquirer.OpCapture}}},
+		{"challenge on all operations", config.Scenario{Outcome: OutcomeChallenge}},
+		{"invalid amount", config.Scenario{Amount: "ten"}},
+		{"unknown latency", config.Scenario{Latency: config.Latency{Distribution: "poisson"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newScenarios([]config.Scenario{tt.sc}); err == nil {
+				t.Fatal("invalid scenario accepted")
+			}
+		})
+	}
+}
+
+func TestScenarioMatches(t *testing.T) {
+	tests := []struct {
+		name     string
+		sc       config.Scenario
+		op       string
+		token    string
+		amount   string
+		currency string
+		want     bool
+	}{
+		{"magic token", config.Scenario{MethodToken: "tok_decline"}, acquirer.OpAuthorize, "tok_decline", "10", "USD", true},
+		{"other token", config.Scenario{MethodToken: "tok_decline"}, acquirer.OpAuthorize, "tok_visa", "10", "USD", false},
+		{"exact amount", config.Scenario{Amount: "666.00"}, acquirer.OpAuthorize, "", "666", "USD", true},
+		{"other amount", config.Scenario{Amount: "666.00"}, acquirer.OpAuthorize, "", "666.01", "USD", false},
+		{"suffix", config.Scenario{AmountSuffix: ".13"}, acquirer.OpAuthorize, "", "10.13", "USD", true},
+		{"suffix padded to exponent", config.Scenario{AmountSuffix: ".50"}, acquirer.OpAuthorize, "", "10.5", "USD", true},
+		{"suffix without minor units", config.Scenario{AmountSuffix: "13"}, acquirer.OpAuthorize, "", "1013", "JPY", true},
+		{"cents suffix not for yen", config.Scenario{AmountSuffix: ".13"}, acquirer.OpAuthorize, "", "1013", "JPY", false},
+		{"three digit currency", config.Scenario{AmountSuffix: ".013"}, acquirer.OpAuthorize, "", "1.013", "KWD", true},
+		{"two digit suffix in three digit currency", config.Scenario{AmountSuffix: ".13"}, acquirer.OpAuthorize, "", "1.13", "KWD", false},
+		{"operation filter", config.Scenario{Operations: []string{acquirer.OpRefund}}, acquirer.OpAuthorize, "", "10", "USD", false},
+		{"empty scenario matches all", config.Scenario{}, acquirer.OpVoid, "", "10", "USD", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scs, err := newScenarios([]config.Scenario{tt.sc})
+			if err != nil {
+				t.Fatalf("newScenarios: %v", err)
+			}
+			req := psp.Request{MethodToken: tt.token, Amount: decimal.RequireFromString(tt.amount), Currency: tt.currency}
+			if got := scs[0].matches(tt.op, req); got != tt.want {
+				t.Fatalf("matches = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLatency(t *testing.T) {
+	half := func() float64 { return 0.5 }
+	sigma := func() float64 { return 2 }
+
+	tests := []struct {
+		name string
+		l    config.Latency
+		want time.Duration
+	}{
+		{"none", config.Latency{}, 0},
+		{"fixed", config.Latency{Distribution: LatencyFixed, Mean: time.Second}, time.Second},
+		{"uniform", config.Latency{Distribution: LatencyUniform, Min: time.Second, Max: 3 * time.Second}, 2 * time.Second},
+		{"normal capped by max", config.Latency{Distribution: LatencyNormal, Mean: time.Second, StdDev: time.Second,
+			Max: 2 * time.Second}, 2 * time.Second},
+		{"normal not below zero", config.Latency{Distribution: LatencyNormal, Mean: time.Second, StdDev: -time.Second}, 0},
+		{"exponential raised to min", config.Latency{Distribution: LatencyExponential, Mean: time.Millisecond,
+			Min: time.Second}, time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := latency(tt.l, half, sigma); got != tt.want {
+				t.Fatalf("latency = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,51 @@
+// Package acquirer — HTTP-контракт fake-эквайера (cmd/fakepsp) и его клиента
+package acquirer
+
+// Операции: POST /v1/{operation}, статус — GET /v1/operations/{operation}/{idempotency_key}
+const (
+	OpAuthorize = "authorize"
+	OpCapture   = "capture"
+	OpRefund    = "refund"
+	OpVoid      = "void"
+	OpConfirm   = "confirm" // после challenge, ключ — как у авторизации
+)
+
+// повтор запроса с тем же ключом возвращает прежнее решение
+const IdempotencyHeader = "Idempotency-Key"
+
+// Статус отказа в OperationResponse, успешные — как в psp.Status*.
+// PENDING — итог придёт webhook'ом (см. webhook.go)
+const StatusDeclined = "DECLINED"
+
+// Виды отказа
+const (
+	DeclineHard = "hard"
+	DeclineSoft = "soft"
+)
+
+type OperationRequest struct {
+	PaymentID   string  `json:"payment_id"`
+	RefundID    string  `json:"refund_id,omitempty"`
+	MerchantID  string  `json:"merchant_id"`
+	Amount      string  `json:"amount"`
+	Currency    string  `json:"currency"`
+	MethodToken string  `json:"method_token,omitempty"`
+	PSPRef      *string `json:"psp_reference,omitempty"`
+	ChallengeID string  `json:"challenge_id,omitempty"`
+}
+
+type OperationResponse struct {
+	Operation      string      `json:"operation"`
+	IdempotencyKey string      `json:"idempotency_key"`
+	Status         string      `json:"status"`
+	PSPRef         *string     `json:"psp_reference,omitempty"`
+	DeclineType    string      `json:"decline_type,omitempty"`
+	DeclineCode    string      `json:"decline_code,omitempty"`
+	Message        string      `json:"message,omitempty"`
+	NextAction     *NextAction `json:"next_action,omitempty"` // для REQUIRES_ACTION
+}
+
+type NextAction struct {
+	RedirectURL string `json:"redirect_url"`
+	ChallengeID string `json:"challenge_id"`
+}
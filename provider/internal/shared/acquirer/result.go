@@ -0,0 +1,21 @@
+package acquirer
+
+import "github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+
+// Result переводит ответ эквайера (или его webhook) в результат адаптера:
+// отказ — ошибкой psp.ErrHardDecline/ErrSoftDecline с кодом
+func (r OperationResponse) Result(pspName string) (psp.Result, error) {
+	if r.Status == StatusDeclined {
+		kind := psp.ErrHardDecline
+		if r.DeclineType == DeclineSoft {
+			kind = psp.ErrSoftDecline
+		}
+		return psp.Result{}, psp.NewError(kind, pspName, r.DeclineCode, r.Message)
+	}
+
+	res := psp.Result{Status: r.Status, PSPRef: r.PSPRef, PSP: pspName}
+	if r.NextAction != nil {
+		res.NextAction = &psp.NextAction{RedirectURL: r.NextAction.RedirectURL, ChallengeID: r.NextAction.ChallengeID}
+	}
+	return res, nil
+}
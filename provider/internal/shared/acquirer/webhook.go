@@ -0,0 +1,73 @@
+package acquirer
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Итог pending-операции эквайер присылает на POST /v1/webhooks/psp/{psp}
+// с подписью в SignatureHeader: "t=<unix>,v1=<hex hmac-sha256(secret, t.body)>"
+const SignatureHeader = "Acquirer-Signature"
+
+var ErrSignature = errors.New("invalid webhook signature")
+
+// Webhook — итог операции, ответившей PENDING; поля как в ответе на операцию
+type Webhook struct {
+	OperationResponse
+	PaymentID string `json:"payment_id"`
+}
+
+// Sign подписывает тело webhook'а временем отправки
+func Sign(secret string, ts time.Time, body []byte) string {
+	t := strconv.FormatInt(ts.Unix(), 10)
+	return "t=" + t + ",v1=" + signature(secret, t, body)
+}
+
+// Verify проверяет подпись и что она не старше tolerance: перехваченный
+// webhook нельзя переиграть позже. С пустым секретом подпись подделает любой —
+// такой webhook отклоняется
+func Verify(secret, header string, body []byte, now time.Time, tolerance time.Duration) error {
+	if secret == "" {
+		return ErrSignature
+	}
+
+	var t, v1 string
+	for part := range strings.SplitSeq(header, ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			t = v
+		case "v1":
+			v1 = v
+		}
+	}
+	if t == "" || v1 == "" {
+		return ErrSignature
+	}
+
+	unix, err := strconv.ParseInt(t, 10, 64)
+	if err != nil {
+		return ErrSignature
+	}
+	if age := now.Sub(time.Unix(unix, 0)); tolerance > 0 && (age > tolerance || age < -tolerance) {
+		return ErrSignature
+	}
+
+	if !hmac.Equal([]byte(v1), []byte(signature(secret, t, body))) {
+		return ErrSignature
+	}
+	return nil
+}
+
+func signature(secret, t string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,49 @@
+package acquirer
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerify(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	body := []byte(`{"payment_id":"pay_1"}`)
+	valid := Sign("whsec_1", now, body)
+
+	tests := []struct {
+		name   string
+		secret string
+		header string
+		body   []byte
+		now    time.Time
+		ok     bool
+	}{
+		{"valid", "whsec_1", valid, body, now, true},
+		{"within tolerance", "whsec_1", valid, body, now.Add(4 * time.Minute), true},
+		{"signed slightly ahead", "whsec_1", valid, body, now.Add(-time.Minute), true},
+		{"extra spaces and fields", "whsec_1", strings.ReplaceAll(valid, ",", ", v0=abc, "), body, now, true},
+		{"expired", "whsec_1", valid, body, now.Add(6 * time.Minute), false},
+		{"from the future", "whsec_1", valid, body, now.Add(-6 * time.Minute), false},
+		{"other secret", "whsec_2", valid, body, now, false},
+		{"tampered body", "whsec_1", valid, []byte(`{"payment_id":"pay_2"}`), now, false},
+		// подпись того же тела с подменённым временем не сходится
+		{"replaced timestamp", "whsec_1", strings.Replace(valid, "t=1700000000", "t=1700000300", 1), body, now.Add(5 * time.Minute), false},
+		{"empty secret", "", Sign("", now, body), body, now, false},
+		{"missing signature", "whsec_1", "t=1700000000", body, now, false},
+		{"invalid timestamp", "whsec_1", "t=abc,v1=00", body, now, false},
+		{"empty header", "whsec_1", "", body, now, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.secret, tt.header, tt.body, tt.now, 5*time.Minute)
+			if tt.ok && err != nil {
+				t.Fatalf("valid signature rejected: %v", err)
+			}
+			if !tt.ok && !errors.Is(err, ErrSignature) {
+				t.Fatalf("expected ErrSignature, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,24 @@
+package currency
+
+import "github.com/shopspring/decimal"
+
+// Число знаков минорной единицы ISO 4217 для валют, где оно не 2
+var exponents = map[string]int32{
+	"BHD": 3, "BIF": 0, "CLF": 4, "CLP": 0, "DJF": 0, "GNF": 0, "IQD": 3,
+	"ISK": 0, "JOD": 3, "JPY": 0, "KMF": 0, "KRW": 0, "KWD": 3, "LYD": 3,
+	"OMR": 3, "PYG": 0, "RWF": 0, "TND": 3, "UGX": 0, "UYI": 0, "UYW": 4,
+	"VND": 0, "VUV": 0, "XAF": 0, "XOF": 0, "XPF": 0,
+}
+
+// Exponent — число знаков минорной единицы: JPY 0, USD 2, KWD 3
+func Exponent(code string) int32 {
+	if e, ok := exponents[code]; ok {
+		return e
+	}
+	return 2
+}
+
+// Format печатает сумму с числом знаков валюты: 100 JPY, 10.50 USD, 1.250 KWD
+func Format(amount decimal.Decimal, code string) string {
+	return amount.StringFixed(Exponent(code))
+}
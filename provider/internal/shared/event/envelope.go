@@ -6,8 +6,25 @@ const (
 	PaymentCreatedEvent   EnvelopeType = "payment.created"
 	PaymentProcessedEvent EnvelopeType = "payments.processed"
 	PaymentFailedEvent    EnvelopeType = "payments.failed"
+	RefundCreatedEvent    EnvelopeType = "refund.created"
+	RefundProcessedEvent  EnvelopeType = "refund.processed"
+	RefundFailedEvent     EnvelopeType = "refund.failed"
+
+	// двухстадийные платежи: команды из checkout и результаты
+	PaymentCaptureRequestedEvent EnvelopeType = "payment.capture_requested"
+	PaymentVoidRequestedEvent    EnvelopeType = "payment.void_requested"
+	PaymentCapturedEvent         EnvelopeType = "payment.captured"
+	PaymentCaptureFailedEvent    EnvelopeType = "payment.capture_failed"
+	PaymentVoidedEvent           EnvelopeType = "payment.voided"
+	PaymentVoidFailedEvent       EnvelopeType = "payment.void_failed"
+
+	// 3-D Secure: покупатель прошёл challenge, продолжить авторизацию
+	PaymentConfirmRequestedEvent EnvelopeType = "payment.confirm_requested"
 )
 
+// заголовок kafka с типом события: в одном топике бывает несколько типов
+const TypeHeader = "event-type"
+
 type Envelope struct {
 	Type    EnvelopeType      // "payment.created"
 	Key     string            // routing key (e.g. payment_id)
@@ -10,6 +10,26 @@ func StringToType(s string) (EnvelopeType, error) {
 		return PaymentProcessedEvent, nil
 	case string(PaymentFailedEvent):
 		return PaymentFailedEvent, nil
+	case string(RefundCreatedEvent):
+		return RefundCreatedEvent, nil
+	case string(RefundProcessedEvent):
+		return RefundProcessedEvent, nil
+	case string(RefundFailedEvent):
+		return RefundFailedEvent, nil
+	case string(PaymentCaptureRequestedEvent):
+		return PaymentCaptureRequestedEvent, nil
+	case string(PaymentVoidRequestedEvent):
+		return PaymentVoidRequestedEvent, nil
+	case string(PaymentCapturedEvent):
+		return PaymentCapturedEvent, nil
+	case string(PaymentCaptureFailedEvent):
+		return PaymentCaptureFailedEvent, nil
+	case string(PaymentVoidedEvent):
+		return PaymentVoidedEvent, nil
+	case string(PaymentVoidFailedEvent):
+		return PaymentVoidFailedEvent, nil
+	case string(PaymentConfirmRequestedEvent):
+		return PaymentConfirmRequestedEvent, nil
 	default:
 		return EnvelopeType(""), errors.New("invalid envelope type")
 	}
@@ -0,0 +1,40 @@
+package web
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/config"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	v1 "github.com/EgorLis/MicroserviceExampleGo/provider/internal/transport/web/v1"
+)
+
+// NewFakePSP — сервер cmd/fakepsp: HTTP-эквайер поверх симулятора
+func NewFakePSP(cfg config.FakePSP, sim psp.Acquirer) *Server {
+	healthHandler := &v1.HealthHandler{Version: config.Version}
+	acquirerHandler := &v1.AcquirerHandler{
+		Sim:           sim,
+		HangTimeout:   cfg.HangTimeout,
+		WebhookURL:    cfg.Webhook.URL,
+		WebhookSecret: cfg.Webhook.Secret,
+		WebhookDelay:  cfg.Webhook.Delay,
+		Client:        &http.Client{Timeout: 5 * time.Second},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", healthHandler.Liveness)
+	mux.HandleFunc("GET /version", healthHandler.VersionInfo)
+	mux.HandleFunc("POST /v1/{operation}", limitBody(1<<20, acquirerHandler.Operation))
+	mux.HandleFunc("GET /v1/operations/{operation}/{key}", acquirerHandler.Status)
+
+	srv := &http.Server{
+		Addr:              cfg.Addr,
+		Handler:           loggingMiddleware(mux),
+		ReadTimeout:       10 * time.Second,
+		WriteTimeout:      cfg.HangTimeout + 10*time.Second, // scenario timeout держит ответ
+		MaxHeaderBytes:    1 << 20,
+		ReadHeaderTimeout: 2 * time.Second,
+		IdleTimeout:       60 * time.Second,
+	}
+	return &Server{server: srv, cfg: config.HTTP{Addr: cfg.Addr}}
+}
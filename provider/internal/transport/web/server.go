@@ -15,12 +15,18 @@ type Server struct {
 	cfg    config.HTTP
 }
 
-func New(cfg config.HTTP, db v1.Database) *Server {
+func New(cfg config.HTTP, db v1.Database, webhooks config.Webhooks, pending v1.PendingPayments) *Server {
 	healthHandler := &v1.HealthHandler{Version: config.Version, DB: db}
 
+	secrets := make(map[string]string, len(webhooks.PSPs))
+	for _, p := range webhooks.PSPs {
+		secrets[p.Name] = p.Secret
+	}
+	webhookHandler := &v1.WebhookHandler{Payments: pending, Secrets: secrets, Tolerance: webhooks.Tolerance}
+
 	srv := &http.Server{
 		Addr:              cfg.Addr,
-		Handler:           newRouter(healthHandler),
+		Handler:           newRouter(healthHandler, webhookHandler),
 		ReadTimeout:       10 * time.Second,
 		WriteTimeout:      10 * time.Second,
 		MaxHeaderBytes:    1 << 20,
@@ -45,7 +51,7 @@ func (ws *Server) Close(ctx context.Context) {
 	log.Println("server exited gracefully")
 }
 
-func newRouter(hh *v1.HealthHandler) http.Handler {
+func newRouter(hh *v1.HealthHandler, wh *v1.WebhookHandler) http.Handler {
 	mux := http.NewServeMux()
 
 	// health
@@ -54,6 +60,9 @@ func newRouter(hh *v1.HealthHandler) http.Handler {
 	mux.HandleFunc("GET /version", hh.VersionInfo)
 	mux.HandleFunc("GET /stats", hh.Stats)
 
+	// итог асинхронных операций от PSP
+	mux.HandleFunc("POST /v1/webhooks/psp/{psp}", limitBody(64<<10, wh.PSP))
+
 	loggedMux := loggingMiddleware(mux)
 
 	return loggedMux
@@ -94,3 +103,8 @@ func (lrw *loggingResponseWriter) WriteHeader(code int) {
 	lrw.statusCode = code
 	lrw.ResponseWriter.WriteHeader(code)
 }
+
+// Unwrap — для http.ResponseController (Hijack в fakepsp)
+func (lrw *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return lrw.ResponseWriter
+}
@@ -0,0 +1,224 @@
+package v1
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/acquirer"
+	"github.com/shopspring/decimal"
+)
+
+// AcquirerHandler — HTTP API fake-эквайера (cmd/fakepsp). Итог PENDING-операций
+// уходит подписанным webhook'ом на WebhookURL через WebhookDelay
+type AcquirerHandler struct {
+	Sim           psp.Acquirer
+	HangTimeout   time.Duration
+	WebhookURL    string
+	WebhookSecret string
+	WebhookDelay  time.Duration
+	Client        *http.Client
+}
+
+// Operation: POST /v1/{operation} с заголовком Idempotency-Key
+func (h *AcquirerHandler) Operation(w http.ResponseWriter, r *http.Request) {
+	op := r.PathValue("operation")
+	call := h.operation(op)
+	if call == nil {
+		writeError(w, http.StatusNotFound, "unknown operation")
+		return
+	}
+
+	key := r.Header.Get(acquirer.IdempotencyHeader)
+	if key == "" {
+		writeError(w, http.StatusBadRequest, "missing "+acquirer.IdempotencyHeader)
+		return
+	}
+
+	var body acquirer.OperationRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	defer r.Body.Close()
+
+	amount, err := decimal.NewFromString(body.Amount)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid amount")
+		return
+	}
+
+	req := psp.Request{
+		IdempotencyKey: key,
+		PaymentID:      body.PaymentID,
+		RefundID:       body.RefundID,
+		MerchantID:     body.MerchantID,
+		Amount:         amount,
+		Currency:       body.Currency,
+		MethodToken:    body.MethodToken,
+		PSPRef:         body.PSPRef,
+		ChallengeID:    body.ChallengeID,
+	}
+
+	// сетевые сбои отыгрываются до решения: до эквайера запрос "не дошёл"
+	switch h.Sim.Fault(op, req) {
+	case psp.FaultTimeout:
+		h.hang(w, r)
+		return
+	case psp.FaultServerError:
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	case psp.FaultReset:
+		resetConn(w)
+		return
+	}
+
+	res, err := call(r.Context(), req)
+	writeOperation(w, op, key, res, err)
+
+	if err == nil && res.Status == psp.StatusPending && h.WebhookURL != "" {
+		go h.notify(op, key, req.PaymentID)
+	}
+}
+
+// Status: GET /v1/operations/{operation}/{key} — решение по ключу идемпотентности
+func (h *AcquirerHandler) Status(w http.ResponseWriter, r *http.Request) {
+	op, key := r.PathValue("operation"), r.PathValue("key")
+	res, ok, err := h.Sim.Lookup(op, key)
+	if !ok {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	writeOperation(w, op, key, res, err)
+}
+
+func (h *AcquirerHandler) operation(op string) func(context.Context, psp.Request) (psp.Result, error) {
+	switch op {
+	case acquirer.OpAuthorize:
+		return h.Sim.Authorize
+	case acquirer.OpCapture:
+		return h.Sim.Capture
+	case acquirer.OpRefund:
+		return h.Sim.Refund
+	case acquirer.OpVoid:
+		return h.Sim.Void
+	case acquirer.OpConfirm:
+		return h.Sim.Confirm
+	}
+	return nil
+}
+
+// hang держит запрос, пока клиент не сдастся по своему таймауту
+func (h *AcquirerHandler) hang(w http.ResponseWriter, r *http.Request) {
+	t := time.NewTimer(h.HangTimeout)
+	defer t.Stop()
+	select {
+	case <-r.Context().Done():
+	case <-t.C:
+		writeError(w, http.StatusGatewayTimeout, "timeout")
+	}
+}
+
+// resetConn закрывает соединение с RST вместо ответа
+func resetConn(w http.ResponseWriter) {
+	conn, _, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		log.Printf("fakepsp: hijack error:%v", err)
+		writeError(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		_ = tcp.SetLinger(0)
+	}
+	_ = conn.Close()
+}
+
+// notify: через WebhookDelay фиксирует итог и шлёт его webhook'ом,
+// пока получатель не ответит 2xx (до 5 попыток)
+func (h *AcquirerHandler) notify(op, key, paymentID string) {
+	time.Sleep(h.WebhookDelay)
+
+	res, ok, resErr := h.Sim.Settle(op, key)
+	if !ok {
+		return
+	}
+
+	body, err := json.Marshal(acquirer.Webhook{
+		OperationResponse: operationResponse(op, key, res, resErr),
+		PaymentID:         paymentID,
+	})
+	if err != nil {
+		log.Printf("fakepsp: webhook marshal error:%v", err)
+		return
+	}
+
+	for attempt := 1; attempt <= 5; attempt++ {
+		if err = h.sendWebhook(body); err == nil {
+			log.Printf("fakepsp: webhook sent %s key=%s", op, key)
+			return
+		}
+		log.Printf("fakepsp: webhook attempt=%d %s key=%s error:%v", attempt, op, key, err)
+		time.Sleep(time.Duration(attempt) * time.Second)
+	}
+}
+
+func (h *AcquirerHandler) sendWebhook(body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, h.WebhookURL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(acquirer.SignatureHeader, acquirer.Sign(h.WebhookSecret, time.Now(), body))
+
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return errors.New(resp.Status)
+	}
+	return nil
+}
+
+// operationResponse — ответ на одобренную или отклонённую операцию
+func operationResponse(op, key string, res psp.Result, err error) acquirer.OperationResponse {
+	resp := acquirer.OperationResponse{Operation: op, IdempotencyKey: key, Status: res.Status, PSPRef: res.PSPRef}
+	if err == nil {
+		if res.NextAction != nil {
+			resp.NextAction = &acquirer.NextAction{RedirectURL: res.NextAction.RedirectURL, ChallengeID: res.NextAction.ChallengeID}
+		}
+		return resp
+	}
+
+	resp.Status, resp.DeclineType, resp.Message = acquirer.StatusDeclined, acquirer.DeclineHard, err.Error()
+	if errors.Is(err, psp.ErrSoftDecline) {
+		resp.DeclineType = acquirer.DeclineSoft
+	}
+	var pspErr *psp.Error
+	if errors.As(err, &pspErr) {
+		resp.DeclineCode, resp.Message = pspErr.Code, pspErr.Reason
+	}
+	return resp
+}
+
+func writeOperation(w http.ResponseWriter, op, key string, res psp.Result, err error) {
+	switch {
+	case err == nil || psp.IsDecline(err):
+		writeJSON(w, http.StatusOK, operationResponse(op, key, res, err))
+	case errors.Is(err, psp.ErrUnavailable):
+		w.Header().Set("Retry-After", "1")
+		writeError(w, http.StatusServiceUnavailable, err.Error())
+	case errors.Is(err, psp.ErrTimeout):
+		writeError(w, http.StatusGatewayTimeout, err.Error())
+	default:
+		writeError(w, http.StatusInternalServerError, err.Error())
+	}
+}
@@ -12,3 +12,7 @@ type statsResponse struct {
 	Autorized int `json:"autorized"`
 	Declined  int `json:"declined"`
 }
+
+type webhookResponse struct {
+	Status string `json:"status"`
+}
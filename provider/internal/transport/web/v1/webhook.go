@@ -0,0 +1,76 @@
+package v1
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/payment"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/domain/psp"
+	"github.com/EgorLis/MicroserviceExampleGo/provider/internal/shared/acquirer"
+)
+
+// PendingPayments фиксирует итог PENDING-авторизаций
+type PendingPayments interface {
+	CompletePayment(ctx context.Context, pspName, paymentID string, res psp.Result, pspErr error) error
+}
+
+// WebhookHandler — входящие webhook'и PSP с итогом PENDING-авторизаций
+type WebhookHandler struct {
+	Payments  PendingPayments
+	Secrets   map[string]string // PSP -> секрет подписи
+	Tolerance time.Duration
+}
+
+// PSP: POST /v1/webhooks/psp/{psp}. 2xx — итог принят или уже был принят,
+// PSP перестаёт повторять; остальное PSP повторит
+func (h *WebhookHandler) PSP(w http.ResponseWriter, r *http.Request) {
+	pspName := r.PathValue("psp")
+	secret, ok := h.Secrets[pspName]
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown psp")
+		return
+	}
+
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid body")
+		return
+	}
+
+	if err := acquirer.Verify(secret, r.Header.Get(acquirer.SignatureHeader), body, time.Now(), h.Tolerance); err != nil {
+		log.Printf("http: psp %s webhook rejected:%v", pspName, err)
+		writeError(w, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+
+	var wh acquirer.Webhook
+	if err := json.Unmarshal(body, &wh); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON")
+		return
+	}
+	if wh.Operation != acquirer.OpAuthorize || wh.PaymentID == "" {
+		writeError(w, http.StatusBadRequest, "expected authorize result with payment_id")
+		return
+	}
+
+	res, pspErr := wh.OperationResponse.Result(pspName)
+	err = h.Payments.CompletePayment(r.Context(), pspName, wh.PaymentID, res, pspErr)
+	switch {
+	case err == nil:
+		writeJSON(w, http.StatusOK, webhookResponse{Status: "accepted"})
+	case errors.Is(err, payment.ErrPendingResolved):
+		writeJSON(w, http.StatusOK, webhookResponse{Status: "already_resolved"})
+	case errors.Is(err, payment.ErrPendingNotFound):
+		writeError(w, http.StatusNotFound, "pending payment not found")
+	case errors.Is(err, payment.ErrInvalidCallback):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		log.Printf("http: psp %s webhook payment_id=%s error:%v", pspName, wh.PaymentID, err)
+		writeError(w, http.StatusInternalServerError, "")
+	}
+}